@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/williamokano/pg_backuper/pkg/config"
+	"github.com/williamokano/pg_backuper/pkg/logger"
+	"github.com/williamokano/pg_backuper/pkg/rotation"
+)
+
+// commands maps subcommand names to their entry points.
+// Each entry point receives the arguments after the subcommand name and returns the exit code.
+var commands = map[string]func(args []string) int{
+	"restore":      runRestore,
+	"archive-wal":  runArchiveWAL,
+	"restore-wal":  runRestoreWAL,
+	"daemon":       runDaemon,
+	"sync":         runSync,
+	"prune":        runPrune,
+	"pin":          runPin,
+	"unpin":        runUnpin,
+	"list":         runList,
+	"rekey":        runRekey,
+	"verify":       runVerify,
+	"restore-test": runRestoreTest,
+}
+
+// defaultConfigFile returns the config path used when --config is not given
+func defaultConfigFile() string {
+	if configFile := os.Getenv("CONFIG_FILE"); configFile != "" {
+		return configFile
+	}
+	return "./noop_config.json"
+}
+
+// loadConfig validates and parses a config file and initializes the logger
+func loadConfig(configFile string) (*config.Config, error) {
+	// Validate and parse config
+	if err := config.Validate(configFile); err != nil {
+		return nil, fmt.Errorf("Configuration validation failed: %w", err)
+	}
+
+	cfg, err := config.ParseConfig(configFile)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse config: %w", err)
+	}
+
+	// Initialize logger with config settings
+	logger.Init(cfg.GetLogLevel(), cfg.GetLogFormat())
+
+	// Filenames without zone carry the wall-clock time of the configured timezone
+	loc, err := cfg.GlobalDefaults.GetLocation()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse config: %w", err)
+	}
+	rotation.LegacyLocation = loc
+
+	return cfg, nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/williamokano/pg_backuper/pkg/daemon"
+	"github.com/williamokano/pg_backuper/pkg/logger"
+)
+
+// runDaemon implements "pg_backuper daemon"
+func runDaemon(args []string) int {
+	flags := flag.NewFlagSet("daemon", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: pg_backuper daemon [options]\n\n")
+		fmt.Fprintf(os.Stderr, "Keeps running and backs up every source when its tiers are due.\n")
+		fmt.Fprintf(os.Stderr, "SIGTERM lets running backups finish (up to daemon.shutdown_timeout), a second SIGTERM cancels them.\n\n")
+		flags.PrintDefaults()
+	}
+
+	configFile := flags.String("config", defaultConfigFile(), "path to config file")
+	var opts daemon.Options
+	flags.BoolVar(&opts.DelayFirstRun, "delay-first-run", false, "wait one tick before the first schedule evaluation")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	log := logger.Get()
+
+	if cfg.BackupDir != "" {
+		if err := os.MkdirAll(cfg.BackupDir, os.ModePerm); err != nil {
+			log.Error().Err(err).Str("backup_dir", cfg.BackupDir).Msg("failed to create backup directory")
+			return 1
+		}
+	}
+
+	d, err := daemon.New(cfg, opts, *log)
+	if err != nil {
+		log.Error().Err(err).Msg("invalid daemon configuration")
+		return 1
+	}
+
+	// First signal: stop scheduling and let running backups finish; second signal: cancel them
+	ctx, stop := context.WithCancel(context.Background())
+	force, forceStop := context.WithCancel(context.Background())
+	defer stop()
+	defer forceStop()
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	go func() {
+		sig := <-signals
+		log.Info().Str("signal", sig.String()).Msg("received signal")
+		stop()
+		sig = <-signals
+		log.Info().Str("signal", sig.String()).Msg("received second signal")
+		forceStop()
+	}()
+
+	d.Run(ctx, force)
+	return 0
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/williamokano/pg_backuper/pkg/catalog"
+)
+
+// runList implements "pg_backuper list"
+func runList(args []string) int {
+	flags := flag.NewFlagSet("list", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: pg_backuper list [options]\n\n")
+		fmt.Fprintf(os.Stderr, "Lists the backups stored on the storage destinations, with their pin status.\n\n")
+		flags.PrintDefaults()
+	}
+
+	configFile := flags.String("config", defaultConfigFile(), "path to config file")
+	var opts catalog.ListOptions
+	flags.StringVar(&opts.Database, "database", "", "only backups of this database (or host-port for server backups)")
+	flags.StringVar(&opts.Destination, "destination", "", "only this storage destination (default: all enabled destinations)")
+	flags.StringVar(&opts.Tier, "tier", "", "only backups of this tier (e.g. daily)")
+	output := flags.String("output", "table", "output format: table or json")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *output != "table" && *output != "json" {
+		flags.Usage()
+		return 2
+	}
+
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	log := stderrLogger(cfg)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	entries, err := catalog.List(ctx, cfg, opts)
+	if err != nil {
+		log.Error().Err(err).Msg("list failed")
+		return 1
+	}
+
+	if *output == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(entries); err != nil {
+			log.Error().Err(err).Msg("failed to write backup list")
+			return 1
+		}
+		return 0
+	}
+
+	printEntries(os.Stdout, entries, time.Now())
+	return 0
+}
+
+// printEntries writes stored backups as a table
+func printEntries(w io.Writer, entries []catalog.Entry, now time.Time) {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "DESTINATION\tBACKUP\tTIER\tTAKEN\tSIZE\tPIN")
+	for _, entry := range entries {
+		pin := "-"
+		if entry.Pin != nil {
+			pin = entry.Pin.String()
+			if !entry.Pin.Active(now) {
+				pin = "expired (" + pin + ")"
+			}
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			entry.Destination, entry.Path, entry.Tier, entry.TakenAt.Format(time.RFC3339), formatBytes(entry.Size), pin)
+	}
+	table.Flush()
+}
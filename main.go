@@ -2,36 +2,54 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"os"
 	"time"
 
 	"github.com/williamokano/pg_backuper/pkg/backup"
-	"github.com/williamokano/pg_backuper/pkg/config"
 	"github.com/williamokano/pg_backuper/pkg/logger"
 )
 
 func main() {
-	configFile := "./noop_config.json"
-
+	// Subcommands (e.g. "pg_backuper restore ..."); anything else runs a backup
 	if len(os.Args) > 1 {
-		configFile = os.Args[1]
+		if command, ok := commands[os.Args[1]]; ok {
+			os.Exit(command(os.Args[2:]))
+		}
 	}
 
-	// Validate and parse config
-	if err := config.Validate(configFile); err != nil {
-		fmt.Fprintf(os.Stderr, "Configuration validation failed: %v\n", err)
-		os.Exit(1)
+	os.Exit(runBackup(os.Args[1:]))
+}
+
+// runBackup runs the scheduled backup for all databases
+func runBackup(args []string) int {
+	flags := flag.NewFlagSet("pg_backuper", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: pg_backuper [options] [config file]\n\n")
+		fmt.Fprintf(os.Stderr, "Backs up every source whose tiers are due.\n\n")
+		flags.PrintDefaults()
 	}
+	ignoreWindows := flags.Bool("ignore-windows", false, "run due backups even outside their backup windows (manual runs)")
+	allowMassDelete := flags.Bool("allow-mass-delete", false, "lift the rotation deletion limits (max_delete_files, max_delete_percent, require_recent_backup)")
 
-	cfg, err := config.ParseConfig(configFile)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to parse config: %v\n", err)
-		os.Exit(1)
+	if err := flags.Parse(args); err != nil {
+		return 2
 	}
 
-	// Initialize logger with config settings
-	logger.Init(cfg.GetLogLevel(), cfg.GetLogFormat())
+	configFile := "./noop_config.json"
+
+	if flags.NArg() > 0 {
+		configFile = flags.Arg(0)
+	}
+
+	cfg, err := loadConfig(configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	cfg.IgnoreWindows = *ignoreWindows
+	cfg.AllowMassDelete = *allowMassDelete
 	log := logger.Get()
 
 	log.Info().Str("config_file", configFile).Msg("starting pg_backuper v2.0")
@@ -46,18 +64,31 @@ func main() {
 	// Create context for cancellation support
 	ctx := context.Background()
 
-	// Execute parallel backups
-	results, err := backup.BackupAllDatabases(ctx, cfg, timestamp, *log)
+	// Globals, base backups, then all databases in parallel
+	results, err := backup.BackupAll(ctx, cfg, timestamp, *log)
 	if err != nil {
 		log.Error().Err(err).Msg("backup execution failed")
-		os.Exit(1)
+		return 1
 	}
 
 	// Count successes, skips, and failures
 	successCount := 0
 	skippedCount := 0
 	failureCount := 0
+	backfilledCount := 0
+	blockedCount := 0
+	restoreTestsPassed := 0
+	restoreTestsFailed := 0
 	for _, result := range results {
+		backfilledCount += len(result.Backfilled)
+		blockedCount += len(result.Blocked)
+		if result.RestoreTest != nil {
+			if result.RestoreTest.Success {
+				restoreTestsPassed++
+			} else {
+				restoreTestsFailed++
+			}
+		}
 		if result.Skipped {
 			skippedCount++
 		} else if result.Success {
@@ -71,9 +102,21 @@ func main() {
 		Int("successful", successCount).
 		Int("skipped", skippedCount).
 		Int("failed", failureCount).
+		Int("backfilled", backfilledCount).
+		Int("blocked_deletions", blockedCount).
+		Int("restore_tests_passed", restoreTestsPassed).
+		Int("restore_tests_failed", restoreTestsFailed).
 		Msg("pg_backuper v2.0 completed")
 
-	if failureCount > 0 {
-		os.Exit(1)
+	if blockedCount > 0 {
+		log.Warn().
+			Int("blocked_deletions", blockedCount).
+			Msg("rotation safety guards kept backups retention would have deleted, check the configuration or rerun with --allow-mass-delete")
+	}
+
+	// A backup that fails its restore test was stored, but cannot be relied on
+	if failureCount > 0 || restoreTestsFailed > 0 {
+		return 1
 	}
+	return 0
 }
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/williamokano/pg_backuper/pkg/catalog"
+	"github.com/williamokano/pg_backuper/pkg/logger"
+)
+
+// runPin implements "pg_backuper pin"
+func runPin(args []string) int {
+	flags := flag.NewFlagSet("pin", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: pg_backuper pin <backup> [options]\n\n")
+		fmt.Fprintf(os.Stderr, "Places a legal hold on a backup: rotation never deletes it while pinned.\n\n")
+		fmt.Fprintf(os.Stderr, "Example:\n")
+		fmt.Fprintf(os.Stderr, "  pg_backuper pin myapp--daily--2025-03-09T02-00-00Z.backup --reason \"incident 2025-03-10\" --until 2032-01-01\n\n")
+		flags.PrintDefaults()
+	}
+
+	configFile := flags.String("config", defaultConfigFile(), "path to config file")
+	var opts catalog.PinOptions
+	flags.StringVar(&opts.Destination, "destination", "", "only pin on this storage destination (default: every destination holding the backup)")
+	flags.StringVar(&opts.Reason, "reason", "", "why the backup is held")
+	until := flags.String("until", "", "when the pin expires: YYYY-MM-DD in global_defaults.timezone, or RFC 3339 (default: never)")
+
+	backupName, ok := parseWithBackup(flags, args)
+	if !ok {
+		return 2
+	}
+	opts.Backup = backupName
+
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	log := logger.Get()
+
+	if *until != "" {
+		loc, _ := cfg.GlobalDefaults.GetLocation()
+		opts.Until, err = parseUntil(*until, loc)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 2
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	result := catalog.Pin(ctx, cfg, opts, *log)
+	if !result.Success {
+		log.Error().Err(result.Error).Str("backup", result.Backup).Msg("pin failed")
+		return 1
+	}
+
+	log.Info().
+		Str("backup", result.Backup).
+		Strs("destinations", result.Destinations).
+		Msg("backup pinned")
+	return 0
+}
+
+// runUnpin implements "pg_backuper unpin"
+func runUnpin(args []string) int {
+	flags := flag.NewFlagSet("unpin", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: pg_backuper unpin <backup> [options]\n\n")
+		fmt.Fprintf(os.Stderr, "Releases the legal hold on a backup; rotation may delete it on its next run.\n\n")
+		flags.PrintDefaults()
+	}
+
+	configFile := flags.String("config", defaultConfigFile(), "path to config file")
+	destination := flags.String("destination", "", "only unpin on this storage destination (default: every destination)")
+
+	backupName, ok := parseWithBackup(flags, args)
+	if !ok {
+		return 2
+	}
+
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	log := logger.Get()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	result := catalog.Unpin(ctx, cfg, backupName, *destination, *log)
+	if !result.Success {
+		log.Error().Err(result.Error).Str("backup", result.Backup).Msg("unpin failed")
+		return 1
+	}
+
+	log.Info().
+		Str("backup", result.Backup).
+		Strs("destinations", result.Destinations).
+		Msg("backup unpinned")
+	return 0
+}
+
+// parseWithBackup parses flags given before or after a single backup filename argument
+func parseWithBackup(flags *flag.FlagSet, args []string) (string, bool) {
+	if err := flags.Parse(args); err != nil {
+		return "", false
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return "", false
+	}
+
+	backupName := flags.Arg(0)
+	if err := flags.Parse(flags.Args()[1:]); err != nil {
+		return "", false
+	}
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return "", false
+	}
+	return backupName, true
+}
+
+// parseUntil parses a pin expiry: a date (start of the day in loc) or an RFC 3339 time
+func parseUntil(value string, loc *time.Location) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", value, loc); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid --until %q: use YYYY-MM-DD or RFC 3339", value)
+	}
+	return t, nil
+}
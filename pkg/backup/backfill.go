@@ -0,0 +1,253 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/williamokano/pg_backuper/pkg/config"
+	"github.com/williamokano/pg_backuper/pkg/rotation"
+	"github.com/williamokano/pg_backuper/pkg/storage"
+)
+
+// Backfill is a stored backup that some destinations of its source are missing
+type Backfill struct {
+	Tier    string
+	Path    string   // Backup filename, the same on every destination
+	Source  string   // Destination the backup is copied from
+	Targets []string // Destinations missing the backup
+}
+
+// getDueTiersAcrossBackends evaluates the due tiers of a backup source on every backend.
+// A tier is only due when no backend has a recent enough backup of it; a backup present
+// on some backends but missing on others is scheduled for backfill instead of a new dump.
+func getDueTiersAcrossBackends(ctx context.Context, cfg *config.Config, backends []storage.Backend, naming rotation.Naming, retentionTiers []config.RetentionTier, now time.Time, logger zerolog.Logger) TierSchedule {
+	if len(backends) == 1 {
+		return getDueTiersWithBackend(ctx, cfg, backends[0], naming, retentionTiers, now, logger)
+	}
+
+	var schedules []TierSchedule
+	for _, backend := range backends {
+		backendLog := logger.With().Str("backend", backend.Name()).Logger()
+		schedules = append(schedules, getDueTiersWithBackend(ctx, cfg, backend, naming, retentionTiers, now, backendLog))
+	}
+
+	schedule := mergeSchedules(schedules)
+	schedule.Backfill = planBackfill(ctx, backends, naming, retentionTiers, now, logger)
+	return schedule
+}
+
+// mergeSchedules combines the schedules of one source on several backends: a tier is due
+// only if it is due on every backend, and becomes due when the freshest copy ages out
+func mergeSchedules(schedules []TierSchedule) TierSchedule {
+	merged := TierSchedule{
+		Due:  []string{},
+		Next: make(map[string]time.Time),
+	}
+
+	dueCount := make(map[string]int)
+	var order []string
+	for _, schedule := range schedules {
+		for _, tier := range schedule.Due {
+			if dueCount[tier] == 0 {
+				order = append(order, tier)
+			}
+			dueCount[tier]++
+		}
+		for tier, next := range schedule.Next {
+			if current, ok := merged.Next[tier]; !ok || next.After(current) {
+				merged.Next[tier] = next
+			}
+		}
+	}
+
+	for _, tier := range order {
+		if dueCount[tier] == len(schedules) {
+			merged.Due = append(merged.Due, tier)
+		}
+	}
+
+	return merged
+}
+
+// planBackfill finds the retained backups of every tier that exist on some backends but
+// not on others. Backends whose files cannot be listed are left out, as what they are
+// missing is unknown. Empty files count as missing. Retention by age is judged at now,
+// the time of the run.
+func planBackfill(ctx context.Context, backends []storage.Backend, naming rotation.Naming, retentionTiers []config.RetentionTier, now time.Time, logger zerolog.Logger) []Backfill {
+	var items []Backfill
+
+	for _, retentionTier := range retentionTiers {
+		tierName := retentionTier.Tier
+
+		// Rotation refuses to plan a tier with an invalid max_age, so backfill leaves it alone too
+		cutoff, err := retentionTier.Cutoff(now)
+		if err != nil {
+			logger.Warn().
+				Err(err).
+				Str("database", naming.Name).
+				Str("tier", tierName).
+				Msg("invalid max_age, not backfilling tier")
+			continue
+		}
+
+		// Which listed backends hold each backup of the tier
+		holders := make(map[string][]string)
+		var listed []string
+		for _, backend := range backends {
+			files, err := backend.List(ctx, naming.TierPattern(tierName))
+			if err != nil {
+				logger.Warn().
+					Err(err).
+					Str("database", naming.Name).
+					Str("tier", tierName).
+					Str("backend", backend.Name()).
+					Msg("cannot list backups, not checking backend for missing copies")
+				continue
+			}
+			listed = append(listed, backend.Name())
+			for _, file := range files {
+				if file.Size > 0 {
+					holders[file.Path] = append(holders[file.Path], backend.Name())
+				}
+			}
+		}
+		if len(listed) < 2 {
+			continue
+		}
+
+		for _, path := range retainedBackups(holders, retentionTier.Retention, cutoff) {
+			if len(holders[path]) == len(listed) {
+				continue
+			}
+			items = append(items, Backfill{
+				Tier:    tierName,
+				Path:    path,
+				Source:  holders[path][0],
+				Targets: missingFrom(listed, holders[path]),
+			})
+		}
+	}
+
+	return items
+}
+
+// retainedBackups returns the backups of a tier that retention keeps, newest first: the newest
+// retention of them (all when 0) that were taken at or after cutoff (any time when zero)
+func retainedBackups(holders map[string][]string, retention int, cutoff time.Time) []string {
+	timestamps := make(map[string]time.Time)
+	var paths []string
+	for path := range holders {
+		components, err := rotation.ParseBackupFilename(path)
+		if err != nil || components.Timestamp.Before(cutoff) {
+			continue
+		}
+		timestamps[path] = components.Timestamp
+		paths = append(paths, path)
+	}
+
+	sort.Slice(paths, func(i, j int) bool {
+		return timestamps[paths[i]].After(timestamps[paths[j]])
+	})
+
+	if retention > 0 && len(paths) > retention {
+		paths = paths[:retention]
+	}
+	return paths
+}
+
+// missingFrom returns the names in all that are not in present
+func missingFrom(all, present []string) []string {
+	has := make(map[string]bool)
+	for _, name := range present {
+		has[name] = true
+	}
+
+	var missing []string
+	for _, name := range all {
+		if !has[name] {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
+
+// backfillDestinations copies backups missing on some destinations from a destination that has
+// them. Copied paths are recorded in result.Backfilled and the per-backend outcome of every item
+// in result.BackendResults under its path. A failed copy is logged and retried on the next run;
+// it does not fail the backup, just like an upload failing on only some destinations.
+func backfillDestinations(ctx context.Context, cfg *config.Config, db config.DatabaseConfig, items []Backfill, result *Result, logger zerolog.Logger) {
+	if len(items) == 0 {
+		return
+	}
+
+	backends, err := initializeBackends(ctx, cfg, db, logger)
+	if err != nil {
+		logger.Error().Err(err).Msg("cannot initialize storage backends, skipping backfill")
+		return
+	}
+	defer closeBackends(backends)
+
+	byName := make(map[string]storage.Backend)
+	for _, backend := range backends {
+		byName[backend.Name()] = backend
+	}
+
+	uploader := storage.NewMultiUploader(logger)
+
+	for _, item := range items {
+		itemLog := logger.With().
+			Str("tier", item.Tier).
+			Str("file", item.Path).
+			Str("source", item.Source).
+			Strs("targets", item.Targets).
+			Logger()
+
+		source, targets, err := backfillBackends(byName, item)
+		if err != nil {
+			itemLog.Error().Err(err).Msg("cannot backfill missing copy")
+			continue
+		}
+
+		itemLog.Info().Msg("copying backup to destinations missing it")
+		results := uploader.CopyAcross(ctx, source, targets, item.Path)
+		result.BackendResults[item.Path] = results
+
+		copied := true
+		for i, r := range results {
+			if !r.Success {
+				copied = false
+				continue
+			}
+			if err := storage.CopyManifest(ctx, source, targets[i], item.Path); err != nil {
+				itemLog.Warn().Err(err).Str("backend", r.BackendName).Msg("failed to copy backup manifest")
+			}
+		}
+		if copied {
+			itemLog.Info().Msg("backfilled missing copy")
+			result.Backfilled = append(result.Backfilled, item.Path)
+		} else {
+			itemLog.Warn().Msg("backfill failed on some destinations, retrying on next run")
+		}
+	}
+}
+
+// backfillBackends resolves the source and target backends of a backfill item
+func backfillBackends(byName map[string]storage.Backend, item Backfill) (storage.Backend, []storage.Backend, error) {
+	source, ok := byName[item.Source]
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown storage destination: %s", item.Source)
+	}
+
+	var targets []storage.Backend
+	for _, name := range item.Targets {
+		target, ok := byName[name]
+		if !ok {
+			return nil, nil, fmt.Errorf("unknown storage destination: %s", name)
+		}
+		targets = append(targets, target)
+	}
+	return source, targets, nil
+}
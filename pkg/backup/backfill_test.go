@@ -0,0 +1,152 @@
+package backup
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/williamokano/pg_backuper/pkg/config"
+	"github.com/williamokano/pg_backuper/pkg/rotation"
+)
+
+// twoDestinationConfig returns a config with a primary and an offsite local destination
+func twoDestinationConfig(t *testing.T) (*config.Config, string, string) {
+	primary := t.TempDir()
+	offsite := t.TempDir()
+
+	cfg := &config.Config{
+		Storage: config.StorageConfig{
+			TempDir: t.TempDir(),
+			Destinations: []config.StorageDestination{
+				{Name: "primary", Type: "local", Enabled: true, Options: map[string]interface{}{"path": primary}},
+				{Name: "offsite", Type: "local", Enabled: true, Options: map[string]interface{}{"path": offsite}},
+			},
+		},
+	}
+	return cfg, primary, offsite
+}
+
+// writeBackup stores a daily backup of app taken at ts in dir
+func writeBackup(t *testing.T, dir string, ts time.Time) string {
+	name := rotation.DatabaseNaming("app").Filename("daily", ts)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("PGDMP"), 0644))
+	return name
+}
+
+func TestGetDueTiers_PerDestination(t *testing.T) {
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	db := config.DatabaseConfig{
+		Name:           "app",
+		RetentionTiers: []config.RetentionTier{{Tier: "daily", Retention: 2}},
+	}
+
+	t.Run("copy missing on one destination is backfilled", func(t *testing.T) {
+		cfg, primary, offsite := twoDestinationConfig(t)
+		writeBackup(t, offsite, now.Add(-72*time.Hour))
+		writeBackup(t, primary, now.Add(-48*time.Hour))
+		writeBackup(t, primary, now.Add(-2*time.Hour))
+		writeBackup(t, offsite, now.Add(-2*time.Hour))
+
+		schedule, err := GetDueTiers(context.Background(), cfg, db, now, zerolog.Nop())
+		require.NoError(t, err)
+
+		assert.Empty(t, schedule.Due, "a fresh copy on any destination satisfies the tier")
+		assert.True(t, schedule.Next["daily"].Equal(now.Add(22*time.Hour)))
+
+		// Retention 2 keeps the two newest backups; the oldest one is not worth copying
+		require.Len(t, schedule.Backfill, 1)
+		assert.Equal(t, Backfill{
+			Tier:    "daily",
+			Path:    rotation.DatabaseNaming("app").Filename("daily", now.Add(-48*time.Hour)),
+			Source:  "primary",
+			Targets: []string{"offsite"},
+		}, schedule.Backfill[0])
+	})
+
+	t.Run("max age is judged at the time of the run", func(t *testing.T) {
+		cfg, primary, offsite := twoDestinationConfig(t)
+		aged := config.DatabaseConfig{
+			Name:           "app",
+			RetentionTiers: []config.RetentionTier{{Tier: "daily", MaxAge: "7d"}},
+		}
+		missing := writeBackup(t, primary, now.Add(-72*time.Hour))
+		writeBackup(t, offsite, now.Add(-10*24*time.Hour))
+		writeBackup(t, primary, now.Add(-2*time.Hour))
+		writeBackup(t, offsite, now.Add(-2*time.Hour))
+
+		schedule, err := GetDueTiers(context.Background(), cfg, aged, now, zerolog.Nop())
+		require.NoError(t, err)
+
+		require.Len(t, schedule.Backfill, 1)
+		assert.Equal(t, missing, schedule.Backfill[0].Path)
+		assert.Equal(t, []string{"offsite"}, schedule.Backfill[0].Targets)
+	})
+
+	t.Run("invalid max age is not backfilled", func(t *testing.T) {
+		cfg, primary, offsite := twoDestinationConfig(t)
+		invalid := config.DatabaseConfig{
+			Name:           "app",
+			RetentionTiers: []config.RetentionTier{{Tier: "daily", MaxAge: "0mo"}},
+		}
+		writeBackup(t, primary, now.Add(-72*time.Hour))
+		writeBackup(t, primary, now.Add(-2*time.Hour))
+		writeBackup(t, offsite, now.Add(-2*time.Hour))
+
+		schedule, err := GetDueTiers(context.Background(), cfg, invalid, now, zerolog.Nop())
+		require.NoError(t, err)
+
+		assert.Empty(t, schedule.Backfill)
+	})
+
+	t.Run("tier missing everywhere is due", func(t *testing.T) {
+		cfg, primary, offsite := twoDestinationConfig(t)
+		writeBackup(t, primary, now.Add(-30*time.Hour))
+		writeBackup(t, offsite, now.Add(-30*time.Hour))
+
+		schedule, err := GetDueTiers(context.Background(), cfg, db, now, zerolog.Nop())
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"daily"}, schedule.Due)
+		assert.Empty(t, schedule.Backfill)
+	})
+}
+
+func TestBackupDatabase_Backfill(t *testing.T) {
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	cfg, primary, offsite := twoDestinationConfig(t)
+	db := config.DatabaseConfig{Name: "app"}
+
+	name := writeBackup(t, primary, now.Add(-2*time.Hour))
+	schedule := TierSchedule{
+		Backfill: []Backfill{{Tier: "daily", Path: name, Source: "primary", Targets: []string{"offsite"}}},
+	}
+
+	result := backupDatabase(context.Background(), cfg, db, now, schedule, zerolog.Nop())
+
+	assert.True(t, result.Success)
+	assert.False(t, result.Skipped)
+	assert.Equal(t, []string{name}, result.Backfilled)
+	require.Len(t, result.BackendResults[name], 1)
+	assert.Equal(t, "offsite", result.BackendResults[name][0].BackendName)
+
+	content, err := os.ReadFile(filepath.Join(offsite, name))
+	require.NoError(t, err)
+	assert.Equal(t, "PGDMP", string(content))
+}
+
+func TestMergeSchedules(t *testing.T) {
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	merged := mergeSchedules([]TierSchedule{
+		{Due: []string{"hourly", "daily"}, Next: map[string]time.Time{"hourly": now, "daily": now}},
+		{Due: []string{"hourly"}, Next: map[string]time.Time{"hourly": now, "daily": now.Add(5 * time.Hour)}},
+	})
+
+	assert.Equal(t, []string{"hourly"}, merged.Due)
+	assert.True(t, merged.Next["daily"].Equal(now.Add(5*time.Hour)))
+}
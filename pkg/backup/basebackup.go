@@ -0,0 +1,146 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/williamokano/pg_backuper/pkg/config"
+	"github.com/williamokano/pg_backuper/pkg/dumpformat"
+	"github.com/williamokano/pg_backuper/pkg/rotation"
+	"github.com/williamokano/pg_backuper/pkg/storage"
+)
+
+// BackupAllBasebackups takes a physical backup of every basebackup-mode server, one at a time
+// (each copies a whole cluster, running them in parallel would only compete for I/O)
+func BackupAllBasebackups(ctx context.Context, cfg *config.Config, timestamp time.Time, logger zerolog.Logger) []Result {
+	var servers []config.ServerConfig
+	for _, server := range cfg.Servers {
+		if server.GetMode() == config.ModeBasebackup {
+			servers = append(servers, server)
+		}
+	}
+
+	if len(servers) == 0 {
+		return nil
+	}
+
+	logger.Info().
+		Int("servers", len(servers)).
+		Msg("starting base backups")
+
+	var results []Result
+	for _, server := range servers {
+		if ctx.Err() != nil {
+			break
+		}
+		results = append(results, BackupBasebackup(ctx, cfg, server, timestamp, logger))
+	}
+
+	return results
+}
+
+// BackupBasebackup runs pg_basebackup against one server and stores the packaged
+// result as name--basebackup--TIER--timestamp.tar for every due tier
+func BackupBasebackup(ctx context.Context, cfg *config.Config, server config.ServerConfig, timestamp time.Time, logger zerolog.Logger) Result {
+	port := server.GetPort(cfg.GlobalDefaults)
+	naming := rotation.BasebackupNaming(server.Host, port)
+	baseLog := logger.With().
+		Str("database", naming.Name).
+		Str("kind", rotation.KindBasebackup).
+		Str("host", server.Host).
+		Int("port", port).
+		Logger()
+
+	tempDir := cfg.GetTempDir()
+	artifact := basebackupArtifact(cfg, server)
+	artifact.dump = func(pgpassPath, outputFile string) error {
+		return runPgBasebackup(ctx, server, port, pgpassPath, outputFile, tempDir, timestamp, baseLog)
+	}
+	if server.ArchiveWAL {
+		// WAL older than the oldest retained base backup can no longer be replayed
+		artifact.afterRotation = func(backend storage.Backend) error {
+			return pruneWAL(ctx, backend, server.Host, port, baseLog.With().Str("backend", backend.Name()).Logger())
+		}
+	}
+	return backupServerArtifact(ctx, cfg, artifact, timestamp, baseLog)
+}
+
+// basebackupArtifact describes the base backup of a server, without its dump step
+func basebackupArtifact(cfg *config.Config, server config.ServerConfig) serverArtifact {
+	port := server.GetPort(cfg.GlobalDefaults)
+	return serverArtifact{
+		naming:              rotation.BasebackupNaming(server.Host, port),
+		storageDestinations: server.StorageDestinations,
+		retentionTiers:      server.GetRetentionTiers(cfg.GlobalDefaults),
+		host:                server.Host,
+		port:                port,
+		user:                server.User,
+		tool:                "pg_basebackup",
+		format:              "tar",
+		compression:         "gzip",
+	}
+}
+
+// runPgBasebackup copies the cluster with pg_basebackup (tar format, gzip, WAL streamed
+// alongside) and packages its output directory into outputFile
+func runPgBasebackup(ctx context.Context, server config.ServerConfig, port int, pgpassPath, outputFile, tempDir string, timestamp time.Time, logger zerolog.Logger) error {
+	// pg_basebackup writes base.tar.gz, pg_wal.tar.gz and one tar per tablespace
+	workDir := outputFile + ".dir"
+	os.RemoveAll(workDir)
+	defer os.RemoveAll(workDir)
+
+	cmd := exec.CommandContext(ctx, "pg_basebackup", buildPgBasebackupArgs(server, port, workDir)...)
+	cmd.Env = os.Environ()
+	if pgpassPath != "" {
+		cmd.Env = append(cmd.Env, "PGPASSFILE="+pgpassPath)
+	}
+
+	logFile := openDumpLog(tempDir, rotation.BasebackupNaming(server.Host, port).Name+"--"+rotation.KindBasebackup, timestamp, logger)
+	if logFile != nil {
+		defer logFile.Close()
+		cmd.Stdout = logFile
+		cmd.Stderr = logFile
+	} else {
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+	}
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("pg_basebackup failed: %w", err)
+	}
+
+	if err := dumpformat.PackBasebackup(workDir, outputFile); err != nil {
+		os.Remove(outputFile)
+		return fmt.Errorf("failed to package base backup: %w", err)
+	}
+
+	fileInfo, err := os.Stat(outputFile)
+	if err != nil {
+		return fmt.Errorf("base backup not found after packaging: %w", err)
+	}
+
+	logger.Info().
+		Int64("size_bytes", fileInfo.Size()).
+		Msg("base backup packaged")
+
+	return nil
+}
+
+// buildPgBasebackupArgs builds the pg_basebackup argument list for a compressed tar backup
+// that includes the WAL needed to make it consistent
+func buildPgBasebackupArgs(server config.ServerConfig, port int, outputDir string) []string {
+	return []string{
+		"-U", server.User,
+		"-h", server.Host,
+		"-p", fmt.Sprintf("%d", port),
+		"-D", outputDir,
+		"-F", "t",
+		"-z",
+		"-X", "stream",
+		"-v",
+	}
+}
@@ -0,0 +1,25 @@
+package backup
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/williamokano/pg_backuper/pkg/config"
+)
+
+func TestBuildPgBasebackupArgs(t *testing.T) {
+	server := config.ServerConfig{Host: "pg1", User: "replicator", Mode: config.ModeBasebackup}
+
+	args := buildPgBasebackupArgs(server, 5432, "/tmp/pg1-5432--basebackup.tar.tmp.dir")
+
+	assert.Equal(t, []string{
+		"-U", "replicator",
+		"-h", "pg1",
+		"-p", "5432",
+		"-D", "/tmp/pg1-5432--basebackup.tar.tmp.dir",
+		"-F", "t",
+		"-z",
+		"-X", "stream",
+		"-v",
+	}, args)
+}
@@ -0,0 +1,168 @@
+package backup
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/williamokano/pg_backuper/pkg/config"
+)
+
+// weekdays maps the weekday names accepted in retention tiers to time.Weekday
+var weekdays = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+}
+
+// calendarAnchor places the slots of a tier on the calendar: every hour at minute,
+// every day at hour:minute, every week on weekday, every month (year) on day.
+// Unset fields default to the start of the period (midnight, Monday, the 1st, January).
+// Slots of tiers spanning several units (every > 1) are aligned to the calendar:
+// quarterly slots fall in January, April, July and October.
+type calendarAnchor struct {
+	unit    string
+	every   int
+	hour    int
+	minute  int
+	weekday time.Weekday
+	day     int
+	month   time.Month
+}
+
+// parseAnchor reads the calendar anchor of a retention tier
+func parseAnchor(rt config.RetentionTier, tier config.Tier) (calendarAnchor, error) {
+	anchor := calendarAnchor{unit: tier.Unit, every: tier.Every, weekday: time.Monday, day: 1, month: time.January}
+
+	if tier.Unit == "" {
+		return anchor, fmt.Errorf("tier %s has no calendar rule", tier.Name)
+	}
+	if anchor.every < 1 {
+		anchor.every = 1
+	}
+
+	if rt.At != "" {
+		at, err := time.Parse("15:04", rt.At)
+		if err != nil {
+			return anchor, fmt.Errorf("invalid time of day %q: %w", rt.At, err)
+		}
+		anchor.hour, anchor.minute = at.Hour(), at.Minute()
+	}
+
+	if rt.Weekday != "" {
+		if tier.Unit != config.UnitWeek {
+			return anchor, fmt.Errorf("weekday only applies to weekly tiers, not %s", rt.Tier)
+		}
+		weekday, ok := weekdays[strings.ToLower(rt.Weekday)]
+		if !ok {
+			return anchor, fmt.Errorf("invalid weekday %q", rt.Weekday)
+		}
+		anchor.weekday = weekday
+	}
+
+	if rt.Day != 0 {
+		if tier.Unit != config.UnitMonth && tier.Unit != config.UnitYear {
+			return anchor, fmt.Errorf("day only applies to monthly, quarterly and yearly tiers, not %s", rt.Tier)
+		}
+		if rt.Day < 1 || rt.Day > 31 {
+			return anchor, fmt.Errorf("invalid day of month %d", rt.Day)
+		}
+		anchor.day = rt.Day
+	}
+
+	if rt.Month != 0 {
+		if tier.Unit != config.UnitYear {
+			return anchor, fmt.Errorf("month only applies to yearly tiers, not %s", rt.Tier)
+		}
+		if rt.Month < 1 || rt.Month > 12 {
+			return anchor, fmt.Errorf("invalid month %d", rt.Month)
+		}
+		anchor.month = time.Month(rt.Month)
+	}
+
+	return anchor, nil
+}
+
+// slot returns the slot of the period containing t, shifted by offset periods
+func (a calendarAnchor) slot(t time.Time, offset int) time.Time {
+	year, month, day := t.Date()
+	loc := t.Location()
+
+	switch a.unit {
+	case config.UnitHour:
+		// Counted from midnight
+		hour := t.Hour() - floorMod(t.Hour(), a.every)
+		return time.Date(year, month, day, hour+a.every*offset, a.minute, 0, 0, loc)
+	case config.UnitDay:
+		day -= floorMod(civilDay(year, month, day), a.every)
+		return time.Date(year, month, day+a.every*offset, a.hour, a.minute, 0, 0, loc)
+	case config.UnitWeek:
+		day -= (int(t.Weekday()) - int(a.weekday) + 7) % 7
+		day -= 7 * floorMod(floorDiv(civilDay(year, month, day), 7), a.every)
+		return time.Date(year, month, day+7*a.every*offset, a.hour, a.minute, 0, 0, loc)
+	case config.UnitMonth:
+		index := year*12 + int(month) - 1
+		index -= floorMod(index, a.every)
+		index += a.every * offset
+		return a.onDay(floorDiv(index, 12), time.Month(floorMod(index, 12)+1), loc)
+	default: // year
+		year -= floorMod(year, a.every)
+		return a.onDay(year+a.every*offset, a.month, loc)
+	}
+}
+
+// civilDay returns the number of days between 1970-01-01 and a calendar date
+func civilDay(year int, month time.Month, day int) int {
+	return int(time.Date(year, month, day, 0, 0, 0, 0, time.UTC).Unix() / 86400)
+}
+
+// floorDiv divides rounding towards negative infinity
+func floorDiv(a, b int) int {
+	return (a - floorMod(a, b)) / b
+}
+
+// floorMod returns a modulo b in [0, b)
+func floorMod(a, b int) int {
+	return ((a % b) + b) % b
+}
+
+// onDay returns the anchored day and time in the given month, clamping the day to the month's length
+func (a calendarAnchor) onDay(year int, month time.Month, loc *time.Location) time.Time {
+	// Normalize month overflow (e.g. month 13) before measuring the month
+	first := time.Date(year, month, 1, 0, 0, 0, 0, loc)
+	lastDay := first.AddDate(0, 1, -1).Day()
+	day := a.day
+	if day > lastDay {
+		day = lastDay
+	}
+	return time.Date(first.Year(), first.Month(), day, a.hour, a.minute, 0, 0, loc)
+}
+
+// previous returns the latest slot at or before now
+func (a calendarAnchor) previous(now time.Time) time.Time {
+	if slot := a.slot(now, 0); !slot.After(now) {
+		return slot
+	}
+	return a.slot(now, -1)
+}
+
+// next returns the first slot after now
+func (a calendarAnchor) next(now time.Time) time.Time {
+	if slot := a.slot(now, 0); slot.After(now) {
+		return slot
+	}
+	return a.slot(now, 1)
+}
+
+// anchoredSchedule decides whether an anchored tier is due: a backup is due once the calendar
+// has passed a slot that has no backup taken at or after it. now must be in the configured timezone.
+func anchoredSchedule(anchor calendarAnchor, lastBackup, now time.Time) (bool, time.Time) {
+	if lastBackup.IsZero() || lastBackup.Before(anchor.previous(now)) {
+		return true, now
+	}
+	return false, anchor.next(now)
+}
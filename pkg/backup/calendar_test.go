@@ -0,0 +1,250 @@
+package backup
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/williamokano/pg_backuper/pkg/config"
+)
+
+// builtinTier returns the built-in tier of a retention tier, or an interval-only tier for other names
+func builtinTier(rt config.RetentionTier) config.Tier {
+	if tier, ok := config.BuiltinTiers.Lookup(rt.Tier); ok {
+		return tier
+	}
+	return config.Tier{Name: rt.Tier, Interval: time.Hour}
+}
+
+func TestParseAnchor(t *testing.T) {
+	tests := []struct {
+		name    string
+		tier    config.RetentionTier
+		wantErr bool
+	}{
+		{name: "daily at", tier: config.RetentionTier{Tier: "daily", At: "02:00"}},
+		{name: "weekly on sunday", tier: config.RetentionTier{Tier: "weekly", Weekday: "Sunday"}},
+		{name: "yearly day and month", tier: config.RetentionTier{Tier: "yearly", Day: 1, Month: 7}},
+		{name: "weekday on daily tier", tier: config.RetentionTier{Tier: "daily", Weekday: "sunday"}, wantErr: true},
+		{name: "day on weekly tier", tier: config.RetentionTier{Tier: "weekly", Day: 1}, wantErr: true},
+		{name: "month on monthly tier", tier: config.RetentionTier{Tier: "monthly", Month: 1}, wantErr: true},
+		{name: "invalid time", tier: config.RetentionTier{Tier: "daily", At: "25:00"}, wantErr: true},
+		{name: "tier without calendar rule", tier: config.RetentionTier{Tier: "every-15m", At: "02:00"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseAnchor(tt.tier, builtinTier(tt.tier))
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestAnchoredSchedule(t *testing.T) {
+	loc := time.UTC
+	at := func(year int, month time.Month, day, hour, min int) time.Time {
+		return time.Date(year, month, day, hour, min, 0, 0, loc)
+	}
+
+	tests := []struct {
+		name     string
+		tier     config.RetentionTier
+		last     time.Time
+		now      time.Time
+		wantDue  bool
+		wantNext time.Time
+	}{
+		{
+			name:     "daily before slot is not due",
+			tier:     config.RetentionTier{Tier: "daily", At: "02:00"},
+			last:     at(2025, 3, 9, 2, 0),
+			now:      at(2025, 3, 10, 1, 30),
+			wantNext: at(2025, 3, 10, 2, 0),
+		},
+		{
+			name:    "daily after slot is due",
+			tier:    config.RetentionTier{Tier: "daily", At: "02:00"},
+			last:    at(2025, 3, 9, 2, 0),
+			now:     at(2025, 3, 10, 2, 5),
+			wantDue: true,
+		},
+		{
+			name:     "daily taken late is not due again the same day",
+			tier:     config.RetentionTier{Tier: "daily", At: "02:00"},
+			last:     at(2025, 3, 10, 9, 0),
+			now:      at(2025, 3, 10, 23, 0),
+			wantNext: at(2025, 3, 11, 2, 0),
+		},
+		{
+			name:     "weekly on sunday",
+			tier:     config.RetentionTier{Tier: "weekly", Weekday: "sunday", At: "03:00"},
+			last:     at(2025, 3, 9, 3, 0), // Sunday
+			now:      at(2025, 3, 12, 12, 0),
+			wantNext: at(2025, 3, 16, 3, 0),
+		},
+		{
+			name:    "weekly missed sunday is due",
+			tier:    config.RetentionTier{Tier: "weekly", Weekday: "sunday"},
+			last:    at(2025, 3, 2, 0, 0),
+			now:     at(2025, 3, 10, 0, 0),
+			wantDue: true,
+		},
+		{
+			name:     "monthly on the 1st",
+			tier:     config.RetentionTier{Tier: "monthly", Day: 1},
+			last:     at(2025, 1, 1, 0, 0),
+			now:      at(2025, 1, 31, 23, 0),
+			wantNext: at(2025, 2, 1, 0, 0),
+		},
+		{
+			name:     "monthly day clamped to end of february",
+			tier:     config.RetentionTier{Tier: "monthly", Day: 31},
+			last:     at(2025, 1, 31, 0, 0),
+			now:      at(2025, 2, 15, 0, 0),
+			wantNext: at(2025, 2, 28, 0, 0),
+		},
+		{
+			name:     "quarterly on first day of quarter",
+			tier:     config.RetentionTier{Tier: "quarterly", Day: 1},
+			last:     at(2025, 4, 1, 0, 0),
+			now:      at(2025, 5, 20, 0, 0),
+			wantNext: at(2025, 7, 1, 0, 0),
+		},
+		{
+			name:     "yearly in july",
+			tier:     config.RetentionTier{Tier: "yearly", Day: 1, Month: 7},
+			last:     at(2024, 7, 1, 0, 0),
+			now:      at(2025, 6, 30, 0, 0),
+			wantNext: at(2025, 7, 1, 0, 0),
+		},
+		{
+			name:    "hourly at minute 15",
+			tier:    config.RetentionTier{Tier: "hourly", At: "00:15"},
+			last:    at(2025, 3, 10, 9, 15),
+			now:     at(2025, 3, 10, 10, 20),
+			wantDue: true,
+		},
+		{
+			name:    "no previous backup is due",
+			tier:    config.RetentionTier{Tier: "monthly", Day: 1},
+			now:     at(2025, 3, 10, 0, 0),
+			wantDue: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			anchor, err := parseAnchor(tt.tier, builtinTier(tt.tier))
+			require.NoError(t, err)
+
+			isDue, next := anchoredSchedule(anchor, tt.last, tt.now)
+			assert.Equal(t, tt.wantDue, isDue, "due mismatch")
+			if tt.wantDue {
+				assert.True(t, next.Equal(tt.now), "next = %v, want now", next)
+			} else {
+				assert.True(t, next.Equal(tt.wantNext), "next = %v, want %v", next, tt.wantNext)
+			}
+		})
+	}
+}
+
+func TestAnchoredSchedule_CustomTiers(t *testing.T) {
+	at := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name     string
+		def      config.TierDefinition
+		last     time.Time
+		now      time.Time
+		wantDue  bool
+		wantNext time.Time
+	}{
+		{
+			name:     "semiannual in january and july",
+			def:      config.TierDefinition{Name: "semiannual", Calendar: "month", Every: 6},
+			last:     at(2025, 1, 1),
+			now:      at(2025, 3, 15),
+			wantNext: at(2025, 7, 1),
+		},
+		{
+			name:    "semiannual missed july is due",
+			def:     config.TierDefinition{Name: "semiannual", Calendar: "month", Every: 6},
+			last:    at(2025, 1, 1),
+			now:     at(2025, 8, 2),
+			wantDue: true,
+		},
+		{
+			name:     "biweekly skips the odd week",
+			def:      config.TierDefinition{Name: "biweekly", Calendar: "week", Every: 2},
+			last:     at(2025, 3, 3), // Monday
+			now:      at(2025, 3, 12),
+			wantNext: at(2025, 3, 17),
+		},
+		{
+			name:     "every six hours",
+			def:      config.TierDefinition{Name: "every-6h", Calendar: "hour", Every: 6},
+			last:     time.Date(2025, 3, 10, 6, 0, 0, 0, time.UTC),
+			now:      time.Date(2025, 3, 10, 11, 0, 0, 0, time.UTC),
+			wantNext: time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tier, err := tt.def.Resolve()
+			require.NoError(t, err)
+			anchor, err := parseAnchor(config.RetentionTier{Tier: tt.def.Name}, tier)
+			require.NoError(t, err)
+
+			isDue, next := anchoredSchedule(anchor, tt.last, tt.now)
+			assert.Equal(t, tt.wantDue, isDue, "due mismatch")
+			if !tt.wantDue {
+				assert.True(t, next.Equal(tt.wantNext), "next = %v, want %v", next, tt.wantNext)
+			}
+		})
+	}
+}
+
+func TestAnchoredSchedule_Timezone(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+
+	rt := config.RetentionTier{Tier: "daily", At: "02:00"}
+	anchor, err := parseAnchor(rt, builtinTier(rt))
+	require.NoError(t, err)
+
+	// 05:30 UTC is 01:30 in New York (EDT), before the 02:00 slot
+	now := time.Date(2025, 6, 10, 5, 30, 0, 0, time.UTC).In(loc)
+	last := time.Date(2025, 6, 9, 2, 0, 0, 0, loc)
+
+	isDue, next := anchoredSchedule(anchor, last, now)
+	assert.False(t, isDue)
+	assert.True(t, next.Equal(time.Date(2025, 6, 10, 2, 0, 0, 0, loc)), "next = %v", next)
+}
+
+func TestAnchoredSchedule_DST(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+
+	rt := config.RetentionTier{Tier: "daily", At: "02:30"}
+	anchor, err := parseAnchor(rt, builtinTier(rt))
+	require.NoError(t, err)
+
+	// 2025-03-09 02:30 does not exist in New York (clocks jump from 02:00 to 03:00)
+	last := time.Date(2025, 3, 8, 2, 30, 0, 0, loc)
+	isDue, _ := anchoredSchedule(anchor, last, time.Date(2025, 3, 9, 4, 0, 0, 0, loc))
+	assert.True(t, isDue, "skipped slot must still make the tier due")
+
+	// After that backup the next slot is at 02:30 local time again, 23 hours later
+	last = time.Date(2025, 3, 9, 4, 0, 0, 0, loc)
+	isDue, next := anchoredSchedule(anchor, last, time.Date(2025, 3, 9, 5, 0, 0, 0, loc))
+	assert.False(t, isDue)
+	assert.True(t, next.Equal(time.Date(2025, 3, 10, 2, 30, 0, 0, loc)), "next = %v", next)
+}
@@ -0,0 +1,110 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rs/zerolog"
+	"github.com/williamokano/pg_backuper/pkg/config"
+	"github.com/williamokano/pg_backuper/pkg/discovery"
+	"github.com/williamokano/pg_backuper/pkg/rotation"
+)
+
+// KindDiscovery marks the result of a server whose databases could not be discovered,
+// or of a discovered database that cannot be backed up
+const KindDiscovery = "discovery"
+
+// listDatabases is swapped out in tests
+var listDatabases = discovery.ListDatabases
+
+// ExpandDatabases returns the static databases followed by the databases discovered on
+// every logical-mode server. A discovered database whose name is already taken (statically
+// or by an earlier server) is skipped, since both would write the same backup files.
+// Servers that cannot be queried, and discovered databases that cannot be backed up,
+// are reported as failed results.
+func ExpandDatabases(ctx context.Context, cfg *config.Config, logger zerolog.Logger) ([]config.DatabaseConfig, []Result) {
+	databases := append([]config.DatabaseConfig(nil), cfg.Databases...)
+	if len(cfg.Servers) == 0 {
+		return databases, nil
+	}
+
+	claimed := make(map[string]string)
+	for _, db := range cfg.Databases {
+		claimed[db.Name] = "databases"
+	}
+
+	var failures []Result
+	pgpassPath, pgpassErr := GetPgpassPath(cfg.GetPgpassFile())
+
+	for _, server := range cfg.Servers {
+		if server.GetMode() != config.ModeLogical {
+			continue
+		}
+
+		port := server.GetPort(cfg.GlobalDefaults)
+		hostID := rotation.HostID(server.Host, port)
+		serverLog := logger.With().Str("server", hostID).Logger()
+
+		fail := func(err error) {
+			serverLog.Error().Err(err).Msg("database discovery failed")
+			failures = append(failures, Result{
+				Database: hostID,
+				Kind:     KindDiscovery,
+				Success:  false,
+				Error:    err,
+			})
+		}
+
+		if pgpassErr != nil {
+			fail(fmt.Errorf(".pgpass file not found: %w", pgpassErr))
+			continue
+		}
+
+		found, err := listDatabases(ctx, server, port, pgpassPath)
+		if err != nil {
+			fail(err)
+			continue
+		}
+
+		selected, skipped, err := discovery.Select(server, found)
+		if err != nil {
+			fail(err)
+			continue
+		}
+
+		// Nothing else would show that these databases are not backed up
+		for _, s := range skipped {
+			serverLog.Warn().
+				Str("database", s.Name).
+				Str("reason", s.Reason).
+				Msg("skipping discovered database")
+			failures = append(failures, Result{
+				Database: s.Name,
+				Kind:     KindDiscovery,
+				Success:  false,
+				Error:    fmt.Errorf("discovered on %s but not backed up: %s", hostID, s.Reason),
+			})
+		}
+
+		added := 0
+		for _, db := range selected {
+			if owner, ok := claimed[db.Name]; ok {
+				serverLog.Warn().
+					Str("database", db.Name).
+					Str("configured_in", owner).
+					Msg("skipping discovered database, name is already backed up")
+				continue
+			}
+			claimed[db.Name] = hostID
+			databases = append(databases, db)
+			added++
+		}
+
+		serverLog.Info().
+			Int("found", len(found)).
+			Int("selected", added).
+			Msg("discovered databases")
+	}
+
+	return databases, failures
+}
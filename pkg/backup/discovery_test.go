@@ -0,0 +1,82 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/williamokano/pg_backuper/pkg/config"
+	"github.com/williamokano/pg_backuper/pkg/discovery"
+)
+
+func TestExpandDatabases(t *testing.T) {
+	pgpassPath := filepath.Join(t.TempDir(), ".pgpass")
+	require.NoError(t, os.WriteFile(pgpassPath, []byte("*:*:*:backup:secret\n"), 0600))
+
+	servers := map[string][]discovery.Database{
+		"db1": {{Name: "app"}, {Name: "billing"}, {Name: "template1", IsTemplate: true}},
+		"db2": {{Name: "billing"}, {Name: "reports"}, {Name: "bad name"}},
+	}
+
+	original := listDatabases
+	t.Cleanup(func() { listDatabases = original })
+	listDatabases = func(_ context.Context, server config.ServerConfig, port int, path string) ([]discovery.Database, error) {
+		assert.Equal(t, pgpassPath, path)
+		assert.NotEqual(t, "db4", server.Host, "basebackup servers are not discovered")
+		assert.Equal(t, 5432, port)
+		found, ok := servers[server.Host]
+		if !ok {
+			return nil, errors.New("connection refused")
+		}
+		return found, nil
+	}
+
+	cfg := &config.Config{
+		GlobalDefaults: config.GlobalDefaults{PgpassFile: pgpassPath},
+		Databases: []config.DatabaseConfig{
+			{Name: "app", User: "app", Host: "db1"},
+		},
+		Servers: []config.ServerConfig{
+			{Host: "db1", User: "backup"},
+			{Host: "db2", User: "backup"},
+			{Host: "db3", User: "backup"},
+			{Host: "db4", User: "replicator", Mode: config.ModeBasebackup},
+		},
+	}
+
+	databases, failures := ExpandDatabases(context.Background(), cfg, zerolog.Nop())
+
+	var got []string
+	for _, db := range databases {
+		got = append(got, db.Host+"/"+db.Name)
+	}
+	// Static entry wins over discovery, and the first server claims a shared name
+	assert.Equal(t, []string{"db1/app", "db1/billing", "db2/reports"}, got)
+	assert.Equal(t, "app", databases[0].User)
+
+	// Unusable names are reported rather than left out silently
+	require.Len(t, failures, 2)
+	assert.Equal(t, "bad name", failures[0].Database)
+	assert.Equal(t, KindDiscovery, failures[0].Kind)
+	assert.False(t, failures[0].Success)
+	assert.ErrorContains(t, failures[0].Error, "discovered on db2-5432 but not backed up")
+	assert.Equal(t, "db3-5432", failures[1].Database)
+	assert.Equal(t, KindDiscovery, failures[1].Kind)
+	assert.False(t, failures[1].Success)
+	assert.Error(t, failures[1].Error)
+}
+
+func TestExpandDatabases_NoServers(t *testing.T) {
+	cfg := &config.Config{
+		Databases: []config.DatabaseConfig{{Name: "app", User: "app", Host: "db1"}},
+	}
+
+	databases, failures := ExpandDatabases(context.Background(), cfg, zerolog.Nop())
+	assert.Equal(t, cfg.Databases, databases)
+	assert.Empty(t, failures)
+}
@@ -0,0 +1,66 @@
+package backup
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/rs/zerolog"
+	"github.com/williamokano/pg_backuper/pkg/config"
+	"github.com/williamokano/pg_backuper/pkg/encryption"
+)
+
+// LoadKeyring loads the configured encryption keys, failing when the active key is unusable
+func LoadKeyring(cfg *config.Config) (*encryption.Keyring, error) {
+	keyring, err := encryption.LoadKeyring(cfg.Encryption)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load encryption keys: %w", err)
+	}
+	return keyring, nil
+}
+
+// encryptArtifact encrypts a local artifact with the active key before upload and removes the
+// plaintext. Returns the path of the file to upload and the digest of the encrypted file, or
+// path itself and a nil digest when encryption is disabled.
+func encryptArtifact(keyring *encryption.Keyring, path string, logger zerolog.Logger) (string, *digest, error) {
+	if !keyring.Enabled() {
+		return path, nil, nil
+	}
+
+	encrypted := path + ".enc"
+	sum := newDigest()
+	if err := encryptFile(keyring, path, encrypted, sum); err != nil {
+		os.Remove(encrypted)
+		return "", nil, fmt.Errorf("failed to encrypt backup: %w", err)
+	}
+	os.Remove(path)
+
+	logger.Debug().
+		Str("key_id", keyring.ActiveKeyID()).
+		Msg("backup encrypted")
+	return encrypted, sum, nil
+}
+
+// encryptFile writes src encrypted with the active key to dst, feeding the output to sum
+func encryptFile(keyring *encryption.Keyring, src, dst string, sum io.Writer) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	sealed, err := keyring.Encrypt(in)
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(io.MultiWriter(out, sum), sealed); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
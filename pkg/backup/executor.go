@@ -3,6 +3,7 @@ package backup
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -10,6 +11,9 @@ import (
 
 	"github.com/rs/zerolog"
 	"github.com/williamokano/pg_backuper/pkg/config"
+	"github.com/williamokano/pg_backuper/pkg/dumpformat"
+	"github.com/williamokano/pg_backuper/pkg/encryption"
+	"github.com/williamokano/pg_backuper/pkg/restoretest"
 	"github.com/williamokano/pg_backuper/pkg/rotation"
 	"github.com/williamokano/pg_backuper/pkg/storage"
 
@@ -23,19 +27,31 @@ import (
 // Result represents the outcome of a backup operation
 type Result struct {
 	Database       string
+	Kind           string                        // Empty for database dumps, rotation.KindGlobals for globals backups
 	Success        bool
 	Skipped        bool                          // True if backup was skipped due to not being due
 	TiersCompleted []string                      // List of tiers that were successfully backed up
 	TiersFailed    []string                      // List of tiers that failed to backup
-	BackendResults map[string][]storage.Result   // Tier -> Backend results
+	BackendResults map[string][]storage.Result   // Tier (or backfilled path) -> Backend results
+	Backfilled     []string                      // Existing backups copied to destinations that were missing them
+	Blocked        []rotation.BlockedDeletion    // Backups rotation would have deleted but a safety guard kept
+	RestoreTest    *restoretest.Result           // Restore test of the new backup, when enabled for the database
 	Error          error
 	Duration       time.Duration
 }
 
-// BackupDatabase performs backups for specified tiers of a single database
-func BackupDatabase(cfg *config.Config, db config.DatabaseConfig, timestamp time.Time, dueTiers []string, logger zerolog.Logger) Result {
+// BackupDatabase performs backups for specified tiers of a single database.
+// pg_dump runs once and the artifact is stored under each due tier's filename.
+// Cancelling ctx stops pg_dump and any upload in progress.
+func BackupDatabase(ctx context.Context, cfg *config.Config, db config.DatabaseConfig, timestamp time.Time, dueTiers []string, logger zerolog.Logger) Result {
+	return backupDatabase(ctx, cfg, db, timestamp, TierSchedule{Due: dueTiers}, logger)
+}
+
+// backupDatabase backs up the due tiers of a schedule, after copying the backups
+// the schedule found missing on some destinations
+func backupDatabase(ctx context.Context, cfg *config.Config, db config.DatabaseConfig, timestamp time.Time, schedule TierSchedule, logger zerolog.Logger) Result {
 	start := time.Now()
-	ctx := context.Background()
+	dueTiers := schedule.Due
 
 	result := Result{
 		Database:       db.Name,
@@ -46,12 +62,15 @@ func BackupDatabase(cfg *config.Config, db config.DatabaseConfig, timestamp time
 	}
 
 	dbLog := logger.With().Str("database", db.Name).Logger()
-	port := db.GetPort(cfg.GlobalDefaults)
+	dumpOpts := newDumpOptions(cfg, db)
+	port := dumpOpts.port
+
+	backfillDestinations(ctx, cfg, db, schedule.Backfill, &result, dbLog)
 
 	// If no tiers specified, skip backup (backward compatibility with old behavior)
 	if len(dueTiers) == 0 {
 		dbLog.Debug().Msg("no tiers due, skipping backup")
-		result.Skipped = true
+		result.Skipped = len(result.Backfilled) == 0
 		result.Success = true
 		result.Duration = time.Since(start)
 		return result
@@ -61,6 +80,8 @@ func BackupDatabase(cfg *config.Config, db config.DatabaseConfig, timestamp time
 		Strs("due_tiers", dueTiers).
 		Str("host", db.Host).
 		Int("port", port).
+		Str("format", dumpOpts.format).
+		Int("jobs", dumpOpts.jobs).
 		Msg("starting backup for due tiers")
 
 	// Get .pgpass file path (shared across all tier backups)
@@ -104,16 +125,17 @@ func BackupDatabase(cfg *config.Config, db config.DatabaseConfig, timestamp time
 		Int("backend_count", len(backends)).
 		Msg("initialized storage backends")
 
-	// Create temp directory for pg_dump
-	tempDir := cfg.Storage.TempDir
-	if tempDir == "" {
-		// Backward compatibility: if BackupDir is set, use it with .tmp subdirectory
-		if cfg.BackupDir != "" {
-			tempDir = filepath.Join(cfg.BackupDir, ".tmp")
-		} else {
-			tempDir = filepath.Join(os.TempDir(), "pg_backuper")
-		}
+	keyring, err := LoadKeyring(cfg)
+	if err != nil {
+		result.Error = err
+		result.Duration = time.Since(start)
+		dbLog.Error().Err(err).Msg("FATAL: cannot load encryption keys")
+		return result
 	}
+	dumpOpts.keyring = keyring
+
+	// Create temp directory for pg_dump
+	tempDir := cfg.GetTempDir()
 	if err := os.MkdirAll(tempDir, 0755); err != nil {
 		result.Error = fmt.Errorf("failed to create temp directory: %w", err)
 		result.Duration = time.Since(start)
@@ -124,135 +146,99 @@ func BackupDatabase(cfg *config.Config, db config.DatabaseConfig, timestamp time
 	// Initialize multi-uploader
 	uploader := storage.NewMultiUploader(logger)
 
-	// Create one backup per due tier
-	for _, tier := range dueTiers {
-		// Generate temp filename
-		tempFile := filepath.Join(tempDir, fmt.Sprintf("%s--%s--%s.backup.tmp",
-			db.Name, tier, timestamp.Format("2006-01-02T15-04-05")))
-
-		// Generate final filename (without .tmp extension, without base directory)
-		finalFilename := rotation.GenerateBackupFilenameWithTier("", db.Name, tier, timestamp)
-		finalFilename = filepath.Base(finalFilename)
-
-		tierLog := dbLog.With().Str("tier", tier).Logger()
-		tierLog.Info().
-			Str("temp_file", tempFile).
-			Str("final_filename", finalFilename).
-			Msg("creating tier-specific backup")
-
-		// Build pg_dump command (writes to temp file)
-		cmd := exec.Command("pg_dump",
-			"-U", db.User,
-			"-h", db.Host,
-			"-p", fmt.Sprintf("%d", port),
-			"-F", "c", // custom format (compressed)
-			"-b",      // include blobs
-			"-v",      // verbose
-			"-f", tempFile,
-			db.Name,
-		)
-
-		// Set PGPASSFILE environment variable if .pgpass was found
-		if pgpassPath != "" {
-			cmd.Env = append(os.Environ(), "PGPASSFILE="+pgpassPath)
-		} else {
-			cmd.Env = os.Environ()
-		}
-
-		// Create logs directory for pg_dump output
-		logsDir := filepath.Join(tempDir, "logs")
-		var logFile *os.File
-		if err := os.MkdirAll(logsDir, 0755); err != nil {
-			tierLog.Warn().Err(err).Msg("failed to create logs directory, pg_dump output will go to stdout")
-			cmd.Stdout = os.Stdout
-			cmd.Stderr = os.Stderr
-		} else {
-			// Create log file for this backup operation
-			logFileName := filepath.Join(logsDir, fmt.Sprintf("%s--%s--%s.log", db.Name, tier, timestamp.Format("2006-01-02T15-04-05")))
-			var err error
-			logFile, err = os.Create(logFileName)
-			if err != nil {
-				tierLog.Warn().Err(err).Msg("failed to create log file, pg_dump output will go to stdout")
-				cmd.Stdout = os.Stdout
-				cmd.Stderr = os.Stderr
-			} else {
-				cmd.Stdout = logFile
-				cmd.Stderr = logFile
-				tierLog.Debug().Str("log_file", logFileName).Msg("pg_dump output redirected to log file")
-			}
-		}
+	// Dump once per run; the same artifact is stored under every due tier's filename.
+	// storeFirst stores the dump under the first tier's filename; sourcePath is the
+	// local artifact used for re-uploads (empty when streaming, as there is none)
+	var storeFirst func(destPath string) ([]storage.Result, error)
+	sourcePath := ""
+	// sum and dumpDuration describe the stored artifact once storeFirst succeeded
+	var sum *digest
+	var dumpDuration time.Duration
+
+	streaming := cfg.Storage.Streaming
+	if streaming && dumpOpts.format == dumpformat.Directory {
+		// pg_dump writes directory format to disk, so it cannot be piped
+		dbLog.Warn().Msg("directory format cannot be streamed, using temp directory")
+		streaming = false
+	}
 
-		// Execute backup for this tier
-		cmdErr := cmd.Run()
+	if streaming {
+		dbLog.Info().Msg("streaming backup directly to destinations")
 
-		// Close log file if it was opened
-		if logFile != nil {
-			logFile.Close()
+		storeFirst = func(destPath string) ([]storage.Result, error) {
+			sum = newDigest()
+			streamStart := time.Now()
+			defer func() { dumpDuration = time.Since(streamStart) }()
+			return streamPgDump(ctx, uploader, backends, db, dumpOpts, pgpassPath, tempDir, timestamp, destPath, sum, dbLog)
 		}
+	} else {
+		tempFile := filepath.Join(tempDir, fmt.Sprintf("%s--%s.backup.tmp",
+			db.Name, rotation.FormatTimestamp(timestamp)))
 
-		if cmdErr != nil {
-			tierLog.Error().
-				Err(cmdErr).
-				Msg("backup failed for tier")
-			result.TiersFailed = append(result.TiersFailed, tier)
+		dbLog.Info().
+			Str("temp_file", tempFile).
+			Msg("creating backup")
 
-			// Clean up failed temp backup file
+		dumpStart := time.Now()
+		dumpSum, dumpErr := runPgDump(ctx, db, dumpOpts, pgpassPath, tempFile, tempDir, timestamp, dbLog)
+		dumpDuration = time.Since(dumpStart)
+		if dumpErr != nil {
 			os.Remove(tempFile)
-
-			// Continue with other tiers even if this one fails
-			continue
-		}
-
-		// Verify backup file was actually created and has content
-		fileInfo, err := os.Stat(tempFile)
-		if err != nil {
-			tierLog.Error().
-				Err(err).
-				Str("file", tempFile).
-				Msg("backup file not found after pg_dump")
-			result.TiersFailed = append(result.TiersFailed, tier)
-			continue
-		}
-
-		if fileInfo.Size() == 0 {
-			tierLog.Error().
-				Str("file", tempFile).
-				Msg("backup file is empty (0 bytes)")
-			result.TiersFailed = append(result.TiersFailed, tier)
-			// Remove the empty file
+			storeFirst = func(destPath string) ([]storage.Result, error) {
+				return nil, dumpErr
+			}
+		} else if uploadPath, encSum, encErr := encryptArtifact(keyring, tempFile, dbLog); encErr != nil {
 			os.Remove(tempFile)
-			continue
-		}
-
-		tierLog.Info().
-			Int64("size_bytes", fileInfo.Size()).
-			Msg("backup created successfully, uploading to destinations")
-
-		// Upload to all configured backends in parallel
-		uploadResults := uploader.Upload(ctx, backends, tempFile, finalFilename)
-		result.BackendResults[tier] = uploadResults
-
-		// Check if at least one backend succeeded
-		hasSuccess := false
-		for _, ur := range uploadResults {
-			if ur.Success {
-				hasSuccess = true
-				break
+			storeFirst = func(destPath string) ([]storage.Result, error) {
+				return nil, encErr
+			}
+		} else {
+			sum = dumpSum
+			if encSum != nil {
+				sum = encSum
+			}
+			dbLog.Info().
+				Int64("size_bytes", dumpSum.size).
+				Str("sha256", sum.Sum()).
+				Bool("encrypted", keyring.Enabled()).
+				Msg("backup created successfully, uploading to destinations")
+
+			sourcePath = uploadPath
+			storeFirst = func(destPath string) ([]storage.Result, error) {
+				return uploader.Upload(ctx, backends, uploadPath, destPath), nil
 			}
 		}
+	}
 
-		if !hasSuccess {
-			tierLog.Error().Msg("all backends failed to upload backup")
-			result.TiersFailed = append(result.TiersFailed, tier)
-			// Keep temp file for retry
-		} else {
-			tierLog.Info().Msg("backup uploaded to at least one destination")
-			result.TiersCompleted = append(result.TiersCompleted, tier)
-			// Delete temp file after successful upload
-			os.Remove(tempFile)
+	// Describes the stored backup once the dump is done (for streams, once it is uploaded)
+	pgDumpVersion := toolVersion(ctx, "pg_dump")
+	dbVersion := serverVersion(ctx, db.Host, port, db.User, db.Name, pgpassPath)
+	describe := func(tier string) storage.Manifest {
+		return storage.Manifest{
+			Database:        db.Name,
+			Tier:            tier,
+			Host:            db.Host,
+			Port:            port,
+			ServerVersion:   dbVersion,
+			PgDumpVersion:   pgDumpVersion,
+			Size:            sum.size,
+			SHA256:          sum.Sum(),
+			DurationSeconds: dumpDuration.Seconds(),
+			Format:          dumpOpts.format,
+			Compression:     dumpCompression(dumpOpts.format, dumpOpts.compress),
+			KeyID:           keyring.ActiveKeyID(),
+			CreatedAt:       time.Now().UTC(),
 		}
 	}
 
+	storeTiers(ctx, uploader, backends, rotation.DatabaseNaming(db.Name), dueTiers, timestamp, storeFirst, sourcePath, describe, &result, dbLog)
+
+	if sourcePath != "" && len(result.TiersCompleted) > 0 {
+		// Delete temp file after successful upload
+		os.Remove(sourcePath)
+	}
+	// Otherwise keep temp file for retry
+
 	result.Duration = time.Since(start)
 
 	// Check overall success
@@ -285,8 +271,11 @@ func BackupDatabase(cfg *config.Config, db config.DatabaseConfig, timestamp time
 				Msg("applying retention policy per backend")
 
 			// Apply retention policy on each backend independently
+			guards := RotationGuards(cfg)
 			for _, backend := range backends {
-				if err := rotation.ApplyRetentionWithBackend(ctx, backend, db.Name, retentionTiers, dbLog); err != nil {
+				blocked, err := rotation.ApplyGuardedRetention(ctx, backend, rotation.DatabaseNaming(db.Name), retentionTiers, guards, dbLog)
+				result.Blocked = append(result.Blocked, blocked...)
+				if err != nil {
 					dbLog.Error().
 						Err(err).
 						Str("backend", backend.Name()).
@@ -299,26 +288,240 @@ func BackupDatabase(cfg *config.Config, db config.DatabaseConfig, timestamp time
 		dbLog.Warn().Msg("skipping rotation - no successful backups created")
 	}
 
+	// A failed restore test is reported on its own: the backup itself was stored
+	testRestore(ctx, cfg, db, backends, timestamp, keyring, pgpassPath, &result, dbLog)
+
 	return result
 }
 
+// storeTiers stores one backup artifact under the filename of every due tier.
+// storeFirst uploads it for the first tier, or returns an error if the backup itself
+// failed; remaining tiers are copied from the first stored file (re-uploading
+// sourcePath, or reading back from the backend when sourcePath is empty).
+// Completed and failed tiers are recorded in result.
+func storeTiers(ctx context.Context, uploader *storage.MultiUploader, backends []storage.Backend, naming rotation.Naming, dueTiers []string, timestamp time.Time, storeFirst func(destPath string) ([]storage.Result, error), sourcePath string, describe func(tier string) storage.Manifest, result *Result, logger zerolog.Logger) {
+	// The first stored tier is the source for copies of the remaining tiers
+	primaryFilename := ""
+
+	for i, tier := range dueTiers {
+		finalFilename := naming.Filename(tier, timestamp)
+
+		tierLog := logger.With().Str("tier", tier).Logger()
+
+		var uploadResults []storage.Result
+		if primaryFilename == "" {
+			tierLog.Info().
+				Str("final_filename", finalFilename).
+				Msg("uploading tier-specific backup")
+
+			var dumpErr error
+			uploadResults, dumpErr = storeFirst(finalFilename)
+			if dumpErr != nil {
+				// Without a dump there is nothing to store for any remaining tier
+				tierLog.Error().
+					Err(dumpErr).
+					Msg("backup failed")
+				result.BackendResults[tier] = uploadResults
+				result.TiersFailed = append(result.TiersFailed, dueTiers[i:]...)
+				return
+			}
+		} else {
+			tierLog.Info().
+				Str("source", primaryFilename).
+				Str("final_filename", finalFilename).
+				Msg("storing tier-specific backup from existing copy")
+			uploadResults = uploader.Replicate(ctx, backends, sourcePath, primaryFilename, finalFilename)
+		}
+		result.BackendResults[tier] = uploadResults
+
+		// Check if at least one backend succeeded
+		hasSuccess := false
+		for _, ur := range uploadResults {
+			if ur.Success {
+				hasSuccess = true
+				break
+			}
+		}
+
+		if !hasSuccess {
+			tierLog.Error().Msg("all backends failed to store backup")
+
+			// A stream cannot be replayed: with nothing stored there is no source for other tiers
+			if primaryFilename == "" && sourcePath == "" {
+				result.TiersFailed = append(result.TiersFailed, dueTiers[i:]...)
+				return
+			}
+			result.TiersFailed = append(result.TiersFailed, tier)
+			continue
+		}
+
+		tierLog.Info().Msg("backup stored on at least one destination")
+		writeManifests(ctx, backends, uploadResults, finalFilename, describe(tier), tierLog)
+		result.TiersCompleted = append(result.TiersCompleted, tier)
+		if primaryFilename == "" {
+			primaryFilename = finalFilename
+		}
+	}
+}
+
+// dumpOptions holds the effective pg_dump settings for a database
+type dumpOptions struct {
+	port     int
+	format   string              // dumpformat.Custom, Directory, Tar or Plain
+	jobs     int                 // parallel jobs, directory format only
+	compress bool                // gzip the packaged directory-format dump
+	keyring  *encryption.Keyring // encrypts the artifact before upload when enabled
+}
+
+// newDumpOptions resolves the pg_dump settings for a database from config
+func newDumpOptions(cfg *config.Config, db config.DatabaseConfig) dumpOptions {
+	return dumpOptions{
+		port:     db.GetPort(cfg.GlobalDefaults),
+		format:   db.GetFormat(cfg.GlobalDefaults),
+		jobs:     db.GetJobs(cfg.GlobalDefaults),
+		compress: db.GetCompressDirectory(cfg.GlobalDefaults),
+	}
+}
+
+// runPgDump dumps a database to outputFile and verifies the result is not empty.
+// Directory-format output is packaged into a single tar at outputFile.
+// Returns the digest of outputFile, computed while it is written.
+func runPgDump(ctx context.Context, db config.DatabaseConfig, opts dumpOptions, pgpassPath, outputFile, tempDir string, timestamp time.Time, logger zerolog.Logger) (*digest, error) {
+	// Other formats are written to stdout, so they can be hashed on the way to outputFile
+	dumpPath := ""
+	if opts.format == dumpformat.Directory {
+		// pg_dump refuses to write into an existing directory, clear leftovers of a failed run
+		dumpPath = outputFile + ".dir"
+		os.RemoveAll(dumpPath)
+		defer os.RemoveAll(dumpPath)
+	}
+
+	cmd, err := newPgDumpCmd(ctx, db, opts, pgpassPath, dumpPath)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := os.Create(outputFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create backup file: %w", err)
+	}
+	defer out.Close()
+	sum := newDigest()
+
+	logFile := openDumpLog(tempDir, db.Name, timestamp, logger)
+	if logFile != nil {
+		cmd.Stdout = logFile
+		cmd.Stderr = logFile
+	} else {
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+	}
+	if dumpPath == "" {
+		cmd.Stdout = io.MultiWriter(out, sum)
+	}
+
+	// Execute backup
+	cmdErr := cmd.Run()
+
+	// Close log file if it was opened
+	if logFile != nil {
+		logFile.Close()
+	}
+
+	if cmdErr != nil {
+		return nil, fmt.Errorf("pg_dump failed: %w", cmdErr)
+	}
+
+	if opts.format == dumpformat.Directory {
+		logger.Debug().
+			Str("dump_dir", dumpPath).
+			Bool("compress", opts.compress).
+			Msg("packaging directory-format dump")
+
+		if err := dumpformat.PackDirectoryTo(dumpPath, io.MultiWriter(out, sum), opts.compress); err != nil {
+			return nil, fmt.Errorf("failed to package directory dump: %w", err)
+		}
+	}
+
+	if err := out.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write backup file: %w", err)
+	}
+
+	// Verify backup file has content
+	if sum.size == 0 {
+		return nil, fmt.Errorf("backup file is empty (0 bytes): %s", outputFile)
+	}
+
+	return sum, nil
+}
+
+// newPgDumpCmd builds the pg_dump command for a database.
+// An empty outputFile writes the archive to stdout.
+func newPgDumpCmd(ctx context.Context, db config.DatabaseConfig, opts dumpOptions, pgpassPath, outputFile string) (*exec.Cmd, error) {
+	formatFlag, err := dumpformat.PgDumpFlag(opts.format)
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{
+		"-U", db.User,
+		"-h", db.Host,
+		"-p", fmt.Sprintf("%d", opts.port),
+		"-F", formatFlag,
+		"-b", // include blobs
+		"-v", // verbose
+	}
+	// pg_dump only supports parallel jobs for directory format
+	if opts.format == dumpformat.Directory && opts.jobs > 1 {
+		args = append(args, "-j", fmt.Sprintf("%d", opts.jobs))
+	}
+	if outputFile != "" {
+		args = append(args, "-f", outputFile)
+	}
+	args = append(args, db.Name)
+
+	cmd := exec.CommandContext(ctx, "pg_dump", args...)
+
+	// Set PGPASSFILE environment variable if .pgpass was found
+	if pgpassPath != "" {
+		cmd.Env = append(os.Environ(), "PGPASSFILE="+pgpassPath)
+	} else {
+		cmd.Env = os.Environ()
+	}
+
+	return cmd, nil
+}
+
+// openDumpLog creates the log file for pg_dump output.
+// Returns nil if it cannot be created, in which case output goes to stdout/stderr.
+func openDumpLog(tempDir, dbName string, timestamp time.Time, logger zerolog.Logger) *os.File {
+	// Create logs directory for pg_dump output
+	logsDir := filepath.Join(tempDir, "logs")
+	if err := os.MkdirAll(logsDir, 0755); err != nil {
+		logger.Warn().Err(err).Msg("failed to create logs directory, pg_dump output will go to stdout")
+		return nil
+	}
+
+	// Create log file for this backup operation
+	logFileName := filepath.Join(logsDir, fmt.Sprintf("%s--%s.log", dbName, rotation.FormatTimestamp(timestamp)))
+	logFile, err := os.Create(logFileName)
+	if err != nil {
+		logger.Warn().Err(err).Msg("failed to create log file, pg_dump output will go to stdout")
+		return nil
+	}
+
+	logger.Debug().Str("log_file", logFileName).Msg("pg_dump output redirected to log file")
+	return logFile
+}
+
 // initializeBackends creates backend instances from config
 func initializeBackends(ctx context.Context, cfg *config.Config, db config.DatabaseConfig, logger zerolog.Logger) ([]storage.Backend, error) {
 	// Backward compatibility: if no storage config but BackupDir is set, create default local backend
 	if len(cfg.Storage.Destinations) == 0 && cfg.BackupDir != "" {
 		logger.Debug().Str("backup_dir", cfg.BackupDir).Msg("no storage config, creating default local backend")
-		storageConfig := storage.Config{
-			Name:    "default_local",
-			Type:    "local",
-			Enabled: true,
-			BaseDir: cfg.BackupDir,
-			Options: map[string]interface{}{
-				"path": cfg.BackupDir,
-			},
-		}
 
 		factory := storage.NewFactory()
-		backend, err := factory.Create(ctx, storageConfig)
+		backend, err := factory.Create(ctx, defaultLocalConfig(cfg))
 		if err != nil {
 			return nil, fmt.Errorf("failed to create default local backend: %w", err)
 		}
@@ -338,13 +541,7 @@ func initializeBackends(ctx context.Context, cfg *config.Config, db config.Datab
 	for _, destName := range destNames {
 		for _, dest := range cfg.Storage.Destinations {
 			if dest.Name == destName && dest.Enabled {
-				storageConfigs = append(storageConfigs, storage.Config{
-					Name:    dest.Name,
-					Type:    dest.Type,
-					Enabled: dest.Enabled,
-					BaseDir: dest.BaseDir,
-					Options: dest.Options,
-				})
+				storageConfigs = append(storageConfigs, destinationConfig(dest))
 				break
 			}
 		}
@@ -369,6 +566,75 @@ func initializeBackends(ctx context.Context, cfg *config.Config, db config.Datab
 	return backends, nil
 }
 
+// InitializeDestination creates a single backend for a named storage destination.
+// With a legacy config (backup_dir only), the name "default_local" or an empty
+// name selects the implicit local backend.
+func InitializeDestination(ctx context.Context, cfg *config.Config, name string) (storage.Backend, error) {
+	factory := storage.NewFactory()
+
+	if len(cfg.Storage.Destinations) == 0 && cfg.BackupDir != "" {
+		if name != "" && name != defaultLocalName {
+			return nil, fmt.Errorf("unknown storage destination: %s (only %s is available without storage config)", name, defaultLocalName)
+		}
+		return factory.Create(ctx, defaultLocalConfig(cfg))
+	}
+
+	for _, dest := range cfg.Storage.Destinations {
+		if dest.Name != name {
+			continue
+		}
+		if !dest.Enabled {
+			return nil, fmt.Errorf("storage destination %s is disabled", name)
+		}
+		return factory.Create(ctx, destinationConfig(dest))
+	}
+
+	return nil, fmt.Errorf("unknown storage destination: %s", name)
+}
+
+// EnabledDestinations returns the names of the enabled storage destinations,
+// or the implicit local backend of a legacy config (backup_dir only)
+func EnabledDestinations(cfg *config.Config) []string {
+	if len(cfg.Storage.Destinations) == 0 && cfg.BackupDir != "" {
+		return []string{defaultLocalName}
+	}
+
+	var names []string
+	for _, dest := range cfg.Storage.Destinations {
+		if dest.Enabled {
+			names = append(names, dest.Name)
+		}
+	}
+	return names
+}
+
+// defaultLocalName is the name of the implicit local backend used by legacy configs
+const defaultLocalName = "default_local"
+
+// defaultLocalConfig builds the implicit local backend config for legacy configs
+func defaultLocalConfig(cfg *config.Config) storage.Config {
+	return storage.Config{
+		Name:    defaultLocalName,
+		Type:    "local",
+		Enabled: true,
+		BaseDir: cfg.BackupDir,
+		Options: map[string]interface{}{
+			"path": cfg.BackupDir,
+		},
+	}
+}
+
+// destinationConfig converts a configured destination into a backend config
+func destinationConfig(dest config.StorageDestination) storage.Config {
+	return storage.Config{
+		Name:    dest.Name,
+		Type:    dest.Type,
+		Enabled: dest.Enabled,
+		BaseDir: dest.BaseDir,
+		Options: dest.Options,
+	}
+}
+
 // closeBackends safely closes all backends
 func closeBackends(backends []storage.Backend) {
 	for _, backend := range backends {
@@ -8,6 +8,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	"github.com/williamokano/pg_backuper/pkg/config"
 	"github.com/williamokano/pg_backuper/pkg/storage"
 	"github.com/williamokano/pg_backuper/pkg/storage/mocks"
 )
@@ -248,6 +249,63 @@ func TestInitializeBackends(t *testing.T) {
 	})
 }
 
+func TestNewPgDumpCmd(t *testing.T) {
+	db := config.DatabaseConfig{Name: "mydb", User: "postgres", Host: "db.internal"}
+
+	t.Run("custom_format_default", func(t *testing.T) {
+		opts := newDumpOptions(&config.Config{}, db)
+
+		cmd, err := newPgDumpCmd(context.Background(), db, opts, "", "/tmp/mydb.backup.tmp")
+
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			"pg_dump",
+			"-U", "postgres",
+			"-h", "db.internal",
+			"-p", "5432",
+			"-F", "c",
+			"-b",
+			"-v",
+			"-f", "/tmp/mydb.backup.tmp",
+			"mydb",
+		}, cmd.Args)
+	})
+
+	t.Run("directory_format_with_jobs", func(t *testing.T) {
+		dirDB := db
+		dirDB.Format = "directory"
+		dirDB.Jobs = 8
+		opts := newDumpOptions(&config.Config{}, dirDB)
+
+		cmd, err := newPgDumpCmd(context.Background(), dirDB, opts, "", "/tmp/mydb.backup.tmp.dir")
+
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			"pg_dump",
+			"-U", "postgres",
+			"-h", "db.internal",
+			"-p", "5432",
+			"-F", "d",
+			"-b",
+			"-v",
+			"-j", "8",
+			"-f", "/tmp/mydb.backup.tmp.dir",
+			"mydb",
+		}, cmd.Args)
+	})
+
+	t.Run("jobs_ignored_for_other_formats", func(t *testing.T) {
+		opts := newDumpOptions(&config.Config{GlobalDefaults: config.GlobalDefaults{Format: "tar", Jobs: 4}}, db)
+
+		cmd, err := newPgDumpCmd(context.Background(), db, opts, "", "")
+
+		require.NoError(t, err)
+		assert.NotContains(t, cmd.Args, "-j")
+		assert.NotContains(t, cmd.Args, "-f")
+		assert.Equal(t, "t", cmd.Args[8])
+	})
+}
+
 // Note: Full unit testing of BackupDatabase requires refactoring to support
 // dependency injection. Current implementation couples pg_dump execution,
 // file I/O, and backend initialization, making it difficult to unit test
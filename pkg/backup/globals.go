@@ -0,0 +1,172 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/williamokano/pg_backuper/pkg/config"
+	"github.com/williamokano/pg_backuper/pkg/rotation"
+)
+
+// GlobalsTarget is a PostgreSQL server whose globals (roles, tablespaces, grants) are backed up
+type GlobalsTarget struct {
+	Host string
+	Port int
+	User string
+}
+
+// Naming returns the backup naming for the server's globals
+func (t GlobalsTarget) Naming() rotation.Naming {
+	return rotation.GlobalsNaming(t.Host, t.Port)
+}
+
+// GlobalsTargets returns every distinct host/port of the enabled databases and logical-mode
+// servers, in config order (base backups already contain the globals). The connecting user is globals.user, or the user of the first
+// database (or server) on that host/port.
+func GlobalsTargets(cfg *config.Config) []GlobalsTarget {
+	var targets []GlobalsTarget
+	seen := make(map[string]bool)
+
+	add := func(target GlobalsTarget) {
+		if cfg.Globals.User != "" {
+			target.User = cfg.Globals.User
+		}
+
+		key := fmt.Sprintf("%s:%d", target.Host, target.Port)
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		targets = append(targets, target)
+	}
+
+	for _, db := range cfg.Databases {
+		if !db.IsEnabled() {
+			continue
+		}
+		add(GlobalsTarget{
+			Host: db.Host,
+			Port: db.GetPort(cfg.GlobalDefaults),
+			User: db.User,
+		})
+	}
+
+	for _, server := range cfg.Servers {
+		if server.GetMode() != config.ModeLogical {
+			continue
+		}
+		add(GlobalsTarget{
+			Host: server.Host,
+			Port: server.GetPort(cfg.GlobalDefaults),
+			User: server.User,
+		})
+	}
+
+	return targets
+}
+
+// BackupAllGlobals backs up the globals of every server, one at a time (globals dumps are small)
+func BackupAllGlobals(ctx context.Context, cfg *config.Config, timestamp time.Time, logger zerolog.Logger) []Result {
+	if !cfg.Globals.Enabled {
+		return nil
+	}
+
+	targets := GlobalsTargets(cfg)
+	logger.Info().
+		Int("servers", len(targets)).
+		Msg("starting globals backups")
+
+	var results []Result
+	for _, target := range targets {
+		if ctx.Err() != nil {
+			break
+		}
+		results = append(results, BackupGlobals(ctx, cfg, target, timestamp, logger))
+	}
+
+	return results
+}
+
+// BackupGlobals runs pg_dumpall --globals-only against one server and stores the
+// result as name--globals--TIER--timestamp.sql for every due tier
+func BackupGlobals(ctx context.Context, cfg *config.Config, target GlobalsTarget, timestamp time.Time, logger zerolog.Logger) Result {
+	naming := target.Naming()
+	globalsLog := logger.With().
+		Str("database", naming.Name).
+		Str("kind", rotation.KindGlobals).
+		Str("host", target.Host).
+		Int("port", target.Port).
+		Logger()
+
+	tempDir := cfg.GetTempDir()
+	artifact := globalsArtifact(cfg, target)
+	artifact.dump = func(pgpassPath, outputFile string) error {
+		return runPgDumpall(ctx, target, pgpassPath, outputFile, tempDir, timestamp, globalsLog)
+	}
+	return backupServerArtifact(ctx, cfg, artifact, timestamp, globalsLog)
+}
+
+// globalsArtifact describes the globals backup of a server, without its dump step
+func globalsArtifact(cfg *config.Config, target GlobalsTarget) serverArtifact {
+	return serverArtifact{
+		naming:              target.Naming(),
+		storageDestinations: cfg.Globals.StorageDestinations,
+		retentionTiers:      cfg.Globals.GetRetentionTiers(cfg.GlobalDefaults),
+		host:                target.Host,
+		port:                target.Port,
+		user:                target.User,
+		tool:                "pg_dumpall",
+		format:              "plain",
+		compression:         "none",
+	}
+}
+
+// runPgDumpall dumps the roles, tablespaces and grants of a server to outputFile
+func runPgDumpall(ctx context.Context, target GlobalsTarget, pgpassPath, outputFile, tempDir string, timestamp time.Time, logger zerolog.Logger) error {
+	cmd := exec.CommandContext(ctx, "pg_dumpall", buildPgDumpallArgs(target, outputFile)...)
+	cmd.Env = os.Environ()
+	if pgpassPath != "" {
+		cmd.Env = append(cmd.Env, "PGPASSFILE="+pgpassPath)
+	}
+
+	logFile := openDumpLog(tempDir, target.Naming().Name+"--"+rotation.KindGlobals, timestamp, logger)
+	if logFile != nil {
+		defer logFile.Close()
+		cmd.Stdout = logFile
+		cmd.Stderr = logFile
+	} else {
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+	}
+
+	if err := cmd.Run(); err != nil {
+		os.Remove(outputFile)
+		return fmt.Errorf("pg_dumpall failed: %w", err)
+	}
+
+	fileInfo, err := os.Stat(outputFile)
+	if err != nil {
+		return fmt.Errorf("globals file not found after pg_dumpall: %w", err)
+	}
+	if fileInfo.Size() == 0 {
+		return fmt.Errorf("globals file is empty (0 bytes): %s", outputFile)
+	}
+
+	return nil
+}
+
+// buildPgDumpallArgs builds the pg_dumpall argument list for a globals-only dump
+func buildPgDumpallArgs(target GlobalsTarget, outputFile string) []string {
+	return []string{
+		"-U", target.User,
+		"-h", target.Host,
+		"-p", fmt.Sprintf("%d", target.Port),
+		"--globals-only",
+		"-v",
+		"-f", outputFile,
+	}
+}
@@ -0,0 +1,82 @@
+package backup
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/williamokano/pg_backuper/pkg/config"
+)
+
+func TestGlobalsTargets(t *testing.T) {
+	cfg := &config.Config{
+		GlobalDefaults: config.GlobalDefaults{Port: 5432},
+		Databases: []config.DatabaseConfig{
+			{Name: "app", User: "app_owner", Host: "pg1"},
+			{Name: "billing", User: "billing_owner", Host: "pg1"},
+			{Name: "analytics", User: "analyst", Host: "pg1", Port: 5433},
+			{Name: "reports", User: "reporter", Host: "pg2"},
+		},
+	}
+
+	t.Run("one_target_per_host_and_port", func(t *testing.T) {
+		targets := GlobalsTargets(cfg)
+
+		assert.Equal(t, []GlobalsTarget{
+			{Host: "pg1", Port: 5432, User: "app_owner"},
+			{Host: "pg1", Port: 5433, User: "analyst"},
+			{Host: "pg2", Port: 5432, User: "reporter"},
+		}, targets)
+	})
+
+	t.Run("includes_discovery_servers", func(t *testing.T) {
+		withServers := *cfg
+		withServers.Servers = []config.ServerConfig{
+			{Host: "pg2", User: "backup"},
+			{Host: "pg3", Port: 5434, User: "backup"},
+		}
+
+		targets := GlobalsTargets(&withServers)
+
+		assert.Equal(t, []GlobalsTarget{
+			{Host: "pg1", Port: 5432, User: "app_owner"},
+			{Host: "pg1", Port: 5433, User: "analyst"},
+			{Host: "pg2", Port: 5432, User: "reporter"},
+			{Host: "pg3", Port: 5434, User: "backup"},
+		}, targets)
+	})
+
+	t.Run("skips_basebackup_servers", func(t *testing.T) {
+		withServers := *cfg
+		withServers.Servers = []config.ServerConfig{
+			{Host: "pg3", User: "replicator", Mode: config.ModeBasebackup},
+		}
+
+		for _, target := range GlobalsTargets(&withServers) {
+			assert.NotEqual(t, "pg3", target.Host)
+		}
+	})
+
+	t.Run("globals_user_override", func(t *testing.T) {
+		withUser := *cfg
+		withUser.Globals.User = "postgres"
+
+		for _, target := range GlobalsTargets(&withUser) {
+			assert.Equal(t, "postgres", target.User)
+		}
+	})
+}
+
+func TestBuildPgDumpallArgs(t *testing.T) {
+	target := GlobalsTarget{Host: "pg1", Port: 5432, User: "postgres"}
+
+	args := buildPgDumpallArgs(target, "/tmp/pg1-5432--globals.sql.tmp")
+
+	assert.Equal(t, []string{
+		"-U", "postgres",
+		"-h", "pg1",
+		"-p", "5432",
+		"--globals-only",
+		"-v",
+		"-f", "/tmp/pg1-5432--globals.sql.tmp",
+	}, args)
+}
@@ -136,7 +136,7 @@ func TestBackupToS3Integration(t *testing.T) {
 		// Run backup
 		logger := zerolog.Nop()
 		timestamp := time.Now()
-		result := BackupDatabase(cfg, dbConfig, timestamp, []string{"daily"}, logger)
+		result := BackupDatabase(context.Background(), cfg, dbConfig, timestamp, []string{"daily"}, logger)
 
 		// Verify result
 		require.True(t, result.Success, "Backup should succeed: %v", result.Error)
@@ -0,0 +1,134 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog"
+	"github.com/williamokano/pg_backuper/pkg/dumpformat"
+	"github.com/williamokano/pg_backuper/pkg/storage"
+)
+
+// digest computes the SHA-256 and size of the bytes written through it.
+// It is fed while the artifact is written, so the manifest describes exactly what was uploaded.
+type digest struct {
+	hash hash.Hash
+	size int64
+}
+
+func newDigest() *digest {
+	return &digest{hash: sha256.New()}
+}
+
+func (d *digest) Write(p []byte) (int, error) {
+	d.size += int64(len(p))
+	return d.hash.Write(p)
+}
+
+// Sum returns the hex SHA-256 of the bytes written so far
+func (d *digest) Sum() string {
+	return hex.EncodeToString(d.hash.Sum(nil))
+}
+
+// hashFile returns the digest of a local file, for artifacts written by external tools
+func hashFile(path string) (*digest, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	sum := newDigest()
+	if _, err := io.Copy(sum, file); err != nil {
+		return nil, err
+	}
+	return sum, nil
+}
+
+// toolVersions caches the output of "<tool> --version" per tool
+var toolVersions sync.Map
+
+// toolVersion returns the version string of a PostgreSQL client tool, or "" if it cannot be run
+func toolVersion(ctx context.Context, tool string) string {
+	if version, ok := toolVersions.Load(tool); ok {
+		return version.(string)
+	}
+	output, err := exec.CommandContext(ctx, tool, "--version").Output()
+	if err != nil {
+		return ""
+	}
+	version := strings.TrimSpace(string(output))
+	toolVersions.Store(tool, version)
+	return version
+}
+
+// serverVersion asks the server of a database for its version, or returns "" if it cannot
+func serverVersion(ctx context.Context, host string, port int, user, dbName, pgpassPath string) string {
+	cmd := exec.CommandContext(ctx, "psql",
+		"-h", host,
+		"-p", fmt.Sprintf("%d", port),
+		"-U", user,
+		"-d", dbName,
+		"-X", "-A", "-t", "-w",
+		"-c", "SHOW server_version",
+	)
+	cmd.Env = os.Environ()
+	if pgpassPath != "" {
+		cmd.Env = append(cmd.Env, "PGPASSFILE="+pgpassPath)
+	}
+
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		return ""
+	}
+	return strings.TrimSpace(stdout.String())
+}
+
+// dumpCompression describes how a pg_dump artifact of a format is compressed
+func dumpCompression(format string, compressDirectory bool) string {
+	switch format {
+	case dumpformat.Custom, "":
+		return "pg_dump"
+	case dumpformat.Directory:
+		if compressDirectory {
+			return "gzip"
+		}
+		return "pg_dump"
+	default:
+		return "none"
+	}
+}
+
+// writeManifests stores the manifest of a backup next to it on every backend that stored it.
+// A backup without a manifest is still usable, so failures are only logged.
+func writeManifests(ctx context.Context, backends []storage.Backend, results []storage.Result, backupPath string, manifest storage.Manifest, logger zerolog.Logger) {
+	stored := make(map[string]bool)
+	for _, result := range results {
+		if result.Success {
+			stored[result.BackendName] = true
+		}
+	}
+
+	for _, backend := range backends {
+		if !stored[backend.Name()] {
+			continue
+		}
+		if err := storage.WriteManifest(ctx, backend, backupPath, manifest); err != nil {
+			logger.Warn().
+				Err(err).
+				Str("backend", backend.Name()).
+				Str("file", backupPath).
+				Msg("failed to write backup manifest")
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/williamokano/pg_backuper/pkg/config"
+	"github.com/williamokano/pg_backuper/pkg/dumpformat"
+	"github.com/williamokano/pg_backuper/pkg/storage"
+)
+
+func TestDigest(t *testing.T) {
+	data := bytes.Repeat([]byte("PGDMP"), 1000)
+	want := sha256.Sum256(data)
+
+	sum := newDigest()
+	sum.Write(data[:10])
+	sum.Write(data[10:])
+
+	assert.Equal(t, int64(len(data)), sum.size)
+	assert.Equal(t, hex.EncodeToString(want[:]), sum.Sum())
+
+	path := filepath.Join(t.TempDir(), "backup")
+	require.NoError(t, os.WriteFile(path, data, 0600))
+	fromFile, err := hashFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, sum.Sum(), fromFile.Sum())
+	assert.Equal(t, sum.size, fromFile.size)
+}
+
+func TestDumpCompression(t *testing.T) {
+	assert.Equal(t, "pg_dump", dumpCompression(dumpformat.Custom, false))
+	assert.Equal(t, "pg_dump", dumpCompression(dumpformat.Directory, false))
+	assert.Equal(t, "gzip", dumpCompression(dumpformat.Directory, true))
+	assert.Equal(t, "none", dumpCompression(dumpformat.Plain, false))
+}
+
+func TestWriteManifests(t *testing.T) {
+	ctx := context.Background()
+	primaryDir := t.TempDir()
+	offsiteDir := t.TempDir()
+	cfg := &config.Config{
+		Storage: config.StorageConfig{
+			Destinations: []config.StorageDestination{
+				{Name: "primary", Type: "local", Enabled: true, Options: map[string]interface{}{"path": primaryDir}},
+				{Name: "offsite", Type: "local", Enabled: true, Options: map[string]interface{}{"path": offsiteDir}},
+			},
+		},
+	}
+
+	var backends []storage.Backend
+	for _, name := range []string{"primary", "offsite"} {
+		backend, err := InitializeDestination(ctx, cfg, name)
+		require.NoError(t, err)
+		defer backend.Close()
+		backends = append(backends, backend)
+	}
+
+	results := []storage.Result{
+		{BackendName: "primary", Success: true},
+		{BackendName: "offsite", Error: errors.New("upload failed")},
+	}
+	manifest := storage.Manifest{Database: "app", Tier: "daily", Size: 42, SHA256: "abc"}
+
+	writeManifests(ctx, backends, results, "app--daily--2025-03-09T02-00-00.dump", manifest, zerolog.Nop())
+
+	stored, err := storage.ReadManifest(ctx, backends[0], "app--daily--2025-03-09T02-00-00.dump")
+	require.NoError(t, err)
+	assert.Equal(t, manifest, *stored)
+
+	_, err = storage.ReadManifest(ctx, backends[1], "app--daily--2025-03-09T02-00-00.dump")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
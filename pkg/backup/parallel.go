@@ -12,12 +12,21 @@ import (
 	"github.com/williamokano/pg_backuper/pkg/config"
 )
 
-// BackupAllDatabases performs backups of all enabled databases in parallel
-// with concurrency control via semaphore
+// BackupAllDatabases performs backups of all enabled databases (static and discovered)
+// in parallel with concurrency control via semaphore
 func BackupAllDatabases(ctx context.Context, cfg *config.Config, timestamp time.Time, logger zerolog.Logger) ([]Result, error) {
+	databases, discoveryFailures := ExpandDatabases(ctx, cfg, logger)
+
+	results, err := BackupDatabases(ctx, cfg, databases, timestamp, logger)
+	return append(discoveryFailures, results...), err
+}
+
+// BackupDatabases performs backups of the given databases in parallel, skipping disabled
+// ones and those without due tiers
+func BackupDatabases(ctx context.Context, cfg *config.Config, databases []config.DatabaseConfig, timestamp time.Time, logger zerolog.Logger) ([]Result, error) {
 	// Filter enabled databases
 	var enabledDBs []config.DatabaseConfig
-	for _, db := range cfg.Databases {
+	for _, db := range databases {
 		if db.IsEnabled() {
 			enabledDBs = append(enabledDBs, db)
 		} else {
@@ -64,7 +73,9 @@ func BackupAllDatabases(ctx context.Context, cfg *config.Config, timestamp time.
 			}
 
 			// Check which tiers are due for backup
-			schedule, err := GetDueTiers(cfg, db, timestamp, logger)
+			// The parent ctx (not gCtx) is used from here on: a failure of another
+			// database stops pending backups, but never interrupts a running one
+			schedule, err := GetDueTiers(ctx, cfg, db, timestamp, logger)
 			if err != nil {
 				logger.Warn().
 					Err(err).
@@ -80,8 +91,8 @@ func BackupAllDatabases(ctx context.Context, cfg *config.Config, timestamp time.
 				return nil
 			}
 
-			if len(schedule.Due) == 0 {
-				// No tiers due, skip backup
+			if len(schedule.Due) == 0 && len(schedule.Backfill) == 0 {
+				// No tiers due and no copies missing, skip backup
 				// (detailed logging already done in GetDueTiers)
 				resultsChan <- Result{
 					Database: db.Name,
@@ -92,8 +103,8 @@ func BackupAllDatabases(ctx context.Context, cfg *config.Config, timestamp time.
 				return nil
 			}
 
-			// Perform backup for all due tiers
-			result := BackupDatabase(cfg, db, timestamp, schedule.Due, logger)
+			// Backfill missing copies and perform backup for all due tiers
+			result := backupDatabase(ctx, cfg, db, timestamp, schedule, logger)
 			resultsChan <- result
 
 			// If backup failed, return error (will cancel other operations)
@@ -0,0 +1,160 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/williamokano/pg_backuper/pkg/config"
+	"github.com/williamokano/pg_backuper/pkg/encryption"
+	"github.com/williamokano/pg_backuper/pkg/restoretest"
+	"github.com/williamokano/pg_backuper/pkg/rotation"
+	"github.com/williamokano/pg_backuper/pkg/storage"
+)
+
+// RestoreTestOptions defines which databases "pg_backuper restore-test" tests
+type RestoreTestOptions struct {
+	Database    string // Only this database, tested even when restore tests are not enabled for it (optional)
+	Destination string // Storage destination to fetch backups from (default: the database's first destination)
+}
+
+// restoreTestTier returns the completed tier whose backup is test-restored, or "" when
+// restore tests are disabled for db or none of its tested tiers completed
+func restoreTestTier(cfg *config.Config, db config.DatabaseConfig, completed []string) string {
+	if cfg.RestoreTest == nil || !db.IsRestoreTested() {
+		return ""
+	}
+	tiers := db.GetRestoreTestTiers(cfg)
+	for _, tier := range completed {
+		if len(tiers) == 0 || slices.Contains(tiers, tier) {
+			return tier
+		}
+	}
+	return ""
+}
+
+// testRestore test-restores the backup just stored for a tested tier, from the first
+// backend that stored it, and records the outcome in result
+func testRestore(ctx context.Context, cfg *config.Config, db config.DatabaseConfig, backends []storage.Backend, timestamp time.Time, keyring *encryption.Keyring, pgpassPath string, result *Result, logger zerolog.Logger) {
+	tier := restoreTestTier(cfg, db, result.TiersCompleted)
+	if tier == "" {
+		return
+	}
+
+	stored := make(map[string]bool)
+	for _, ur := range result.BackendResults[tier] {
+		if ur.Success {
+			stored[ur.BackendName] = true
+		}
+	}
+	for _, backend := range backends {
+		if !stored[backend.Name()] {
+			continue
+		}
+		target := restoretest.Target{Backend: backend, Path: rotation.DatabaseNaming(db.Name).Filename(tier, timestamp)}
+		outcome := restoretest.Run(ctx, cfg, db, target, keyring, pgpassPath, logger.With().Str("tier", tier).Logger())
+		result.RestoreTest = &outcome
+		return
+	}
+}
+
+// TestRestores test-restores the newest backup of each selected database
+func TestRestores(ctx context.Context, cfg *config.Config, opts RestoreTestOptions, logger zerolog.Logger) ([]restoretest.Result, error) {
+	if cfg.RestoreTest == nil {
+		return nil, errors.New("no restore_test server configured")
+	}
+
+	var databases []config.DatabaseConfig
+	for _, db := range cfg.Databases {
+		if opts.Database != "" {
+			if db.Name == opts.Database {
+				databases = append(databases, db)
+			}
+		} else if db.IsRestoreTested() {
+			databases = append(databases, db)
+		}
+	}
+	if len(databases) == 0 {
+		if opts.Database != "" {
+			return nil, fmt.Errorf("database %s not found in config", opts.Database)
+		}
+		return nil, errors.New("no databases have restore tests enabled")
+	}
+
+	pgpassPath, err := GetPgpassPath(cfg.GetPgpassFile())
+	if err != nil {
+		return nil, fmt.Errorf(".pgpass file not found: %w", err)
+	}
+	if err := ValidatePgpassPermissions(pgpassPath); err != nil {
+		return nil, fmt.Errorf(".pgpass file has incorrect permissions: %w", err)
+	}
+
+	keyring, err := LoadKeyring(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]restoretest.Result, 0, len(databases))
+	for _, db := range databases {
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+		results = append(results, testLatest(ctx, cfg, db, opts.Destination, keyring, pgpassPath, logger))
+	}
+	return results, nil
+}
+
+// testLatest test-restores the newest backup of db on a destination
+func testLatest(ctx context.Context, cfg *config.Config, db config.DatabaseConfig, destination string, keyring *encryption.Keyring, pgpassPath string, logger zerolog.Logger) restoretest.Result {
+	result := restoretest.Result{Database: db.Name, Destination: destination}
+	if destination == "" {
+		if dests := db.GetStorageDestinations(cfg); len(dests) > 0 {
+			destination = dests[0]
+		}
+		result.Destination = destination
+	}
+
+	backend, err := InitializeDestination(ctx, cfg, destination)
+	if err != nil {
+		result.Error = fmt.Errorf("failed to initialize storage destination: %w", err)
+		return result
+	}
+	defer backend.Close()
+
+	path, err := latestBackup(ctx, backend, db.Name)
+	if err != nil {
+		result.Error = err
+		return result
+	}
+
+	return restoretest.Run(ctx, cfg, db, restoretest.Target{Backend: backend, Path: path}, keyring, pgpassPath, logger)
+}
+
+// latestBackup returns the path of the newest backup of a database on a backend, by
+// filename timestamp rather than modification time, which reflects upload time
+func latestBackup(ctx context.Context, backend storage.Backend, dbName string) (string, error) {
+	files, err := backend.List(ctx, rotation.DatabaseNaming(dbName).Pattern())
+	if err != nil {
+		return "", fmt.Errorf("failed to list backups on %s: %w", backend.Name(), err)
+	}
+
+	var latest string
+	var latestTime time.Time
+	for _, file := range files {
+		components, err := rotation.ParseBackupFilename(file.Path)
+		if err != nil || components.DatabaseName != dbName || components.Kind != "" {
+			continue
+		}
+		if latest == "" || components.Timestamp.After(latestTime) {
+			latest = file.Path
+			latestTime = components.Timestamp
+		}
+	}
+	if latest == "" {
+		return "", fmt.Errorf("no backups found for database %s on %s", dbName, backend.Name())
+	}
+	return latest, nil
+}
@@ -0,0 +1,80 @@
+package backup
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/williamokano/pg_backuper/pkg/config"
+	"github.com/williamokano/pg_backuper/pkg/rotation"
+)
+
+func TestRestoreTestTier(t *testing.T) {
+	server := &config.RestoreTestConfig{Host: "scratch.internal", User: "restore_tester", Tiers: []string{"weekly", "monthly"}}
+	tested := config.DatabaseConfig{Name: "app", RestoreTest: &config.DatabaseRestoreTest{Enabled: true}}
+
+	tests := []struct {
+		name      string
+		server    *config.RestoreTestConfig
+		db        config.DatabaseConfig
+		completed []string
+		want      string
+	}{
+		{name: "tested_tier_completed", server: server, db: tested, completed: []string{"daily", "weekly"}, want: "weekly"},
+		{name: "no_tested_tier_completed", server: server, db: tested, completed: []string{"daily"}, want: ""},
+		{name: "every_tier_without_tiers", server: &config.RestoreTestConfig{Host: "scratch.internal"}, db: tested, completed: []string{"hourly", "daily"}, want: "hourly"},
+		{
+			name:      "database_tiers_override",
+			server:    server,
+			db:        config.DatabaseConfig{Name: "app", RestoreTest: &config.DatabaseRestoreTest{Enabled: true, Tiers: []string{"daily"}}},
+			completed: []string{"daily", "weekly"},
+			want:      "daily",
+		},
+		{name: "disabled_for_database", server: server, db: config.DatabaseConfig{Name: "app"}, completed: []string{"weekly"}, want: ""},
+		{name: "no_test_server", server: nil, db: tested, completed: []string{"weekly"}, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{RestoreTest: tt.server}
+			assert.Equal(t, tt.want, restoreTestTier(cfg, tt.db, tt.completed))
+		})
+	}
+}
+
+func TestLatestBackup(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	cfg := &config.Config{
+		Storage: config.StorageConfig{
+			Destinations: []config.StorageDestination{
+				{Name: "primary", Type: "local", Enabled: true, Options: map[string]interface{}{"path": dir}},
+			},
+		},
+	}
+	backend, err := InitializeDestination(ctx, cfg, "primary")
+	require.NoError(t, err)
+	defer backend.Close()
+
+	_, err = latestBackup(ctx, backend, "app")
+	assert.ErrorContains(t, err, "no backups found for database app")
+
+	app := rotation.DatabaseNaming("app")
+	newest := app.Filename("daily", time.Date(2025, 3, 9, 2, 0, 0, 0, time.UTC))
+	for _, name := range []string{
+		app.Filename("weekly", time.Date(2025, 3, 2, 2, 0, 0, 0, time.UTC)),
+		newest,
+		newest + ".pin",
+		rotation.DatabaseNaming("app-old").Filename("daily", time.Date(2025, 3, 10, 2, 0, 0, 0, time.UTC)),
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("PGDMP"), 0644))
+	}
+
+	latest, err := latestBackup(ctx, backend, "app")
+	require.NoError(t, err)
+	assert.Equal(t, newest, latest)
+}
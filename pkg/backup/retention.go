@@ -0,0 +1,71 @@
+package backup
+
+import (
+	"github.com/williamokano/pg_backuper/pkg/config"
+	"github.com/williamokano/pg_backuper/pkg/discovery"
+	"github.com/williamokano/pg_backuper/pkg/rotation"
+)
+
+// RetentionFor returns the retention tiers of the configured source a backup naming belongs to.
+// Discovered databases are matched against the include/exclude patterns and overrides of the
+// logical-mode servers without connecting to them. Returns false if no configured source matches.
+func RetentionFor(cfg *config.Config, naming rotation.Naming) ([]config.RetentionTier, bool) {
+	switch naming.Kind {
+	case rotation.KindGlobals:
+		for _, target := range GlobalsTargets(cfg) {
+			if target.Naming().Name == naming.Name {
+				return cfg.Globals.GetRetentionTiers(cfg.GlobalDefaults), true
+			}
+		}
+		return nil, false
+
+	case rotation.KindBasebackup:
+		for _, server := range cfg.Servers {
+			if server.GetMode() != config.ModeBasebackup {
+				continue
+			}
+			if basebackupArtifact(cfg, server).naming.Name == naming.Name {
+				return server.GetRetentionTiers(cfg.GlobalDefaults), true
+			}
+		}
+		return nil, false
+
+	case "":
+		for _, db := range cfg.Databases {
+			if db.Name == naming.Name {
+				return db.GetRetentionTiers(cfg.GlobalDefaults), true
+			}
+		}
+		for _, server := range cfg.Servers {
+			if server.GetMode() != config.ModeLogical {
+				continue
+			}
+			selected, _, err := discovery.Select(server, []discovery.Database{{Name: naming.Name}})
+			if err != nil || len(selected) == 0 {
+				continue
+			}
+			return selected[0].GetRetentionTiers(cfg.GlobalDefaults), true
+		}
+		return nil, false
+	}
+
+	return nil, false
+}
+
+// RotationGuards returns the deletion guards of rotation for a configuration
+func RotationGuards(cfg *config.Config) rotation.Guards {
+	tiers, err := cfg.GetTiers()
+	if err != nil {
+		// require_recent then only checks built-in tiers; custom ones are not looked up
+		tiers = config.BuiltinTiers
+	}
+
+	return rotation.Guards{
+		KeepLast:         cfg.Rotation.GetKeepLast(),
+		MaxDeleteFiles:   cfg.Rotation.MaxDeleteFiles,
+		MaxDeletePercent: cfg.Rotation.MaxDeletePercent,
+		RequireRecent:    cfg.Rotation.RequireRecent,
+		Tiers:            tiers,
+		AllowMassDelete:  cfg.AllowMassDelete,
+	}
+}
@@ -0,0 +1,48 @@
+package backup
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/williamokano/pg_backuper/pkg/config"
+	"github.com/williamokano/pg_backuper/pkg/rotation"
+)
+
+func TestRetentionFor(t *testing.T) {
+	daily := []config.RetentionTier{{Tier: "daily", Retention: 7}}
+	weekly := []config.RetentionTier{{Tier: "weekly", Retention: 4}}
+	monthly := []config.RetentionTier{{Tier: "monthly", Retention: 12}}
+
+	cfg := &config.Config{
+		GlobalDefaults: config.GlobalDefaults{RetentionTiers: daily},
+		Databases:      []config.DatabaseConfig{{Name: "app", Host: "db1", Enabled: true}},
+		Servers: []config.ServerConfig{
+			{Host: "db2", Include: []string{"shop_*"}, Overrides: []config.DatabaseOverride{{Pattern: "shop_eu", RetentionTiers: monthly}}},
+			{Host: "db3", Mode: config.ModeBasebackup, RetentionTiers: weekly},
+		},
+		Globals: config.GlobalsConfig{Enabled: true, RetentionTiers: monthly},
+	}
+
+	tests := []struct {
+		name   string
+		naming rotation.Naming
+		want   []config.RetentionTier
+		wantOK bool
+	}{
+		{name: "static database", naming: rotation.DatabaseNaming("app"), want: daily, wantOK: true},
+		{name: "discovered database", naming: rotation.DatabaseNaming("shop_us"), want: daily, wantOK: true},
+		{name: "discovered database with override", naming: rotation.DatabaseNaming("shop_eu"), want: monthly, wantOK: true},
+		{name: "not included by discovery", naming: rotation.DatabaseNaming("analytics")},
+		{name: "base backup", naming: rotation.BasebackupNaming("db3", 5432), want: weekly, wantOK: true},
+		{name: "globals", naming: rotation.GlobalsNaming("db1", 5432), want: monthly, wantOK: true},
+		{name: "unknown globals", naming: rotation.GlobalsNaming("db9", 5432)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := RetentionFor(cfg, tt.naming)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package backup
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/williamokano/pg_backuper/pkg/config"
+)
+
+// BackupAll runs every backup that is due: cluster globals first (so every database dump
+// has matching roles), then base backups, then the database dumps in parallel
+func BackupAll(ctx context.Context, cfg *config.Config, timestamp time.Time, logger zerolog.Logger) ([]Result, error) {
+	results := BackupAllGlobals(ctx, cfg, timestamp, logger)
+	results = append(results, BackupAllBasebackups(ctx, cfg, timestamp, logger)...)
+
+	dbResults, err := BackupAllDatabases(ctx, cfg, timestamp, logger)
+	return append(results, dbResults...), err
+}
+
+// PlannedBackup is the schedule of one backup source
+type PlannedBackup struct {
+	Name     string // Database name, or host identifier for server artifacts
+	Kind     string // Empty for database dumps, e.g. "globals" otherwise
+	Schedule TierSchedule
+	Err      error // Set if the schedule could not be determined
+}
+
+// Plan evaluates the schedule of every source BackupAll would back up, without running anything
+func Plan(ctx context.Context, cfg *config.Config, now time.Time, logger zerolog.Logger) []PlannedBackup {
+	var planned []PlannedBackup
+
+	if cfg.Globals.Enabled {
+		for _, target := range GlobalsTargets(cfg) {
+			planned = append(planned, planArtifact(ctx, cfg, globalsArtifact(cfg, target), now, logger))
+		}
+	}
+
+	for _, server := range cfg.Servers {
+		if server.GetMode() == config.ModeBasebackup {
+			planned = append(planned, planArtifact(ctx, cfg, basebackupArtifact(cfg, server), now, logger))
+		}
+	}
+
+	databases, failures := ExpandDatabases(ctx, cfg, logger)
+	for _, failure := range failures {
+		planned = append(planned, PlannedBackup{Name: failure.Database, Kind: failure.Kind, Err: failure.Error})
+	}
+	for _, db := range databases {
+		if !db.IsEnabled() {
+			continue
+		}
+		schedule, err := GetDueTiers(ctx, cfg, db, now, logger)
+		planned = append(planned, PlannedBackup{Name: db.Name, Schedule: schedule, Err: err})
+	}
+
+	return planned
+}
+
+// planArtifact evaluates the schedule of a server artifact
+func planArtifact(ctx context.Context, cfg *config.Config, artifact serverArtifact, now time.Time, logger zerolog.Logger) PlannedBackup {
+	planned := PlannedBackup{Name: artifact.naming.Name, Kind: artifact.naming.Kind}
+
+	backends, err := initializeBackends(ctx, cfg, artifact.pseudoDatabase(), logger)
+	if err != nil {
+		planned.Err = err
+		return planned
+	}
+	defer closeBackends(backends)
+
+	planned.Schedule = artifact.schedule(ctx, cfg, backends, now, logger)
+	return planned
+}
+
+// NextRun returns the earliest time any tier becomes due, or the zero time if no tier is scheduled
+func (s TierSchedule) NextRun() time.Time {
+	var next time.Time
+	for _, t := range s.Next {
+		if next.IsZero() || t.Before(next) {
+			next = t
+		}
+	}
+	return next
+}
@@ -14,30 +14,76 @@ import (
 	"github.com/williamokano/pg_backuper/pkg/storage"
 )
 
-// TierInterval maps tier names to their durations
-var TierInterval = map[string]time.Duration{
-	"hourly":    1 * time.Hour,
-	"daily":     24 * time.Hour,
-	"weekly":    7 * 24 * time.Hour,
-	"monthly":   30 * 24 * time.Hour,
-	"quarterly": 90 * 24 * time.Hour,
-	"yearly":    365 * 24 * time.Hour,
-}
-
-// TierOrder defines the priority order of tiers (shortest first)
-var TierOrder = []string{"hourly", "daily", "weekly", "monthly", "quarterly", "yearly"}
-
 // TierSchedule represents which tiers are due for backup
 type TierSchedule struct {
-	Due  []string              // List of tier names that are due (e.g., ["hourly", "daily"])
-	Next map[string]time.Time  // When each configured tier becomes due next
+	Due      []string             // List of tier names that are due (e.g., ["hourly", "daily"])
+	Next     map[string]time.Time // When each configured tier becomes due next
+	Backfill []Backfill           // Stored backups missing on some destinations
 }
 
 // GetDueTiers checks which tiers are due for backup for a database.
 // Returns a TierSchedule with the list of due tiers and next backup times.
-func GetDueTiers(cfg *config.Config, db config.DatabaseConfig, now time.Time, logger zerolog.Logger) (TierSchedule, error) {
-	ctx := context.Background()
+// Due tiers outside the database's backup windows are deferred to the next allowed window.
+func GetDueTiers(ctx context.Context, cfg *config.Config, db config.DatabaseConfig, now time.Time, logger zerolog.Logger) (TierSchedule, error) {
+	schedule, err := getDueTiers(ctx, cfg, db, now, logger)
+	if err != nil {
+		return schedule, err
+	}
+	return deferToWindow(cfg, db, schedule, now, logger), nil
+}
+
+// deferToWindow moves due tiers to the next allowed window when backups may not start now
+func deferToWindow(cfg *config.Config, db config.DatabaseConfig, schedule TierSchedule, now time.Time, logger zerolog.Logger) TierSchedule {
+	windowConfig := db.GetWindows(cfg.GlobalDefaults)
+	if windowConfig == nil || len(schedule.Due) == 0 {
+		return schedule
+	}
+
+	windows, err := parseWindows(windowConfig, cfg.GlobalDefaults)
+	if err != nil {
+		// Backing up outside a window beats not backing up at all
+		logger.Warn().
+			Err(err).
+			Str("database", db.Name).
+			Msg("invalid backup windows, ignoring them")
+		return schedule
+	}
 
+	if windows.allows(now) {
+		return schedule
+	}
+
+	if cfg.IgnoreWindows {
+		logger.Info().
+			Str("database", db.Name).
+			Strs("due_tiers", schedule.Due).
+			Msg("outside backup window, running anyway (windows ignored)")
+		return schedule
+	}
+
+	next := windows.nextAllowed(now)
+	event := logger.Info().
+		Str("database", db.Name).
+		Strs("deferred_tiers", schedule.Due)
+	if next.IsZero() {
+		event.Msg("backup deferred, windows never allow a backup")
+	} else {
+		event.Time("next_window", next).Msg("backup deferred until next allowed window")
+	}
+
+	for _, tier := range schedule.Due {
+		if next.IsZero() {
+			delete(schedule.Next, tier)
+		} else {
+			schedule.Next[tier] = next
+		}
+	}
+	schedule.Due = []string{}
+	return schedule
+}
+
+// getDueTiers checks which tiers are due for a database, regardless of backup windows
+func getDueTiers(ctx context.Context, cfg *config.Config, db config.DatabaseConfig, now time.Time, logger zerolog.Logger) (TierSchedule, error) {
 	// Get retention tiers for this database (with fallback to global)
 	retentionTiers := db.GetRetentionTiers(cfg.GlobalDefaults)
 
@@ -60,7 +106,7 @@ func GetDueTiers(cfg *config.Config, db config.DatabaseConfig, now time.Time, lo
 		return getDueTiersFileBased(cfg, db, now, logger, retentionTiers)
 	}
 
-	// Initialize a backend for checking due tiers (use first configured backend)
+	// Initialize the backends to check due tiers on each destination
 	backends, err := initializeBackends(ctx, cfg, db, logger)
 	if err != nil {
 		// Fallback to old file-based approach if backend initialization fails
@@ -69,27 +115,37 @@ func GetDueTiers(cfg *config.Config, db config.DatabaseConfig, now time.Time, lo
 	}
 	defer closeBackends(backends)
 
-	// Use the first backend to check for due tiers
-	backend := backends[0]
+	return getDueTiersAcrossBackends(ctx, cfg, backends, rotation.DatabaseNaming(db.Name), retentionTiers, now, logger), nil
+}
+
+// getDueTiersWithBackend checks which tiers of a backup source are due using the files on a backend
+func getDueTiersWithBackend(ctx context.Context, cfg *config.Config, backend storage.Backend, naming rotation.Naming, retentionTiers []config.RetentionTier, now time.Time, logger zerolog.Logger) TierSchedule {
+	schedule := TierSchedule{
+		Due:  []string{},
+		Next: make(map[string]time.Time),
+	}
+
+	tiers := tierDefinitions(cfg, logger)
 
 	// Check each configured tier independently
 	for _, retentionTier := range retentionTiers {
 		tierName := retentionTier.Tier
-		interval, ok := TierInterval[tierName]
+		tier, ok := tiers.Lookup(tierName)
 		if !ok {
 			logger.Warn().
-				Str("database", db.Name).
+				Str("database", naming.Name).
 				Str("tier", tierName).
 				Msg("unknown tier name, skipping")
 			continue
 		}
+		interval := tier.Interval
 
 		// Find last backup for this specific tier using backend
-		lastBackupTime, err := findLastBackupTimeByTierWithBackend(ctx, backend, db.Name, tierName)
+		lastBackupTime, err := findLastBackupTimeByTierWithBackend(ctx, backend, naming, tierName)
 		if err != nil {
 			logger.Warn().
 				Err(err).
-				Str("database", db.Name).
+				Str("database", naming.Name).
 				Str("tier", tierName).
 				Str("backend", backend.Name()).
 				Msg("error finding last backup for tier, assuming due")
@@ -98,15 +154,33 @@ func GetDueTiers(cfg *config.Config, db config.DatabaseConfig, now time.Time, lo
 			continue
 		}
 
+		if retentionTier.IsAnchored() || tier.Calendar {
+			if anchor, ok := tierAnchor(retentionTier, tier, naming.Name, logger); ok {
+				isDue, next := anchoredSchedule(anchor, lastBackupTime, now.In(scheduleLocation(cfg)))
+				logger.Info().
+					Str("database", naming.Name).
+					Str("tier", tierName).
+					Time("last_backup", lastBackupTime).
+					Bool("due", isDue).
+					Time("next_backup", next).
+					Msg("evaluated calendar-anchored tier")
+				if isDue {
+					schedule.Due = append(schedule.Due, tierName)
+				}
+				schedule.Next[tierName] = next
+				continue
+			}
+		}
+
 		// Special handling for yearly tier: also check if ANY backup is older than 365 days
 		if tierName == "yearly" && !lastBackupTime.IsZero() {
-			oldestBackup, err := findOldestBackup(cfg.BackupDir, db.Name)
+			oldestBackup, err := findOldestBackup(cfg.BackupDir, naming.Name)
 			if err == nil && !oldestBackup.IsZero() {
 				ageOfOldest := now.Sub(oldestBackup)
 				if ageOfOldest >= interval {
 					// We have a backup that's old enough to satisfy yearly retention
 					logger.Debug().
-						Str("database", db.Name).
+						Str("database", naming.Name).
 						Time("oldest_backup", oldestBackup).
 						Dur("age", ageOfOldest).
 						Msg("yearly tier satisfied by aged backup")
@@ -120,7 +194,7 @@ func GetDueTiers(cfg *config.Config, db config.DatabaseConfig, now time.Time, lo
 		if lastBackupTime.IsZero() {
 			// No previous backup found for this tier, backup is due
 			logger.Info().
-				Str("database", db.Name).
+				Str("database", naming.Name).
 				Str("tier", tierName).
 				Msg("no previous backup found for tier, backup is due")
 			schedule.Due = append(schedule.Due, tierName)
@@ -134,7 +208,7 @@ func GetDueTiers(cfg *config.Config, db config.DatabaseConfig, now time.Time, lo
 
 		if isDue {
 			logger.Info().
-				Str("database", db.Name).
+				Str("database", naming.Name).
 				Str("tier", tierName).
 				Dur("interval", interval).
 				Time("last_backup", lastBackupTime).
@@ -146,7 +220,7 @@ func GetDueTiers(cfg *config.Config, db config.DatabaseConfig, now time.Time, lo
 			timeUntilDue := interval - timeSinceLastBackup
 			nextBackupTime := lastBackupTime.Add(interval)
 			logger.Info().
-				Str("database", db.Name).
+				Str("database", naming.Name).
 				Str("tier", tierName).
 				Dur("interval", interval).
 				Time("last_backup", lastBackupTime).
@@ -158,14 +232,50 @@ func GetDueTiers(cfg *config.Config, db config.DatabaseConfig, now time.Time, lo
 		}
 	}
 
-	return schedule, nil
+	return schedule
+}
+
+// tierAnchor parses the calendar anchor of a tier. An invalid anchor is logged and the
+// tier falls back to its interval, so a misconfigured tier still gets backed up.
+func tierAnchor(rt config.RetentionTier, tier config.Tier, name string, logger zerolog.Logger) (calendarAnchor, bool) {
+	anchor, err := parseAnchor(rt, tier)
+	if err != nil {
+		logger.Warn().
+			Err(err).
+			Str("database", name).
+			Str("tier", rt.Tier).
+			Msg("invalid calendar anchor, using interval schedule")
+		return anchor, false
+	}
+	return anchor, true
+}
+
+// tierDefinitions returns the built-in and configured tiers
+func tierDefinitions(cfg *config.Config, logger zerolog.Logger) config.Tiers {
+	tiers, err := cfg.GetTiers()
+	if err != nil {
+		// Databases that only use built-in tiers keep being backed up
+		logger.Warn().Err(err).Msg("invalid tier definitions, using built-in tiers")
+		return config.BuiltinTiers
+	}
+	return tiers
+}
+
+// scheduleLocation returns the timezone of calendar-anchored tiers
+func scheduleLocation(cfg *config.Config) *time.Location {
+	loc, err := cfg.GlobalDefaults.GetLocation()
+	if err != nil {
+		// Anchors are then evaluated in UTC, the same as when no timezone is set
+		return time.UTC
+	}
+	return loc
 }
 
 // IsBackupDue checks if a backup is due for a database based on retention tiers
 // and existing backups. Returns true if a backup should be created.
 // Deprecated: Use GetDueTiers for more detailed tier information.
 func IsBackupDue(cfg *config.Config, db config.DatabaseConfig, now time.Time, logger zerolog.Logger) (bool, error) {
-	schedule, err := GetDueTiers(cfg, db, now, logger)
+	schedule, err := GetDueTiers(context.Background(), cfg, db, now, logger)
 	if err != nil {
 		return false, err
 	}
@@ -173,14 +283,13 @@ func IsBackupDue(cfg *config.Config, db config.DatabaseConfig, now time.Time, lo
 }
 
 // findShortestTierInterval returns the shortest interval from configured retention tiers
-func findShortestTierInterval(retentionTiers []config.RetentionTier) (time.Duration, string) {
-	for _, tierName := range TierOrder {
+func findShortestTierInterval(tiers config.Tiers, retentionTiers []config.RetentionTier) (time.Duration, string) {
+	// Tiers are ordered shortest first
+	for _, tier := range tiers {
 		// Check if this tier is configured
 		for _, rt := range retentionTiers {
-			if rt.Tier == tierName {
-				if interval, ok := TierInterval[tierName]; ok {
-					return interval, tierName
-				}
+			if rt.Tier == tier.Name {
+				return tier.Interval, tier.Name
 			}
 		}
 	}
@@ -333,27 +442,28 @@ func isBackupForDatabase(filename, dbName string) bool {
 }
 
 // findLastBackupTimeByTierWithBackend finds the most recent backup timestamp for a specific tier using a storage backend
-func findLastBackupTimeByTierWithBackend(ctx context.Context, backend storage.Backend, dbName, tierName string) (time.Time, error) {
-	pattern := fmt.Sprintf("%s--%s--*.backup", dbName, tierName)
+func findLastBackupTimeByTierWithBackend(ctx context.Context, backend storage.Backend, naming rotation.Naming, tierName string) (time.Time, error) {
+	pattern := naming.TierPattern(tierName)
 
 	files, err := backend.List(ctx, pattern)
 	if err != nil {
 		return time.Time{}, fmt.Errorf("failed to list files for tier %s: %w", tierName, err)
 	}
 
-	if len(files) == 0 {
-		return time.Time{}, nil
-	}
-
-	// Files are sorted by modtime (newest first) from backend.List()
-	// Parse timestamp from newest file
-	newestFile := files[0]
-	components, err := rotation.ParseBackupFilename(newestFile.Path)
-	if err != nil {
-		return time.Time{}, err
+	// Judge by the filename timestamps: modtimes say when a file was written,
+	// which for backfilled copies is long after the backup was taken
+	var mostRecent time.Time
+	for _, file := range files {
+		components, err := rotation.ParseBackupFilename(file.Path)
+		if err != nil {
+			continue
+		}
+		if components.Timestamp.After(mostRecent) {
+			mostRecent = components.Timestamp
+		}
 	}
 
-	return components.Timestamp, nil
+	return mostRecent, nil
 }
 
 // getDueTiersFileBased is the old file-based approach for backward compatibility
@@ -363,10 +473,12 @@ func getDueTiersFileBased(cfg *config.Config, db config.DatabaseConfig, now time
 		Next: make(map[string]time.Time),
 	}
 
+	tiers := tierDefinitions(cfg, logger)
+
 	// Check each configured tier independently using the old file-based approach
 	for _, retentionTier := range retentionTiers {
 		tierName := retentionTier.Tier
-		interval, ok := TierInterval[tierName]
+		tier, ok := tiers.Lookup(tierName)
 		if !ok {
 			logger.Warn().
 				Str("database", db.Name).
@@ -374,6 +486,7 @@ func getDueTiersFileBased(cfg *config.Config, db config.DatabaseConfig, now time
 				Msg("unknown tier name, skipping")
 			continue
 		}
+		interval := tier.Interval
 
 		// Find last backup for this specific tier using old approach
 		lastBackupTime, err := findLastBackupTimeByTier(cfg.BackupDir, db.Name, tierName)
@@ -388,6 +501,17 @@ func getDueTiersFileBased(cfg *config.Config, db config.DatabaseConfig, now time
 			continue
 		}
 
+		if retentionTier.IsAnchored() || tier.Calendar {
+			if anchor, ok := tierAnchor(retentionTier, tier, db.Name, logger); ok {
+				isDue, next := anchoredSchedule(anchor, lastBackupTime, now.In(scheduleLocation(cfg)))
+				if isDue {
+					schedule.Due = append(schedule.Due, tierName)
+				}
+				schedule.Next[tierName] = next
+				continue
+			}
+		}
+
 		// Handle yearly tier
 		if tierName == "yearly" && !lastBackupTime.IsZero() {
 			oldestBackup, err := findOldestBackup(cfg.BackupDir, db.Name)
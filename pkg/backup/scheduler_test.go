@@ -11,6 +11,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/williamokano/pg_backuper/pkg/config"
+	"github.com/williamokano/pg_backuper/pkg/rotation"
 )
 
 func TestFindShortestTierInterval(t *testing.T) {
@@ -56,7 +57,7 @@ func TestFindShortestTierInterval(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			gotDuration, gotTierName := findShortestTierInterval(tt.tiers)
+			gotDuration, gotTierName := findShortestTierInterval(config.BuiltinTiers, tt.tiers)
 			assert.Equal(t, tt.wantDuration, gotDuration, "duration mismatch")
 			assert.Equal(t, tt.wantTierName, gotTierName, "tier name mismatch")
 		})
@@ -208,7 +209,7 @@ func TestIsBackupDue(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			// Create tier-specific backup files for each tier in the test
 			for _, tier := range tt.tiers {
-				filename := twoHoursAgo.Format(fmt.Sprintf("mydb--%s--2006-01-02T15-04-05.backup", tier.Tier))
+				filename := fmt.Sprintf("mydb--%s--%s.backup", tier.Tier, rotation.FormatTimestamp(twoHoursAgo))
 				filePath := filepath.Join(tmpDir, filename)
 				err := os.WriteFile(filePath, []byte("test backup data"), 0644)
 				require.NoError(t, err, "Failed to create test file")
@@ -233,7 +234,7 @@ func TestIsBackupDue(t *testing.T) {
 
 			// Clean up test files for next iteration
 			for _, tier := range tt.tiers {
-				filename := twoHoursAgo.Format(fmt.Sprintf("mydb--%s--2006-01-02T15-04-05.backup", tier.Tier))
+				filename := fmt.Sprintf("mydb--%s--%s.backup", tier.Tier, rotation.FormatTimestamp(twoHoursAgo))
 				filePath := filepath.Join(tmpDir, filename)
 				os.Remove(filePath)
 			}
@@ -0,0 +1,212 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/williamokano/pg_backuper/pkg/config"
+	"github.com/williamokano/pg_backuper/pkg/rotation"
+	"github.com/williamokano/pg_backuper/pkg/storage"
+)
+
+// serverArtifact is a cluster-wide backup of one server (globals, base backup)
+type serverArtifact struct {
+	naming              rotation.Naming
+	storageDestinations []string
+	retentionTiers      []config.RetentionTier
+	// host, port, user, tool, format and compression describe the artifact in its manifest
+	host        string
+	port        int
+	user        string
+	tool        string
+	format      string
+	compression string
+	// dump writes the artifact to outputFile
+	dump func(pgpassPath, outputFile string) error
+	// afterRotation optionally cleans up data tied to the retained artifacts (e.g. archived WAL)
+	afterRotation func(backend storage.Backend) error
+}
+
+// pseudoDatabase carries the artifact's destinations to initializeBackends
+func (a serverArtifact) pseudoDatabase() config.DatabaseConfig {
+	return config.DatabaseConfig{
+		Name:                a.naming.Name,
+		StorageDestinations: a.storageDestinations,
+	}
+}
+
+// schedule returns the due tiers of the artifact, judged by the files on its backends.
+// Due tiers outside the global backup windows are deferred to the next allowed window.
+func (a serverArtifact) schedule(ctx context.Context, cfg *config.Config, backends []storage.Backend, now time.Time, logger zerolog.Logger) TierSchedule {
+	schedule := TierSchedule{Due: []string{"default"}, Next: make(map[string]time.Time)}
+	if len(a.retentionTiers) > 0 {
+		schedule = getDueTiersAcrossBackends(ctx, cfg, backends, a.naming, a.retentionTiers, now, logger)
+	}
+	// The pseudo database has no windows of its own, so the global ones apply
+	return deferToWindow(cfg, a.pseudoDatabase(), schedule, now, logger)
+}
+
+// backupServerArtifact creates a server artifact for every due tier, stores it as
+// name--KIND--TIER--timestamp.ext and applies retention, like BackupDatabase does for dumps
+func backupServerArtifact(ctx context.Context, cfg *config.Config, artifact serverArtifact, timestamp time.Time, logger zerolog.Logger) Result {
+	start := time.Now()
+	naming := artifact.naming
+	kind := naming.Kind
+
+	result := Result{
+		Database:       naming.Name,
+		Kind:           kind,
+		Success:        false,
+		TiersCompleted: []string{},
+		TiersFailed:    []string{},
+		BackendResults: make(map[string][]storage.Result),
+	}
+
+	fail := func(err error, msg string) Result {
+		result.Error = err
+		result.Duration = time.Since(start)
+		logger.Error().Err(err).Msg(msg)
+		return result
+	}
+
+	pgpassPath, err := GetPgpassPath(cfg.GetPgpassFile())
+	if err != nil {
+		return fail(fmt.Errorf(".pgpass file not found: %w", err), "FATAL: .pgpass file not found - cannot authenticate to server")
+	}
+	if err := ValidatePgpassPermissions(pgpassPath); err != nil {
+		return fail(fmt.Errorf(".pgpass file has incorrect permissions: %w", err), "FATAL: .pgpass file must have 0600 permissions")
+	}
+
+	backends, err := initializeBackends(ctx, cfg, artifact.pseudoDatabase(), logger)
+	if err != nil {
+		return fail(fmt.Errorf("failed to initialize storage backends: %w", err), "FATAL: cannot initialize storage backends")
+	}
+	defer closeBackends(backends)
+
+	keyring, err := LoadKeyring(cfg)
+	if err != nil {
+		return fail(err, "FATAL: cannot load encryption keys")
+	}
+
+	schedule := artifact.schedule(ctx, cfg, backends, timestamp, logger)
+	dueTiers := schedule.Due
+
+	backfillDestinations(ctx, cfg, artifact.pseudoDatabase(), schedule.Backfill, &result, logger)
+
+	if len(dueTiers) == 0 {
+		logger.Debug().Msgf("no tiers due, skipping %s backup", kind)
+		result.Skipped = len(result.Backfilled) == 0
+		result.Success = true
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	logger.Info().
+		Strs("due_tiers", dueTiers).
+		Msgf("starting %s backup for due tiers", kind)
+
+	tempDir := cfg.GetTempDir()
+	if err := os.MkdirAll(tempDir, 0755); err != nil {
+		return fail(fmt.Errorf("failed to create temp directory: %w", err), "FATAL: cannot create temp directory")
+	}
+
+	tempFile := filepath.Join(tempDir, fmt.Sprintf("%s--%s--%s%s.tmp",
+		naming.Name, kind, rotation.FormatTimestamp(timestamp), naming.Ext))
+
+	uploader := storage.NewMultiUploader(logger)
+
+	uploadPath := tempFile
+	var sum *digest
+	dumpStart := time.Now()
+	dumpErr := artifact.dump(pgpassPath, tempFile)
+	dumpDuration := time.Since(dumpStart)
+	if dumpErr == nil {
+		uploadPath, sum, dumpErr = encryptArtifact(keyring, tempFile, logger)
+	}
+	if dumpErr == nil && sum == nil {
+		if sum, err = hashFile(uploadPath); err != nil {
+			dumpErr = fmt.Errorf("failed to checksum %s backup: %w", kind, err)
+		}
+	}
+	storeFirst := func(destPath string) ([]storage.Result, error) {
+		if dumpErr != nil {
+			return nil, dumpErr
+		}
+		return uploader.Upload(ctx, backends, uploadPath, destPath), nil
+	}
+
+	clientVersion := toolVersion(ctx, artifact.tool)
+	dbVersion := serverVersion(ctx, artifact.host, artifact.port, artifact.user, "postgres", pgpassPath)
+	describe := func(tier string) storage.Manifest {
+		return storage.Manifest{
+			Database:        naming.Name,
+			Kind:            kind,
+			Tier:            tier,
+			Host:            artifact.host,
+			Port:            artifact.port,
+			ServerVersion:   dbVersion,
+			PgDumpVersion:   clientVersion,
+			Size:            sum.size,
+			SHA256:          sum.Sum(),
+			DurationSeconds: dumpDuration.Seconds(),
+			Format:          artifact.format,
+			Compression:     artifact.compression,
+			KeyID:           keyring.ActiveKeyID(),
+			CreatedAt:       time.Now().UTC(),
+		}
+	}
+
+	storeTiers(ctx, uploader, backends, naming, dueTiers, timestamp, storeFirst, uploadPath, describe, &result, logger)
+
+	// Server artifacts are always taken from scratch, so the temp file is never kept for retry
+	os.Remove(tempFile)
+	os.Remove(uploadPath)
+
+	result.Duration = time.Since(start)
+
+	if len(result.TiersFailed) > 0 {
+		result.Error = fmt.Errorf("%d of %d tier %s backups failed", len(result.TiersFailed), len(dueTiers), kind)
+		logger.Error().
+			Strs("completed_tiers", result.TiersCompleted).
+			Strs("failed_tiers", result.TiersFailed).
+			Dur("duration", result.Duration).
+			Msgf("%s backup completed with failures", kind)
+	} else {
+		result.Success = true
+		logger.Info().
+			Strs("completed_tiers", result.TiersCompleted).
+			Dur("duration", result.Duration).
+			Msgf("%s backup completed successfully", kind)
+	}
+
+	// CRITICAL: Never delete old backups if all new backups failed
+	if len(result.TiersCompleted) > 0 && len(artifact.retentionTiers) > 0 {
+		guards := RotationGuards(cfg)
+		for _, backend := range backends {
+			blocked, err := rotation.ApplyGuardedRetention(ctx, backend, naming, artifact.retentionTiers, guards, logger)
+			result.Blocked = append(result.Blocked, blocked...)
+			if err != nil {
+				logger.Error().
+					Err(err).
+					Str("backend", backend.Name()).
+					Msg("rotation failed for backend")
+				continue
+			}
+			if artifact.afterRotation == nil {
+				continue
+			}
+			if err := artifact.afterRotation(backend); err != nil {
+				logger.Error().
+					Err(err).
+					Str("backend", backend.Name()).
+					Msg("cleanup after rotation failed for backend")
+			}
+		}
+	}
+
+	return result
+}
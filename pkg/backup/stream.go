@@ -0,0 +1,134 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/williamokano/pg_backuper/pkg/config"
+	"github.com/williamokano/pg_backuper/pkg/storage"
+)
+
+// errDumpAbandoned is reported when every destination failed before pg_dump finished
+var errDumpAbandoned = errors.New("pg_dump aborted: no destination accepted the stream")
+
+// streamPgDump runs pg_dump with its output piped to every backend, without a temp file.
+// Returns the per-backend results, or an error if pg_dump itself failed; in that
+// case backends have received the error mid-stream and discarded their partial objects.
+// The stored bytes are also written to sum.
+func streamPgDump(ctx context.Context, uploader *storage.MultiUploader, backends []storage.Backend, db config.DatabaseConfig, opts dumpOptions, pgpassPath, tempDir string, timestamp time.Time, destPath string, sum io.Writer, logger zerolog.Logger) ([]storage.Result, error) {
+	dumpCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	cmd, err := newPgDumpCmd(dumpCtx, db, opts, pgpassPath, "")
+	if err != nil {
+		return nil, err
+	}
+
+	// Only stderr goes to the log, stdout carries the archive
+	logFile := openDumpLog(tempDir, db.Name, timestamp, logger)
+	if logFile != nil {
+		defer logFile.Close()
+		cmd.Stderr = logFile
+	} else {
+		cmd.Stderr = os.Stderr
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("pg_dump failed: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("pg_dump failed: %w", err)
+	}
+
+	reader := &dumpReader{stdout: stdout, cmd: cmd}
+	var body io.Reader = reader
+	if opts.keyring.Enabled() {
+		// pg_dump failures surface through the encrypting reader as read errors
+		if body, err = opts.keyring.Encrypt(reader); err != nil {
+			reader.Close()
+			return nil, fmt.Errorf("failed to encrypt backup: %w", err)
+		}
+	}
+	// The checksum covers the stored bytes, after encryption
+	results := uploader.UploadStream(ctx, backends, io.TeeReader(body, sum), destPath)
+
+	// Stops pg_dump if every destination failed before it finished
+	if err := reader.Close(); err != nil {
+		return results, err
+	}
+
+	logger.Info().
+		Int64("size_bytes", reader.size).
+		Msg("backup streamed to destinations")
+
+	return results, nil
+}
+
+// dumpReader reads pg_dump's stdout and reports the command's outcome in place of EOF,
+// so a failed or empty dump reaches backends as an error before they commit the object
+type dumpReader struct {
+	stdout io.Reader
+	cmd    *exec.Cmd
+	size   int64
+	done   bool
+	err    error // outcome once done; nil on success
+}
+
+func (d *dumpReader) Read(p []byte) (int, error) {
+	if d.done {
+		if d.err != nil {
+			return 0, d.err
+		}
+		return 0, io.EOF
+	}
+
+	n, err := d.stdout.Read(p)
+	d.size += int64(n)
+	if err == io.EOF {
+		d.finish(d.cmd.Wait())
+		if d.err != nil {
+			return n, d.err
+		}
+		return n, io.EOF
+	}
+	if err != nil {
+		d.finish(d.kill(err))
+	}
+	return n, err
+}
+
+// Close waits for pg_dump, killing it if its output was not read to the end
+func (d *dumpReader) Close() error {
+	if !d.done {
+		d.finish(d.kill(errDumpAbandoned))
+	}
+	return d.err
+}
+
+// kill stops pg_dump after its output could not be consumed and returns cause
+func (d *dumpReader) kill(cause error) error {
+	d.cmd.Process.Kill()
+	d.cmd.Wait()
+	return cause
+}
+
+// finish records the outcome of pg_dump
+func (d *dumpReader) finish(err error) {
+	d.done = true
+	switch {
+	case err != nil:
+		if !errors.Is(err, errDumpAbandoned) {
+			err = fmt.Errorf("pg_dump failed: %w", err)
+		}
+		d.err = err
+	case d.size == 0:
+		d.err = errors.New("pg_dump produced no output (0 bytes)")
+	}
+}
@@ -0,0 +1,67 @@
+package backup
+
+import (
+	"errors"
+	"io"
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startDumpReader runs a shell command standing in for pg_dump
+func startDumpReader(t *testing.T, script string) *dumpReader {
+	t.Helper()
+
+	cmd := exec.Command("sh", "-c", script)
+	stdout, err := cmd.StdoutPipe()
+	require.NoError(t, err)
+	require.NoError(t, cmd.Start())
+
+	return &dumpReader{stdout: stdout, cmd: cmd}
+}
+
+func TestDumpReader(t *testing.T) {
+	t.Run("successful_dump", func(t *testing.T) {
+		reader := startDumpReader(t, "printf PGDMP-archive")
+
+		data, err := io.ReadAll(reader)
+
+		require.NoError(t, err)
+		assert.Equal(t, "PGDMP-archive", string(data))
+		assert.NoError(t, reader.Close())
+		assert.Equal(t, int64(len(data)), reader.size)
+	})
+
+	t.Run("failed_dump_replaces_eof", func(t *testing.T) {
+		reader := startDumpReader(t, "printf partial; exit 1")
+
+		data, err := io.ReadAll(reader)
+
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "pg_dump failed")
+		assert.Equal(t, "partial", string(data))
+		assert.Error(t, reader.Close())
+	})
+
+	t.Run("empty_dump", func(t *testing.T) {
+		reader := startDumpReader(t, "exit 0")
+
+		_, err := io.ReadAll(reader)
+
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "no output")
+	})
+
+	t.Run("abandoned_stream_stops_dump", func(t *testing.T) {
+		reader := startDumpReader(t, "yes PGDMP")
+
+		buf := make([]byte, 16)
+		_, err := reader.Read(buf)
+		require.NoError(t, err)
+
+		err = reader.Close()
+		assert.True(t, errors.Is(err, errDumpAbandoned))
+	})
+}
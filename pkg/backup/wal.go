@@ -0,0 +1,368 @@
+package backup
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/williamokano/pg_backuper/pkg/config"
+	"github.com/williamokano/pg_backuper/pkg/encryption"
+	"github.com/williamokano/pg_backuper/pkg/rotation"
+	"github.com/williamokano/pg_backuper/pkg/storage"
+)
+
+// walRetentionMargin keeps WAL uploaded shortly before the oldest base backup started,
+// covering clock differences between this host and the storage destinations
+const walRetentionMargin = time.Hour
+
+// ErrWALNotArchived is returned by FetchWAL when no destination has the requested file,
+// which is expected at the end of recovery
+var ErrWALNotArchived = errors.New("WAL file not found in archive")
+
+// errWALDamaged marks an archived WAL copy that cannot be read back completely, such as one
+// left truncated by an interrupted upload
+var errWALDamaged = errors.New("archived WAL copy is damaged")
+
+// errStreamDone closes the reading side of the compression pipe once uploads returned
+var errStreamDone = errors.New("upload finished")
+
+// FindWALServer returns the configured server accepting WAL for "host" or "host:port"
+func FindWALServer(cfg *config.Config, spec string) (config.ServerConfig, error) {
+	host, portStr, hasPort := strings.Cut(spec, ":")
+	port := 0
+	if hasPort {
+		var err error
+		if port, err = strconv.Atoi(portStr); err != nil {
+			return config.ServerConfig{}, fmt.Errorf("invalid port in server %q: %w", spec, err)
+		}
+	}
+
+	for _, server := range cfg.Servers {
+		if server.Host != host || (hasPort && server.GetPort(cfg.GlobalDefaults) != port) {
+			continue
+		}
+		if server.GetMode() != config.ModeBasebackup || !server.ArchiveWAL {
+			return config.ServerConfig{}, fmt.Errorf("server %s does not have archive_wal enabled in basebackup mode", spec)
+		}
+		return server, nil
+	}
+
+	return config.ServerConfig{}, fmt.Errorf("server %s not found in config", spec)
+}
+
+// ArchiveWAL uploads one WAL file (gzip-compressed) to every destination of the server.
+// Destinations that already have an identical copy are skipped, so PostgreSQL can safely
+// retry after a partial failure; a damaged copy is archived again. A copy with different
+// content fails the call, as archive_command must never overwrite another archived file.
+// Any failed destination fails the whole call.
+func ArchiveWAL(ctx context.Context, cfg *config.Config, server config.ServerConfig, walPath, walName string, logger zerolog.Logger) error {
+	port := server.GetPort(cfg.GlobalDefaults)
+	destPath := rotation.WALFilename(server.Host, port, walName)
+
+	walLog := logger.With().
+		Str("server", rotation.HostID(server.Host, port)).
+		Str("wal", walName).
+		Logger()
+
+	file, err := os.Open(walPath)
+	if err != nil {
+		return fmt.Errorf("failed to open WAL file: %w", err)
+	}
+	defer file.Close()
+
+	backends, err := initializeBackends(ctx, cfg, basebackupArtifact(cfg, server).pseudoDatabase(), walLog)
+	if err != nil {
+		return fmt.Errorf("failed to initialize storage backends: %w", err)
+	}
+	defer closeBackends(backends)
+
+	keyring, err := LoadKeyring(cfg)
+	if err != nil {
+		return err
+	}
+
+	var pending []storage.Backend
+	var localSum []byte
+	for _, backend := range backends {
+		exists, err := backend.Exists(ctx, destPath)
+		if err != nil {
+			return fmt.Errorf("failed to check %s: %w", backend.Name(), err)
+		}
+		if !exists {
+			pending = append(pending, backend)
+			continue
+		}
+
+		if localSum == nil {
+			if localSum, err = hashReader(file); err != nil {
+				return fmt.Errorf("failed to read WAL file: %w", err)
+			}
+		}
+		archivedSum, err := hashArchivedWAL(ctx, backend, keyring, destPath)
+		switch {
+		case errors.Is(err, errWALDamaged):
+			walLog.Warn().
+				Err(err).
+				Str("backend", backend.Name()).
+				Msg("archived WAL file is damaged, archiving it again")
+			pending = append(pending, backend)
+		case err != nil:
+			return fmt.Errorf("failed to check %s on %s: %w", destPath, backend.Name(), err)
+		case !bytes.Equal(archivedSum, localSum):
+			return fmt.Errorf("WAL file %s is already archived on %s with different content", walName, backend.Name())
+		default:
+			walLog.Info().
+				Str("backend", backend.Name()).
+				Msg("identical WAL file already archived, skipping destination")
+		}
+	}
+
+	if len(pending) == 0 {
+		return nil
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to read WAL file: %w", err)
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		gz := gzip.NewWriter(pw)
+		_, err := io.Copy(gz, file)
+		if err == nil {
+			err = gz.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	var body io.Reader = pr
+	if keyring.Enabled() {
+		if body, err = keyring.Encrypt(pr); err != nil {
+			pr.CloseWithError(err)
+			return fmt.Errorf("failed to encrypt WAL file: %w", err)
+		}
+	}
+
+	results := storage.NewMultiUploader(walLog).UploadStream(ctx, pending, body, destPath)
+	// Unblocks the compressor if every destination failed early
+	pr.CloseWithError(errStreamDone)
+
+	var failed []string
+	for _, result := range results {
+		if !result.Success {
+			failed = append(failed, result.BackendName)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to archive WAL to %s", strings.Join(failed, ", "))
+	}
+
+	walLog.Info().
+		Int("destinations", len(pending)).
+		Msg("WAL file archived")
+
+	return nil
+}
+
+// hashArchivedWAL returns the SHA-256 of the decompressed content of an archived WAL file.
+// Returns an error wrapping errWALDamaged when the copy does not decrypt or decompress
+// completely, as opposed to failing to read it from the backend.
+func hashArchivedWAL(ctx context.Context, backend storage.Backend, keyring *encryption.Keyring, srcPath string) ([]byte, error) {
+	rc, err := backend.Read(ctx, srcPath)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	source := &readErrRecorder{r: rc}
+
+	plain, err := keyring.Open(source)
+	if err != nil {
+		if source.err != nil || errors.Is(err, encryption.ErrNoKey) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %v", errWALDamaged, err)
+	}
+
+	gz, err := gzip.NewReader(plain)
+	if err == nil {
+		var sum []byte
+		sum, err = hashReader(gz)
+		if err == nil {
+			return sum, nil
+		}
+	}
+	if source.err != nil {
+		return nil, source.err
+	}
+	return nil, fmt.Errorf("%w: %v", errWALDamaged, err)
+}
+
+// readErrRecorder remembers read errors of the underlying reader, telling them apart
+// from errors in the data read
+type readErrRecorder struct {
+	r   io.Reader
+	err error
+}
+
+func (r *readErrRecorder) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
+}
+
+// hashReader returns the SHA-256 of everything read from r
+func hashReader(r io.Reader) ([]byte, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, r); err != nil {
+		return nil, err
+	}
+	return hash.Sum(nil), nil
+}
+
+// FetchWAL downloads one WAL file from the first destination that has it and
+// decompresses it to destPath. Returns ErrWALNotArchived if no destination has it.
+func FetchWAL(ctx context.Context, cfg *config.Config, server config.ServerConfig, walName, destPath string, logger zerolog.Logger) error {
+	port := server.GetPort(cfg.GlobalDefaults)
+	srcPath := rotation.WALFilename(server.Host, port, walName)
+
+	walLog := logger.With().
+		Str("server", rotation.HostID(server.Host, port)).
+		Str("wal", walName).
+		Logger()
+
+	backends, err := initializeBackends(ctx, cfg, basebackupArtifact(cfg, server).pseudoDatabase(), walLog)
+	if err != nil {
+		return fmt.Errorf("failed to initialize storage backends: %w", err)
+	}
+	defer closeBackends(backends)
+
+	keyring, err := LoadKeyring(cfg)
+	if err != nil {
+		return err
+	}
+
+	var lastErr error
+	for _, backend := range backends {
+		err := fetchWALFrom(ctx, backend, keyring, srcPath, destPath)
+		if err == nil {
+			walLog.Info().
+				Str("backend", backend.Name()).
+				Msg("WAL file restored")
+			return nil
+		}
+		if !errors.Is(err, storage.ErrNotFound) {
+			walLog.Warn().
+				Err(err).
+				Str("backend", backend.Name()).
+				Msg("failed to fetch WAL file, trying next destination")
+			lastErr = err
+		}
+	}
+
+	if lastErr != nil {
+		return lastErr
+	}
+	return ErrWALNotArchived
+}
+
+// fetchWALFrom decrypts (if encrypted) and decompresses srcPath from one backend into
+// destPath, which only appears once complete
+func fetchWALFrom(ctx context.Context, backend storage.Backend, keyring *encryption.Keyring, srcPath, destPath string) error {
+	rc, err := backend.Read(ctx, srcPath)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	plain, err := keyring.Open(rc)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt %s: %w", srcPath, err)
+	}
+
+	gz, err := gzip.NewReader(plain)
+	if err != nil {
+		return fmt.Errorf("failed to decompress %s: %w", srcPath, err)
+	}
+	defer gz.Close()
+
+	tmpPath := destPath + ".tmp"
+	out, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, gz); err != nil {
+		out.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to decompress %s: %w", srcPath, err)
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, destPath)
+}
+
+// pruneWAL deletes archived WAL segments that no retained base backup needs: those uploaded
+// before the oldest base backup on the backend started. Timeline history files are kept.
+// Nothing is deleted while the backend has no base backup.
+func pruneWAL(ctx context.Context, backend storage.Backend, host string, port int, logger zerolog.Logger) error {
+	bases, err := backend.List(ctx, rotation.BasebackupPattern(host, port))
+	if err != nil {
+		return fmt.Errorf("failed to list base backups: %w", err)
+	}
+
+	var oldest time.Time
+	for _, base := range bases {
+		components, err := rotation.ParseBackupFilename(base.Path)
+		if err != nil {
+			continue
+		}
+		if oldest.IsZero() || components.Timestamp.Before(oldest) {
+			oldest = components.Timestamp
+		}
+	}
+	if oldest.IsZero() {
+		logger.Debug().Msg("no base backups found, keeping all WAL")
+		return nil
+	}
+
+	cutoff := oldest.Add(-walRetentionMargin)
+
+	files, err := backend.List(ctx, rotation.WALPattern(host, port))
+	if err != nil {
+		return fmt.Errorf("failed to list WAL files: %w", err)
+	}
+
+	deleted := 0
+	for _, file := range files {
+		if strings.HasSuffix(file.Path, ".history.gz") || !file.ModTime.Before(cutoff) {
+			continue
+		}
+		if err := backend.Delete(ctx, file.Path); err != nil {
+			logger.Error().
+				Err(err).
+				Str("file", file.Path).
+				Msg("failed to delete archived WAL")
+			continue
+		}
+		deleted++
+	}
+
+	logger.Info().
+		Time("oldest_basebackup", oldest).
+		Int("deleted", deleted).
+		Int("total", len(files)).
+		Msg("pruned archived WAL")
+
+	return nil
+}
@@ -0,0 +1,201 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/williamokano/pg_backuper/pkg/config"
+	"github.com/williamokano/pg_backuper/pkg/encryption"
+	"github.com/williamokano/pg_backuper/pkg/rotation"
+)
+
+// walTestConfig returns a config with one basebackup server archiving WAL to a local destination
+func walTestConfig(t *testing.T) (*config.Config, string) {
+	t.Helper()
+
+	archiveDir := t.TempDir()
+	cfg := &config.Config{
+		Storage: config.StorageConfig{
+			Destinations: []config.StorageDestination{
+				{Name: "archive", Type: "local", Enabled: true, BaseDir: archiveDir, Options: map[string]interface{}{"path": archiveDir}},
+			},
+		},
+		Servers: []config.ServerConfig{
+			{Host: "pg1", User: "replicator", Mode: config.ModeBasebackup, ArchiveWAL: true, StorageDestinations: []string{"archive"}},
+			{Host: "pg2", User: "replicator", Mode: config.ModeBasebackup},
+		},
+	}
+	return cfg, archiveDir
+}
+
+func TestFindWALServer(t *testing.T) {
+	cfg, _ := walTestConfig(t)
+
+	server, err := FindWALServer(cfg, "pg1")
+	require.NoError(t, err)
+	assert.Equal(t, "pg1", server.Host)
+
+	_, err = FindWALServer(cfg, "pg1:5432")
+	assert.NoError(t, err)
+
+	_, err = FindWALServer(cfg, "pg1:5433")
+	assert.Error(t, err)
+
+	_, err = FindWALServer(cfg, "pg2")
+	assert.ErrorContains(t, err, "archive_wal")
+}
+
+func TestArchiveAndFetchWAL(t *testing.T) {
+	ctx := context.Background()
+	cfg, archiveDir := walTestConfig(t)
+	server := cfg.Servers[0]
+
+	segment := []byte("WAL segment contents")
+	walPath := filepath.Join(t.TempDir(), "000000010000000000000002")
+	require.NoError(t, os.WriteFile(walPath, segment, 0600))
+
+	require.NoError(t, ArchiveWAL(ctx, cfg, server, walPath, "000000010000000000000002", zerolog.Nop()))
+	assert.FileExists(t, filepath.Join(archiveDir, "pg1-5432--wal--000000010000000000000002.gz"))
+
+	t.Run("archiving_again_succeeds", func(t *testing.T) {
+		assert.NoError(t, ArchiveWAL(ctx, cfg, server, walPath, "000000010000000000000002", zerolog.Nop()))
+	})
+
+	t.Run("different_copy_fails", func(t *testing.T) {
+		otherPath := filepath.Join(t.TempDir(), "000000010000000000000002")
+		require.NoError(t, os.WriteFile(otherPath, []byte("WAL segment of another cluster"), 0600))
+
+		err := ArchiveWAL(ctx, cfg, server, otherPath, "000000010000000000000002", zerolog.Nop())
+
+		assert.ErrorContains(t, err, "already archived on archive with different content")
+	})
+
+	t.Run("damaged_copy_is_archived_again", func(t *testing.T) {
+		archived := filepath.Join(archiveDir, "pg1-5432--wal--000000010000000000000002.gz")
+		stored, err := os.ReadFile(archived)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(archived, stored[:len(stored)/2], 0644))
+
+		require.NoError(t, ArchiveWAL(ctx, cfg, server, walPath, "000000010000000000000002", zerolog.Nop()))
+
+		repaired, err := os.ReadFile(archived)
+		require.NoError(t, err)
+		assert.Equal(t, stored, repaired)
+	})
+
+	t.Run("fetch_decompresses", func(t *testing.T) {
+		dest := filepath.Join(t.TempDir(), "RECOVERYXLOG")
+		require.NoError(t, FetchWAL(ctx, cfg, server, "000000010000000000000002", dest, zerolog.Nop()))
+
+		got, err := os.ReadFile(dest)
+		require.NoError(t, err)
+		assert.Equal(t, segment, got)
+	})
+
+	t.Run("fetch_missing", func(t *testing.T) {
+		dest := filepath.Join(t.TempDir(), "RECOVERYXLOG")
+		err := FetchWAL(ctx, cfg, server, "000000010000000000000003", dest, zerolog.Nop())
+		assert.True(t, errors.Is(err, ErrWALNotArchived))
+		assert.NoFileExists(t, dest)
+	})
+}
+
+func TestArchiveAndFetchWAL_Encrypted(t *testing.T) {
+	ctx := context.Background()
+	cfg, archiveDir := walTestConfig(t)
+	server := cfg.Servers[0]
+
+	keyFile := filepath.Join(t.TempDir(), "wal.key")
+	require.NoError(t, os.WriteFile(keyFile, bytes.Repeat([]byte{7}, 32), 0600))
+	cfg.Encryption = config.EncryptionConfig{
+		Enabled: true,
+		KeyID:   "wal-2025",
+		Keys:    []config.EncryptionKey{{ID: "wal-2025", KeyFile: keyFile}},
+	}
+
+	segment := bytes.Repeat([]byte("WAL segment contents "), 1000)
+	walPath := filepath.Join(t.TempDir(), "000000010000000000000002")
+	require.NoError(t, os.WriteFile(walPath, segment, 0600))
+
+	require.NoError(t, ArchiveWAL(ctx, cfg, server, walPath, "000000010000000000000002", zerolog.Nop()))
+
+	stored, err := os.ReadFile(filepath.Join(archiveDir, "pg1-5432--wal--000000010000000000000002.gz"))
+	require.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(stored, []byte(encryption.Magic)))
+
+	// Copies are compared by content, not by their encrypted bytes
+	require.NoError(t, ArchiveWAL(ctx, cfg, server, walPath, "000000010000000000000002", zerolog.Nop()))
+
+	dest := filepath.Join(t.TempDir(), "RECOVERYXLOG")
+	require.NoError(t, FetchWAL(ctx, cfg, server, "000000010000000000000002", dest, zerolog.Nop()))
+	got, err := os.ReadFile(dest)
+	require.NoError(t, err)
+	assert.Equal(t, segment, got)
+
+	t.Run("fetch_without_key_fails", func(t *testing.T) {
+		cfg.Encryption = config.EncryptionConfig{}
+		err := FetchWAL(ctx, cfg, server, "000000010000000000000002", filepath.Join(t.TempDir(), "RECOVERYXLOG"), zerolog.Nop())
+		assert.ErrorIs(t, err, encryption.ErrNoKey)
+	})
+}
+
+func TestPruneWAL(t *testing.T) {
+	ctx := context.Background()
+	cfg, archiveDir := walTestConfig(t)
+
+	backend, err := InitializeDestination(ctx, cfg, "archive")
+	require.NoError(t, err)
+	defer backend.Close()
+
+	oldestBase := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+	write := func(name string, modTime time.Time) {
+		path := filepath.Join(archiveDir, name)
+		require.NoError(t, os.WriteFile(path, []byte("data"), 0644))
+		require.NoError(t, os.Chtimes(path, modTime, modTime))
+	}
+
+	naming := rotation.BasebackupNaming("pg1", 5432)
+	write(naming.Filename("weekly", oldestBase), oldestBase.Add(time.Hour))
+	write(naming.Filename("daily", oldestBase.Add(24*time.Hour)), oldestBase.Add(25*time.Hour))
+
+	old := rotation.WALFilename("pg1", 5432, "000000010000000000000001")
+	history := rotation.WALFilename("pg1", 5432, "00000002.history")
+	withinMargin := rotation.WALFilename("pg1", 5432, "000000010000000000000002")
+	needed := rotation.WALFilename("pg1", 5432, "000000010000000000000003")
+	write(old, oldestBase.Add(-3*time.Hour))
+	write(history, oldestBase.Add(-3*time.Hour))
+	write(withinMargin, oldestBase.Add(-time.Minute))
+	write(needed, oldestBase.Add(time.Minute))
+
+	require.NoError(t, pruneWAL(ctx, backend, "pg1", 5432, zerolog.Nop()))
+
+	assert.NoFileExists(t, filepath.Join(archiveDir, old))
+	assert.FileExists(t, filepath.Join(archiveDir, history))
+	assert.FileExists(t, filepath.Join(archiveDir, withinMargin))
+	assert.FileExists(t, filepath.Join(archiveDir, needed))
+}
+
+func TestPruneWAL_NoBasebackups(t *testing.T) {
+	ctx := context.Background()
+	cfg, archiveDir := walTestConfig(t)
+
+	backend, err := InitializeDestination(ctx, cfg, "archive")
+	require.NoError(t, err)
+	defer backend.Close()
+
+	segment := filepath.Join(archiveDir, rotation.WALFilename("pg1", 5432, "000000010000000000000001"))
+	require.NoError(t, os.WriteFile(segment, []byte("data"), 0644))
+	old := time.Now().Add(-30 * 24 * time.Hour)
+	require.NoError(t, os.Chtimes(segment, old, old))
+
+	require.NoError(t, pruneWAL(ctx, backend, "pg1", 5432, zerolog.Nop()))
+	assert.FileExists(t, segment)
+}
@@ -0,0 +1,159 @@
+package backup
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/williamokano/pg_backuper/pkg/config"
+)
+
+// windowSearchDays is how far ahead the next allowed window is searched;
+// ranges repeat weekly, so a window that exists is always found
+const windowSearchDays = 8
+
+// timeRange is a parsed daily time range in minutes since midnight
+type timeRange struct {
+	days  map[time.Weekday]bool // nil means every day
+	start int
+	end   int
+}
+
+// backupWindows decides when scheduled backups may start
+type backupWindows struct {
+	loc       *time.Location
+	allowed   []timeRange
+	blackouts []timeRange
+}
+
+// parseWindows reads the window configuration of a database
+func parseWindows(w *config.WindowConfig, globalDefaults config.GlobalDefaults) (backupWindows, error) {
+	var windows backupWindows
+
+	loc, err := w.GetLocation(globalDefaults)
+	if err != nil {
+		return windows, err
+	}
+	windows.loc = loc
+
+	for _, r := range w.Allowed {
+		parsed, err := parseTimeRange(r)
+		if err != nil {
+			return windows, fmt.Errorf("allowed window: %w", err)
+		}
+		windows.allowed = append(windows.allowed, parsed)
+	}
+
+	for _, r := range w.Blackouts {
+		parsed, err := parseTimeRange(r)
+		if err != nil {
+			return windows, fmt.Errorf("blackout: %w", err)
+		}
+		windows.blackouts = append(windows.blackouts, parsed)
+	}
+
+	return windows, nil
+}
+
+// parseTimeRange reads a configured time range
+func parseTimeRange(r config.TimeRange) (timeRange, error) {
+	var parsed timeRange
+
+	start, err := time.Parse("15:04", r.Start)
+	if err != nil {
+		return parsed, fmt.Errorf("invalid start %q: %w", r.Start, err)
+	}
+	end, err := time.Parse("15:04", r.End)
+	if err != nil {
+		return parsed, fmt.Errorf("invalid end %q: %w", r.End, err)
+	}
+	parsed.start = start.Hour()*60 + start.Minute()
+	parsed.end = end.Hour()*60 + end.Minute()
+
+	if len(r.Days) > 0 {
+		parsed.days = make(map[time.Weekday]bool)
+		for _, day := range r.Days {
+			weekday, ok := weekdays[strings.ToLower(day)]
+			if !ok {
+				return parsed, fmt.Errorf("invalid weekday %q", day)
+			}
+			parsed.days[weekday] = true
+		}
+	}
+
+	return parsed, nil
+}
+
+// startsOn reports whether the range starts on a weekday
+func (r timeRange) startsOn(day time.Weekday) bool {
+	return r.days == nil || r.days[day]
+}
+
+// contains reports whether t (in the windows' timezone) falls inside the range
+func (r timeRange) contains(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	if r.start < r.end {
+		return r.startsOn(t.Weekday()) && minute >= r.start && minute < r.end
+	}
+	// Crosses midnight: the evening part belongs to today's range, the morning part to yesterday's
+	yesterday := (t.Weekday() + 6) % 7
+	return (r.startsOn(t.Weekday()) && minute >= r.start) || (r.startsOn(yesterday) && minute < r.end)
+}
+
+// allows reports whether a backup may start at t
+func (w backupWindows) allows(t time.Time) bool {
+	t = t.In(w.loc)
+
+	for _, blackout := range w.blackouts {
+		if blackout.contains(t) {
+			return false
+		}
+	}
+
+	if len(w.allowed) == 0 {
+		return true
+	}
+	for _, allowed := range w.allowed {
+		if allowed.contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// nextAllowed returns the first time at or after now at which a backup may start,
+// or the zero time if the windows never allow one
+func (w backupWindows) nextAllowed(now time.Time) time.Time {
+	if w.allows(now) {
+		return now
+	}
+
+	// The allowed state only changes where an allowed range starts or a blackout ends
+	var boundaries []int
+	for _, r := range w.allowed {
+		boundaries = append(boundaries, r.start)
+	}
+	for _, r := range w.blackouts {
+		boundaries = append(boundaries, r.end)
+	}
+
+	local := now.In(w.loc)
+	year, month, day := local.Date()
+
+	var next time.Time
+	for offset := 0; offset <= windowSearchDays; offset++ {
+		for _, minute := range boundaries {
+			candidate := time.Date(year, month, day+offset, minute/60, minute%60, 0, 0, w.loc)
+			if !candidate.After(now) || (!next.IsZero() && !candidate.Before(next)) {
+				continue
+			}
+			if w.allows(candidate) {
+				next = candidate
+			}
+		}
+		if !next.IsZero() {
+			return next
+		}
+	}
+	return next
+}
@@ -0,0 +1,166 @@
+package backup
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/williamokano/pg_backuper/pkg/config"
+	"github.com/williamokano/pg_backuper/pkg/rotation"
+)
+
+func TestBackupWindows_NextAllowed(t *testing.T) {
+	// 2025-03-10 is a Monday
+	at := func(day, hour, min int) time.Time {
+		return time.Date(2025, 3, day, hour, min, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name    string
+		windows config.WindowConfig
+		now     time.Time
+		want    time.Time
+	}{
+		{
+			name:    "no ranges allow any time",
+			windows: config.WindowConfig{Timezone: "UTC"},
+			now:     at(10, 12, 0),
+			want:    at(10, 12, 0),
+		},
+		{
+			name: "blackout defers to its end",
+			windows: config.WindowConfig{
+				Timezone:  "UTC",
+				Blackouts: []config.TimeRange{{Start: "09:00", End: "18:00"}},
+			},
+			now:  at(10, 12, 0),
+			want: at(10, 18, 0),
+		},
+		{
+			name: "outside blackout runs now",
+			windows: config.WindowConfig{
+				Timezone:  "UTC",
+				Blackouts: []config.TimeRange{{Start: "09:00", End: "18:00"}},
+			},
+			now:  at(10, 20, 0),
+			want: at(10, 20, 0),
+		},
+		{
+			name: "allowed window crossing midnight",
+			windows: config.WindowConfig{
+				Timezone: "UTC",
+				Allowed:  []config.TimeRange{{Start: "22:00", End: "04:00"}},
+			},
+			now:  at(11, 3, 0),
+			want: at(11, 3, 0),
+		},
+		{
+			name: "allowed window later today",
+			windows: config.WindowConfig{
+				Timezone: "UTC",
+				Allowed:  []config.TimeRange{{Start: "22:00", End: "04:00"}},
+			},
+			now:  at(11, 5, 0),
+			want: at(11, 22, 0),
+		},
+		{
+			name: "weekend only window",
+			windows: config.WindowConfig{
+				Timezone: "UTC",
+				Allowed:  []config.TimeRange{{Days: []string{"saturday", "sunday"}, Start: "00:00", End: "00:00"}},
+			},
+			now:  at(12, 10, 0),
+			want: at(15, 0, 0),
+		},
+		{
+			name: "blackout inside allowed window",
+			windows: config.WindowConfig{
+				Timezone:  "UTC",
+				Allowed:   []config.TimeRange{{Start: "20:00", End: "06:00"}},
+				Blackouts: []config.TimeRange{{Days: []string{"monday"}, Start: "19:00", End: "23:30"}},
+			},
+			now:  at(10, 21, 0),
+			want: at(10, 23, 30),
+		},
+		{
+			name: "window in configured timezone",
+			windows: config.WindowConfig{
+				Timezone:  "Europe/Berlin",
+				Blackouts: []config.TimeRange{{Start: "09:00", End: "18:00"}},
+			},
+			now:  at(10, 12, 0), // 13:00 in Berlin
+			want: at(10, 17, 0), // 18:00 in Berlin
+		},
+		{
+			name: "never allowed",
+			windows: config.WindowConfig{
+				Timezone:  "UTC",
+				Blackouts: []config.TimeRange{{Start: "00:00", End: "00:00"}},
+			},
+			now: at(10, 12, 0),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			windows, err := parseWindows(&tt.windows, config.GlobalDefaults{})
+			require.NoError(t, err)
+
+			got := windows.nextAllowed(tt.now)
+			assert.True(t, got.Equal(tt.want), "nextAllowed() = %v, want %v", got, tt.want)
+		})
+	}
+}
+
+func TestDeferToWindow(t *testing.T) {
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	cfg := &config.Config{
+		GlobalDefaults: config.GlobalDefaults{
+			Windows: &config.WindowConfig{
+				Timezone:  "UTC",
+				Blackouts: []config.TimeRange{{Start: "09:00", End: "18:00"}},
+			},
+		},
+	}
+	db := config.DatabaseConfig{Name: "oltp"}
+	due := func() TierSchedule {
+		return TierSchedule{Due: []string{"hourly"}, Next: map[string]time.Time{"hourly": now}}
+	}
+
+	schedule := deferToWindow(cfg, db, due(), now, zerolog.Nop())
+	assert.Empty(t, schedule.Due)
+	assert.True(t, schedule.Next["hourly"].Equal(time.Date(2025, 3, 10, 18, 0, 0, 0, time.UTC)))
+
+	cfg.IgnoreWindows = true
+	schedule = deferToWindow(cfg, db, due(), now, zerolog.Nop())
+	assert.Equal(t, []string{"hourly"}, schedule.Due)
+
+	// A database without windows of its own inherits the global ones, an empty one allows any time
+	cfg.IgnoreWindows = false
+	db.Windows = &config.WindowConfig{}
+	schedule = deferToWindow(cfg, db, due(), now, zerolog.Nop())
+	assert.Equal(t, []string{"hourly"}, schedule.Due)
+}
+
+func TestServerArtifactSchedule_Windows(t *testing.T) {
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	cfg := &config.Config{
+		GlobalDefaults: config.GlobalDefaults{
+			Windows: &config.WindowConfig{
+				Timezone:  "UTC",
+				Blackouts: []config.TimeRange{{Start: "09:00", End: "18:00"}},
+			},
+		},
+	}
+	artifact := serverArtifact{naming: rotation.BasebackupNaming("warehouse.internal", 5432)}
+
+	schedule := artifact.schedule(context.Background(), cfg, nil, now, zerolog.Nop())
+	assert.Empty(t, schedule.Due)
+	assert.True(t, schedule.Next["default"].Equal(time.Date(2025, 3, 10, 18, 0, 0, 0, time.UTC)))
+
+	schedule = artifact.schedule(context.Background(), cfg, nil, now.Add(8*time.Hour), zerolog.Nop())
+	assert.Equal(t, []string{"default"}, schedule.Due)
+}
@@ -0,0 +1,222 @@
+package catalog
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/williamokano/pg_backuper/pkg/backup"
+	"github.com/williamokano/pg_backuper/pkg/config"
+	"github.com/williamokano/pg_backuper/pkg/rotation"
+)
+
+// ListOptions defines which stored backups to list
+type ListOptions struct {
+	Database    string // Only backups of this database or server (host-port), optional
+	Destination string // Only this storage destination, optional (default: all enabled destinations)
+	Tier        string // Only backups of this tier, optional
+}
+
+// Entry is a backup stored on a destination
+type Entry struct {
+	Destination string        `json:"destination"`
+	Path        string        `json:"path"`
+	Source      string        `json:"source"`         // Database name, or host identifier for cluster-wide backups
+	Kind        string        `json:"kind,omitempty"` // Empty for database dumps
+	Tier        string        `json:"tier,omitempty"`
+	TakenAt     time.Time     `json:"taken_at"`
+	Size        int64         `json:"size_bytes"`
+	Pin         *rotation.Pin `json:"pin,omitempty"` // Pin marker of the backup, active or expired
+}
+
+// List returns the backups stored on the selected destinations, newest first per destination.
+// Archived WAL is left out.
+func List(ctx context.Context, cfg *config.Config, opts ListOptions) ([]Entry, error) {
+	var entries []Entry
+
+	for _, name := range destinations(cfg, opts.Destination) {
+		backend, err := backup.InitializeDestination(ctx, cfg, name)
+		if err != nil {
+			return entries, fmt.Errorf("failed to initialize storage destination %s: %w", name, err)
+		}
+
+		files, err := backend.List(ctx, opts.Database+"*")
+		if err != nil {
+			backend.Close()
+			return entries, fmt.Errorf("failed to list backups on %s: %w", name, err)
+		}
+		pins, err := rotation.ListPins(ctx, backend, opts.Database+"*")
+		backend.Close()
+		if err != nil {
+			return entries, fmt.Errorf("failed to list pins on %s: %w", name, err)
+		}
+
+		var destEntries []Entry
+		for _, file := range files {
+			if _, wal := rotation.ParseWALFilename(filepath.Base(file.Path)); wal {
+				continue
+			}
+			components, err := rotation.ParseBackupFilename(filepath.Base(file.Path))
+			if err != nil {
+				continue
+			}
+			if opts.Database != "" && components.DatabaseName != opts.Database {
+				continue
+			}
+			if opts.Tier != "" && components.Tier != opts.Tier {
+				continue
+			}
+
+			entry := Entry{
+				Destination: name,
+				Path:        file.Path,
+				Source:      components.DatabaseName,
+				Kind:        components.Kind,
+				Tier:        components.Tier,
+				TakenAt:     components.Timestamp,
+				Size:        file.Size,
+			}
+			if pin, ok := pins[file.Path]; ok {
+				entry.Pin = &pin
+			}
+			destEntries = append(destEntries, entry)
+		}
+
+		sort.SliceStable(destEntries, func(i, j int) bool {
+			return destEntries[i].TakenAt.After(destEntries[j].TakenAt)
+		})
+		entries = append(entries, destEntries...)
+	}
+
+	return entries, nil
+}
+
+// PinOptions defines a backup to pin
+type PinOptions struct {
+	Backup      string    // Backup filename
+	Destination string    // Only this storage destination, optional (default: every destination holding the backup)
+	Reason      string    // Why the backup is held, optional
+	Until       time.Time // When the pin expires, optional (zero holds indefinitely)
+}
+
+// Result represents the outcome of pinning or unpinning a backup
+type Result struct {
+	Backup       string
+	Destinations []string // Destinations the backup was pinned or unpinned on
+	Success      bool
+	Error        error
+}
+
+// Pin places a legal hold on a backup on every destination holding it, so that rotation
+// never deletes it. Pinning an already pinned backup replaces its reason and expiry.
+func Pin(ctx context.Context, cfg *config.Config, opts PinOptions, logger zerolog.Logger) Result {
+	result := Result{Backup: opts.Backup}
+
+	_, wal := rotation.ParseWALFilename(opts.Backup)
+	_, err := rotation.ParseBackupFilename(opts.Backup)
+	if err != nil || wal || filepath.Base(opts.Backup) != opts.Backup {
+		result.Error = fmt.Errorf("not a backup filename: %s", opts.Backup)
+		return result
+	}
+
+	pin := rotation.Pin{
+		Reason:   opts.Reason,
+		Until:    opts.Until,
+		PinnedAt: time.Now().UTC(),
+	}
+
+	for _, name := range destinations(cfg, opts.Destination) {
+		destLog := logger.With().
+			Str("destination", name).
+			Str("backup", opts.Backup).
+			Logger()
+
+		backend, err := backup.InitializeDestination(ctx, cfg, name)
+		if err != nil {
+			result.Error = fmt.Errorf("failed to initialize storage destination %s: %w", name, err)
+			return result
+		}
+
+		exists, err := backend.Exists(ctx, opts.Backup)
+		if err == nil && exists {
+			err = rotation.WritePin(ctx, backend, opts.Backup, pin)
+		}
+		backend.Close()
+
+		if err != nil {
+			result.Error = fmt.Errorf("failed to pin backup on %s: %w", name, err)
+			return result
+		}
+		if !exists {
+			destLog.Debug().Msg("backup not stored on destination")
+			continue
+		}
+
+		destLog.Info().
+			Str("reason", pin.Reason).
+			Time("until", pin.Until).
+			Msg("pinned backup")
+		result.Destinations = append(result.Destinations, name)
+	}
+
+	if len(result.Destinations) == 0 {
+		result.Error = fmt.Errorf("backup %s not found on any destination", opts.Backup)
+		return result
+	}
+
+	result.Success = true
+	return result
+}
+
+// Unpin releases the legal hold on a backup on every destination it is pinned on (or only
+// on destination if set). Rotation deletes the backup on its next run if retention no longer keeps it.
+func Unpin(ctx context.Context, cfg *config.Config, backupName, destination string, logger zerolog.Logger) Result {
+	result := Result{Backup: backupName}
+
+	for _, name := range destinations(cfg, destination) {
+		backend, err := backup.InitializeDestination(ctx, cfg, name)
+		if err != nil {
+			result.Error = fmt.Errorf("failed to initialize storage destination %s: %w", name, err)
+			return result
+		}
+
+		exists, err := backend.Exists(ctx, rotation.PinPath(backupName))
+		if err == nil && exists {
+			err = rotation.RemovePin(ctx, backend, backupName)
+		}
+		backend.Close()
+
+		if err != nil {
+			result.Error = fmt.Errorf("failed to unpin backup on %s: %w", name, err)
+			return result
+		}
+		if !exists {
+			continue
+		}
+
+		logger.Info().
+			Str("destination", name).
+			Str("backup", backupName).
+			Msg("unpinned backup")
+		result.Destinations = append(result.Destinations, name)
+	}
+
+	if len(result.Destinations) == 0 {
+		result.Error = fmt.Errorf("backup %s is not pinned on any destination", backupName)
+		return result
+	}
+
+	result.Success = true
+	return result
+}
+
+// destinations returns the destination names an operation runs on
+func destinations(cfg *config.Config, destination string) []string {
+	if destination != "" {
+		return []string{destination}
+	}
+	return backup.EnabledDestinations(cfg)
+}
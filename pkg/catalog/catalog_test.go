@@ -0,0 +1,125 @@
+package catalog
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/williamokano/pg_backuper/pkg/config"
+	"github.com/williamokano/pg_backuper/pkg/prune"
+	"github.com/williamokano/pg_backuper/pkg/rotation"
+)
+
+// catalogConfig returns a config with two local destinations and the directories behind them
+func catalogConfig(t *testing.T) (*config.Config, string, string) {
+	primary := t.TempDir()
+	offsite := t.TempDir()
+
+	cfg := &config.Config{
+		Storage: config.StorageConfig{
+			Destinations: []config.StorageDestination{
+				{Name: "primary", Type: "local", Enabled: true, Options: map[string]interface{}{"path": primary}},
+				{Name: "offsite", Type: "local", Enabled: true, Options: map[string]interface{}{"path": offsite}},
+			},
+		},
+		Databases: []config.DatabaseConfig{
+			{Name: "app", RetentionTiers: []config.RetentionTier{{Tier: "daily", Retention: 1}}},
+		},
+	}
+	return cfg, primary, offsite
+}
+
+// writeDaily stores a daily backup of app taken days ago in dir
+func writeDaily(t *testing.T, dir string, days int) string {
+	name := rotation.DatabaseNaming("app").Filename("daily", time.Now().AddDate(0, 0, -days))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("PGDMP"), 0644))
+	return name
+}
+
+func TestPin(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("pinned_backup_survives_rotation", func(t *testing.T) {
+		cfg, primary, offsite := catalogConfig(t)
+		writeDaily(t, primary, 1)
+		old := writeDaily(t, primary, 2)
+		writeDaily(t, offsite, 2)
+
+		result := Pin(ctx, cfg, PinOptions{Backup: old, Reason: "legal hold"}, zerolog.Nop())
+		require.NoError(t, result.Error)
+		assert.Equal(t, []string{"primary", "offsite"}, result.Destinations)
+
+		pruned := prune.Prune(ctx, cfg, prune.Options{Destination: "primary"}, zerolog.Nop())
+		require.True(t, pruned.Success)
+		assert.Zero(t, pruned.Deleted)
+		assert.FileExists(t, filepath.Join(primary, old))
+
+		entries, err := List(ctx, cfg, ListOptions{Destination: "primary"})
+		require.NoError(t, err)
+		require.Len(t, entries, 2)
+		assert.Nil(t, entries[0].Pin)
+		require.NotNil(t, entries[1].Pin)
+		assert.Equal(t, "legal hold", entries[1].Pin.Reason)
+
+		unpinned := Unpin(ctx, cfg, old, "", zerolog.Nop())
+		require.NoError(t, unpinned.Error)
+		assert.Equal(t, []string{"primary", "offsite"}, unpinned.Destinations)
+
+		pruned = prune.Prune(ctx, cfg, prune.Options{Destination: "primary"}, zerolog.Nop())
+		require.True(t, pruned.Success)
+		assert.Equal(t, 1, pruned.Deleted)
+		assert.NoFileExists(t, filepath.Join(primary, old))
+	})
+
+	t.Run("expired_pin_releases_backup", func(t *testing.T) {
+		cfg, primary, _ := catalogConfig(t)
+		writeDaily(t, primary, 1)
+		old := writeDaily(t, primary, 2)
+
+		result := Pin(ctx, cfg, PinOptions{Backup: old, Until: time.Now().Add(-time.Minute)}, zerolog.Nop())
+		require.True(t, result.Success)
+
+		pruned := prune.Prune(ctx, cfg, prune.Options{}, zerolog.Nop())
+		require.True(t, pruned.Success)
+		assert.Equal(t, 1, pruned.Deleted)
+		assert.NoFileExists(t, filepath.Join(primary, old))
+		assert.NoFileExists(t, filepath.Join(primary, rotation.PinPath(old)))
+	})
+
+	t.Run("unknown_backup_fails", func(t *testing.T) {
+		cfg, _, _ := catalogConfig(t)
+
+		result := Pin(ctx, cfg, PinOptions{Backup: rotation.DatabaseNaming("app").Filename("daily", time.Now())}, zerolog.Nop())
+		assert.False(t, result.Success)
+		assert.Error(t, result.Error)
+
+		result = Pin(ctx, cfg, PinOptions{Backup: "../escape.backup"}, zerolog.Nop())
+		assert.Error(t, result.Error)
+
+		result = Unpin(ctx, cfg, "app--daily--2025-03-10T02-00-00Z.backup", "", zerolog.Nop())
+		assert.Error(t, result.Error)
+	})
+}
+
+func TestList(t *testing.T) {
+	cfg, primary, _ := catalogConfig(t)
+	newer := writeDaily(t, primary, 1)
+	older := writeDaily(t, primary, 3)
+	require.NoError(t, os.WriteFile(filepath.Join(primary, "apple--daily--2025-03-10T02-00-00Z.backup"), []byte("PGDMP"), 0644))
+
+	entries, err := List(context.Background(), cfg, ListOptions{Database: "app", Tier: "daily"})
+
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, newer, entries[0].Path)
+	assert.Equal(t, older, entries[1].Path)
+	assert.Equal(t, "primary", entries[0].Destination)
+	assert.Equal(t, "app", entries[0].Source)
+	assert.Equal(t, "daily", entries[0].Tier)
+	assert.Equal(t, int64(len("PGDMP")), entries[0].Size)
+}
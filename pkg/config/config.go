@@ -1,9 +1,59 @@
 package config
 
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
 // RetentionTier defines a retention policy for a specific tier
 type RetentionTier struct {
-	Tier      string `json:"tier"`      // hourly, daily, weekly, monthly, quarterly, yearly
-	Retention int    `json:"retention"` // number of backups to keep (0 = unlimited)
+	Tier      string `json:"tier"`              // hourly, daily, weekly, monthly, quarterly, yearly or a tier from "tiers"
+	Retention int    `json:"retention"`         // number of backups to keep (0 = unlimited)
+	MaxAge    string `json:"max_age,omitempty"` // maximum age of kept backups: Go duration, days, weeks, months or years ("36h", "35d", "13mo", "7y")
+	At        string `json:"at,omitempty"`      // calendar anchor: time of day "HH:MM" (hourly tier: only the minute is used)
+	Weekday   string `json:"weekday,omitempty"` // calendar anchor: day of week, weekly tier only
+	Day       int    `json:"day,omitempty"`     // calendar anchor: day of month, monthly/quarterly/yearly tiers (clamped to the month's last day)
+	Month     int    `json:"month,omitempty"`   // calendar anchor: month of year, yearly tier only
+}
+
+// IsUnlimited returns whether the tier keeps all of its backups
+func (t RetentionTier) IsUnlimited() bool {
+	return t.Retention == 0 && t.MaxAge == ""
+}
+
+// Cutoff returns the time before which backups of the tier are too old to keep,
+// or the zero time if the tier sets no max_age. Months and years are calendar months.
+func (t RetentionTier) Cutoff(now time.Time) (time.Time, error) {
+	if t.MaxAge == "" {
+		return time.Time{}, nil
+	}
+
+	for _, unit := range []struct {
+		suffix string
+		months int
+	}{{"mo", 1}, {"y", 12}} {
+		if n, err := strconv.Atoi(strings.TrimSuffix(t.MaxAge, unit.suffix)); err == nil && strings.HasSuffix(t.MaxAge, unit.suffix) {
+			if n <= 0 {
+				return time.Time{}, fmt.Errorf("invalid max_age %q: must be positive", t.MaxAge)
+			}
+			return now.AddDate(0, -n*unit.months, 0), nil
+		}
+	}
+
+	age, err := parseInterval(t.MaxAge)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid max_age %q: %w", t.MaxAge, err)
+	}
+	return now.Add(-age), nil
+}
+
+// IsAnchored returns whether the tier is scheduled on calendar slots instead of elapsed time
+func (t RetentionTier) IsAnchored() bool {
+	return t.At != "" || t.Weekday != "" || t.Day != 0 || t.Month != 0
 }
 
 // StorageDestination represents a storage backend configuration
@@ -18,15 +68,288 @@ type StorageDestination struct {
 // StorageConfig defines storage backend configuration
 type StorageConfig struct {
 	TempDir      string               `json:"temp_dir"`     // Temp directory for pg_dump
+	Streaming    bool                 `json:"streaming"`    // Pipe pg_dump output to backends instead of a temp file
 	Destinations []StorageDestination `json:"destinations"` // All configured backends
 }
 
+// Server backup modes
+const (
+	ModeLogical    = "logical"    // pg_dump of every discovered database
+	ModeBasebackup = "basebackup" // pg_basebackup of the whole cluster
+)
+
+// ServerConfig defines a PostgreSQL server whose databases are discovered at run time,
+// or which is backed up physically as a whole (mode "basebackup")
+type ServerConfig struct {
+	Host                string             `json:"host"`
+	Port                int                `json:"port,omitempty"`                 // optional, overrides global default
+	User                string             `json:"user"`                           // Used for discovery and for backing up every discovered database
+	Mode                string             `json:"mode,omitempty"`                 // logical (default) or basebackup
+	RetentionTiers      []RetentionTier    `json:"retention_tiers,omitempty"`      // Base backup tiers, or defaults for discovered databases
+	StorageDestinations []string           `json:"storage_destinations,omitempty"` // Base backup destinations, or defaults for discovered databases
+	ArchiveWAL          bool               `json:"archive_wal,omitempty"`          // Accept WAL from archive-wal and prune it with the base backups (basebackup mode)
+	MaintenanceDB       string             `json:"maintenance_db,omitempty"`       // Database to connect to for discovery (default: postgres)
+	Include             []string           `json:"include,omitempty"`              // Glob patterns, or regular expressions prefixed with "re:" (default: all)
+	Exclude             []string           `json:"exclude,omitempty"`              // Same syntax as include, applied after it
+	IncludeTemplates    bool               `json:"include_templates,omitempty"`    // Template databases are skipped unless set
+	Overrides           []DatabaseOverride `json:"overrides,omitempty"`            // First matching override applies
+}
+
+// DatabaseOverride customizes discovered databases whose name matches Pattern
+type DatabaseOverride struct {
+	Pattern             string          `json:"pattern"` // Same syntax as include/exclude
+	RetentionTiers      []RetentionTier `json:"retention_tiers,omitempty"`
+	StorageDestinations []string        `json:"storage_destinations,omitempty"`
+	Format              string          `json:"format,omitempty"`
+	Jobs                int             `json:"jobs,omitempty"`
+}
+
+// GetPort returns the effective port for a server (server-specific or global default)
+func (s *ServerConfig) GetPort(globalDefaults GlobalDefaults) int {
+	if s.Port > 0 {
+		return s.Port
+	}
+	if globalDefaults.Port > 0 {
+		return globalDefaults.Port
+	}
+	return 5432 // PostgreSQL default
+}
+
+// GetMode returns the backup mode of the server (defaults to logical)
+func (s *ServerConfig) GetMode() string {
+	if s.Mode != "" {
+		return s.Mode
+	}
+	return ModeLogical
+}
+
+// GetRetentionTiers returns the effective retention tiers for a server's base backups
+func (s *ServerConfig) GetRetentionTiers(globalDefaults GlobalDefaults) []RetentionTier {
+	if len(s.RetentionTiers) > 0 {
+		return s.RetentionTiers
+	}
+	return globalDefaults.RetentionTiers
+}
+
+// GetMaintenanceDB returns the database used to list the server's databases
+func (s *ServerConfig) GetMaintenanceDB() string {
+	if s.MaintenanceDB != "" {
+		return s.MaintenanceDB
+	}
+	return "postgres"
+}
+
+// GlobalsConfig defines the per-server backup of roles, tablespaces and grants (pg_dumpall --globals-only)
+type GlobalsConfig struct {
+	Enabled             bool            `json:"enabled"`                        // Back up globals of every distinct host/port in databases
+	User                string          `json:"user,omitempty"`                 // Defaults to the user of the first database on each server
+	RetentionTiers      []RetentionTier `json:"retention_tiers,omitempty"`      // Defaults to global_defaults.retention_tiers
+	StorageDestinations []string        `json:"storage_destinations,omitempty"` // Defaults to global_defaults.storage_destinations
+}
+
+// DaemonConfig defines the schedule of "pg_backuper daemon"
+type DaemonConfig struct {
+	Tick            string `json:"tick,omitempty"`             // How often due tiers are evaluated (default: 5m)
+	ShutdownTimeout string `json:"shutdown_timeout,omitempty"` // How long running backups may finish after SIGTERM (default: 10m)
+}
+
+// GetTick returns the interval between schedule evaluations
+func (d *DaemonConfig) GetTick() (time.Duration, error) {
+	return parseDuration(d.Tick, 5*time.Minute)
+}
+
+// GetShutdownTimeout returns how long running backups may finish after a shutdown request
+func (d *DaemonConfig) GetShutdownTimeout() (time.Duration, error) {
+	return parseDuration(d.ShutdownTimeout, 10*time.Minute)
+}
+
+// RotationConfig defines the safety guards of rotation
+type RotationConfig struct {
+	KeepLast         *int `json:"keep_last,omitempty"`             // Newest non-empty backups of a source never deleted (default: 1)
+	MaxDeleteFiles   int  `json:"max_delete_files,omitempty"`      // Most backups deleted per tier and run (0 = no limit)
+	MaxDeletePercent int  `json:"max_delete_percent,omitempty"`    // Most percent of a tier's backups deleted per run (0 = no limit)
+	RequireRecent    bool `json:"require_recent_backup,omitempty"` // Refuse deletions when the tier's newest backup is older than the tier interval
+}
+
+// GetKeepLast returns how many of the newest backups of a source rotation never deletes
+func (r *RotationConfig) GetKeepLast() int {
+	if r.KeepLast != nil {
+		return *r.KeepLast
+	}
+	return 1
+}
+
+// EncryptionConfig defines client-side encryption of backups before upload
+type EncryptionConfig struct {
+	Enabled bool            `json:"enabled"`
+	KeyID   string          `json:"key_id,omitempty"` // Key new backups are encrypted with
+	Keys    []EncryptionKey `json:"keys,omitempty"`   // Every key stored backups may be encrypted with
+}
+
+// EncryptionKey is an AES-256 key, read from a key file or derived from a passphrase
+type EncryptionKey struct {
+	ID            string `json:"id"`                       // Recorded in the header of every backup encrypted with the key
+	KeyFile       string `json:"key_file,omitempty"`       // File holding 32 bytes: raw, 64 hex digits or base64
+	PassphraseEnv string `json:"passphrase_env,omitempty"` // Environment variable holding a passphrase
+}
+
+// validate checks the key references, which the schema cannot express
+func (e *EncryptionConfig) validate() error {
+	ids := make(map[string]bool)
+	for _, key := range e.Keys {
+		if ids[key.ID] {
+			return fmt.Errorf("encryption: duplicate key id %q", key.ID)
+		}
+		ids[key.ID] = true
+		if (key.KeyFile == "") == (key.PassphraseEnv == "") {
+			return fmt.Errorf("encryption: key %q needs exactly one of key_file or passphrase_env", key.ID)
+		}
+	}
+	if e.Enabled && !ids[e.KeyID] {
+		return fmt.Errorf("encryption: key_id %q is not one of the configured keys", e.KeyID)
+	}
+	return nil
+}
+
+// RestoreTestConfig defines the server backups are test-restored on, in throwaway databases
+type RestoreTestConfig struct {
+	Host    string   `json:"host"`
+	Port    int      `json:"port,omitempty"`    // optional, overrides global default
+	User    string   `json:"user"`              // Needs CREATEDB; authenticated through .pgpass like backups
+	Tiers   []string `json:"tiers,omitempty"`   // Test after backups of these tiers (default: after every backup)
+	Timeout string   `json:"timeout,omitempty"` // Go duration a restore test may take, including download (default: 1h)
+}
+
+// GetPort returns the effective port of the restore test server
+func (r *RestoreTestConfig) GetPort(globalDefaults GlobalDefaults) int {
+	if r.Port > 0 {
+		return r.Port
+	}
+	if globalDefaults.Port > 0 {
+		return globalDefaults.Port
+	}
+	return 5432
+}
+
+// GetTimeout returns how long a restore test may take (default: 1h)
+func (r *RestoreTestConfig) GetTimeout() (time.Duration, error) {
+	return parseDuration(r.Timeout, time.Hour)
+}
+
+// DatabaseRestoreTest enables restore tests of a database and defines its sanity checks
+type DatabaseRestoreTest struct {
+	Enabled bool           `json:"enabled"`
+	Tiers   []string       `json:"tiers,omitempty"`  // optional, overrides restore_test.tiers
+	Checks  []RestoreCheck `json:"checks,omitempty"` // Run against the restored database, in order
+}
+
+// RestoreCheck is a sanity query run against a restored database. The query must return a
+// single value: true, or with min and/or max a number within those bounds.
+type RestoreCheck struct {
+	Name string   `json:"name"`
+	SQL  string   `json:"sql"`
+	Min  *float64 `json:"min,omitempty"`
+	Max  *float64 `json:"max,omitempty"`
+}
+
+// GetRestoreTestTiers returns the tiers whose backups are test-restored, or nil for every backup
+func (db *DatabaseConfig) GetRestoreTestTiers(cfg *Config) []string {
+	if db.RestoreTest != nil && len(db.RestoreTest.Tiers) > 0 {
+		return db.RestoreTest.Tiers
+	}
+	if cfg.RestoreTest != nil {
+		return cfg.RestoreTest.Tiers
+	}
+	return nil
+}
+
+// IsRestoreTested reports whether the backups of a database are test-restored
+func (db *DatabaseConfig) IsRestoreTested() bool {
+	return db.RestoreTest != nil && db.RestoreTest.Enabled
+}
+
+// validateRestoreTests checks that tested databases have a server to restore on, which the
+// schema cannot express
+func (c *Config) validateRestoreTests() error {
+	tiers, err := c.GetTiers()
+	if err != nil {
+		return err
+	}
+	checkTiers := func(where string, names []string) error {
+		for _, name := range names {
+			if _, ok := tiers.Lookup(name); !ok {
+				return fmt.Errorf("%s: unknown tier %q (define it in \"tiers\")", where, name)
+			}
+		}
+		return nil
+	}
+
+	if c.RestoreTest != nil {
+		if _, err := c.RestoreTest.GetTimeout(); err != nil {
+			return fmt.Errorf("restore_test: %w", err)
+		}
+		if err := checkTiers("restore_test", c.RestoreTest.Tiers); err != nil {
+			return err
+		}
+	}
+	for _, db := range c.Databases {
+		if !db.IsRestoreTested() {
+			continue
+		}
+		if c.RestoreTest == nil {
+			return fmt.Errorf("database %s: restore_test is enabled but no restore_test server is configured", db.Name)
+		}
+		if err := checkTiers("database "+db.Name+" restore_test", db.RestoreTest.Tiers); err != nil {
+			return err
+		}
+		for _, check := range db.RestoreTest.Checks {
+			if check.Min != nil && check.Max != nil && *check.Min > *check.Max {
+				return fmt.Errorf("database %s: restore check %q: min is greater than max", db.Name, check.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// parseDuration parses a Go duration string, returning def for an empty string
+func parseDuration(value string, def time.Duration) (time.Duration, error) {
+	if value == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q: %w", value, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("invalid duration %q: must be positive", value)
+	}
+	return d, nil
+}
+
 // GlobalDefaults defines default values applied to all databases
 type GlobalDefaults struct {
 	Port                int              `json:"port,omitempty"`                     // default PostgreSQL port
 	RetentionTiers      []RetentionTier  `json:"retention_tiers,omitempty"`          // default retention policy
 	PgpassFile          string           `json:"pgpass_file,omitempty"`              // path to .pgpass file
 	StorageDestinations []string         `json:"storage_destinations,omitempty"`     // default storage backends
+	Format              string           `json:"format,omitempty"`                   // default pg_dump format: custom, directory, tar, plain
+	Jobs                int              `json:"jobs,omitempty"`                     // default parallel pg_dump jobs (directory format only)
+	CompressDirectory   bool             `json:"compress_directory,omitempty"`       // gzip the packaged directory-format dump
+	Timezone            string           `json:"timezone,omitempty"`                 // IANA timezone of schedules and zone-less filename timestamps (default: UTC)
+	Windows             *WindowConfig    `json:"windows,omitempty"`                  // default backup windows and blackout periods
+}
+
+// GetLocation returns the timezone calendar-anchored tiers and backup windows are evaluated in,
+// independent of the host's local time
+func (g *GlobalDefaults) GetLocation() (*time.Location, error) {
+	if g.Timezone == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(g.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q: %w", g.Timezone, err)
+	}
+	return loc, nil
 }
 
 // DatabaseConfig defines configuration for a single database
@@ -38,17 +361,58 @@ type DatabaseConfig struct {
 	RetentionTiers      []RetentionTier `json:"retention_tiers,omitempty"`          // optional, overrides global default
 	Enabled             bool            `json:"enabled,omitempty"`                  // defaults to true if omitted
 	StorageDestinations []string        `json:"storage_destinations,omitempty"`     // override storage backends
+	Format              string          `json:"format,omitempty"`                   // optional, overrides global default
+	Jobs                int             `json:"jobs,omitempty"`                     // optional, overrides global default
+	CompressDirectory   bool            `json:"compress_directory,omitempty"`       // optional, enables gzip when global default is off
+	Windows             *WindowConfig   `json:"windows,omitempty"`                  // optional, overrides global default
+	RestoreTest         *DatabaseRestoreTest `json:"restore_test,omitempty"`       // optional, test-restores new backups
+}
+
+// WindowConfig restricts when scheduled backups of a database may start
+type WindowConfig struct {
+	Timezone  string      `json:"timezone,omitempty"`  // IANA timezone of the ranges (default: global_defaults.timezone)
+	Allowed   []TimeRange `json:"allowed,omitempty"`   // backups start only inside one of these ranges (default: any time)
+	Blackouts []TimeRange `json:"blackouts,omitempty"` // backups never start inside these ranges
+}
+
+// TimeRange is a daily time range; an end at or before the start crosses midnight
+type TimeRange struct {
+	Days  []string `json:"days,omitempty"` // weekdays the range starts on (default: every day)
+	Start string   `json:"start"`          // "HH:MM"
+	End   string   `json:"end"`            // "HH:MM", exclusive
+}
+
+// GetLocation returns the timezone the window ranges are evaluated in
+func (w *WindowConfig) GetLocation(globalDefaults GlobalDefaults) (*time.Location, error) {
+	if w.Timezone == "" {
+		return globalDefaults.GetLocation()
+	}
+	loc, err := time.LoadLocation(w.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid window timezone %q: %w", w.Timezone, err)
+	}
+	return loc, nil
 }
 
 // Config is the root configuration structure
 type Config struct {
 	BackupDir            string           `json:"backup_dir,omitempty"`             // DEPRECATED: Use storage.destinations instead
 	Storage              StorageConfig    `json:"storage"`
+	Globals              GlobalsConfig    `json:"globals,omitempty"`
+	Daemon               DaemonConfig     `json:"daemon,omitempty"`
+	Rotation             RotationConfig   `json:"rotation,omitempty"`
+	Encryption           EncryptionConfig `json:"encryption,omitempty"`
+	RestoreTest          *RestoreTestConfig `json:"restore_test,omitempty"`         // Server backups are test-restored on
+	Tiers                []TierDefinition `json:"tiers,omitempty"`                  // Custom tiers in addition to the built-in ones
 	GlobalDefaults       GlobalDefaults   `json:"global_defaults,omitempty"`
 	MaxConcurrentBackups int              `json:"max_concurrent_backups,omitempty"` // default: 3
 	LogLevel             string           `json:"log_level,omitempty"`              // debug, info, warn, error (default: info)
 	LogFormat            string           `json:"log_format,omitempty"`             // json, console (default: json)
 	Databases            []DatabaseConfig `json:"databases"`
+	Servers              []ServerConfig   `json:"servers,omitempty"`                // Servers whose databases are discovered at run time
+
+	IgnoreWindows   bool `json:"-"` // Set for manual runs (--ignore-windows): due tiers are never deferred
+	AllowMassDelete bool `json:"-"` // Set for manual runs (--allow-mass-delete): rotation deletion limits are lifted
 }
 
 // GetPort returns the effective port for a database (database-specific or global default)
@@ -70,6 +434,49 @@ func (db *DatabaseConfig) GetRetentionTiers(globalDefaults GlobalDefaults) []Ret
 	return globalDefaults.RetentionTiers
 }
 
+// GetWindows returns the effective backup windows for a database, or nil if backups may start any time
+func (db *DatabaseConfig) GetWindows(globalDefaults GlobalDefaults) *WindowConfig {
+	if db.Windows != nil {
+		return db.Windows
+	}
+	return globalDefaults.Windows
+}
+
+// GetFormat returns the effective pg_dump format for a database (defaults to custom)
+func (db *DatabaseConfig) GetFormat(globalDefaults GlobalDefaults) string {
+	if db.Format != "" {
+		return db.Format
+	}
+	if globalDefaults.Format != "" {
+		return globalDefaults.Format
+	}
+	return "custom"
+}
+
+// GetJobs returns the effective number of parallel pg_dump jobs (defaults to 1)
+func (db *DatabaseConfig) GetJobs(globalDefaults GlobalDefaults) int {
+	if db.Jobs > 0 {
+		return db.Jobs
+	}
+	if globalDefaults.Jobs > 0 {
+		return globalDefaults.Jobs
+	}
+	return 1
+}
+
+// GetCompressDirectory returns whether packaged directory-format dumps are gzip-compressed
+func (db *DatabaseConfig) GetCompressDirectory(globalDefaults GlobalDefaults) bool {
+	return db.CompressDirectory || globalDefaults.CompressDirectory
+}
+
+// GetRetentionTiers returns the effective retention tiers for globals backups
+func (g *GlobalsConfig) GetRetentionTiers(globalDefaults GlobalDefaults) []RetentionTier {
+	if len(g.RetentionTiers) > 0 {
+		return g.RetentionTiers
+	}
+	return globalDefaults.RetentionTiers
+}
+
 // IsEnabled returns whether the database backup is enabled (defaults to true)
 func (db *DatabaseConfig) IsEnabled() bool {
 	// If Enabled field is not set (zero value), default to true
@@ -87,6 +494,18 @@ func (c *Config) GetPgpassFile() string {
 	return ""
 }
 
+// GetTempDir returns the directory used for temporary dump files
+// Falls back to <backup_dir>/.tmp for legacy configs, then the system temp directory
+func (c *Config) GetTempDir() string {
+	if c.Storage.TempDir != "" {
+		return c.Storage.TempDir
+	}
+	if c.BackupDir != "" {
+		return filepath.Join(c.BackupDir, ".tmp")
+	}
+	return filepath.Join(os.TempDir(), "pg_backuper")
+}
+
 // GetMaxConcurrentBackups returns the max concurrent backups (defaults to 3)
 func (c *Config) GetMaxConcurrentBackups() int {
 	if c.MaxConcurrentBackups > 0 {
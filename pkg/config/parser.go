@@ -19,6 +19,37 @@ func ParseConfig(configFile string) (*Config, error) {
 		return nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
 
+	// Timezone names cannot be checked by the schema
+	if _, err := config.GlobalDefaults.GetLocation(); err != nil {
+		return nil, err
+	}
+
+	if config.GlobalDefaults.Windows != nil {
+		if _, err := config.GlobalDefaults.Windows.GetLocation(config.GlobalDefaults); err != nil {
+			return nil, err
+		}
+	}
+	for _, db := range config.Databases {
+		if db.Windows != nil {
+			if _, err := db.Windows.GetLocation(config.GlobalDefaults); err != nil {
+				return nil, fmt.Errorf("database %s: %w", db.Name, err)
+			}
+		}
+	}
+
+	// Tier names depend on the tier definitions, so they are checked here rather than in the schema
+	if err := config.validateTiers(); err != nil {
+		return nil, err
+	}
+
+	if err := config.Encryption.validate(); err != nil {
+		return nil, err
+	}
+
+	if err := config.validateRestoreTests(); err != nil {
+		return nil, err
+	}
+
 	// Set defaults for enabled flag
 	for i := range config.Databases {
 		// If Enabled is not explicitly set in JSON, default to true
@@ -24,11 +24,33 @@ const Schema = `{
                         "properties": {
                             "tier": {
                                 "type": "string",
-                                "enum": ["hourly", "daily", "weekly", "monthly", "quarterly", "yearly"]
+                                "pattern": "^[a-z0-9_]+(-[a-z0-9_]+)*$"
                             },
                             "retention": {
                                 "type": "integer",
                                 "minimum": 0
+                            },
+                            "max_age": {
+                                "type": "string",
+                                "pattern": "^([0-9]+(mo|y|d|w)|([0-9]+(\\.[0-9]+)?(ns|us|ms|s|m|h))+)$"
+                            },
+                            "at": {
+                                "type": "string",
+                                "pattern": "^([01][0-9]|2[0-3]):[0-5][0-9]$"
+                            },
+                            "weekday": {
+                                "type": "string",
+                                "enum": ["sunday", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday"]
+                            },
+                            "day": {
+                                "type": "integer",
+                                "minimum": 1,
+                                "maximum": 31
+                            },
+                            "month": {
+                                "type": "integer",
+                                "minimum": 1,
+                                "maximum": 12
                             }
                         },
                         "required": ["tier", "retention"]
@@ -36,6 +58,258 @@ const Schema = `{
                 },
                 "pgpass_file": {
                     "type": "string"
+                },
+                "format": {
+                    "type": "string",
+                    "enum": ["custom", "directory", "tar", "plain"]
+                },
+                "jobs": {
+                    "type": "integer",
+                    "minimum": 1
+                },
+                "compress_directory": {
+                    "type": "boolean"
+                },
+                "timezone": {
+                    "type": "string"
+                },
+                "windows": {
+                    "type": "object",
+                    "properties": {
+                        "timezone": {
+                            "type": "string"
+                        },
+                        "allowed": {
+                            "type": "array",
+                            "items": {
+                                "type": "object",
+                                "properties": {
+                                    "days": {
+                                        "type": "array",
+                                        "items": {
+                                            "type": "string",
+                                            "enum": ["sunday", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday"]
+                                        }
+                                    },
+                                    "start": {
+                                        "type": "string",
+                                        "pattern": "^([01][0-9]|2[0-3]):[0-5][0-9]$"
+                                    },
+                                    "end": {
+                                        "type": "string",
+                                        "pattern": "^([01][0-9]|2[0-3]):[0-5][0-9]$"
+                                    }
+                                },
+                                "required": ["start", "end"]
+                            }
+                        },
+                        "blackouts": {
+                            "type": "array",
+                            "items": {
+                                "type": "object",
+                                "properties": {
+                                    "days": {
+                                        "type": "array",
+                                        "items": {
+                                            "type": "string",
+                                            "enum": ["sunday", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday"]
+                                        }
+                                    },
+                                    "start": {
+                                        "type": "string",
+                                        "pattern": "^([01][0-9]|2[0-3]):[0-5][0-9]$"
+                                    },
+                                    "end": {
+                                        "type": "string",
+                                        "pattern": "^([01][0-9]|2[0-3]):[0-5][0-9]$"
+                                    }
+                                },
+                                "required": ["start", "end"]
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "tiers": {
+            "type": "array",
+            "items": {
+                "type": "object",
+                "properties": {
+                    "name": {
+                        "type": "string",
+                        "pattern": "^[a-z0-9_]+(-[a-z0-9_]+)*$"
+                    },
+                    "interval": {
+                        "type": "string",
+                        "pattern": "^([0-9]+[dw]|([0-9]+(\\.[0-9]+)?(ns|us|ms|s|m|h))+)$"
+                    },
+                    "calendar": {
+                        "type": "string",
+                        "enum": ["hour", "day", "week", "month", "year"]
+                    },
+                    "every": {
+                        "type": "integer",
+                        "minimum": 1
+                    }
+                },
+                "required": ["name"],
+                "anyOf": [
+                    {"required": ["interval"]},
+                    {"required": ["calendar"]}
+                ]
+            }
+        },
+        "daemon": {
+            "type": "object",
+            "properties": {
+                "tick": {
+                    "type": "string",
+                    "pattern": "^([0-9]+(\\.[0-9]+)?(ns|us|ms|s|m|h))+$"
+                },
+                "shutdown_timeout": {
+                    "type": "string",
+                    "pattern": "^([0-9]+(\\.[0-9]+)?(ns|us|ms|s|m|h))+$"
+                }
+            }
+        },
+        "rotation": {
+            "type": "object",
+            "properties": {
+                "keep_last": {
+                    "type": "integer",
+                    "minimum": 0
+                },
+                "max_delete_files": {
+                    "type": "integer",
+                    "minimum": 0
+                },
+                "max_delete_percent": {
+                    "type": "integer",
+                    "minimum": 0,
+                    "maximum": 100
+                },
+                "require_recent_backup": {
+                    "type": "boolean"
+                }
+            }
+        },
+        "encryption": {
+            "type": "object",
+            "properties": {
+                "enabled": {
+                    "type": "boolean"
+                },
+                "key_id": {
+                    "type": "string",
+                    "minLength": 1
+                },
+                "keys": {
+                    "type": "array",
+                    "items": {
+                        "type": "object",
+                        "required": ["id"],
+                        "properties": {
+                            "id": {
+                                "type": "string",
+                                "minLength": 1
+                            },
+                            "key_file": {
+                                "type": "string",
+                                "minLength": 1
+                            },
+                            "passphrase_env": {
+                                "type": "string",
+                                "minLength": 1
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "restore_test": {
+            "type": "object",
+            "properties": {
+                "host": {
+                    "type": "string",
+                    "minLength": 1
+                },
+                "port": {
+                    "type": "integer",
+                    "minimum": 1,
+                    "maximum": 65535
+                },
+                "user": {
+                    "type": "string",
+                    "minLength": 1
+                },
+                "tiers": {
+                    "type": "array",
+                    "items": {
+                        "type": "string",
+                        "pattern": "^[a-z0-9_]+(-[a-z0-9_]+)*$"
+                    }
+                },
+                "timeout": {
+                    "type": "string",
+                    "pattern": "^([0-9]+(\\.[0-9]+)?(ns|us|ms|s|m|h))+$"
+                }
+            },
+            "required": ["host", "user"]
+        },
+        "globals": {
+            "type": "object",
+            "properties": {
+                "enabled": {
+                    "type": "boolean"
+                },
+                "user": {
+                    "type": "string"
+                },
+                "retention_tiers": {
+                    "type": "array",
+                    "items": {
+                        "type": "object",
+                        "properties": {
+                            "tier": {
+                                "type": "string",
+                                "pattern": "^[a-z0-9_]+(-[a-z0-9_]+)*$"
+                            },
+                            "retention": {
+                                "type": "integer",
+                                "minimum": 0
+                            },
+                            "max_age": {
+                                "type": "string",
+                                "pattern": "^([0-9]+(mo|y|d|w)|([0-9]+(\\.[0-9]+)?(ns|us|ms|s|m|h))+)$"
+                            },
+                            "at": {
+                                "type": "string",
+                                "pattern": "^([01][0-9]|2[0-3]):[0-5][0-9]$"
+                            },
+                            "weekday": {
+                                "type": "string",
+                                "enum": ["sunday", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday"]
+                            },
+                            "day": {
+                                "type": "integer",
+                                "minimum": 1,
+                                "maximum": 31
+                            },
+                            "month": {
+                                "type": "integer",
+                                "minimum": 1,
+                                "maximum": 12
+                            }
+                        },
+                        "required": ["tier", "retention"]
+                    }
+                },
+                "storage_destinations": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
                 }
             }
         },
@@ -51,6 +325,161 @@ const Schema = `{
             "type": "string",
             "enum": ["json", "console"]
         },
+        "servers": {
+            "type": "array",
+            "items": {
+                "type": "object",
+                "properties": {
+                    "host": {
+                        "type": "string"
+                    },
+                    "port": {
+                        "type": "integer",
+                        "minimum": 1,
+                        "maximum": 65535
+                    },
+                    "user": {
+                        "type": "string"
+                    },
+                    "mode": {
+                        "type": "string",
+                        "enum": ["logical", "basebackup"]
+                    },
+                    "retention_tiers": {
+                        "type": "array",
+                        "items": {
+                            "type": "object",
+                            "properties": {
+                                "tier": {
+                                    "type": "string",
+                                    "pattern": "^[a-z0-9_]+(-[a-z0-9_]+)*$"
+                                },
+                                "retention": {
+                                    "type": "integer",
+                                    "minimum": 0
+                                },
+                                "max_age": {
+                                    "type": "string",
+                                    "pattern": "^([0-9]+(mo|y|d|w)|([0-9]+(\\.[0-9]+)?(ns|us|ms|s|m|h))+)$"
+                                },
+                                "at": {
+                                    "type": "string",
+                                    "pattern": "^([01][0-9]|2[0-3]):[0-5][0-9]$"
+                                },
+                                "weekday": {
+                                    "type": "string",
+                                    "enum": ["sunday", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday"]
+                                },
+                                "day": {
+                                    "type": "integer",
+                                    "minimum": 1,
+                                    "maximum": 31
+                                },
+                                "month": {
+                                    "type": "integer",
+                                    "minimum": 1,
+                                    "maximum": 12
+                                }
+                            },
+                            "required": ["tier", "retention"]
+                        }
+                    },
+                    "storage_destinations": {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        }
+                    },
+                    "archive_wal": {
+                        "type": "boolean"
+                    },
+                    "maintenance_db": {
+                        "type": "string"
+                    },
+                    "include": {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        }
+                    },
+                    "exclude": {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        }
+                    },
+                    "include_templates": {
+                        "type": "boolean"
+                    },
+                    "overrides": {
+                        "type": "array",
+                        "items": {
+                            "type": "object",
+                            "properties": {
+                                "pattern": {
+                                    "type": "string"
+                                },
+                                "retention_tiers": {
+                            "type": "array",
+                            "items": {
+                                "type": "object",
+                                "properties": {
+                                    "tier": {
+                                        "type": "string",
+                                        "pattern": "^[a-z0-9_]+(-[a-z0-9_]+)*$"
+                                    },
+                                    "retention": {
+                                        "type": "integer",
+                                        "minimum": 0
+                                    },
+                                    "max_age": {
+                                        "type": "string",
+                                        "pattern": "^([0-9]+(mo|y|d|w)|([0-9]+(\\.[0-9]+)?(ns|us|ms|s|m|h))+)$"
+                                    },
+                                    "at": {
+                                        "type": "string",
+                                        "pattern": "^([01][0-9]|2[0-3]):[0-5][0-9]$"
+                                    },
+                                    "weekday": {
+                                        "type": "string",
+                                        "enum": ["sunday", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday"]
+                                    },
+                                    "day": {
+                                        "type": "integer",
+                                        "minimum": 1,
+                                        "maximum": 31
+                                    },
+                                    "month": {
+                                        "type": "integer",
+                                        "minimum": 1,
+                                        "maximum": 12
+                                    }
+                                },
+                                "required": ["tier", "retention"]
+                            }
+                        },
+                                "storage_destinations": {
+                                    "type": "array",
+                                    "items": {
+                                        "type": "string"
+                                    }
+                                },
+                                "format": {
+                                    "type": "string",
+                                    "enum": ["custom", "directory", "tar", "plain"]
+                                },
+                                "jobs": {
+                                    "type": "integer",
+                                    "minimum": 1
+                                }
+                            },
+                            "required": ["pattern"]
+                        }
+                    }
+                },
+                "required": ["host", "user"]
+            }
+        },
         "databases": {
             "type": "array",
             "items": {
@@ -78,11 +507,33 @@ const Schema = `{
                             "properties": {
                                 "tier": {
                                     "type": "string",
-                                    "enum": ["hourly", "daily", "weekly", "monthly", "quarterly", "yearly"]
+                                    "pattern": "^[a-z0-9_]+(-[a-z0-9_]+)*$"
                                 },
                                 "retention": {
                                     "type": "integer",
                                     "minimum": 0
+                                },
+                                "max_age": {
+                                    "type": "string",
+                                    "pattern": "^([0-9]+(mo|y|d|w)|([0-9]+(\\.[0-9]+)?(ns|us|ms|s|m|h))+)$"
+                                },
+                                "at": {
+                                    "type": "string",
+                                    "pattern": "^([01][0-9]|2[0-3]):[0-5][0-9]$"
+                                },
+                                "weekday": {
+                                    "type": "string",
+                                    "enum": ["sunday", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday"]
+                                },
+                                "day": {
+                                    "type": "integer",
+                                    "minimum": 1,
+                                    "maximum": 31
+                                },
+                                "month": {
+                                    "type": "integer",
+                                    "minimum": 1,
+                                    "maximum": 12
                                 }
                             },
                             "required": ["tier", "retention"]
@@ -90,6 +541,111 @@ const Schema = `{
                     },
                     "enabled": {
                         "type": "boolean"
+                    },
+                    "format": {
+                        "type": "string",
+                        "enum": ["custom", "directory", "tar", "plain"]
+                    },
+                    "jobs": {
+                        "type": "integer",
+                        "minimum": 1
+                    },
+                    "compress_directory": {
+                        "type": "boolean"
+                    },
+                    "windows": {
+                        "type": "object",
+                        "properties": {
+                            "timezone": {
+                                "type": "string"
+                            },
+                            "allowed": {
+                                "type": "array",
+                                "items": {
+                                    "type": "object",
+                                    "properties": {
+                                        "days": {
+                                            "type": "array",
+                                            "items": {
+                                                "type": "string",
+                                                "enum": ["sunday", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday"]
+                                            }
+                                        },
+                                        "start": {
+                                            "type": "string",
+                                            "pattern": "^([01][0-9]|2[0-3]):[0-5][0-9]$"
+                                        },
+                                        "end": {
+                                            "type": "string",
+                                            "pattern": "^([01][0-9]|2[0-3]):[0-5][0-9]$"
+                                        }
+                                    },
+                                    "required": ["start", "end"]
+                                }
+                            },
+                            "blackouts": {
+                                "type": "array",
+                                "items": {
+                                    "type": "object",
+                                    "properties": {
+                                        "days": {
+                                            "type": "array",
+                                            "items": {
+                                                "type": "string",
+                                                "enum": ["sunday", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday"]
+                                            }
+                                        },
+                                        "start": {
+                                            "type": "string",
+                                            "pattern": "^([01][0-9]|2[0-3]):[0-5][0-9]$"
+                                        },
+                                        "end": {
+                                            "type": "string",
+                                            "pattern": "^([01][0-9]|2[0-3]):[0-5][0-9]$"
+                                        }
+                                    },
+                                    "required": ["start", "end"]
+                                }
+                            }
+                        }
+                    },
+                    "restore_test": {
+                        "type": "object",
+                        "properties": {
+                            "enabled": {
+                                "type": "boolean"
+                            },
+                            "tiers": {
+                                "type": "array",
+                                "items": {
+                                    "type": "string",
+                                    "pattern": "^[a-z0-9_]+(-[a-z0-9_]+)*$"
+                                }
+                            },
+                            "checks": {
+                                "type": "array",
+                                "items": {
+                                    "type": "object",
+                                    "properties": {
+                                        "name": {
+                                            "type": "string",
+                                            "minLength": 1
+                                        },
+                                        "sql": {
+                                            "type": "string",
+                                            "minLength": 1
+                                        },
+                                        "min": {
+                                            "type": "number"
+                                        },
+                                        "max": {
+                                            "type": "number"
+                                        }
+                                    },
+                                    "required": ["name", "sql"]
+                                }
+                            }
+                        }
                     }
                 },
                 "required": ["name", "user", "host"]
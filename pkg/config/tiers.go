@@ -0,0 +1,196 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Calendar units of tier slots
+const (
+	UnitHour  = "hour"
+	UnitDay   = "day"
+	UnitWeek  = "week"
+	UnitMonth = "month"
+	UnitYear  = "year"
+)
+
+// unitLength is the nominal length of a calendar unit, used to order calendar-defined tiers
+var unitLength = map[string]time.Duration{
+	UnitHour:  time.Hour,
+	UnitDay:   24 * time.Hour,
+	UnitWeek:  7 * 24 * time.Hour,
+	UnitMonth: 30 * 24 * time.Hour,
+	UnitYear:  365 * 24 * time.Hour,
+}
+
+// tierNamePattern keeps tier names usable in filenames and glob patterns (no "--", no wildcards)
+var tierNamePattern = regexp.MustCompile(`^[a-z0-9_]+(-[a-z0-9_]+)*$`)
+
+// TierDefinition declares a custom tier in the config file
+type TierDefinition struct {
+	Name     string `json:"name"`               // used in retention_tiers and backup filenames, e.g. "biweekly"
+	Interval string `json:"interval,omitempty"` // time between backups: Go duration or days/weeks ("15m", "14d", "2w")
+	Calendar string `json:"calendar,omitempty"` // calendar rule instead of an interval: hour, day, week, month, year
+	Every    int    `json:"every,omitempty"`    // calendar units per slot (default: 1), e.g. month + 6 = semiannual
+}
+
+// Tier is a resolved tier definition
+type Tier struct {
+	Name     string
+	Interval time.Duration // time between backups when scheduled by elapsed time; also orders the tiers
+	Unit     string        // calendar unit of the tier's slots, empty if the tier has no calendar rule
+	Every    int           // calendar units per slot
+	Calendar bool          // scheduled on calendar slots even when the retention tier sets no anchor
+}
+
+// Tiers is a set of tier definitions ordered by interval (shortest first)
+type Tiers []Tier
+
+// BuiltinTiers are the tiers available without any tier definition
+var BuiltinTiers = Tiers{
+	{Name: "hourly", Interval: time.Hour, Unit: UnitHour, Every: 1},
+	{Name: "daily", Interval: 24 * time.Hour, Unit: UnitDay, Every: 1},
+	{Name: "weekly", Interval: 7 * 24 * time.Hour, Unit: UnitWeek, Every: 1},
+	{Name: "monthly", Interval: 30 * 24 * time.Hour, Unit: UnitMonth, Every: 1},
+	{Name: "quarterly", Interval: 90 * 24 * time.Hour, Unit: UnitMonth, Every: 3},
+	{Name: "yearly", Interval: 365 * 24 * time.Hour, Unit: UnitYear, Every: 1},
+}
+
+// Lookup returns the tier with the given name
+func (t Tiers) Lookup(name string) (Tier, bool) {
+	for _, tier := range t {
+		if tier.Name == name {
+			return tier, true
+		}
+	}
+	return Tier{}, false
+}
+
+// Resolve validates a tier definition and computes its interval
+func (d TierDefinition) Resolve() (Tier, error) {
+	tier := Tier{Name: d.Name, Unit: d.Calendar, Every: d.Every}
+
+	if !tierNamePattern.MatchString(d.Name) {
+		return tier, fmt.Errorf("invalid tier name %q: use lowercase letters, digits, '_' and single '-'", d.Name)
+	}
+	if tier.Every == 0 {
+		tier.Every = 1
+	}
+	if tier.Every < 0 {
+		return tier, fmt.Errorf("tier %s: every must be positive", d.Name)
+	}
+
+	if d.Calendar != "" {
+		length, ok := unitLength[d.Calendar]
+		if !ok {
+			return tier, fmt.Errorf("tier %s: invalid calendar unit %q", d.Name, d.Calendar)
+		}
+		tier.Interval = length * time.Duration(tier.Every)
+		tier.Calendar = d.Interval == ""
+	}
+
+	if d.Interval != "" {
+		interval, err := parseInterval(d.Interval)
+		if err != nil {
+			return tier, fmt.Errorf("tier %s: %w", d.Name, err)
+		}
+		tier.Interval = interval
+	}
+
+	if tier.Interval == 0 {
+		return tier, fmt.Errorf("tier %s: interval or calendar is required", d.Name)
+	}
+	return tier, nil
+}
+
+// parseInterval parses a Go duration, or a whole number of days ("14d") or weeks ("2w")
+func parseInterval(value string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, err := strconv.Atoi(strings.TrimSuffix(value, suffix)); err == nil && strings.HasSuffix(value, suffix) {
+			if n <= 0 {
+				return 0, fmt.Errorf("invalid interval %q: must be positive", value)
+			}
+			return time.Duration(n) * unit, nil
+		}
+	}
+	return parseDuration(value, 0)
+}
+
+// GetTiers returns the built-in tiers plus the tiers defined in the config, ordered by interval.
+// A definition with the name of a built-in tier replaces it.
+func (c *Config) GetTiers() (Tiers, error) {
+	tiers := make(Tiers, 0, len(BuiltinTiers)+len(c.Tiers))
+	defined := make(map[string]bool)
+
+	for _, def := range c.Tiers {
+		if defined[def.Name] {
+			return nil, fmt.Errorf("tier %s is defined more than once", def.Name)
+		}
+		defined[def.Name] = true
+
+		tier, err := def.Resolve()
+		if err != nil {
+			return nil, err
+		}
+		tiers = append(tiers, tier)
+	}
+
+	for _, tier := range BuiltinTiers {
+		if !defined[tier.Name] {
+			tiers = append(tiers, tier)
+		}
+	}
+
+	sort.SliceStable(tiers, func(i, j int) bool {
+		return tiers[i].Interval < tiers[j].Interval
+	})
+	return tiers, nil
+}
+
+// validateTiers checks the tier definitions and that every retention tier refers to a defined tier
+// and has a valid max_age
+func (c *Config) validateTiers() error {
+	tiers, err := c.GetTiers()
+	if err != nil {
+		return err
+	}
+
+	check := func(where string, retentionTiers []RetentionTier) error {
+		for _, rt := range retentionTiers {
+			if _, ok := tiers.Lookup(rt.Tier); !ok {
+				return fmt.Errorf("%s: unknown tier %q (define it in \"tiers\")", where, rt.Tier)
+			}
+			if _, err := rt.Cutoff(time.Now()); err != nil {
+				return fmt.Errorf("%s: tier %s: %w", where, rt.Tier, err)
+			}
+		}
+		return nil
+	}
+
+	if err := check("global_defaults", c.GlobalDefaults.RetentionTiers); err != nil {
+		return err
+	}
+	if err := check("globals", c.Globals.RetentionTiers); err != nil {
+		return err
+	}
+	for _, db := range c.Databases {
+		if err := check("database "+db.Name, db.RetentionTiers); err != nil {
+			return err
+		}
+	}
+	for _, server := range c.Servers {
+		if err := check("server "+server.Host, server.RetentionTiers); err != nil {
+			return err
+		}
+		for _, override := range server.Overrides {
+			if err := check("server "+server.Host+" override "+override.Pattern, override.RetentionTiers); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,231 @@
+package daemon
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/williamokano/pg_backuper/pkg/backup"
+	"github.com/williamokano/pg_backuper/pkg/config"
+)
+
+// defaultTierInterval is how often sources without retention tiers are backed up,
+// matching the hourly cron schedule the Docker image used before the daemon
+const defaultTierInterval = time.Hour
+
+// Options tune a daemon beyond the daemon section of the config
+type Options struct {
+	DelayFirstRun bool // Wait one tick before the first evaluation instead of running at startup
+}
+
+// Daemon evaluates the schedule of every backup source on a fixed tick and
+// runs the backups when any of them is due
+type Daemon struct {
+	logger          zerolog.Logger
+	tick            time.Duration
+	shutdownTimeout time.Duration
+	delayFirstRun   bool
+
+	// plan and backup are replaced in tests
+	plan   func(ctx context.Context, now time.Time) []backup.PlannedBackup
+	backup func(ctx context.Context, now time.Time) ([]backup.Result, error)
+
+	lastRun    time.Time            // Start of the last backup run
+	nextLogged map[string]time.Time // Last logged next run per source, to log changes only
+}
+
+// New creates a daemon for cfg
+func New(cfg *config.Config, opts Options, logger zerolog.Logger) (*Daemon, error) {
+	tick, err := cfg.Daemon.GetTick()
+	if err != nil {
+		return nil, err
+	}
+	shutdownTimeout, err := cfg.Daemon.GetShutdownTimeout()
+	if err != nil {
+		return nil, err
+	}
+
+	// Evaluating the schedule logs every tier of every source; only warnings are kept for the tick
+	quiet := logger.Level(zerolog.WarnLevel)
+
+	return &Daemon{
+		logger:          logger,
+		tick:            tick,
+		shutdownTimeout: shutdownTimeout,
+		delayFirstRun:   opts.DelayFirstRun,
+		plan: func(ctx context.Context, now time.Time) []backup.PlannedBackup {
+			return backup.Plan(ctx, cfg, now, quiet)
+		},
+		backup: func(ctx context.Context, now time.Time) ([]backup.Result, error) {
+			return backup.BackupAll(ctx, cfg, now, logger)
+		},
+		nextLogged: make(map[string]time.Time),
+	}, nil
+}
+
+// Run evaluates the schedule every tick until ctx is cancelled. A backup run in progress
+// at that point may finish within the shutdown timeout; it is cancelled (stopping pg_dump)
+// once the timeout expires or force is cancelled.
+func (d *Daemon) Run(ctx, force context.Context) {
+	work, cancelWork := context.WithCancel(context.Background())
+	defer cancelWork()
+
+	done := make(chan struct{})
+	defer close(done)
+	go d.watchShutdown(ctx, force, done, cancelWork)
+
+	d.logger.Info().
+		Dur("tick", d.tick).
+		Dur("shutdown_timeout", d.shutdownTimeout).
+		Msg("daemon started")
+
+	ticker := time.NewTicker(d.tick)
+	defer ticker.Stop()
+
+	if d.delayFirstRun {
+		select {
+		case <-ctx.Done():
+			d.logger.Info().Msg("daemon stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+
+	for {
+		if ctx.Err() != nil {
+			break
+		}
+
+		// Ticks missed during a long run are dropped by the ticker, so runs never overlap
+		d.runTick(work, time.Now())
+
+		select {
+		case <-ctx.Done():
+		case <-ticker.C:
+		}
+	}
+
+	d.logger.Info().Msg("daemon stopped")
+}
+
+// watchShutdown cancels in-flight work once a shutdown request outlives the timeout
+func (d *Daemon) watchShutdown(ctx, force context.Context, done <-chan struct{}, cancelWork context.CancelFunc) {
+	select {
+	case <-ctx.Done():
+	case <-done:
+		return
+	}
+
+	d.logger.Info().
+		Dur("timeout", d.shutdownTimeout).
+		Msg("shutdown requested, waiting for running backups to finish")
+
+	timer := time.NewTimer(d.shutdownTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		d.logger.Warn().Msg("shutdown timeout reached, cancelling running backups")
+	case <-force.Done():
+		d.logger.Warn().Msg("forced shutdown, cancelling running backups")
+	case <-done:
+		return
+	}
+	cancelWork()
+}
+
+// runTick evaluates the schedule and runs the backups if anything is due
+func (d *Daemon) runTick(ctx context.Context, now time.Time) {
+	due := false
+	for _, planned := range d.plan(ctx, now) {
+		log := d.logger.With().Str("database", planned.Name).Logger()
+		if planned.Kind != "" {
+			log = log.With().Str("kind", planned.Kind).Logger()
+		}
+
+		if planned.Err != nil {
+			log.Warn().Err(planned.Err).Msg("cannot determine schedule")
+			continue
+		}
+
+		if len(planned.Schedule.Next) == 0 {
+			// No retention tiers: backed up on a fixed interval
+			if d.lastRun.IsZero() || now.Sub(d.lastRun) >= defaultTierInterval {
+				due = true
+			}
+			continue
+		}
+
+		if len(planned.Schedule.Due) > 0 {
+			log.Info().Strs("due_tiers", planned.Schedule.Due).Msg("backup is due")
+			due = true
+			continue
+		}
+
+		if len(planned.Schedule.Backfill) > 0 {
+			log.Info().Int("missing_copies", len(planned.Schedule.Backfill)).Msg("backups missing on some destinations")
+			due = true
+			continue
+		}
+
+		d.logNext(log, planned)
+	}
+
+	if !due {
+		return
+	}
+
+	d.lastRun = now
+	results, err := d.backup(ctx, now)
+	if err != nil {
+		d.logger.Error().Err(err).Msg("backup run failed")
+	}
+
+	succeeded, skipped, failed, backfilled, blocked := 0, 0, 0, 0, 0
+	restoresPassed, restoresFailed := 0, 0
+	for _, result := range results {
+		backfilled += len(result.Backfilled)
+		blocked += len(result.Blocked)
+		if result.RestoreTest != nil {
+			if result.RestoreTest.Success {
+				restoresPassed++
+			} else {
+				restoresFailed++
+			}
+		}
+		switch {
+		case result.Skipped:
+			skipped++
+		case result.Success:
+			succeeded++
+		default:
+			failed++
+		}
+	}
+
+	d.logger.Info().
+		Int("successful", succeeded).
+		Int("skipped", skipped).
+		Int("failed", failed).
+		Int("backfilled", backfilled).
+		Int("blocked_deletions", blocked).
+		Int("restore_tests_passed", restoresPassed).
+		Int("restore_tests_failed", restoresFailed).
+		Dur("duration", time.Since(now)).
+		Msg("backup run completed")
+}
+
+// logNext logs the next planned run of a source when it changed since the last tick
+func (d *Daemon) logNext(log zerolog.Logger, planned backup.PlannedBackup) {
+	key := planned.Kind + "/" + planned.Name
+	next := planned.Schedule.NextRun()
+	if previous, ok := d.nextLogged[key]; ok && previous.Equal(next) {
+		return
+	}
+	d.nextLogged[key] = next
+
+	log.Info().
+		Time("next_run", next).
+		Dur("in", time.Until(next).Round(time.Second)).
+		Msg("next planned backup")
+}
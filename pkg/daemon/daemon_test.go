@@ -0,0 +1,169 @@
+package daemon
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/williamokano/pg_backuper/pkg/backup"
+)
+
+// newTestDaemon returns a daemon whose plan always returns planned and whose backup runs fn
+func newTestDaemon(planned []backup.PlannedBackup, fn func(ctx context.Context) ([]backup.Result, error)) (*Daemon, *int32) {
+	var runs int32
+	d := &Daemon{
+		logger:          zerolog.Nop(),
+		tick:            time.Hour,
+		shutdownTimeout: time.Hour,
+		plan: func(ctx context.Context, now time.Time) []backup.PlannedBackup {
+			return planned
+		},
+		backup: func(ctx context.Context, now time.Time) ([]backup.Result, error) {
+			atomic.AddInt32(&runs, 1)
+			if fn == nil {
+				return nil, nil
+			}
+			return fn(ctx)
+		},
+		nextLogged: make(map[string]time.Time),
+	}
+	return d, &runs
+}
+
+func TestRunTick(t *testing.T) {
+	now := time.Date(2025, 12, 20, 10, 0, 0, 0, time.UTC)
+
+	t.Run("nothing_due", func(t *testing.T) {
+		d, runs := newTestDaemon([]backup.PlannedBackup{
+			{Name: "app", Schedule: backup.TierSchedule{Next: map[string]time.Time{"daily": now.Add(time.Hour)}}},
+		}, nil)
+
+		d.runTick(context.Background(), now)
+		assert.EqualValues(t, 0, *runs)
+		assert.Equal(t, now.Add(time.Hour), d.nextLogged["/app"])
+	})
+
+	t.Run("due_tier_runs_backups", func(t *testing.T) {
+		d, runs := newTestDaemon([]backup.PlannedBackup{
+			{Name: "app", Schedule: backup.TierSchedule{Next: map[string]time.Time{"daily": now.Add(time.Hour)}}},
+			{Name: "pg1-5432", Kind: "globals", Schedule: backup.TierSchedule{Due: []string{"daily"}, Next: map[string]time.Time{"daily": now}}},
+		}, nil)
+
+		d.runTick(context.Background(), now)
+		assert.EqualValues(t, 1, *runs)
+	})
+
+	t.Run("missing_copies_run_backups", func(t *testing.T) {
+		d, runs := newTestDaemon([]backup.PlannedBackup{
+			{Name: "app", Schedule: backup.TierSchedule{
+				Next:     map[string]time.Time{"daily": now.Add(time.Hour)},
+				Backfill: []backup.Backfill{{Tier: "daily", Path: "app--daily--2025-12-20T02-00-00Z.backup", Source: "local", Targets: []string{"s3"}}},
+			}},
+		}, nil)
+
+		d.runTick(context.Background(), now)
+		assert.EqualValues(t, 1, *runs)
+	})
+
+	t.Run("planning_errors_do_not_trigger_runs", func(t *testing.T) {
+		d, runs := newTestDaemon([]backup.PlannedBackup{
+			{Name: "pg9-5432", Kind: backup.KindDiscovery, Err: assert.AnError},
+		}, nil)
+
+		d.runTick(context.Background(), now)
+		assert.EqualValues(t, 0, *runs)
+	})
+
+	t.Run("sources_without_tiers_run_hourly", func(t *testing.T) {
+		d, runs := newTestDaemon([]backup.PlannedBackup{
+			{Name: "app", Schedule: backup.TierSchedule{Due: []string{"default"}, Next: map[string]time.Time{}}},
+		}, nil)
+
+		d.runTick(context.Background(), now)
+		d.runTick(context.Background(), now.Add(5*time.Minute))
+		assert.EqualValues(t, 1, *runs)
+
+		d.runTick(context.Background(), now.Add(time.Hour))
+		assert.EqualValues(t, 2, *runs)
+	})
+}
+
+func TestRun_Shutdown(t *testing.T) {
+	due := []backup.PlannedBackup{
+		{Name: "app", Schedule: backup.TierSchedule{Due: []string{"daily"}, Next: map[string]time.Time{"daily": time.Now()}}},
+	}
+
+	// run starts the daemon with a backup that blocks until release or cancellation,
+	// cancels ctx once the backup is running, and returns whether the backup was cancelled
+	run := func(t *testing.T, shutdownTimeout time.Duration, release <-chan struct{}, forceAfterStop bool) bool {
+		t.Helper()
+
+		started := make(chan struct{})
+		var cancelled atomic.Bool
+		d, _ := newTestDaemon(due, func(ctx context.Context) ([]backup.Result, error) {
+			close(started)
+			select {
+			case <-ctx.Done():
+				cancelled.Store(true)
+			case <-release:
+			}
+			return nil, ctx.Err()
+		})
+		d.shutdownTimeout = shutdownTimeout
+
+		ctx, stop := context.WithCancel(context.Background())
+		force, forceStop := context.WithCancel(context.Background())
+		defer forceStop()
+
+		finished := make(chan struct{})
+		go func() {
+			d.Run(ctx, force)
+			close(finished)
+		}()
+
+		<-started
+		stop()
+		if forceAfterStop {
+			forceStop()
+		}
+
+		select {
+		case <-finished:
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "daemon did not stop")
+		}
+		return cancelled.Load()
+	}
+
+	t.Run("running_backup_finishes", func(t *testing.T) {
+		release := make(chan struct{})
+		time.AfterFunc(50*time.Millisecond, func() { close(release) })
+
+		assert.False(t, run(t, time.Hour, release, false))
+	})
+
+	t.Run("timeout_cancels_running_backup", func(t *testing.T) {
+		assert.True(t, run(t, 10*time.Millisecond, nil, false))
+	})
+
+	t.Run("force_cancels_running_backup", func(t *testing.T) {
+		assert.True(t, run(t, time.Hour, nil, true))
+	})
+}
+
+func TestRun_DelayFirstRun(t *testing.T) {
+	d, runs := newTestDaemon([]backup.PlannedBackup{
+		{Name: "app", Schedule: backup.TierSchedule{Due: []string{"daily"}, Next: map[string]time.Time{"daily": time.Now()}}},
+	}, nil)
+	d.delayFirstRun = true
+
+	ctx, stop := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, stop)
+	d.Run(ctx, context.Background())
+
+	assert.EqualValues(t, 0, *runs)
+}
@@ -0,0 +1,195 @@
+package discovery
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/williamokano/pg_backuper/pkg/config"
+)
+
+// listQuery returns every database that accepts connections (template0 does not)
+const listQuery = "SELECT datname, datistemplate FROM pg_database WHERE datallowconn ORDER BY datname"
+
+// fieldSeparator separates psql output columns; it cannot appear in a database name
+const fieldSeparator = "\x1f"
+
+// validName matches database names that are safe to use in backup filenames
+var validName = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+// Database is a database found on a server
+type Database struct {
+	Name       string
+	IsTemplate bool
+}
+
+// ListDatabases connects to the server with psql (authenticated via pgpass) and lists its databases
+func ListDatabases(ctx context.Context, server config.ServerConfig, port int, pgpassPath string) ([]Database, error) {
+	cmd := exec.CommandContext(ctx, "psql",
+		"-h", server.Host,
+		"-p", fmt.Sprintf("%d", port),
+		"-U", server.User,
+		"-d", server.GetMaintenanceDB(),
+		"-X", "-A", "-t", "-w",
+		"-F", fieldSeparator,
+		"-c", listQuery,
+	)
+	cmd.Env = os.Environ()
+	if pgpassPath != "" {
+		cmd.Env = append(cmd.Env, "PGPASSFILE="+pgpassPath)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("failed to list databases on %s:%d: %w: %s",
+			server.Host, port, err, strings.TrimSpace(stderr.String()))
+	}
+
+	return parseDatabaseList(stdout.String()), nil
+}
+
+// parseDatabaseList parses unaligned, tuples-only psql output of listQuery
+func parseDatabaseList(output string) []Database {
+	var databases []Database
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line == "" {
+			continue
+		}
+		name, isTemplate, _ := strings.Cut(line, fieldSeparator)
+		databases = append(databases, Database{
+			Name:       name,
+			IsTemplate: isTemplate == "t",
+		})
+	}
+	return databases
+}
+
+// Skipped is a discovered database that matches the server's patterns but cannot be
+// backed up, with the reason
+type Skipped struct {
+	Name   string
+	Reason string
+}
+
+// Select filters the databases of a server through its include/exclude patterns and
+// expands the remaining ones into database configs with overrides applied
+func Select(server config.ServerConfig, found []Database) ([]config.DatabaseConfig, []Skipped, error) {
+	include, err := compilePatterns(server.Include)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid include pattern: %w", err)
+	}
+	exclude, err := compilePatterns(server.Exclude)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid exclude pattern: %w", err)
+	}
+	overrides := make([]matcher, len(server.Overrides))
+	for i, override := range server.Overrides {
+		if overrides[i], err = compilePattern(override.Pattern); err != nil {
+			return nil, nil, fmt.Errorf("invalid override pattern: %w", err)
+		}
+	}
+
+	var selected []config.DatabaseConfig
+	var skipped []Skipped
+	for _, db := range found {
+		switch {
+		case db.IsTemplate && !server.IncludeTemplates:
+			continue
+		case len(include) > 0 && !matchAny(include, db.Name):
+			continue
+		case matchAny(exclude, db.Name):
+			continue
+		case !validName.MatchString(db.Name) || strings.Contains(db.Name, "--"):
+			skipped = append(skipped, Skipped{Name: db.Name, Reason: "name cannot be used in backup filenames"})
+			continue
+		}
+
+		dbConfig := config.DatabaseConfig{
+			Name:                db.Name,
+			User:                server.User,
+			Host:                server.Host,
+			Port:                server.Port,
+			Enabled:             true,
+			RetentionTiers:      server.RetentionTiers,
+			StorageDestinations: server.StorageDestinations,
+		}
+		for i, match := range overrides {
+			if match(db.Name) {
+				applyOverride(&dbConfig, server.Overrides[i])
+				break
+			}
+		}
+		selected = append(selected, dbConfig)
+	}
+
+	return selected, skipped, nil
+}
+
+// applyOverride copies the fields set on the override into the database config
+func applyOverride(db *config.DatabaseConfig, override config.DatabaseOverride) {
+	if len(override.RetentionTiers) > 0 {
+		db.RetentionTiers = override.RetentionTiers
+	}
+	if len(override.StorageDestinations) > 0 {
+		db.StorageDestinations = override.StorageDestinations
+	}
+	if override.Format != "" {
+		db.Format = override.Format
+	}
+	if override.Jobs > 0 {
+		db.Jobs = override.Jobs
+	}
+}
+
+// matcher reports whether a database name matches a pattern
+type matcher func(name string) bool
+
+// compilePattern compiles a glob pattern, or a regular expression when prefixed with "re:".
+// Regular expressions must match the whole name.
+func compilePattern(pattern string) (matcher, error) {
+	if expr, ok := strings.CutPrefix(pattern, "re:"); ok {
+		re, err := regexp.Compile("^(?:" + expr + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", pattern, err)
+		}
+		return re.MatchString, nil
+	}
+
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("%q: %w", pattern, err)
+	}
+	return func(name string) bool {
+		matched, _ := path.Match(pattern, name)
+		return matched
+	}, nil
+}
+
+func compilePatterns(patterns []string) ([]matcher, error) {
+	matchers := make([]matcher, 0, len(patterns))
+	for _, pattern := range patterns {
+		m, err := compilePattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, m)
+	}
+	return matchers, nil
+}
+
+func matchAny(matchers []matcher, name string) bool {
+	for _, match := range matchers {
+		if match(name) {
+			return true
+		}
+	}
+	return false
+}
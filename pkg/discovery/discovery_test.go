@@ -0,0 +1,159 @@
+package discovery
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/williamokano/pg_backuper/pkg/config"
+)
+
+func names(dbs []config.DatabaseConfig) []string {
+	var out []string
+	for _, db := range dbs {
+		out = append(out, db.Name)
+	}
+	return out
+}
+
+func TestParseDatabaseList(t *testing.T) {
+	output := "app\x1ff\ntemplate1\x1ft\nanalytics\x1ff\n\n"
+
+	assert.Equal(t, []Database{
+		{Name: "app"},
+		{Name: "template1", IsTemplate: true},
+		{Name: "analytics"},
+	}, parseDatabaseList(output))
+}
+
+func TestSelect(t *testing.T) {
+	found := []Database{
+		{Name: "postgres"},
+		{Name: "template1", IsTemplate: true},
+		{Name: "app_prod"},
+		{Name: "app_staging"},
+		{Name: "billing"},
+		{Name: "tmp_2025"},
+		{Name: "bad name"},
+	}
+
+	t.Run("all_by_default_without_templates", func(t *testing.T) {
+		server := config.ServerConfig{Host: "db1", Port: 5433, User: "backup"}
+
+		selected, skipped, err := Select(server, found)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"postgres", "app_prod", "app_staging", "billing", "tmp_2025"}, names(selected))
+		assert.Equal(t, []Skipped{
+			{Name: "bad name", Reason: "name cannot be used in backup filenames"},
+		}, skipped)
+
+		assert.Equal(t, config.DatabaseConfig{
+			Name:    "postgres",
+			User:    "backup",
+			Host:    "db1",
+			Port:    5433,
+			Enabled: true,
+		}, selected[0])
+	})
+
+	t.Run("include_templates", func(t *testing.T) {
+		server := config.ServerConfig{Host: "db1", User: "backup", IncludeTemplates: true, Include: []string{"template*"}}
+
+		selected, _, err := Select(server, found)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"template1"}, names(selected))
+	})
+
+	t.Run("glob_and_regex_patterns", func(t *testing.T) {
+		server := config.ServerConfig{
+			Host:    "db1",
+			User:    "backup",
+			Include: []string{"app_*", "re:bill(ing)?"},
+			Exclude: []string{"*_staging"},
+		}
+
+		selected, _, err := Select(server, found)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"app_prod", "billing"}, names(selected))
+	})
+
+	t.Run("regex_matches_whole_name", func(t *testing.T) {
+		server := config.ServerConfig{Host: "db1", User: "backup", Include: []string{"re:app"}}
+
+		selected, _, err := Select(server, found)
+		require.NoError(t, err)
+		assert.Empty(t, selected)
+	})
+
+	t.Run("first_matching_override_applies", func(t *testing.T) {
+		server := config.ServerConfig{
+			Host: "db1",
+			User: "backup",
+			Overrides: []config.DatabaseOverride{
+				{
+					Pattern:             "app_prod",
+					RetentionTiers:      []config.RetentionTier{{Tier: "hourly", Retention: 24}},
+					StorageDestinations: []string{"s3"},
+					Jobs:                4,
+					Format:              "directory",
+				},
+				{
+					Pattern:        "app_*",
+					RetentionTiers: []config.RetentionTier{{Tier: "daily", Retention: 3}},
+				},
+			},
+		}
+
+		selected, _, err := Select(server, found)
+		require.NoError(t, err)
+
+		byName := make(map[string]config.DatabaseConfig)
+		for _, db := range selected {
+			byName[db.Name] = db
+		}
+
+		prod := byName["app_prod"]
+		assert.Equal(t, []config.RetentionTier{{Tier: "hourly", Retention: 24}}, prod.RetentionTiers)
+		assert.Equal(t, []string{"s3"}, prod.StorageDestinations)
+		assert.Equal(t, "directory", prod.Format)
+		assert.Equal(t, 4, prod.Jobs)
+
+		staging := byName["app_staging"]
+		assert.Equal(t, []config.RetentionTier{{Tier: "daily", Retention: 3}}, staging.RetentionTiers)
+		assert.Empty(t, staging.StorageDestinations)
+
+		assert.Empty(t, byName["billing"].RetentionTiers)
+	})
+
+	t.Run("server_defaults_apply_before_overrides", func(t *testing.T) {
+		server := config.ServerConfig{
+			Host:                "db1",
+			User:                "backup",
+			Include:             []string{"app_*"},
+			RetentionTiers:      []config.RetentionTier{{Tier: "daily", Retention: 7}},
+			StorageDestinations: []string{"local"},
+			Overrides: []config.DatabaseOverride{
+				{Pattern: "app_prod", StorageDestinations: []string{"s3"}},
+			},
+		}
+
+		selected, _, err := Select(server, found)
+		require.NoError(t, err)
+		require.Len(t, selected, 2)
+
+		assert.Equal(t, []string{"s3"}, selected[0].StorageDestinations)
+		assert.Equal(t, server.RetentionTiers, selected[0].RetentionTiers)
+		assert.Equal(t, []string{"local"}, selected[1].StorageDestinations)
+	})
+
+	t.Run("invalid_patterns", func(t *testing.T) {
+		_, _, err := Select(config.ServerConfig{Include: []string{"re:("}}, found)
+		assert.Error(t, err)
+
+		_, _, err = Select(config.ServerConfig{Exclude: []string{"[a"}}, found)
+		assert.Error(t, err)
+
+		_, _, err = Select(config.ServerConfig{Overrides: []config.DatabaseOverride{{Pattern: "re:*"}}}, found)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,237 @@
+package dumpformat
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// pg_dump output formats
+const (
+	Custom    = "custom"    // Compressed archive (-F c), restored with pg_restore
+	Directory = "directory" // One file per table (-F d), supports parallel dumps; packaged as a tar
+	Tar       = "tar"       // Tar archive (-F t), restored with pg_restore
+	Plain     = "plain"     // SQL script (-F p), restored with psql
+)
+
+// rootDir is the top-level directory of a packaged directory-format dump.
+// pg_dump's own tar format starts with toc.dat, so the directory entry tells them apart.
+const rootDir = "dump/"
+
+// basebackupRootDir is the top-level directory of a packaged pg_basebackup
+const basebackupRootDir = "basebackup/"
+
+// PgDumpFlag returns the pg_dump -F value for a format
+func PgDumpFlag(format string) (string, error) {
+	switch format {
+	case Custom, "":
+		return "c", nil
+	case Directory:
+		return "d", nil
+	case Tar:
+		return "t", nil
+	case Plain:
+		return "p", nil
+	default:
+		return "", fmt.Errorf("unknown dump format: %s", format)
+	}
+}
+
+// Detect determines the format of a backup artifact from its content
+func Detect(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	header := make([]byte, 512)
+	n, err := io.ReadFull(file, header)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return "", fmt.Errorf("failed to read backup header: %w", err)
+	}
+	header = header[:n]
+
+	switch {
+	case bytes.HasPrefix(header, []byte("PGDMP")):
+		return Custom, nil
+	case bytes.HasPrefix(header, []byte{0x1f, 0x8b}):
+		// Only packaged directory dumps are gzip-compressed
+		return Directory, nil
+	case n >= 262 && string(header[257:262]) == "ustar":
+		if header[156] == tar.TypeDir {
+			return Directory, nil
+		}
+		return Tar, nil
+	default:
+		return Plain, nil
+	}
+}
+
+// PackDirectory packages a directory-format dump into a single tar file, optionally gzip-compressed
+func PackDirectory(dir, dest string, compress bool) error {
+	return packFile(dir, dest, rootDir, compress)
+}
+
+// PackDirectoryTo writes a directory-format dump packaged as by PackDirectory to w
+func PackDirectoryTo(dir string, w io.Writer, compress bool) error {
+	return packTree(dir, w, rootDir, compress)
+}
+
+// PackBasebackup packages the output directory of pg_basebackup -F t into a single tar file.
+// The tars inside are already compressed by pg_basebackup, so the package is not.
+func PackBasebackup(dir, dest string) error {
+	return packFile(dir, dest, basebackupRootDir, false)
+}
+
+// packFile writes the regular files under dir into a tar file at dest below root
+func packFile(dir, dest, root string, compress bool) (err error) {
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	return packTree(dir, out, root, compress)
+}
+
+// packTree writes the regular files under dir as a tar below root to out
+func packTree(dir string, out io.Writer, root string, compress bool) error {
+	buffered := bufio.NewWriter(out)
+	var w io.Writer = buffered
+	var gz *gzip.Writer
+	if compress {
+		gz = gzip.NewWriter(buffered)
+		w = gz
+	}
+	tw := tar.NewWriter(w)
+
+	if err := tw.WriteHeader(&tar.Header{Name: root, Typeflag: tar.TypeDir, Mode: 0755}); err != nil {
+		return err
+	}
+
+	walkErr := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = root + filepath.ToSlash(rel)
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		_, err = io.Copy(tw, file)
+		return err
+	})
+	if walkErr != nil {
+		return walkErr
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			return err
+		}
+	}
+	return buffered.Flush()
+}
+
+// UnpackDirectory extracts a packaged directory-format dump into destDir
+func UnpackDirectory(src, destDir string) error {
+	file, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	buffered := bufio.NewReader(file)
+	var r io.Reader = buffered
+	if magic, _ := buffered.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return err
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		rel := strings.TrimPrefix(header.Name, rootDir)
+		if rel == "" || header.Typeflag == tar.TypeDir {
+			continue
+		}
+		if header.Typeflag != tar.TypeReg {
+			return fmt.Errorf("unexpected entry in directory dump: %s", header.Name)
+		}
+
+		// Reject entries that would escape destDir
+		target := filepath.Join(destDir, filepath.FromSlash(rel))
+		if !strings.HasPrefix(target, filepath.Clean(destDir)+string(os.PathSeparator)) {
+			return errors.New("invalid path in directory dump: " + header.Name)
+		}
+
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		if err := extractFile(tr, target); err != nil {
+			return err
+		}
+	}
+}
+
+// extractFile writes the current tar entry to path
+func extractFile(r io.Reader, path string) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
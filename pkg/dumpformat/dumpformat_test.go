@@ -0,0 +1,133 @@
+package dumpformat
+
+import (
+	"archive/tar"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeDumpDir creates a fake directory-format dump
+func writeDumpDir(t *testing.T) string {
+	t.Helper()
+
+	dir := filepath.Join(t.TempDir(), "dump")
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "toc.dat"), []byte("PGDMP toc"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "3001.dat.gz"), []byte("table data"), 0644))
+	return dir
+}
+
+func TestPackUnpackDirectory(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		name := "uncompressed"
+		if compress {
+			name = "gzip"
+		}
+
+		t.Run(name, func(t *testing.T) {
+			dir := writeDumpDir(t)
+			artifact := filepath.Join(t.TempDir(), "db--daily--2025-12-20T10-00-00.backup")
+
+			require.NoError(t, PackDirectory(dir, artifact, compress))
+
+			format, err := Detect(artifact)
+			require.NoError(t, err)
+			assert.Equal(t, Directory, format)
+
+			restored := filepath.Join(t.TempDir(), "restored")
+			require.NoError(t, UnpackDirectory(artifact, restored))
+
+			toc, err := os.ReadFile(filepath.Join(restored, "toc.dat"))
+			require.NoError(t, err)
+			assert.Equal(t, "PGDMP toc", string(toc))
+
+			data, err := os.ReadFile(filepath.Join(restored, "3001.dat.gz"))
+			require.NoError(t, err)
+			assert.Equal(t, "table data", string(data))
+		})
+	}
+}
+
+func TestDetect(t *testing.T) {
+	write := func(t *testing.T, content []byte) string {
+		path := filepath.Join(t.TempDir(), "db.backup")
+		require.NoError(t, os.WriteFile(path, content, 0644))
+		return path
+	}
+
+	t.Run("custom", func(t *testing.T) {
+		format, err := Detect(write(t, []byte("PGDMP\x01\x0e\x00")))
+		require.NoError(t, err)
+		assert.Equal(t, Custom, format)
+	})
+
+	t.Run("plain", func(t *testing.T) {
+		format, err := Detect(write(t, []byte("--\n-- PostgreSQL database dump\n--\n")))
+		require.NoError(t, err)
+		assert.Equal(t, Plain, format)
+	})
+
+	t.Run("pg_dump_tar", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "db.backup")
+		file, err := os.Create(path)
+		require.NoError(t, err)
+		tw := tar.NewWriter(file)
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: "toc.dat", Mode: 0644, Size: 3}))
+		_, err = tw.Write([]byte("toc"))
+		require.NoError(t, err)
+		require.NoError(t, tw.Close())
+		require.NoError(t, file.Close())
+
+		format, err := Detect(path)
+		require.NoError(t, err)
+		assert.Equal(t, Tar, format)
+	})
+}
+
+func TestPgDumpFlag(t *testing.T) {
+	tests := map[string]string{
+		"":        "c",
+		Custom:    "c",
+		Directory: "d",
+		Tar:       "t",
+		Plain:     "p",
+	}
+	for format, want := range tests {
+		got, err := PgDumpFlag(format)
+		require.NoError(t, err)
+		assert.Equal(t, want, got, "format %q", format)
+	}
+
+	_, err := PgDumpFlag("zip")
+	assert.Error(t, err)
+}
+
+func TestPackBasebackup(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "base")
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "base.tar.gz"), []byte("base"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "pg_wal.tar.gz"), []byte("wal"), 0644))
+
+	artifact := filepath.Join(t.TempDir(), "pg1-5432--basebackup--daily--2025-12-20T10-00-00.tar")
+	require.NoError(t, PackBasebackup(dir, artifact))
+
+	file, err := os.Open(artifact)
+	require.NoError(t, err)
+	defer file.Close()
+
+	// Not gzipped: the tars inside already are
+	var names []string
+	tr := tar.NewReader(file)
+	for {
+		header, err := tr.Next()
+		if err != nil {
+			break
+		}
+		names = append(names, header.Name)
+	}
+	assert.Equal(t, []string{"basebackup/", "basebackup/base.tar.gz", "basebackup/pg_wal.tar.gz"}, names)
+}
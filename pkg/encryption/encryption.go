@@ -0,0 +1,511 @@
+package encryption
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/williamokano/pg_backuper/pkg/config"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Magic starts every encrypted backup. Filenames are unchanged by encryption, so
+// encrypted backups are recognized by their content, like dump formats are.
+const Magic = "PGBKENC1"
+
+// Algorithm is the only content cipher
+const Algorithm = "AES-256-GCM"
+
+// ChunkSize is the plaintext size of each encrypted chunk
+const ChunkSize = 64 * 1024
+
+const (
+	keySize    = 32
+	headerMax  = 64 * 1024 // Upper bound of the header length, to reject garbage before allocating
+	kdfScrypt  = "scrypt"
+	scryptN    = 1 << 15
+	scryptR    = 8
+	scryptP    = 1
+	saltSize   = 16
+	finalChunk = 1 // Last byte of the nonce of the final chunk, so truncation is detected
+)
+
+// ErrNoKey is returned when an encrypted backup needs a key that is not configured
+var ErrNoKey = errors.New("encryption key not configured")
+
+// Header describes an encrypted backup. It is stored in clear after Magic and authenticated
+// with every chunk.
+//
+// Each backup is encrypted with its own random data key, which is stored wrapped (encrypted)
+// with the configured key identified by KeyID.
+type Header struct {
+	Version    int    `json:"v"`
+	KeyID      string `json:"key_id"`
+	Algorithm  string `json:"alg"`
+	KDF        string `json:"kdf,omitempty"`  // Set when the key is derived from a passphrase
+	Salt       []byte `json:"salt,omitempty"` // KDF salt, per backup
+	WrapNonce  []byte `json:"wrap_nonce"`
+	WrappedKey []byte `json:"wrapped_key"`
+	ChunkSize  int    `json:"chunk_size"`
+}
+
+// key is a configured key: raw key material, or a passphrase a key is derived from per backup
+type key struct {
+	id         string
+	material   []byte
+	passphrase []byte
+}
+
+// wrappingKey returns the key that wraps data keys of backups with the given header
+func (k *key) wrappingKey(h *Header) ([]byte, error) {
+	if k.passphrase == nil {
+		if h.KDF != "" {
+			return nil, fmt.Errorf("key %s is a key file, but the backup was encrypted with a passphrase", k.id)
+		}
+		return k.material, nil
+	}
+	if h.KDF != kdfScrypt {
+		return nil, fmt.Errorf("key %s is a passphrase, but the backup was encrypted with a key file", k.id)
+	}
+	return scrypt.Key(k.passphrase, h.Salt, scryptN, scryptR, scryptP, keySize)
+}
+
+// Keyring holds the keys backups are encrypted and decrypted with
+type Keyring struct {
+	active string // Key new backups are encrypted with; empty when encryption is disabled
+	keys   map[string]*key
+}
+
+// LoadKeyring reads the configured keys. Keys are loaded even when encryption is disabled,
+// so backups taken while it was enabled can still be read.
+func LoadKeyring(cfg config.EncryptionConfig) (*Keyring, error) {
+	ring := &Keyring{keys: make(map[string]*key)}
+
+	for _, k := range cfg.Keys {
+		loaded := &key{id: k.ID}
+		if k.KeyFile != "" {
+			material, err := readKeyFile(k.KeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("encryption key %s: %w", k.ID, err)
+			}
+			loaded.material = material
+		} else {
+			passphrase := os.Getenv(k.PassphraseEnv)
+			if passphrase == "" {
+				// Only fatal for the active key: other keys may legitimately be absent on this host
+				if cfg.Enabled && k.ID == cfg.KeyID {
+					return nil, fmt.Errorf("encryption key %s: environment variable %s is not set", k.ID, k.PassphraseEnv)
+				}
+				continue
+			}
+			loaded.passphrase = []byte(passphrase)
+		}
+		ring.keys[k.ID] = loaded
+	}
+
+	if cfg.Enabled {
+		if _, ok := ring.keys[cfg.KeyID]; !ok {
+			return nil, fmt.Errorf("encryption key %s: %w", cfg.KeyID, ErrNoKey)
+		}
+		ring.active = cfg.KeyID
+	}
+	return ring, nil
+}
+
+// readKeyFile reads a 256-bit key stored raw, as hex or as base64
+func readKeyFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	if len(data) == keySize {
+		return data, nil
+	}
+
+	text := strings.TrimSpace(string(data))
+	if decoded, err := hex.DecodeString(text); err == nil && len(decoded) == keySize {
+		return decoded, nil
+	}
+	if decoded, err := base64.StdEncoding.DecodeString(text); err == nil && len(decoded) == keySize {
+		return decoded, nil
+	}
+	return nil, fmt.Errorf("key file %s must hold 32 bytes: raw, 64 hex digits or base64", path)
+}
+
+// Enabled reports whether new backups are encrypted
+func (r *Keyring) Enabled() bool {
+	return r != nil && r.active != ""
+}
+
+// ActiveKeyID returns the ID of the key new backups are encrypted with
+func (r *Keyring) ActiveKeyID() string {
+	if r == nil {
+		return ""
+	}
+	return r.active
+}
+
+// Encrypt returns a reader of src encrypted with the active key
+func (r *Keyring) Encrypt(src io.Reader) (io.Reader, error) {
+	if !r.Enabled() {
+		return nil, ErrNoKey
+	}
+	return r.EncryptWith(src, r.active)
+}
+
+// EncryptWith returns a reader of src encrypted with the key keyID
+func (r *Keyring) EncryptWith(src io.Reader, keyID string) (io.Reader, error) {
+	k, err := r.key(keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	header := Header{
+		Version:   1,
+		KeyID:     keyID,
+		Algorithm: Algorithm,
+		ChunkSize: ChunkSize,
+	}
+	if k.passphrase != nil {
+		header.KDF = kdfScrypt
+		header.Salt = make([]byte, saltSize)
+		if _, err := rand.Read(header.Salt); err != nil {
+			return nil, err
+		}
+	}
+	wrapping, err := k.wrappingKey(&header)
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey := make([]byte, keySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+	wrapper, err := newGCM(wrapping)
+	if err != nil {
+		return nil, err
+	}
+	header.WrapNonce = make([]byte, wrapper.NonceSize())
+	if _, err := rand.Read(header.WrapNonce); err != nil {
+		return nil, err
+	}
+	header.WrappedKey = wrapper.Seal(nil, header.WrapNonce, dataKey, []byte(keyID))
+
+	prefix, err := encodeHeader(header)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &encryptReader{
+		src:     src,
+		aead:    aead,
+		aad:     prefix,
+		pending: prefix,
+		plain:   make([]byte, ChunkSize),
+	}, nil
+}
+
+// Decrypt returns a reader of the plaintext of an encrypted backup, and the header it was encrypted with
+func (r *Keyring) Decrypt(src io.Reader) (io.Reader, Header, error) {
+	header, prefix, err := readHeader(src)
+	if err != nil {
+		return nil, header, err
+	}
+	dataKey, err := r.unwrap(header)
+	if err != nil {
+		return nil, header, err
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, header, err
+	}
+	if header.ChunkSize <= 0 || header.ChunkSize > 16*1024*1024 {
+		return nil, header, fmt.Errorf("invalid chunk size %d in encryption header", header.ChunkSize)
+	}
+
+	return &decryptReader{
+		src:    src,
+		aead:   aead,
+		aad:    prefix,
+		sealed: make([]byte, header.ChunkSize+aead.Overhead()),
+	}, header, nil
+}
+
+// Open returns a reader of the plaintext of a backup, decrypting it if it is encrypted
+// and passing it through otherwise.
+func (r *Keyring) Open(src io.Reader) (io.Reader, error) {
+	buffered := bufio.NewReader(src)
+	if !IsEncrypted(buffered) {
+		return buffered, nil
+	}
+	plain, _, err := r.Decrypt(buffered)
+	return plain, err
+}
+
+// unwrap decrypts the data key of a backup with the key named in its header
+func (r *Keyring) unwrap(header Header) ([]byte, error) {
+	k, err := r.key(header.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	if header.Algorithm != Algorithm {
+		return nil, fmt.Errorf("unsupported encryption algorithm %q", header.Algorithm)
+	}
+	wrapping, err := k.wrappingKey(&header)
+	if err != nil {
+		return nil, err
+	}
+	wrapper, err := newGCM(wrapping)
+	if err != nil {
+		return nil, err
+	}
+	if len(header.WrapNonce) != wrapper.NonceSize() {
+		return nil, errors.New("invalid wrap nonce in encryption header")
+	}
+	dataKey, err := wrapper.Open(nil, header.WrapNonce, header.WrappedKey, []byte(header.KeyID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key with key %s: wrong key or damaged header", header.KeyID)
+	}
+	return dataKey, nil
+}
+
+// Has reports whether the key keyID is configured
+func (r *Keyring) Has(keyID string) bool {
+	_, err := r.key(keyID)
+	return err == nil
+}
+
+// key returns the configured key keyID
+func (r *Keyring) key(keyID string) (*key, error) {
+	if r != nil {
+		if k, ok := r.keys[keyID]; ok {
+			return k, nil
+		}
+	}
+	return nil, fmt.Errorf("encryption key %s: %w", keyID, ErrNoKey)
+}
+
+// IsEncrypted reports whether a buffered backup starts with Magic, without consuming it
+func IsEncrypted(r *bufio.Reader) bool {
+	prefix, _ := r.Peek(len(Magic))
+	return string(prefix) == Magic
+}
+
+// IsEncryptedFile reports whether the file at path is an encrypted backup
+func IsEncryptedFile(path string) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	return IsEncrypted(bufio.NewReader(file)), nil
+}
+
+// PeekHeader returns the header of a buffered encrypted backup without consuming it.
+// The header must fit in the reader's buffer (headers are a few hundred bytes).
+func PeekHeader(r *bufio.Reader) (Header, error) {
+	fixed, err := r.Peek(len(Magic) + 4)
+	if err != nil {
+		return Header{}, fmt.Errorf("failed to read encryption header: %w", err)
+	}
+	prefix, err := r.Peek(len(fixed) + int(binary.BigEndian.Uint32(fixed[len(Magic):])))
+	if err != nil {
+		return Header{}, fmt.Errorf("failed to read encryption header: %w", err)
+	}
+	return ReadHeader(bytes.NewReader(prefix))
+}
+
+// ReadHeader reads the header of an encrypted backup, leaving src positioned at the first chunk
+func ReadHeader(src io.Reader) (Header, error) {
+	header, _, err := readHeader(src)
+	return header, err
+}
+
+// encodeHeader returns Magic, the header length and the header
+func encodeHeader(header Header) ([]byte, error) {
+	data, err := json.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+	prefix := make([]byte, len(Magic)+4, len(Magic)+4+len(data))
+	copy(prefix, Magic)
+	binary.BigEndian.PutUint32(prefix[len(Magic):], uint32(len(data)))
+	return append(prefix, data...), nil
+}
+
+// readHeader reads and parses the prefix of an encrypted backup, returning its raw bytes as well
+func readHeader(src io.Reader) (Header, []byte, error) {
+	var header Header
+
+	fixed := make([]byte, len(Magic)+4)
+	if _, err := io.ReadFull(src, fixed); err != nil {
+		return header, nil, fmt.Errorf("failed to read encryption header: %w", err)
+	}
+	if string(fixed[:len(Magic)]) != Magic {
+		return header, nil, errors.New("not an encrypted backup")
+	}
+
+	length := binary.BigEndian.Uint32(fixed[len(Magic):])
+	if length == 0 || length > headerMax {
+		return header, nil, fmt.Errorf("invalid encryption header length %d", length)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(src, data); err != nil {
+		return header, nil, fmt.Errorf("failed to read encryption header: %w", err)
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return header, nil, fmt.Errorf("invalid encryption header: %w", err)
+	}
+	if header.Version != 1 {
+		return header, nil, fmt.Errorf("unsupported encryption header version %d", header.Version)
+	}
+
+	return header, append(fixed, data...), nil
+}
+
+// newGCM returns AES-256-GCM with key
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != keySize {
+		return nil, fmt.Errorf("encryption key must be %d bytes", keySize)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// chunkNonce returns the nonce of chunk counter: the counter, then whether it is the final chunk
+func chunkNonce(size int, counter uint64, final bool) []byte {
+	nonce := make([]byte, size)
+	binary.BigEndian.PutUint64(nonce[size-9:size-1], counter)
+	if final {
+		nonce[size-1] = finalChunk
+	}
+	return nonce
+}
+
+// encryptReader encrypts src in chunks of ChunkSize. Every chunk but the last is full, and the
+// last one is sealed as final (possibly empty), so a backup cut at a chunk boundary is detected.
+type encryptReader struct {
+	src     io.Reader
+	aead    cipher.AEAD
+	aad     []byte
+	pending []byte // Sealed output not yet returned
+	plain   []byte
+	counter uint64
+	done    bool
+}
+
+func (e *encryptReader) Read(p []byte) (int, error) {
+	for len(e.pending) == 0 {
+		if e.done {
+			return 0, io.EOF
+		}
+		n, err := io.ReadFull(e.src, e.plain)
+		final := false
+		switch {
+		case err == io.EOF || err == io.ErrUnexpectedEOF:
+			final = true
+		case err != nil:
+			return 0, err
+		}
+		e.pending = e.aead.Seal(nil, chunkNonce(e.aead.NonceSize(), e.counter, final), e.plain[:n], e.aad)
+		e.counter++
+		e.done = final
+	}
+
+	n := copy(p, e.pending)
+	e.pending = e.pending[n:]
+	return n, nil
+}
+
+// decryptReader decrypts the chunks written by encryptReader
+type decryptReader struct {
+	src     io.Reader
+	aead    cipher.AEAD
+	aad     []byte
+	sealed  []byte
+	plain   []byte // Decrypted output not yet returned
+	counter uint64
+	done    bool
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		n, err := io.ReadFull(d.src, d.sealed)
+		final := false
+		switch {
+		case err == io.EOF:
+			return 0, errors.New("encrypted backup is truncated")
+		case err == io.ErrUnexpectedEOF:
+			final = true
+		case err != nil:
+			return 0, err
+		}
+
+		plain, err := d.aead.Open(nil, chunkNonce(d.aead.NonceSize(), d.counter, final), d.sealed[:n], d.aad)
+		if err != nil {
+			if !final {
+				// A full-size chunk is never final, unless the backup was cut right after it
+				if _, perr := d.aead.Open(nil, chunkNonce(d.aead.NonceSize(), d.counter, true), d.sealed[:n], d.aad); perr == nil {
+					return 0, errors.New("encrypted backup has data after its final chunk")
+				}
+			}
+			return 0, fmt.Errorf("encrypted backup is corrupt or truncated at chunk %d", d.counter)
+		}
+		d.plain = plain
+		d.counter++
+		d.done = final
+	}
+
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	return n, nil
+}
+
+// DecryptFile writes the plaintext of the encrypted backup src to dst, removing dst on failure
+func (r *Keyring) DecryptFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	reader, _, err := r.Decrypt(bufio.NewReader(in))
+	if err == nil {
+		_, err = io.Copy(out, reader)
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(dst)
+		return err
+	}
+	return nil
+}
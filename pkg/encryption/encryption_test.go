@@ -0,0 +1,162 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/williamokano/pg_backuper/pkg/config"
+)
+
+// writeKeyFile stores a random hex key in a temporary file
+func writeKeyFile(t *testing.T) string {
+	material := make([]byte, keySize)
+	_, err := rand.Read(material)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "backup.key")
+	require.NoError(t, os.WriteFile(path, []byte(hex.EncodeToString(material)+"\n"), 0600))
+	return path
+}
+
+// keyring loads a keyring encrypting with keyID
+func keyring(t *testing.T, keyID string, keys ...config.EncryptionKey) *Keyring {
+	ring, err := LoadKeyring(config.EncryptionConfig{Enabled: true, KeyID: keyID, Keys: keys})
+	require.NoError(t, err)
+	return ring
+}
+
+// encrypt returns data encrypted with the active key of ring
+func encrypt(t *testing.T, ring *Keyring, data []byte) []byte {
+	reader, err := ring.Encrypt(bytes.NewReader(data))
+	require.NoError(t, err)
+	sealed, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	return sealed
+}
+
+func TestRoundTrip(t *testing.T) {
+	t.Setenv("PG_BACKUPER_TEST_PASSPHRASE", "correct horse battery staple")
+
+	rings := map[string]*Keyring{
+		"key_file":   keyring(t, "k1", config.EncryptionKey{ID: "k1", KeyFile: writeKeyFile(t)}),
+		"passphrase": keyring(t, "p1", config.EncryptionKey{ID: "p1", PassphraseEnv: "PG_BACKUPER_TEST_PASSPHRASE"}),
+	}
+	sizes := []int{0, 1, ChunkSize - 1, ChunkSize, 2*ChunkSize + 17}
+
+	for name, ring := range rings {
+		for _, size := range sizes {
+			data := make([]byte, size)
+			_, err := rand.Read(data)
+			require.NoError(t, err)
+
+			sealed := encrypt(t, ring, data)
+			assert.True(t, bytes.HasPrefix(sealed, []byte(Magic)), name)
+			assert.False(t, size >= ChunkSize && bytes.Contains(sealed, data[:64]), name)
+
+			reader, header, err := ring.Decrypt(bytes.NewReader(sealed))
+			require.NoError(t, err, name)
+			assert.Equal(t, ring.ActiveKeyID(), header.KeyID)
+			plain, err := io.ReadAll(reader)
+			require.NoError(t, err, "%s, %d bytes", name, size)
+			assert.Equal(t, data, plain, "%s, %d bytes", name, size)
+		}
+	}
+}
+
+func TestDecrypt_Failures(t *testing.T) {
+	keyFile := writeKeyFile(t)
+	ring := keyring(t, "k1", config.EncryptionKey{ID: "k1", KeyFile: keyFile})
+	data := bytes.Repeat([]byte("PGDMP"), ChunkSize)
+	sealed := encrypt(t, ring, data)
+
+	readAll := func(ring *Keyring, sealed []byte) error {
+		reader, _, err := ring.Decrypt(bytes.NewReader(sealed))
+		if err != nil {
+			return err
+		}
+		_, err = io.ReadAll(reader)
+		return err
+	}
+
+	t.Run("wrong_key", func(t *testing.T) {
+		other := keyring(t, "k1", config.EncryptionKey{ID: "k1", KeyFile: writeKeyFile(t)})
+		assert.ErrorContains(t, readAll(other, sealed), "wrong key")
+	})
+
+	t.Run("unknown_key", func(t *testing.T) {
+		other := keyring(t, "k2", config.EncryptionKey{ID: "k2", KeyFile: keyFile})
+		assert.ErrorIs(t, readAll(other, sealed), ErrNoKey)
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		prefixLen := len(sealed) - (len(data)/ChunkSize*(ChunkSize+16) + 16)
+		for _, cut := range []int{len(sealed) - 1, len(sealed) - 16, prefixLen + ChunkSize + 16, prefixLen} {
+			assert.Error(t, readAll(ring, sealed[:cut]), "cut at %d", cut)
+		}
+	})
+
+	t.Run("tampered", func(t *testing.T) {
+		tampered := bytes.Clone(sealed)
+		tampered[len(tampered)-100] ^= 1
+		assert.ErrorContains(t, readAll(ring, tampered), "corrupt")
+	})
+}
+
+func TestOpen(t *testing.T) {
+	old := config.EncryptionKey{ID: "2024", KeyFile: writeKeyFile(t)}
+	current := config.EncryptionKey{ID: "2025", KeyFile: writeKeyFile(t)}
+	data := []byte("PGDMP custom archive")
+
+	t.Run("plaintext_passes_through", func(t *testing.T) {
+		ring, err := LoadKeyring(config.EncryptionConfig{})
+		require.NoError(t, err)
+		assert.False(t, ring.Enabled())
+
+		reader, err := ring.Open(bytes.NewReader(data))
+		require.NoError(t, err)
+		plain, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		assert.Equal(t, data, plain)
+	})
+
+	t.Run("old_keys_still_decrypt", func(t *testing.T) {
+		sealed := encrypt(t, keyring(t, "2024", old), data)
+
+		ring := keyring(t, "2025", old, current)
+		reader, err := ring.Open(bytes.NewReader(sealed))
+		require.NoError(t, err)
+		plain, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		assert.Equal(t, data, plain)
+
+		header, err := ReadHeader(bytes.NewReader(encrypt(t, ring, data)))
+		require.NoError(t, err)
+		assert.Equal(t, "2025", header.KeyID)
+	})
+}
+
+func TestLoadKeyring(t *testing.T) {
+	t.Run("missing_active_passphrase", func(t *testing.T) {
+		_, err := LoadKeyring(config.EncryptionConfig{
+			Enabled: true,
+			KeyID:   "p1",
+			Keys:    []config.EncryptionKey{{ID: "p1", PassphraseEnv: "PG_BACKUPER_TEST_UNSET"}},
+		})
+		assert.ErrorContains(t, err, "PG_BACKUPER_TEST_UNSET")
+	})
+
+	t.Run("invalid_key_file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "short.key")
+		require.NoError(t, os.WriteFile(path, []byte("too short"), 0600))
+
+		_, err := LoadKeyring(config.EncryptionConfig{Keys: []config.EncryptionKey{{ID: "k1", KeyFile: path}}})
+		assert.ErrorContains(t, err, "32 bytes")
+	})
+}
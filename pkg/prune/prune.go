@@ -0,0 +1,175 @@
+package prune
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/williamokano/pg_backuper/pkg/backup"
+	"github.com/williamokano/pg_backuper/pkg/config"
+	"github.com/williamokano/pg_backuper/pkg/rotation"
+	"github.com/williamokano/pg_backuper/pkg/storage"
+)
+
+// Options defines which backups to prune
+type Options struct {
+	Database    string // Only backups of this database or server (host-port), optional
+	Destination string // Only this storage destination, optional (default: all enabled destinations)
+	DryRun      bool   // Only compute the plan
+}
+
+// Result represents the outcome of a prune
+type Result struct {
+	Plans        []rotation.Plan            // Retention plan of every source on every destination
+	Planned      int                        // Backups the plans delete
+	PlannedBytes int64                      // Bytes the plans delete
+	Deleted      int                        // Backups deleted (always 0 with DryRun)
+	DeletedBytes int64                      // Bytes deleted
+	Blocked      []rotation.BlockedDeletion // Deletions the safety guards blocked
+	Success      bool
+	Error        error
+	Duration     time.Duration
+}
+
+// Prune computes the retention plan of every backup source on the selected destinations
+// and, unless DryRun is set, deletes the backups it marks for deletion. The retention of
+// each source is looked up from the configuration by the backup filenames, so sources
+// discovered at run time are covered without connecting to their servers.
+func Prune(ctx context.Context, cfg *config.Config, opts Options, logger zerolog.Logger) Result {
+	start := time.Now()
+	result := Result{}
+
+	destinations := backup.EnabledDestinations(cfg)
+	if opts.Destination != "" {
+		destinations = []string{opts.Destination}
+	}
+	if len(destinations) == 0 {
+		result.Error = fmt.Errorf("no enabled storage destinations configured")
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	guards := backup.RotationGuards(cfg)
+	var failures []string
+
+	for _, name := range destinations {
+		destLog := logger.With().
+			Str("destination", name).
+			Bool("dry_run", opts.DryRun).
+			Logger()
+
+		if err := pruneDestination(ctx, cfg, name, opts, guards, &result, destLog); err != nil {
+			destLog.Error().Err(err).Msg("prune failed for destination")
+			failures = append(failures, fmt.Sprintf("%s: %v", name, err))
+		}
+	}
+
+	result.Duration = time.Since(start)
+	if len(failures) > 0 {
+		result.Error = fmt.Errorf("prune failed on %d destinations: %s", len(failures), strings.Join(failures, "; "))
+		return result
+	}
+
+	result.Success = true
+	return result
+}
+
+// pruneDestination plans and applies the retention of every backup source found on one destination
+func pruneDestination(ctx context.Context, cfg *config.Config, name string, opts Options, guards rotation.Guards, result *Result, logger zerolog.Logger) error {
+	backend, err := backup.InitializeDestination(ctx, cfg, name)
+	if err != nil {
+		return fmt.Errorf("failed to initialize storage destination: %w", err)
+	}
+	defer backend.Close()
+
+	files, err := backend.List(ctx, opts.Database+"*")
+	if err != nil {
+		return fmt.Errorf("failed to list backups: %w", err)
+	}
+
+	failed := 0
+	for _, naming := range sourcesOf(files, opts.Database) {
+		sourceLog := logger.With().Str("database", naming.Name).Logger()
+		if naming.Kind != "" {
+			sourceLog = sourceLog.With().Str("kind", naming.Kind).Logger()
+		}
+
+		retentionTiers, ok := backup.RetentionFor(cfg, naming)
+		if !ok {
+			sourceLog.Warn().Msg("backups do not belong to a configured source, not pruned")
+			continue
+		}
+
+		plan, err := rotation.PlanRetention(ctx, backend, naming, retentionTiers, guards, time.Now())
+		if err != nil {
+			return err
+		}
+		result.Plans = append(result.Plans, plan)
+		result.Blocked = append(result.Blocked, plan.Blocked()...)
+
+		deletions := plan.Deletions()
+		result.Planned += len(deletions)
+		for _, file := range deletions {
+			result.PlannedBytes += file.Size
+		}
+
+		if opts.DryRun || len(deletions) == 0 {
+			continue
+		}
+
+		deleted := rotation.ExecutePlan(ctx, backend, plan, sourceLog)
+		result.Deleted += len(deleted)
+		for _, file := range deleted {
+			result.DeletedBytes += file.Size
+		}
+		failed += len(deletions) - len(deleted)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d backups failed to delete", failed)
+	}
+	return nil
+}
+
+// sourcesOf returns the backup sources the stored files belong to, ordered by name.
+// Archived WAL is pruned with the base backups and is left out.
+func sourcesOf(files []storage.FileInfo, database string) []rotation.Naming {
+	seen := make(map[rotation.Naming]bool)
+	var sources []rotation.Naming
+
+	for _, file := range files {
+		base := filepath.Base(file.Path)
+		if _, wal := rotation.ParseWALFilename(base); wal {
+			continue
+		}
+		components, err := rotation.ParseBackupFilename(base)
+		if err != nil {
+			continue
+		}
+		if database != "" && components.DatabaseName != database {
+			continue
+		}
+
+		naming := rotation.Naming{
+			Name: components.DatabaseName,
+			Kind: components.Kind,
+			Ext:  filepath.Ext(base),
+		}
+		if !seen[naming] {
+			seen[naming] = true
+			sources = append(sources, naming)
+		}
+	}
+
+	sort.Slice(sources, func(i, j int) bool {
+		if sources[i].Name != sources[j].Name {
+			return sources[i].Name < sources[j].Name
+		}
+		return sources[i].Kind < sources[j].Kind
+	})
+	return sources
+}
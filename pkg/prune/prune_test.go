@@ -0,0 +1,137 @@
+package prune
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/williamokano/pg_backuper/pkg/config"
+	"github.com/williamokano/pg_backuper/pkg/rotation"
+)
+
+// pruneConfig returns a config with one local destination and the directory behind it
+func pruneConfig(t *testing.T) (*config.Config, string) {
+	dir := t.TempDir()
+
+	cfg := &config.Config{
+		Storage: config.StorageConfig{
+			Destinations: []config.StorageDestination{
+				{Name: "local", Type: "local", Enabled: true, Options: map[string]interface{}{"path": dir}},
+			},
+		},
+		Databases: []config.DatabaseConfig{
+			{Name: "app", RetentionTiers: []config.RetentionTier{{Tier: "daily", Retention: 2}}},
+		},
+	}
+	return cfg, dir
+}
+
+// writeDailies stores count daily backups of a database, one per day before now
+func writeDailies(t *testing.T, dir, database string, count int) []string {
+	var names []string
+	for i := 1; i <= count; i++ {
+		name := rotation.DatabaseNaming(database).Filename("daily", time.Now().AddDate(0, 0, -i))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("PGDMP"), 0644))
+		names = append(names, name)
+	}
+	return names
+}
+
+func TestPrune(t *testing.T) {
+	t.Run("dry_run_plans_without_deleting", func(t *testing.T) {
+		cfg, dir := pruneConfig(t)
+		names := writeDailies(t, dir, "app", 4)
+
+		result := Prune(context.Background(), cfg, Options{DryRun: true}, zerolog.Nop())
+
+		require.NoError(t, result.Error)
+		assert.True(t, result.Success)
+		assert.Equal(t, 2, result.Planned)
+		assert.Equal(t, int64(2*len("PGDMP")), result.PlannedBytes)
+		assert.Zero(t, result.Deleted)
+
+		require.Len(t, result.Plans, 1)
+		plan := result.Plans[0]
+		assert.Equal(t, "local", plan.Backend)
+		assert.Equal(t, "app", plan.Source)
+		require.Len(t, plan.Tiers, 1)
+
+		tier := plan.Tiers[0]
+		assert.Equal(t, int64(2*len("PGDMP")), tier.KeepBytes)
+		assert.Equal(t, int64(2*len("PGDMP")), tier.DeleteBytes)
+		var actions []string
+		for _, file := range tier.Files {
+			actions = append(actions, file.Action)
+			assert.NotEmpty(t, file.Reason)
+		}
+		assert.Equal(t, []string{rotation.ActionKeep, rotation.ActionKeep, rotation.ActionDelete, rotation.ActionDelete}, actions)
+
+		for _, name := range names {
+			assert.FileExists(t, filepath.Join(dir, name))
+		}
+	})
+
+	t.Run("deletes_planned_backups", func(t *testing.T) {
+		cfg, dir := pruneConfig(t)
+		names := writeDailies(t, dir, "app", 4)
+
+		result := Prune(context.Background(), cfg, Options{}, zerolog.Nop())
+
+		require.True(t, result.Success)
+		assert.Equal(t, 2, result.Deleted)
+		assert.FileExists(t, filepath.Join(dir, names[0]))
+		assert.FileExists(t, filepath.Join(dir, names[1]))
+		assert.NoFileExists(t, filepath.Join(dir, names[2]))
+		assert.NoFileExists(t, filepath.Join(dir, names[3]))
+	})
+
+	t.Run("filters_database_and_skips_unknown_sources", func(t *testing.T) {
+		cfg, dir := pruneConfig(t)
+		writeDailies(t, dir, "app", 3)
+		writeDailies(t, dir, "app2", 3)
+		unknown := writeDailies(t, dir, "legacy", 3)
+
+		result := Prune(context.Background(), cfg, Options{Database: "app"}, zerolog.Nop())
+		require.True(t, result.Success)
+		require.Len(t, result.Plans, 1)
+		assert.Equal(t, "app", result.Plans[0].Source)
+
+		result = Prune(context.Background(), cfg, Options{}, zerolog.Nop())
+		require.True(t, result.Success)
+		for _, name := range unknown {
+			assert.FileExists(t, filepath.Join(dir, name))
+		}
+	})
+
+	t.Run("guards_block_mass_deletion", func(t *testing.T) {
+		cfg, dir := pruneConfig(t)
+		cfg.Rotation.MaxDeletePercent = 25
+		writeDailies(t, dir, "app", 4)
+
+		result := Prune(context.Background(), cfg, Options{}, zerolog.Nop())
+
+		require.True(t, result.Success)
+		assert.Zero(t, result.Deleted)
+		assert.Len(t, result.Blocked, 2)
+
+		cfg.AllowMassDelete = true
+		result = Prune(context.Background(), cfg, Options{}, zerolog.Nop())
+
+		require.True(t, result.Success)
+		assert.Equal(t, 2, result.Deleted)
+	})
+
+	t.Run("unknown_destination_fails", func(t *testing.T) {
+		cfg, _ := pruneConfig(t)
+
+		result := Prune(context.Background(), cfg, Options{Destination: "missing"}, zerolog.Nop())
+
+		assert.False(t, result.Success)
+		assert.Error(t, result.Error)
+	})
+}
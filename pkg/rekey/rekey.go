@@ -0,0 +1,352 @@
+package rekey
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/williamokano/pg_backuper/pkg/backup"
+	"github.com/williamokano/pg_backuper/pkg/config"
+	"github.com/williamokano/pg_backuper/pkg/encryption"
+	"github.com/williamokano/pg_backuper/pkg/rotation"
+	"github.com/williamokano/pg_backuper/pkg/storage"
+)
+
+// TempSuffix is appended to an object's path while its rekeyed copy is written.
+// The copy replaces the object once complete, so an interrupted rekey never leaves a partial backup.
+const TempSuffix = ".rekey"
+
+// Options defines which stored backups to re-encrypt
+type Options struct {
+	FromKey     string // Key ID the backups are currently encrypted with
+	ToKey       string // Key ID to encrypt them with
+	Destination string // Only this storage destination, optional (default: all enabled destinations)
+	Database    string // Only backups of this database or server (host-port), optional
+}
+
+// Failure is an object that could not be rekeyed
+type Failure struct {
+	Destination string
+	Path        string
+	Error       error
+}
+
+// Result represents the outcome of a rekey run
+type Result struct {
+	Rekeyed  []string  // Objects re-encrypted with ToKey in this run
+	Done     int       // Objects already encrypted with ToKey (e.g. by an interrupted run)
+	Skipped  int       // Objects not encrypted with FromKey (plaintext or other keys)
+	Failed   []Failure // Objects left encrypted with FromKey
+	Bytes    int64     // Bytes written
+	Success  bool
+	Error    error
+	Duration time.Duration
+}
+
+// Rekey re-encrypts the backups and archived WAL encrypted with FromKey so that they are
+// encrypted with ToKey, keeping their names (and, where the backend allows, modification times).
+//
+// Each object is written under its name plus TempSuffix and then moved over the original.
+// Rerunning after an interruption continues where it stopped: objects already encrypted with
+// ToKey are skipped, and a complete copy whose original is already gone is moved into place.
+func Rekey(ctx context.Context, cfg *config.Config, opts Options, logger zerolog.Logger) Result {
+	start := time.Now()
+	var result Result
+
+	fail := func(err error) Result {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	if opts.FromKey == "" || opts.ToKey == "" {
+		return fail(errors.New("both --from-key and --to-key are required"))
+	}
+	if opts.FromKey == opts.ToKey {
+		return fail(errors.New("--from-key and --to-key must differ"))
+	}
+
+	keyring, err := backup.LoadKeyring(cfg)
+	if err != nil {
+		return fail(err)
+	}
+	for _, keyID := range []string{opts.FromKey, opts.ToKey} {
+		if !keyring.Has(keyID) {
+			return fail(fmt.Errorf("encryption key %s: %w", keyID, encryption.ErrNoKey))
+		}
+	}
+
+	destinations := backup.EnabledDestinations(cfg)
+	if opts.Destination != "" {
+		destinations = []string{opts.Destination}
+	}
+
+	for _, name := range destinations {
+		if err := ctx.Err(); err != nil {
+			return fail(err)
+		}
+
+		backend, err := backup.InitializeDestination(ctx, cfg, name)
+		if err != nil {
+			return fail(fmt.Errorf("failed to initialize storage destination %s: %w", name, err))
+		}
+		err = rekeyDestination(ctx, backend, keyring, opts, &result, logger.With().Str("destination", name).Logger())
+		backend.Close()
+		if err != nil {
+			return fail(fmt.Errorf("failed to rekey %s: %w", name, err))
+		}
+	}
+
+	result.Duration = time.Since(start)
+	if len(result.Failed) > 0 {
+		result.Error = fmt.Errorf("%d objects could not be rekeyed", len(result.Failed))
+		return result
+	}
+	result.Success = true
+	return result
+}
+
+// rekeyDestination rekeys the matching objects of one backend.
+// Returns an error only if the backend cannot be listed or the run was cancelled.
+func rekeyDestination(ctx context.Context, backend storage.Backend, keyring *encryption.Keyring, opts Options, result *Result, logger zerolog.Logger) error {
+	files, err := backend.List(ctx, opts.Database+"*")
+	if err != nil {
+		return err
+	}
+
+	var objects []storage.FileInfo
+	stored := make(map[string]bool)
+	var temps []storage.FileInfo
+	for _, file := range files {
+		if strings.HasSuffix(file.Path, TempSuffix) {
+			temps = append(temps, file)
+			continue
+		}
+		if !selected(file.Path, opts.Database) {
+			continue
+		}
+		objects = append(objects, file)
+		stored[file.Path] = true
+	}
+
+	// Copies left by an interrupted run: complete ones whose original is gone are moved into
+	// place, the others are discarded and their objects rekeyed again below
+	for _, temp := range temps {
+		objectPath := strings.TrimSuffix(temp.Path, TempSuffix)
+		if !selected(objectPath, opts.Database) {
+			continue
+		}
+		if stored[objectPath] {
+			if err := backend.Delete(ctx, temp.Path); err != nil {
+				logger.Warn().Err(err).Str("file", temp.Path).Msg("failed to remove leftover rekey copy")
+			}
+			continue
+		}
+		if err := finishReplace(ctx, backend, keyring, temp, opts.ToKey); err != nil {
+			result.Failed = append(result.Failed, Failure{Destination: backend.Name(), Path: objectPath, Error: err})
+			logger.Error().Err(err).Str("file", objectPath).Msg("failed to complete interrupted rekey")
+			continue
+		}
+		result.Rekeyed = append(result.Rekeyed, objectPath)
+		logger.Info().Str("file", objectPath).Msg("completed interrupted rekey")
+	}
+
+	for i, file := range objects {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		fileLog := logger.With().
+			Str("file", file.Path).
+			Str("progress", fmt.Sprintf("%d/%d", i+1, len(objects))).
+			Logger()
+
+		written, err := rekeyObject(ctx, backend, keyring, file, opts)
+		switch {
+		case errors.Is(err, errAlreadyRekeyed):
+			result.Done++
+			fileLog.Debug().Msg("already encrypted with the new key")
+		case errors.Is(err, errOtherKey):
+			result.Skipped++
+			fileLog.Debug().Msg("not encrypted with the old key, skipping")
+		case errors.Is(err, errStaleManifest):
+			// The object itself is rekeyed, only its recorded checksum is outdated
+			result.Rekeyed = append(result.Rekeyed, file.Path)
+			result.Bytes += written
+			fileLog.Warn().Err(err).Msg("rekeyed, but the manifest still describes the old object")
+		case err != nil:
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			result.Failed = append(result.Failed, Failure{Destination: backend.Name(), Path: file.Path, Error: err})
+			fileLog.Error().Err(err).Msg("failed to rekey")
+		default:
+			result.Rekeyed = append(result.Rekeyed, file.Path)
+			result.Bytes += written
+			fileLog.Info().
+				Int64("size_bytes", written).
+				Msg("rekeyed")
+		}
+	}
+
+	return nil
+}
+
+var (
+	errAlreadyRekeyed = errors.New("already encrypted with the new key")
+	errOtherKey       = errors.New("not encrypted with the old key")
+	// errStaleManifest is returned for objects that were rekeyed but whose manifest was not updated
+	errStaleManifest = errors.New("failed to update manifest")
+)
+
+// rekeyObject re-encrypts one object through a temporary copy and returns the bytes written
+func rekeyObject(ctx context.Context, backend storage.Backend, keyring *encryption.Keyring, file storage.FileInfo, opts Options) (int64, error) {
+	reader, err := backend.Read(ctx, file.Path)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+
+	buffered := bufio.NewReader(reader)
+	if !encryption.IsEncrypted(buffered) {
+		return 0, errOtherKey
+	}
+	header, err := encryption.PeekHeader(buffered)
+	if err != nil {
+		return 0, err
+	}
+	switch header.KeyID {
+	case opts.ToKey:
+		return 0, errAlreadyRekeyed
+	case opts.FromKey:
+	default:
+		return 0, errOtherKey
+	}
+
+	plain, _, err := keyring.Decrypt(buffered)
+	if err != nil {
+		return 0, err
+	}
+	sealed, err := keyring.EncryptWith(plain, opts.ToKey)
+	if err != nil {
+		return 0, err
+	}
+
+	// Decryption errors (corrupt or truncated objects) abort the write, so the
+	// temporary copy is only complete if the whole object was authenticated
+	temp := file.Path + TempSuffix
+	counter := newCountingReader(sealed)
+	if err := backend.WriteStream(ctx, counter, temp); err != nil {
+		return 0, err
+	}
+
+	info, err := backend.Stat(ctx, temp)
+	if err == nil && info.Size != counter.n {
+		err = fmt.Errorf("size mismatch: wrote %d bytes, stored %d", counter.n, info.Size)
+	}
+	if err != nil {
+		backend.Delete(ctx, temp)
+		return 0, err
+	}
+
+	// A failed replace may have removed or truncated the original on backends that
+	// overwrite by rewriting, so the copy is only discarded while the original is intact.
+	// Otherwise it is left for the next run to move into place.
+	if err := storage.Replace(ctx, backend, temp, file.Path, file.ModTime); err != nil {
+		if original, statErr := backend.Stat(ctx, file.Path); statErr == nil && original.Size == file.Size {
+			backend.Delete(ctx, temp)
+			return 0, err
+		}
+		return 0, fmt.Errorf("%w (the rekeyed copy is kept as %s)", err, temp)
+	}
+
+	if err := updateManifest(ctx, backend, file.Path, counter, opts.ToKey); err != nil {
+		return counter.n, fmt.Errorf("%w: %v", errStaleManifest, err)
+	}
+	return counter.n, nil
+}
+
+// finishReplace moves a leftover copy into place after checking it decrypts completely with toKey
+func finishReplace(ctx context.Context, backend storage.Backend, keyring *encryption.Keyring, temp storage.FileInfo, toKey string) error {
+	reader, err := backend.Read(ctx, temp.Path)
+	if err != nil {
+		return err
+	}
+	counter := newCountingReader(reader)
+	plain, header, err := keyring.Decrypt(counter)
+	if err == nil {
+		_, err = io.Copy(io.Discard, plain)
+	}
+	reader.Close()
+	if err != nil {
+		return fmt.Errorf("leftover copy %s is incomplete: %w", temp.Path, err)
+	}
+	if header.KeyID != toKey {
+		return fmt.Errorf("leftover copy %s is encrypted with key %s", temp.Path, header.KeyID)
+	}
+
+	objectPath := strings.TrimSuffix(temp.Path, TempSuffix)
+	if err := storage.Replace(ctx, backend, temp.Path, objectPath, time.Time{}); err != nil {
+		return err
+	}
+	return updateManifest(ctx, backend, objectPath, counter, toKey)
+}
+
+// updateManifest records the new checksum, size and key of a rekeyed object in its manifest,
+// if it has one
+func updateManifest(ctx context.Context, backend storage.Backend, path string, counter *countingReader, keyID string) error {
+	manifest, err := storage.ReadManifest(ctx, backend, path)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	manifest.Size = counter.n
+	manifest.SHA256 = hex.EncodeToString(counter.hash.Sum(nil))
+	manifest.KeyID = keyID
+	return storage.WriteManifest(ctx, backend, path, *manifest)
+}
+
+// selected reports whether a stored path is a backup or archived WAL of database (any if empty)
+func selected(path, database string) bool {
+	if strings.HasSuffix(path, rotation.PinSuffix) {
+		return false
+	}
+	base := filepath.Base(path)
+	if hostID, ok := rotation.ParseWALFilename(base); ok {
+		return database == "" || hostID == database
+	}
+	components, err := rotation.ParseBackupFilename(base)
+	if err != nil {
+		return false
+	}
+	return database == "" || components.DatabaseName == database
+}
+
+// countingReader counts and hashes the bytes read through it
+type countingReader struct {
+	r    io.Reader
+	n    int64
+	hash hash.Hash
+}
+
+func newCountingReader(r io.Reader) *countingReader {
+	return &countingReader{r: r, hash: sha256.New()}
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	c.hash.Write(p[:n])
+	return n, err
+}
@@ -0,0 +1,269 @@
+package rekey
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/williamokano/pg_backuper/pkg/backup"
+	"github.com/williamokano/pg_backuper/pkg/config"
+	"github.com/williamokano/pg_backuper/pkg/encryption"
+	"github.com/williamokano/pg_backuper/pkg/rotation"
+	"github.com/williamokano/pg_backuper/pkg/storage"
+)
+
+// rekeyConfig returns a config with one local destination and keys "old" and "new"
+func rekeyConfig(t *testing.T) (*config.Config, string) {
+	dir := t.TempDir()
+	keys := t.TempDir()
+
+	var encryptionKeys []config.EncryptionKey
+	for i, id := range []string{"old", "new"} {
+		path := filepath.Join(keys, id+".key")
+		require.NoError(t, os.WriteFile(path, bytes.Repeat([]byte{byte(i + 1)}, 32), 0600))
+		encryptionKeys = append(encryptionKeys, config.EncryptionKey{ID: id, KeyFile: path})
+	}
+
+	cfg := &config.Config{
+		Storage: config.StorageConfig{
+			Destinations: []config.StorageDestination{
+				{Name: "primary", Type: "local", Enabled: true, Options: map[string]interface{}{"path": dir}},
+			},
+		},
+		Encryption: config.EncryptionConfig{Enabled: true, KeyID: "new", Keys: encryptionKeys},
+	}
+	return cfg, dir
+}
+
+// writeBackup stores data encrypted with keyID (plaintext if empty) as a daily backup of app
+func writeBackup(t *testing.T, cfg *config.Config, dir string, days int, keyID string, data []byte) string {
+	name := rotation.DatabaseNaming("app").Filename("daily", time.Now().AddDate(0, 0, -days))
+	content := data
+	if keyID != "" {
+		keyring, err := encryption.LoadKeyring(cfg.Encryption)
+		require.NoError(t, err)
+		sealed, err := keyring.EncryptWith(bytes.NewReader(data), keyID)
+		require.NoError(t, err)
+		content, err = io.ReadAll(sealed)
+		require.NoError(t, err)
+	}
+
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, content, 0644))
+	modTime := time.Now().AddDate(0, 0, -days).Truncate(time.Second)
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+	return name
+}
+
+// backendFor returns the local backend of the "primary" destination
+func backendFor(t *testing.T, cfg *config.Config) storage.Backend {
+	backend, err := backup.InitializeDestination(context.Background(), cfg, "primary")
+	require.NoError(t, err)
+	t.Cleanup(func() { backend.Close() })
+	return backend
+}
+
+// storedKey returns the key a stored backup is encrypted with, after checking it decrypts to want
+func storedKey(t *testing.T, cfg *config.Config, path string, want []byte) string {
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	buffered := bufio.NewReader(file)
+	header, err := encryption.PeekHeader(buffered)
+	require.NoError(t, err)
+
+	keyring, err := encryption.LoadKeyring(cfg.Encryption)
+	require.NoError(t, err)
+	plain, _, err := keyring.Decrypt(buffered)
+	require.NoError(t, err)
+	got, err := io.ReadAll(plain)
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+	return header.KeyID
+}
+
+// failingOverwrite is a backend without renames or copies whose overwrites fail.
+// With loseOriginal set, a failed overwrite also removes the object it was replacing.
+type failingOverwrite struct {
+	storage.Backend
+	loseOriginal bool
+}
+
+func (f *failingOverwrite) WriteStream(ctx context.Context, r io.Reader, destPath string) error {
+	if strings.HasSuffix(destPath, TempSuffix) {
+		return f.Backend.WriteStream(ctx, r, destPath)
+	}
+	if f.loseOriginal {
+		f.Backend.Delete(ctx, destPath)
+	}
+	return errors.New("upload interrupted")
+}
+
+func TestRekey(t *testing.T) {
+	ctx := context.Background()
+	data := bytes.Repeat([]byte("PGDMP"), 30000)
+
+	t.Run("rekeys_old_key_only", func(t *testing.T) {
+		cfg, dir := rekeyConfig(t)
+		old := writeBackup(t, cfg, dir, 1, "old", data)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, storage.ManifestPath(old)),
+			[]byte(`{"database":"app","sha256":"stale","encryption_key_id":"old"}`), 0644))
+		current := writeBackup(t, cfg, dir, 2, "new", data)
+		plain := writeBackup(t, cfg, dir, 3, "", data)
+		before, err := os.Stat(filepath.Join(dir, old))
+		require.NoError(t, err)
+
+		result := Rekey(ctx, cfg, Options{FromKey: "old", ToKey: "new"}, zerolog.Nop())
+
+		require.NoError(t, result.Error)
+		assert.True(t, result.Success)
+		assert.Equal(t, []string{old}, result.Rekeyed)
+		assert.Equal(t, 1, result.Done)
+		assert.Equal(t, 1, result.Skipped)
+		assert.Positive(t, result.Bytes)
+
+		assert.Equal(t, "new", storedKey(t, cfg, filepath.Join(dir, old), data))
+		assert.Equal(t, "new", storedKey(t, cfg, filepath.Join(dir, current), data))
+		stored, err := os.ReadFile(filepath.Join(dir, plain))
+		require.NoError(t, err)
+		assert.Equal(t, data, stored)
+
+		manifest, err := storage.ReadManifest(ctx, backendFor(t, cfg), old)
+		require.NoError(t, err)
+		rekeyed, err := os.ReadFile(filepath.Join(dir, old))
+		require.NoError(t, err)
+		sum := sha256.Sum256(rekeyed)
+		assert.Equal(t, hex.EncodeToString(sum[:]), manifest.SHA256)
+		assert.Equal(t, int64(len(rekeyed)), manifest.Size)
+		assert.Equal(t, "new", manifest.KeyID)
+		assert.Equal(t, "app", manifest.Database)
+
+		after, err := os.Stat(filepath.Join(dir, old))
+		require.NoError(t, err)
+		assert.Equal(t, before.ModTime(), after.ModTime())
+		assert.NoFileExists(t, filepath.Join(dir, old+TempSuffix))
+
+		again := Rekey(ctx, cfg, Options{FromKey: "old", ToKey: "new"}, zerolog.Nop())
+		assert.True(t, again.Success)
+		assert.Empty(t, again.Rekeyed)
+		assert.Equal(t, 2, again.Done)
+	})
+
+	t.Run("resumes_after_interruption", func(t *testing.T) {
+		cfg, dir := rekeyConfig(t)
+		old := writeBackup(t, cfg, dir, 1, "old", data)
+
+		// Interrupted after the copy was written but before it replaced the original
+		moved := writeBackup(t, cfg, dir, 2, "new", data)
+		require.NoError(t, os.Rename(filepath.Join(dir, moved), filepath.Join(dir, moved+TempSuffix)))
+
+		// Interrupted while writing the copy
+		partial, err := os.ReadFile(filepath.Join(dir, old))
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, old+TempSuffix), partial[:100], 0644))
+
+		result := Rekey(ctx, cfg, Options{FromKey: "old", ToKey: "new"}, zerolog.Nop())
+
+		require.NoError(t, result.Error)
+		assert.ElementsMatch(t, []string{old, moved}, result.Rekeyed)
+		assert.Equal(t, "new", storedKey(t, cfg, filepath.Join(dir, old), data))
+		assert.Equal(t, "new", storedKey(t, cfg, filepath.Join(dir, moved), data))
+		assert.NoFileExists(t, filepath.Join(dir, old+TempSuffix))
+		assert.NoFileExists(t, filepath.Join(dir, moved+TempSuffix))
+	})
+
+	t.Run("rekeys_archived_wal", func(t *testing.T) {
+		cfg, dir := rekeyConfig(t)
+		backupName := writeBackup(t, cfg, dir, 1, "old", data)
+		wal := rotation.WALFilename("db.internal", 5432, "000000010000000000000002")
+		require.NoError(t, os.Rename(filepath.Join(dir, writeBackup(t, cfg, dir, 2, "old", data)), filepath.Join(dir, wal)))
+
+		result := Rekey(ctx, cfg, Options{FromKey: "old", ToKey: "new", Database: "db.internal-5432"}, zerolog.Nop())
+
+		require.NoError(t, result.Error)
+		assert.Equal(t, []string{wal}, result.Rekeyed)
+		assert.Equal(t, "new", storedKey(t, cfg, filepath.Join(dir, wal), data))
+		assert.Equal(t, "old", storedKey(t, cfg, filepath.Join(dir, backupName), data))
+	})
+
+	t.Run("corrupt_object_is_kept", func(t *testing.T) {
+		cfg, dir := rekeyConfig(t)
+		old := writeBackup(t, cfg, dir, 1, "old", data)
+		path := filepath.Join(dir, old)
+		stored, err := os.ReadFile(path)
+		require.NoError(t, err)
+		stored[len(stored)-10] ^= 1
+		require.NoError(t, os.WriteFile(path, stored, 0644))
+
+		result := Rekey(ctx, cfg, Options{FromKey: "old", ToKey: "new"}, zerolog.Nop())
+
+		assert.False(t, result.Success)
+		require.Len(t, result.Failed, 1)
+		assert.Equal(t, old, result.Failed[0].Path)
+		unchanged, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, stored, unchanged)
+		assert.NoFileExists(t, path+TempSuffix)
+	})
+
+	t.Run("failed_overwrite_keeps_copy_when_original_is_lost", func(t *testing.T) {
+		cfg, dir := rekeyConfig(t)
+		old := writeBackup(t, cfg, dir, 1, "old", data)
+		keyring, err := encryption.LoadKeyring(cfg.Encryption)
+		require.NoError(t, err)
+		backend := &failingOverwrite{Backend: backendFor(t, cfg), loseOriginal: true}
+
+		var result Result
+		err = rekeyDestination(ctx, backend, keyring, Options{FromKey: "old", ToKey: "new"}, &result, zerolog.Nop())
+
+		require.NoError(t, err)
+		require.Len(t, result.Failed, 1)
+		assert.ErrorContains(t, result.Failed[0].Error, "the rekeyed copy is kept")
+		assert.NoFileExists(t, filepath.Join(dir, old))
+		assert.Equal(t, "new", storedKey(t, cfg, filepath.Join(dir, old+TempSuffix), data))
+
+		// The next run moves the kept copy into place
+		again := Rekey(ctx, cfg, Options{FromKey: "old", ToKey: "new"}, zerolog.Nop())
+		require.NoError(t, again.Error)
+		assert.Equal(t, []string{old}, again.Rekeyed)
+		assert.Equal(t, "new", storedKey(t, cfg, filepath.Join(dir, old), data))
+		assert.NoFileExists(t, filepath.Join(dir, old+TempSuffix))
+	})
+
+	t.Run("failed_overwrite_discards_copy_when_original_is_intact", func(t *testing.T) {
+		cfg, dir := rekeyConfig(t)
+		old := writeBackup(t, cfg, dir, 1, "old", data)
+		keyring, err := encryption.LoadKeyring(cfg.Encryption)
+		require.NoError(t, err)
+		backend := &failingOverwrite{Backend: backendFor(t, cfg)}
+
+		var result Result
+		err = rekeyDestination(ctx, backend, keyring, Options{FromKey: "old", ToKey: "new"}, &result, zerolog.Nop())
+
+		require.NoError(t, err)
+		require.Len(t, result.Failed, 1)
+		assert.Equal(t, "old", storedKey(t, cfg, filepath.Join(dir, old), data))
+		assert.NoFileExists(t, filepath.Join(dir, old+TempSuffix))
+	})
+
+	t.Run("unknown_key", func(t *testing.T) {
+		cfg, _ := rekeyConfig(t)
+
+		result := Rekey(ctx, cfg, Options{FromKey: "old", ToKey: "missing"}, zerolog.Nop())
+
+		assert.ErrorIs(t, result.Error, encryption.ErrNoKey)
+	})
+}
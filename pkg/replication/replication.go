@@ -0,0 +1,310 @@
+package replication
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/williamokano/pg_backuper/pkg/backup"
+	"github.com/williamokano/pg_backuper/pkg/config"
+	"github.com/williamokano/pg_backuper/pkg/rotation"
+	"github.com/williamokano/pg_backuper/pkg/storage"
+)
+
+// Verification modes of copied files
+const (
+	VerifyNone     = "none"     // Trust the backend's write result
+	VerifySize     = "size"     // Compare the size of the copy with the source
+	VerifyChecksum = "checksum" // Read the copy back and compare its SHA-256 with the source
+)
+
+// Options defines what to replicate between two storage destinations
+type Options struct {
+	From     string // Destination to copy from
+	To       string // Destination to copy to
+	Database string // Only backups of this database or server (host-port), optional
+	Tier     string // Only backups of this tier, optional (excludes archived WAL)
+	Verify   string // VerifyNone, VerifySize or VerifyChecksum
+	DryRun   bool   // Only report what would be copied
+}
+
+// Result represents the outcome of a sync
+type Result struct {
+	From     string
+	To       string
+	Copied   []string                   // Files copied to the target (with DryRun: files that would be copied)
+	Present  int                        // Files already on the target with the same size
+	Failed   []string                   // Files that could not be copied or failed verification
+	Bytes    int64                      // Bytes copied (with DryRun: bytes that would be copied)
+	Blocked  []rotation.BlockedDeletion // Backups retention on the target would have deleted but a safety guard kept
+	Success  bool
+	Error    error
+	Duration time.Duration
+}
+
+// Sync copies the backups (and archived WAL) of one storage destination that are missing
+// on another, then applies the retention of each copied backup's source on the target.
+// A file on the target with a different size than on the source is copied again.
+func Sync(ctx context.Context, cfg *config.Config, opts Options, logger zerolog.Logger) Result {
+	start := time.Now()
+
+	result := Result{
+		From: opts.From,
+		To:   opts.To,
+	}
+
+	fail := func(err error) Result {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	if err := validateOptions(&opts); err != nil {
+		return fail(err)
+	}
+
+	syncLog := logger.With().
+		Str("from", opts.From).
+		Str("to", opts.To).
+		Bool("dry_run", opts.DryRun).
+		Logger()
+
+	source, err := backup.InitializeDestination(ctx, cfg, opts.From)
+	if err != nil {
+		return fail(fmt.Errorf("failed to initialize storage destination %s: %w", opts.From, err))
+	}
+	defer source.Close()
+
+	target, err := backup.InitializeDestination(ctx, cfg, opts.To)
+	if err != nil {
+		return fail(fmt.Errorf("failed to initialize storage destination %s: %w", opts.To, err))
+	}
+	defer target.Close()
+
+	pattern := opts.Database + "*"
+
+	files, err := source.List(ctx, pattern)
+	if err != nil {
+		return fail(fmt.Errorf("failed to list backups on %s: %w", opts.From, err))
+	}
+	existing, err := target.List(ctx, pattern)
+	if err != nil {
+		return fail(fmt.Errorf("failed to list backups on %s: %w", opts.To, err))
+	}
+
+	present := make(map[string]int64)
+	for _, file := range existing {
+		present[file.Path] = file.Size
+	}
+
+	// Name order copies the backups of each source and tier oldest first
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+
+	// Sources whose backups were copied, for retention afterwards
+	copiedSources := make(map[rotation.Naming]bool)
+
+	for _, file := range files {
+		naming, ok := selectFile(file.Path, opts)
+		if !ok {
+			continue
+		}
+
+		if size, ok := present[file.Path]; ok && size == file.Size {
+			result.Present++
+			continue
+		}
+
+		fileLog := syncLog.With().
+			Str("file", file.Path).
+			Int64("size_bytes", file.Size).
+			Logger()
+
+		if opts.DryRun {
+			fileLog.Info().Msg("would copy backup")
+			result.Copied = append(result.Copied, file.Path)
+			result.Bytes += file.Size
+			continue
+		}
+
+		if ctx.Err() != nil {
+			return fail(ctx.Err())
+		}
+
+		copyStart := time.Now()
+		if err := copyFile(ctx, source, target, file, opts.Verify); err != nil {
+			fileLog.Error().Err(err).Msg("failed to copy backup")
+			result.Failed = append(result.Failed, file.Path)
+			continue
+		}
+		if err := storage.CopyManifest(ctx, source, target, file.Path); err != nil {
+			fileLog.Warn().Err(err).Msg("failed to copy backup manifest")
+		}
+
+		fileLog.Info().
+			Dur("duration", time.Since(copyStart)).
+			Msg("copied backup")
+		result.Copied = append(result.Copied, file.Path)
+		result.Bytes += file.Size
+		if naming.Kind != rotation.KindWAL {
+			copiedSources[naming] = true
+		}
+	}
+
+	for naming := range copiedSources {
+		result.Blocked = append(result.Blocked, applyRetention(ctx, cfg, target, naming, syncLog)...)
+	}
+
+	result.Duration = time.Since(start)
+	if len(result.Failed) > 0 {
+		result.Error = fmt.Errorf("%d of %d files failed to copy", len(result.Failed), len(result.Failed)+len(result.Copied))
+		return result
+	}
+
+	result.Success = true
+	return result
+}
+
+// validateOptions checks the options and fills defaults
+func validateOptions(opts *Options) error {
+	if opts.From == "" || opts.To == "" {
+		return errors.New("source and target destinations are required")
+	}
+	if opts.From == opts.To {
+		return errors.New("source and target destinations must differ")
+	}
+
+	switch opts.Verify {
+	case "":
+		opts.Verify = VerifyNone
+	case VerifyNone, VerifySize, VerifyChecksum:
+	default:
+		return fmt.Errorf("invalid verify mode %q (must be %s, %s or %s)", opts.Verify, VerifyNone, VerifySize, VerifyChecksum)
+	}
+
+	return nil
+}
+
+// selectFile reports whether a stored file is a backup or archived WAL file matching the
+// options, and returns the naming of its source
+func selectFile(path string, opts Options) (rotation.Naming, bool) {
+	base := filepath.Base(path)
+
+	if name, ok := rotation.ParseWALFilename(base); ok {
+		naming := rotation.Naming{Name: name, Kind: rotation.KindWAL}
+		return naming, opts.Tier == "" && (opts.Database == "" || opts.Database == name)
+	}
+
+	components, err := rotation.ParseBackupFilename(base)
+	if err != nil {
+		return rotation.Naming{}, false
+	}
+	if opts.Database != "" && components.DatabaseName != opts.Database {
+		return rotation.Naming{}, false
+	}
+	if opts.Tier != "" && components.Tier != opts.Tier {
+		return rotation.Naming{}, false
+	}
+
+	naming := rotation.Naming{
+		Name: components.DatabaseName,
+		Kind: components.Kind,
+		Ext:  filepath.Ext(base),
+	}
+	return naming, true
+}
+
+// copyFile streams a file from source to target and verifies the copy.
+// A copy that fails verification is deleted from the target.
+func copyFile(ctx context.Context, source, target storage.Backend, file storage.FileInfo, verify string) error {
+	reader, err := source.Read(ctx, file.Path)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	sourceHash := sha256.New()
+	if err := target.WriteStream(ctx, io.TeeReader(reader, sourceHash), file.Path); err != nil {
+		return err
+	}
+
+	var verifyErr error
+	switch verify {
+	case VerifySize:
+		verifyErr = verifySize(ctx, target, file)
+	case VerifyChecksum:
+		verifyErr = verifyChecksum(ctx, target, file.Path, sourceHash)
+	}
+
+	if verifyErr != nil {
+		// Never leave a copy behind that would later be mistaken for a good backup
+		target.Delete(ctx, file.Path)
+		return fmt.Errorf("verification failed: %w", verifyErr)
+	}
+
+	return nil
+}
+
+// verifySize compares the size of the copy with the source
+func verifySize(ctx context.Context, target storage.Backend, file storage.FileInfo) error {
+	info, err := target.Stat(ctx, file.Path)
+	if err != nil {
+		return err
+	}
+	if info.Size != file.Size {
+		return fmt.Errorf("size mismatch: copied %d bytes, source has %d", info.Size, file.Size)
+	}
+	return nil
+}
+
+// verifyChecksum reads the copy back and compares its SHA-256 with the data read from the source
+func verifyChecksum(ctx context.Context, target storage.Backend, path string, sourceHash hash.Hash) error {
+	reader, err := target.Read(ctx, path)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	copyHash := sha256.New()
+	if _, err := io.Copy(copyHash, reader); err != nil {
+		return err
+	}
+
+	if !bytes.Equal(copyHash.Sum(nil), sourceHash.Sum(nil)) {
+		return fmt.Errorf("checksum mismatch: copy %x, source %x", copyHash.Sum(nil), sourceHash.Sum(nil))
+	}
+	return nil
+}
+
+// applyRetention applies the retention of a backup source on the target destination.
+// Returns the deletions the rotation guards blocked.
+func applyRetention(ctx context.Context, cfg *config.Config, target storage.Backend, naming rotation.Naming, logger zerolog.Logger) []rotation.BlockedDeletion {
+	sourceLog := logger.With().Str("database", naming.Name).Logger()
+	if naming.Kind != "" {
+		sourceLog = sourceLog.With().Str("kind", naming.Kind).Logger()
+	}
+
+	retentionTiers, ok := backup.RetentionFor(cfg, naming)
+	if !ok {
+		sourceLog.Warn().Msg("backups do not belong to a configured source, retention not applied")
+		return nil
+	}
+	if len(retentionTiers) == 0 {
+		return nil
+	}
+
+	blocked, err := rotation.ApplyGuardedRetention(ctx, target, naming, retentionTiers, backup.RotationGuards(cfg), sourceLog)
+	if err != nil {
+		sourceLog.Error().Err(err).Msg("rotation failed on target destination")
+	}
+	return blocked
+}
@@ -0,0 +1,142 @@
+package replication
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/williamokano/pg_backuper/pkg/config"
+	"github.com/williamokano/pg_backuper/pkg/rotation"
+	"github.com/williamokano/pg_backuper/pkg/storage"
+)
+
+// syncConfig returns a config with two local destinations and the directories behind them
+func syncConfig(t *testing.T) (*config.Config, string, string) {
+	primary := t.TempDir()
+	offsite := t.TempDir()
+
+	cfg := &config.Config{
+		Storage: config.StorageConfig{
+			Destinations: []config.StorageDestination{
+				{Name: "local_primary", Type: "local", Enabled: true, Options: map[string]interface{}{"path": primary}},
+				{Name: "s3_offsite", Type: "local", Enabled: true, Options: map[string]interface{}{"path": offsite}},
+			},
+		},
+		Databases: []config.DatabaseConfig{
+			{Name: "app", RetentionTiers: []config.RetentionTier{{Tier: "daily", Retention: 2}}},
+		},
+	}
+	return cfg, primary, offsite
+}
+
+func writeFile(t *testing.T, dir, name, content string) {
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+}
+
+func TestSync(t *testing.T) {
+	day := func(d int) string {
+		return rotation.DatabaseNaming("app").Filename("daily", time.Date(2025, 3, d, 2, 0, 0, 0, time.UTC))
+	}
+
+	t.Run("copies_missing_backups_and_applies_retention", func(t *testing.T) {
+		cfg, primary, offsite := syncConfig(t)
+		writeFile(t, primary, day(8), "PGDMP-8")
+		writeFile(t, primary, day(9), "PGDMP-9")
+		writeFile(t, primary, day(10), "PGDMP-10")
+		writeFile(t, offsite, day(10), "PGDMP-10")
+		writeFile(t, primary, storage.ManifestPath(day(8)), `{"database":"app"}`)
+		writeFile(t, primary, storage.ManifestPath(day(9)), `{"database":"app"}`)
+		writeFile(t, primary, "other--daily--2025-03-10T02-00-00Z.backup", "PGDMP")
+
+		result := Sync(context.Background(), cfg, Options{
+			From:     "local_primary",
+			To:       "s3_offsite",
+			Database: "app",
+			Verify:   VerifyChecksum,
+		}, zerolog.Nop())
+
+		require.NoError(t, result.Error)
+		assert.True(t, result.Success)
+		assert.Equal(t, []string{day(8), day(9)}, result.Copied)
+		assert.Equal(t, 1, result.Present)
+
+		// Retention 2 on the target keeps the two newest dailies, even though day 8 was written last
+		assert.NoFileExists(t, filepath.Join(offsite, day(8)))
+		assert.FileExists(t, filepath.Join(offsite, day(9)))
+		// Manifests travel with their backups and are rotated with them
+		assert.NoFileExists(t, filepath.Join(offsite, storage.ManifestPath(day(8))))
+		assert.FileExists(t, filepath.Join(offsite, storage.ManifestPath(day(9))))
+		assert.NoFileExists(t, filepath.Join(offsite, "other--daily--2025-03-10T02-00-00Z.backup"))
+	})
+
+	t.Run("dry_run_copies_nothing", func(t *testing.T) {
+		cfg, primary, offsite := syncConfig(t)
+		writeFile(t, primary, day(9), "PGDMP-9")
+
+		result := Sync(context.Background(), cfg, Options{From: "local_primary", To: "s3_offsite", DryRun: true}, zerolog.Nop())
+
+		require.True(t, result.Success)
+		assert.Equal(t, []string{day(9)}, result.Copied)
+		assert.Equal(t, int64(len("PGDMP-9")), result.Bytes)
+		assert.NoFileExists(t, filepath.Join(offsite, day(9)))
+	})
+
+	t.Run("recopies_files_with_different_size", func(t *testing.T) {
+		cfg, primary, offsite := syncConfig(t)
+		writeFile(t, primary, day(9), "PGDMP-9")
+		writeFile(t, offsite, day(9), "PGD")
+
+		result := Sync(context.Background(), cfg, Options{From: "local_primary", To: "s3_offsite", Verify: VerifySize}, zerolog.Nop())
+
+		require.True(t, result.Success)
+		assert.Equal(t, []string{day(9)}, result.Copied)
+		content, err := os.ReadFile(filepath.Join(offsite, day(9)))
+		require.NoError(t, err)
+		assert.Equal(t, "PGDMP-9", string(content))
+	})
+
+	t.Run("archived_wal_is_copied_unless_filtering_by_tier", func(t *testing.T) {
+		cfg, primary, offsite := syncConfig(t)
+		wal := rotation.WALFilename("db.internal", 5432, "000000010000000000000002")
+		writeFile(t, primary, wal, "WAL")
+
+		result := Sync(context.Background(), cfg, Options{From: "local_primary", To: "s3_offsite", Tier: "daily"}, zerolog.Nop())
+		require.True(t, result.Success)
+		assert.Empty(t, result.Copied)
+
+		result = Sync(context.Background(), cfg, Options{From: "local_primary", To: "s3_offsite"}, zerolog.Nop())
+		require.True(t, result.Success)
+		assert.Equal(t, []string{wal}, result.Copied)
+		assert.FileExists(t, filepath.Join(offsite, wal))
+	})
+}
+
+func TestValidateOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    Options
+		wantErr bool
+	}{
+		{name: "valid", opts: Options{From: "a", To: "b"}},
+		{name: "missing target", opts: Options{From: "a"}, wantErr: true},
+		{name: "same destination", opts: Options{From: "a", To: "a"}, wantErr: true},
+		{name: "invalid verify mode", opts: Options{From: "a", To: "b", Verify: "md5"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateOptions(&tt.opts)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, VerifyNone, tt.opts.Verify)
+			}
+		})
+	}
+}
@@ -0,0 +1,393 @@
+package restore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/williamokano/pg_backuper/pkg/backup"
+	"github.com/williamokano/pg_backuper/pkg/config"
+	"github.com/williamokano/pg_backuper/pkg/dumpformat"
+	"github.com/williamokano/pg_backuper/pkg/encryption"
+	"github.com/williamokano/pg_backuper/pkg/rotation"
+	"github.com/williamokano/pg_backuper/pkg/storage"
+)
+
+// SelectorLatest selects the newest backup of a database (optionally within a tier)
+const SelectorLatest = "latest"
+
+// Options defines what to restore and where to restore it
+type Options struct {
+	Database    string // Source database name, as used in backup filenames
+	Destination string // Storage destination to fetch the backup from
+	Backup      string // Backup filename or "latest"
+	Tier        string // Restrict "latest" to this tier (optional)
+
+	TargetHost string // Defaults to the source database host
+	TargetPort int    // Defaults to the source database port
+	TargetUser string // Defaults to the source database user
+	TargetDB   string // Database to restore into (required)
+
+	Clean        bool // Drop database objects before recreating them
+	Create       bool // Create the target database before restoring
+	NoOwner      bool // Do not restore object ownership
+	Jobs         int  // Number of parallel pg_restore jobs
+	KeepDownload bool // Keep the downloaded archive after restore
+}
+
+// Result represents the outcome of a restore operation
+type Result struct {
+	Database         string
+	Destination      string
+	Backup           string // Backup file that was restored
+	TargetDB         string
+	Size             int64
+	Success          bool
+	Error            error
+	DownloadDuration time.Duration
+	RestoreDuration  time.Duration
+	Duration         time.Duration
+}
+
+// Restore fetches a backup from a storage destination and restores it with
+// pg_restore, or psql for plain-format backups
+func Restore(ctx context.Context, cfg *config.Config, opts Options, logger zerolog.Logger) Result {
+	start := time.Now()
+
+	result := Result{
+		Database:    opts.Database,
+		Destination: opts.Destination,
+		TargetDB:    opts.TargetDB,
+	}
+
+	fail := func(err error) Result {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	if err := applyDefaults(cfg, &opts); err != nil {
+		return fail(err)
+	}
+
+	restoreLog := logger.With().
+		Str("database", opts.Database).
+		Str("destination", opts.Destination).
+		Str("target_host", opts.TargetHost).
+		Int("target_port", opts.TargetPort).
+		Str("target_db", opts.TargetDB).
+		Logger()
+
+	// Same authentication as BackupDatabase: .pgpass must exist with 0600 permissions
+	pgpassPath, err := backup.GetPgpassPath(cfg.GetPgpassFile())
+	if err != nil {
+		return fail(fmt.Errorf(".pgpass file not found: %w", err))
+	}
+	if err := backup.ValidatePgpassPermissions(pgpassPath); err != nil {
+		return fail(fmt.Errorf(".pgpass file has incorrect permissions: %w", err))
+	}
+
+	backend, err := backup.InitializeDestination(ctx, cfg, opts.Destination)
+	if err != nil {
+		return fail(fmt.Errorf("failed to initialize storage destination: %w", err))
+	}
+	defer backend.Close()
+
+	file, err := ResolveBackup(ctx, backend, opts.Database, opts.Backup, opts.Tier)
+	if err != nil {
+		return fail(err)
+	}
+	result.Backup = file.Path
+	result.Size = file.Size
+
+	restoreLog = restoreLog.With().Str("backup", file.Path).Logger()
+	restoreLog.Info().Int64("size_bytes", file.Size).Msg("resolved backup to restore")
+
+	// Download archive to temp directory (pg_restore needs a seekable file for parallel jobs)
+	restoreDir := filepath.Join(cfg.GetTempDir(), "restore")
+	if err := os.MkdirAll(restoreDir, 0755); err != nil {
+		return fail(fmt.Errorf("failed to create restore directory: %w", err))
+	}
+	archivePath := filepath.Join(restoreDir, filepath.Base(file.Path))
+
+	downloadStart := time.Now()
+	if err := storage.Download(ctx, backend, file.Path, archivePath, storage.DefaultRetryConfig()); err != nil {
+		return fail(fmt.Errorf("failed to download backup (rerun to resume): %w", err))
+	}
+	result.DownloadDuration = time.Since(downloadStart)
+	if !opts.KeepDownload {
+		defer os.Remove(archivePath)
+	}
+
+	restoreLog.Info().
+		Str("archive", archivePath).
+		Dur("duration", result.DownloadDuration).
+		Msg("backup downloaded")
+
+	// Encrypted backups are decrypted to a separate file, which is always removed:
+	// --keep-download keeps only the encrypted download
+	encrypted, err := encryption.IsEncryptedFile(archivePath)
+	if err != nil {
+		return fail(fmt.Errorf("failed to read backup: %w", err))
+	}
+	if encrypted {
+		keyring, err := backup.LoadKeyring(cfg)
+		if err != nil {
+			return fail(err)
+		}
+		plainPath := archivePath + ".dec"
+		if err := keyring.DecryptFile(archivePath, plainPath); err != nil {
+			return fail(fmt.Errorf("failed to decrypt backup: %w", err))
+		}
+		defer os.Remove(plainPath)
+		archivePath = plainPath
+		restoreLog.Info().Msg("backup decrypted")
+	}
+
+	env := append(os.Environ(), "PGPASSFILE="+pgpassPath)
+	logsDir := filepath.Join(cfg.GetTempDir(), "logs")
+	logName := fmt.Sprintf("%s--restore--%s", opts.TargetDB, rotation.FormatTimestamp(time.Now()))
+
+	restoreStart := time.Now()
+
+	if opts.Create {
+		restoreLog.Info().Msg("creating target database")
+		if err := run(ctx, "createdb", buildCreatedbArgs(opts), env, logsDir, logName+"--createdb.log", restoreLog); err != nil {
+			return fail(fmt.Errorf("failed to create target database: %w", err))
+		}
+	}
+
+	format, err := dumpformat.Detect(archivePath)
+	if err != nil {
+		return fail(fmt.Errorf("failed to detect backup format: %w", err))
+	}
+	restoreLog = restoreLog.With().Str("format", format).Logger()
+
+	switch format {
+	case dumpformat.Plain:
+		// SQL scripts are replayed as-is, pg_restore options do not apply
+		if opts.Clean || opts.NoOwner || opts.Jobs > 1 {
+			restoreLog.Warn().Msg("clean, no-owner and jobs are ignored for plain-format backups")
+		}
+		restoreLog.Info().Msg("running psql")
+
+		if err := run(ctx, "psql", buildPsqlArgs(opts, archivePath), env, logsDir, logName+".log", restoreLog); err != nil {
+			return fail(fmt.Errorf("psql failed: %w", err))
+		}
+	default:
+		restorePath := archivePath
+		if format == dumpformat.Directory {
+			restorePath = archivePath + ".dir"
+			os.RemoveAll(restorePath)
+			if err := dumpformat.UnpackDirectory(archivePath, restorePath); err != nil {
+				return fail(fmt.Errorf("failed to unpack directory dump: %w", err))
+			}
+			defer os.RemoveAll(restorePath)
+		}
+		if format == dumpformat.Tar && opts.Jobs > 1 {
+			// pg_restore cannot run tar archives in parallel
+			restoreLog.Warn().Msg("jobs are ignored for tar-format backups")
+			opts.Jobs = 1
+		}
+
+		restoreLog.Info().
+			Bool("clean", opts.Clean).
+			Bool("no_owner", opts.NoOwner).
+			Int("jobs", opts.Jobs).
+			Msg("running pg_restore")
+
+		if err := run(ctx, "pg_restore", buildRestoreArgs(opts, restorePath), env, logsDir, logName+".log", restoreLog); err != nil {
+			return fail(fmt.Errorf("pg_restore failed: %w", err))
+		}
+	}
+
+	result.RestoreDuration = time.Since(restoreStart)
+	result.Duration = time.Since(start)
+	result.Success = true
+
+	restoreLog.Info().
+		Dur("restore_duration", result.RestoreDuration).
+		Dur("duration", result.Duration).
+		Msg("restore completed successfully")
+
+	return result
+}
+
+// ResolveBackup finds the backup file to restore.
+// selector is either a backup filename or "latest" (empty means latest);
+// tier restricts "latest" to backups created for that tier.
+func ResolveBackup(ctx context.Context, backend storage.Backend, dbName, selector, tier string) (storage.FileInfo, error) {
+	if selector != "" && selector != SelectorLatest {
+		// A backup of another database would silently be restored into the target
+		components, err := rotation.ParseBackupFilename(selector)
+		if err != nil {
+			return storage.FileInfo{}, fmt.Errorf("backup %s is not a backup filename: %w", selector, err)
+		}
+		if components.DatabaseName != dbName {
+			return storage.FileInfo{}, fmt.Errorf("backup %s belongs to database %s, not %s", selector, components.DatabaseName, dbName)
+		}
+		info, err := backend.Stat(ctx, selector)
+		if err != nil {
+			return storage.FileInfo{}, fmt.Errorf("backup %s not found on %s: %w", selector, backend.Name(), err)
+		}
+		return *info, nil
+	}
+
+	pattern := rotation.GetBackupPattern("", dbName)
+	if tier != "" {
+		pattern = rotation.GetBackupPatternForTier("", dbName, tier)
+	}
+
+	files, err := backend.List(ctx, pattern)
+	if err != nil {
+		return storage.FileInfo{}, fmt.Errorf("failed to list backups on %s: %w", backend.Name(), err)
+	}
+
+	// Pick by filename timestamp rather than modification time, which reflects upload time
+	var latest storage.FileInfo
+	var latestTime time.Time
+	for _, file := range files {
+		components, err := rotation.ParseBackupFilename(file.Path)
+		if err != nil || components.DatabaseName != dbName {
+			continue
+		}
+		if tier != "" && components.Tier != tier {
+			continue
+		}
+		if latestTime.IsZero() || components.Timestamp.After(latestTime) {
+			latest = file
+			latestTime = components.Timestamp
+		}
+	}
+
+	if latestTime.IsZero() {
+		if tier != "" {
+			return storage.FileInfo{}, fmt.Errorf("no %s backups found for database %s on %s", tier, dbName, backend.Name())
+		}
+		return storage.FileInfo{}, fmt.Errorf("no backups found for database %s on %s", dbName, backend.Name())
+	}
+
+	return latest, nil
+}
+
+// applyDefaults validates options and fills connection details from the database config
+func applyDefaults(cfg *config.Config, opts *Options) error {
+	if opts.Database == "" {
+		return errors.New("source database is required")
+	}
+	if opts.TargetDB == "" {
+		return errors.New("target database is required")
+	}
+	if opts.Backup == "" {
+		opts.Backup = SelectorLatest
+	}
+	if opts.Tier != "" && opts.Backup != SelectorLatest {
+		return errors.New("tier can only be combined with the latest backup selector")
+	}
+
+	for _, db := range cfg.Databases {
+		if db.Name != opts.Database {
+			continue
+		}
+		if opts.TargetHost == "" {
+			opts.TargetHost = db.Host
+		}
+		if opts.TargetPort == 0 {
+			opts.TargetPort = db.GetPort(cfg.GlobalDefaults)
+		}
+		if opts.TargetUser == "" {
+			opts.TargetUser = db.User
+		}
+		if opts.Destination == "" {
+			if dests := db.GetStorageDestinations(cfg); len(dests) > 0 {
+				opts.Destination = dests[0]
+			}
+		}
+		break
+	}
+
+	if opts.TargetHost == "" {
+		return errors.New("target host is required for databases not present in config")
+	}
+	if opts.TargetUser == "" {
+		return errors.New("target user is required for databases not present in config")
+	}
+	if opts.TargetPort == 0 {
+		opts.TargetPort = 5432
+	}
+
+	return nil
+}
+
+// buildRestoreArgs builds the pg_restore argument list
+func buildRestoreArgs(opts Options, archivePath string) []string {
+	args := []string{
+		"-h", opts.TargetHost,
+		"-p", fmt.Sprintf("%d", opts.TargetPort),
+		"-U", opts.TargetUser,
+		"-d", opts.TargetDB,
+		"-v",
+	}
+	if opts.Clean {
+		args = append(args, "--clean", "--if-exists")
+	}
+	if opts.NoOwner {
+		args = append(args, "--no-owner")
+	}
+	if opts.Jobs > 1 {
+		args = append(args, "-j", fmt.Sprintf("%d", opts.Jobs))
+	}
+	return append(args, archivePath)
+}
+
+// buildPsqlArgs builds the psql argument list for plain-format backups
+func buildPsqlArgs(opts Options, scriptPath string) []string {
+	return []string{
+		"-h", opts.TargetHost,
+		"-p", fmt.Sprintf("%d", opts.TargetPort),
+		"-U", opts.TargetUser,
+		"-d", opts.TargetDB,
+		"-v", "ON_ERROR_STOP=1",
+		"-f", scriptPath,
+	}
+}
+
+// buildCreatedbArgs builds the createdb argument list
+func buildCreatedbArgs(opts Options) []string {
+	return []string{
+		"-h", opts.TargetHost,
+		"-p", fmt.Sprintf("%d", opts.TargetPort),
+		"-U", opts.TargetUser,
+		opts.TargetDB,
+	}
+}
+
+// run executes a PostgreSQL client command, sending its output to a log file
+func run(ctx context.Context, name string, args, env []string, logsDir, logName string, logger zerolog.Logger) error {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = env
+
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := os.MkdirAll(logsDir, 0755); err != nil {
+		logger.Warn().Err(err).Msgf("failed to create logs directory, %s output will go to stdout", name)
+	} else {
+		logFileName := filepath.Join(logsDir, logName)
+		logFile, err := os.Create(logFileName)
+		if err != nil {
+			logger.Warn().Err(err).Msgf("failed to create log file, %s output will go to stdout", name)
+		} else {
+			defer logFile.Close()
+			cmd.Stdout = logFile
+			cmd.Stderr = logFile
+			logger.Debug().Str("log_file", logFileName).Msgf("%s output redirected to log file", name)
+		}
+	}
+
+	return cmd.Run()
+}
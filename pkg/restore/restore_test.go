@@ -0,0 +1,163 @@
+package restore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/williamokano/pg_backuper/pkg/config"
+	"github.com/williamokano/pg_backuper/pkg/storage"
+	"github.com/williamokano/pg_backuper/pkg/storage/mocks"
+)
+
+func TestResolveBackup(t *testing.T) {
+	now := time.Now()
+
+	// Modification times deliberately disagree with filename timestamps
+	files := []storage.FileInfo{
+		{Path: "mydb--hourly--2025-12-20T10-00-00.backup", Size: 100, ModTime: now.Add(-3 * time.Hour)},
+		{Path: "mydb--daily--2025-12-20T00-00-00.backup", Size: 200, ModTime: now},
+		{Path: "mydb--hourly--2025-12-20T11-00-00.backup", Size: 300, ModTime: now.Add(-2 * time.Hour)},
+		{Path: "mydb_other--daily--2025-12-21T00-00-00.backup", Size: 400, ModTime: now},
+	}
+
+	t.Run("latest_across_tiers", func(t *testing.T) {
+		mockBackend := mocks.NewMockBackend(t)
+		mockBackend.On("List", mock.Anything, "mydb*.backup").Return(files, nil).Once()
+
+		file, err := ResolveBackup(context.Background(), mockBackend, "mydb", SelectorLatest, "")
+
+		require.NoError(t, err)
+		assert.Equal(t, "mydb--hourly--2025-12-20T11-00-00.backup", file.Path)
+	})
+
+	t.Run("latest_for_tier", func(t *testing.T) {
+		mockBackend := mocks.NewMockBackend(t)
+		mockBackend.On("List", mock.Anything, "mydb--daily--*.backup").Return(files[1:2], nil).Once()
+
+		file, err := ResolveBackup(context.Background(), mockBackend, "mydb", "", "daily")
+
+		require.NoError(t, err)
+		assert.Equal(t, "mydb--daily--2025-12-20T00-00-00.backup", file.Path)
+	})
+
+	t.Run("explicit_backup", func(t *testing.T) {
+		mockBackend := mocks.NewMockBackend(t)
+		mockBackend.On("Stat", mock.Anything, files[0].Path).Return(&files[0], nil).Once()
+
+		file, err := ResolveBackup(context.Background(), mockBackend, "mydb", files[0].Path, "")
+
+		require.NoError(t, err)
+		assert.Equal(t, int64(100), file.Size)
+	})
+
+	t.Run("explicit_backup_of_other_database", func(t *testing.T) {
+		mockBackend := mocks.NewMockBackend(t)
+
+		_, err := ResolveBackup(context.Background(), mockBackend, "mydb", files[3].Path, "")
+
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "belongs to database mydb_other, not mydb")
+		mockBackend.AssertNotCalled(t, "Stat", mock.Anything, mock.Anything)
+	})
+
+	t.Run("no_backups", func(t *testing.T) {
+		mockBackend := mocks.NewMockBackend(t)
+		mockBackend.On("Name").Return("local_primary")
+		mockBackend.On("List", mock.Anything, "mydb*.backup").Return([]storage.FileInfo{}, nil).Once()
+
+		_, err := ResolveBackup(context.Background(), mockBackend, "mydb", SelectorLatest, "")
+
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "no backups found for database mydb")
+	})
+}
+
+func TestApplyDefaults(t *testing.T) {
+	cfg := &config.Config{
+		GlobalDefaults: config.GlobalDefaults{Port: 6543},
+		Storage: config.StorageConfig{
+			Destinations: []config.StorageDestination{
+				{Name: "local_primary", Type: "local", Enabled: true},
+			},
+		},
+		Databases: []config.DatabaseConfig{
+			{Name: "mydb", User: "backup", Host: "db.internal"},
+		},
+	}
+
+	t.Run("fills_from_database_config", func(t *testing.T) {
+		opts := Options{Database: "mydb", TargetDB: "mydb_restored"}
+		require.NoError(t, applyDefaults(cfg, &opts))
+
+		assert.Equal(t, "db.internal", opts.TargetHost)
+		assert.Equal(t, 6543, opts.TargetPort)
+		assert.Equal(t, "backup", opts.TargetUser)
+		assert.Equal(t, "local_primary", opts.Destination)
+		assert.Equal(t, SelectorLatest, opts.Backup)
+	})
+
+	t.Run("target_db_required", func(t *testing.T) {
+		opts := Options{Database: "mydb"}
+		assert.Error(t, applyDefaults(cfg, &opts))
+	})
+
+	t.Run("tier_requires_latest", func(t *testing.T) {
+		opts := Options{Database: "mydb", TargetDB: "x", Backup: "mydb--daily--2025-12-20T00-00-00.backup", Tier: "daily"}
+		assert.Error(t, applyDefaults(cfg, &opts))
+	})
+
+	t.Run("unknown_database_requires_connection", func(t *testing.T) {
+		opts := Options{Database: "other", TargetDB: "x"}
+		assert.Error(t, applyDefaults(cfg, &opts))
+	})
+}
+
+func TestBuildRestoreArgs(t *testing.T) {
+	opts := Options{
+		TargetHost: "restore.internal",
+		TargetPort: 5432,
+		TargetUser: "postgres",
+		TargetDB:   "mydb_restored",
+		Clean:      true,
+		NoOwner:    true,
+		Jobs:       4,
+	}
+
+	args := buildRestoreArgs(opts, "/tmp/restore/mydb.backup")
+
+	assert.Equal(t, []string{
+		"-h", "restore.internal",
+		"-p", "5432",
+		"-U", "postgres",
+		"-d", "mydb_restored",
+		"-v",
+		"--clean", "--if-exists",
+		"--no-owner",
+		"-j", "4",
+		"/tmp/restore/mydb.backup",
+	}, args)
+}
+
+func TestBuildPsqlArgs(t *testing.T) {
+	opts := Options{
+		TargetHost: "restore.internal",
+		TargetPort: 5433,
+		TargetUser: "postgres",
+		TargetDB:   "mydb_restored",
+	}
+
+	args := buildPsqlArgs(opts, "/tmp/restore/mydb.backup")
+
+	assert.Equal(t, []string{
+		"-h", "restore.internal",
+		"-p", "5433",
+		"-U", "postgres",
+		"-d", "mydb_restored",
+		"-v", "ON_ERROR_STOP=1",
+		"-f", "/tmp/restore/mydb.backup",
+	}, args)
+}
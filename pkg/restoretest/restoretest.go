@@ -0,0 +1,376 @@
+package restoretest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/williamokano/pg_backuper/pkg/config"
+	"github.com/williamokano/pg_backuper/pkg/dumpformat"
+	"github.com/williamokano/pg_backuper/pkg/encryption"
+	"github.com/williamokano/pg_backuper/pkg/storage"
+)
+
+// scratchPrefix starts the name of every scratch database, so leftovers are easy to spot
+const scratchPrefix = "restore_test_"
+
+// dropTimeout bounds dropping the scratch database, which runs even after a timeout
+const dropTimeout = 5 * time.Minute
+
+// Target is the stored backup to test-restore
+type Target struct {
+	Backend storage.Backend
+	Path    string
+}
+
+// CheckResult is the outcome of one sanity check against the restored database
+type CheckResult struct {
+	Name     string
+	Value    string // Value returned by the query
+	Passed   bool
+	Error    error
+	Duration time.Duration
+}
+
+// Result represents the outcome of a restore test
+type Result struct {
+	Database         string
+	Destination      string
+	Backup           string // Backup file that was restored
+	ScratchDB        string // Throwaway database the backup was restored into
+	Size             int64
+	Success          bool // Restored and every check passed
+	Error            error
+	Checks           []CheckResult
+	Dropped          bool // Scratch database was dropped afterwards
+	DownloadDuration time.Duration
+	RestoreDuration  time.Duration
+	ChecksDuration   time.Duration
+	Duration         time.Duration
+}
+
+// tester holds the connection to the restore test server and the command runner,
+// so tests can replace it
+type tester struct {
+	host string
+	port int
+	user string
+	env  []string
+	// run executes a PostgreSQL client command and returns its standard output
+	run func(ctx context.Context, name string, args, env []string) (string, error)
+}
+
+// Run downloads a stored backup of db, restores it into a new scratch database on the
+// restore test server, runs the database's sanity checks against it and drops it again.
+// The scratch database is dropped even when the restore, a check or the timeout fails.
+func Run(ctx context.Context, cfg *config.Config, db config.DatabaseConfig, target Target, keyring *encryption.Keyring, pgpassPath string, logger zerolog.Logger) Result {
+	t := &tester{run: runCommand}
+	return t.test(ctx, cfg, db, target, keyring, pgpassPath, logger)
+}
+
+func (t *tester) test(ctx context.Context, cfg *config.Config, db config.DatabaseConfig, target Target, keyring *encryption.Keyring, pgpassPath string, logger zerolog.Logger) Result {
+	start := time.Now()
+
+	result := Result{
+		Database:    db.Name,
+		Destination: target.Backend.Name(),
+		Backup:      target.Path,
+	}
+
+	fail := func(err error) Result {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	if cfg.RestoreTest == nil {
+		return fail(errors.New("no restore_test server configured"))
+	}
+	timeout, err := cfg.RestoreTest.GetTimeout()
+	if err != nil {
+		return fail(fmt.Errorf("restore_test: %w", err))
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	t.host = cfg.RestoreTest.Host
+	t.port = cfg.RestoreTest.GetPort(cfg.GlobalDefaults)
+	t.user = cfg.RestoreTest.User
+	t.env = append(os.Environ(), "PGPASSFILE="+pgpassPath)
+
+	result.ScratchDB = ScratchName(db.Name, start)
+
+	testLog := logger.With().
+		Str("database", db.Name).
+		Str("destination", result.Destination).
+		Str("backup", target.Path).
+		Str("test_host", t.host).
+		Int("test_port", t.port).
+		Str("scratch_db", result.ScratchDB).
+		Logger()
+
+	testLog.Info().Msg("starting restore test")
+
+	if err := os.MkdirAll(cfg.GetTempDir(), 0755); err != nil {
+		return fail(fmt.Errorf("failed to create temp directory: %w", err))
+	}
+	tempDir, err := os.MkdirTemp(cfg.GetTempDir(), "restore-test-")
+	if err != nil {
+		return fail(fmt.Errorf("failed to create temp directory: %w", err))
+	}
+	defer os.RemoveAll(tempDir)
+
+	archivePath := filepath.Join(tempDir, filepath.Base(target.Path))
+	downloadStart := time.Now()
+	if err := storage.Download(ctx, target.Backend, target.Path, archivePath, storage.DefaultRetryConfig()); err != nil {
+		return fail(fmt.Errorf("failed to download backup: %w", err))
+	}
+	result.DownloadDuration = time.Since(downloadStart)
+	if info, err := os.Stat(archivePath); err == nil {
+		result.Size = info.Size()
+	}
+
+	encrypted, err := encryption.IsEncryptedFile(archivePath)
+	if err != nil {
+		return fail(fmt.Errorf("failed to read backup: %w", err))
+	}
+	if encrypted {
+		if keyring == nil {
+			return fail(errors.New("backup is encrypted but no encryption keys are loaded"))
+		}
+		plainPath := archivePath + ".dec"
+		if err := keyring.DecryptFile(archivePath, plainPath); err != nil {
+			return fail(fmt.Errorf("failed to decrypt backup: %w", err))
+		}
+		os.Remove(archivePath)
+		archivePath = plainPath
+	}
+
+	format, err := dumpformat.Detect(archivePath)
+	if err != nil {
+		return fail(fmt.Errorf("failed to detect backup format: %w", err))
+	}
+	testLog = testLog.With().Str("format", format).Logger()
+
+	// template0 keeps objects added to template1 on the test server out of the restore
+	if _, err := t.run(ctx, "createdb", append(t.connArgs(), "-T", "template0", result.ScratchDB), t.env); err != nil {
+		return fail(fmt.Errorf("failed to create scratch database: %w", err))
+	}
+	err = t.restoreAndCheck(ctx, cfg, db, format, archivePath, &result, testLog)
+	result.Dropped = t.drop(ctx, result.ScratchDB, testLog)
+	if err != nil {
+		return fail(err)
+	}
+
+	result.Success = true
+	result.Duration = time.Since(start)
+
+	testLog.Info().
+		Int("checks", len(result.Checks)).
+		Dur("download_duration", result.DownloadDuration).
+		Dur("restore_duration", result.RestoreDuration).
+		Dur("checks_duration", result.ChecksDuration).
+		Dur("duration", result.Duration).
+		Msg("restore test passed")
+
+	return result
+}
+
+// restoreAndCheck restores the backup into the scratch database and runs the database's
+// sanity checks, recording timings and check outcomes in result
+func (t *tester) restoreAndCheck(ctx context.Context, cfg *config.Config, db config.DatabaseConfig, format, archivePath string, result *Result, logger zerolog.Logger) error {
+	restoreStart := time.Now()
+	err := t.restore(ctx, format, archivePath, result.ScratchDB, db.GetJobs(cfg.GlobalDefaults))
+	result.RestoreDuration = time.Since(restoreStart)
+	if err != nil {
+		return err
+	}
+
+	logger.Info().
+		Dur("restore_duration", result.RestoreDuration).
+		Msg("backup restored into scratch database")
+
+	if db.RestoreTest == nil {
+		return nil
+	}
+
+	checksStart := time.Now()
+	failed := 0
+	for _, check := range db.RestoreTest.Checks {
+		outcome := t.check(ctx, result.ScratchDB, check)
+		result.Checks = append(result.Checks, outcome)
+		if !outcome.Passed {
+			failed++
+			logger.Error().
+				Err(outcome.Error).
+				Str("check", check.Name).
+				Str("value", outcome.Value).
+				Msg("restore check failed")
+		}
+	}
+	result.ChecksDuration = time.Since(checksStart)
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d restore checks failed", failed, len(result.Checks))
+	}
+	return nil
+}
+
+// restore loads a dump into the scratch database. Ownership and privileges are skipped, as
+// the roles of the source server need not exist on the test server.
+func (t *tester) restore(ctx context.Context, format, archivePath, scratchDB string, jobs int) error {
+	if format == dumpformat.Plain {
+		args := append(t.connArgs(), "-d", scratchDB, "-X", "-q", "-v", "ON_ERROR_STOP=1", "-f", archivePath)
+		if _, err := t.run(ctx, "psql", args, t.env); err != nil {
+			return fmt.Errorf("psql failed: %w", err)
+		}
+		return nil
+	}
+
+	restorePath := archivePath
+	if format == dumpformat.Directory {
+		restorePath = archivePath + ".dir"
+		if err := dumpformat.UnpackDirectory(archivePath, restorePath); err != nil {
+			return fmt.Errorf("failed to unpack directory dump: %w", err)
+		}
+		defer os.RemoveAll(restorePath)
+	}
+
+	args := append(t.connArgs(), "-d", scratchDB, "--no-owner", "--no-privileges", "--exit-on-error")
+	// pg_restore cannot run tar archives in parallel
+	if jobs > 1 && format != dumpformat.Tar {
+		args = append(args, "-j", strconv.Itoa(jobs))
+	}
+	if _, err := t.run(ctx, "pg_restore", append(args, restorePath), t.env); err != nil {
+		return fmt.Errorf("pg_restore failed: %w", err)
+	}
+	return nil
+}
+
+// check runs a sanity query against the scratch database. The query must return a single
+// value: true, or a number within the check's bounds when it has any.
+func (t *tester) check(ctx context.Context, scratchDB string, check config.RestoreCheck) CheckResult {
+	start := time.Now()
+	outcome := CheckResult{Name: check.Name}
+
+	args := append(t.connArgs(), "-d", scratchDB, "-X", "-A", "-t", "-q", "-v", "ON_ERROR_STOP=1", "-c", check.SQL)
+	output, err := t.run(ctx, "psql", args, t.env)
+	outcome.Duration = time.Since(start)
+	if err != nil {
+		outcome.Error = fmt.Errorf("query failed: %w", err)
+		return outcome
+	}
+
+	outcome.Value = strings.TrimSpace(output)
+	outcome.Error = evaluate(outcome.Value, check)
+	outcome.Passed = outcome.Error == nil
+	return outcome
+}
+
+// evaluate checks the value a sanity query returned
+func evaluate(value string, check config.RestoreCheck) error {
+	switch {
+	case value == "":
+		return errors.New("query returned no rows")
+	case strings.Contains(value, "\n"):
+		return errors.New("query must return a single value")
+	}
+
+	if check.Min == nil && check.Max == nil {
+		if value != "t" && !strings.EqualFold(value, "true") {
+			return fmt.Errorf("query returned %s, want true", value)
+		}
+		return nil
+	}
+
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return fmt.Errorf("query returned %s, want a number", value)
+	}
+	if check.Min != nil && number < *check.Min {
+		return fmt.Errorf("query returned %s, want at least %g", value, *check.Min)
+	}
+	if check.Max != nil && number > *check.Max {
+		return fmt.Errorf("query returned %s, want at most %g", value, *check.Max)
+	}
+	return nil
+}
+
+// drop removes the scratch database. It runs on its own deadline, so a test that timed
+// out or was cancelled still cleans up after itself.
+func (t *tester) drop(ctx context.Context, scratchDB string, logger zerolog.Logger) bool {
+	dropCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), dropTimeout)
+	defer cancel()
+
+	if _, err := t.run(dropCtx, "dropdb", append(t.connArgs(), "--if-exists", scratchDB), t.env); err != nil {
+		logger.Error().
+			Err(err).
+			Msg("failed to drop scratch database, drop it manually")
+		return false
+	}
+	logger.Debug().Msg("scratch database dropped")
+	return true
+}
+
+// connArgs returns the connection arguments for the restore test server
+func (t *tester) connArgs() []string {
+	return []string{
+		"-h", t.host,
+		"-p", strconv.Itoa(t.port),
+		"-U", t.user,
+	}
+}
+
+// ScratchName returns the name of the scratch database a backup of dbName is restored
+// into, within PostgreSQL's 63 byte identifier limit
+func ScratchName(dbName string, now time.Time) string {
+	suffix := "_" + now.UTC().Format("20060102t150405")
+
+	var sanitized strings.Builder
+	for _, r := range strings.ToLower(dbName) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' {
+			sanitized.WriteRune(r)
+		} else {
+			sanitized.WriteRune('_')
+		}
+	}
+
+	name := sanitized.String()
+	if limit := 63 - len(scratchPrefix) - len(suffix); len(name) > limit {
+		name = name[:limit]
+	}
+	return scratchPrefix + name + suffix
+}
+
+// runCommand executes a PostgreSQL client command, returning its standard output and
+// including the end of its standard error in the error
+func runCommand(ctx context.Context, name string, args, env []string) (string, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = env
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return stdout.String(), fmt.Errorf("%s: %w", name, ctxErr)
+		}
+		msg := strings.TrimSpace(stderr.String())
+		if len(msg) > 2048 {
+			msg = "..." + msg[len(msg)-2048:]
+		}
+		if msg != "" {
+			return stdout.String(), fmt.Errorf("%s: %w: %s", name, err, msg)
+		}
+		return stdout.String(), fmt.Errorf("%s: %w", name, err)
+	}
+	return stdout.String(), nil
+}
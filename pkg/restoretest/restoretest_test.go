@@ -0,0 +1,242 @@
+package restoretest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/williamokano/pg_backuper/pkg/config"
+	"github.com/williamokano/pg_backuper/pkg/encryption"
+	"github.com/williamokano/pg_backuper/pkg/storage"
+	"github.com/williamokano/pg_backuper/pkg/storage/local"
+)
+
+const backupPath = "app--daily--2025-03-09T02-00-00.dump"
+
+// fakeServer stands in for the PostgreSQL client tools. It records the commands run,
+// answers queries from results and fails pg_restore for archives containing "broken".
+type fakeServer struct {
+	commands [][]string
+	results  map[string]string
+	restored string
+}
+
+func (f *fakeServer) run(ctx context.Context, name string, args, env []string) (string, error) {
+	f.commands = append(f.commands, append([]string{name}, args...))
+	switch name {
+	case "pg_restore", "psql":
+		if i := slices.Index(args, "-c"); i >= 0 {
+			value, ok := f.results[args[i+1]]
+			if !ok {
+				return "", errors.New(`psql: ERROR:  relation "missing" does not exist`)
+			}
+			return value + "\n", nil
+		}
+		data, err := os.ReadFile(args[len(args)-1])
+		if err != nil {
+			return "", err
+		}
+		if bytes.Contains(data, []byte("broken")) {
+			return "", errors.New("pg_restore: error: could not read input file")
+		}
+		f.restored = string(data)
+	}
+	return "", nil
+}
+
+// ran returns the names of the commands run, in order
+func (f *fakeServer) ran() []string {
+	names := make([]string, len(f.commands))
+	for i, command := range f.commands {
+		names[i] = command[0]
+	}
+	return names
+}
+
+// testSetup returns a config with a restore test server and a local backend holding content
+// as a backup of "app"
+func testSetup(t *testing.T, content []byte) (*config.Config, storage.Backend) {
+	backend, err := local.New(storage.Config{Name: "primary", Options: map[string]interface{}{"path": t.TempDir()}})
+	require.NoError(t, err)
+	require.NoError(t, backend.WriteStream(context.Background(), bytes.NewReader(content), backupPath))
+
+	cfg := &config.Config{
+		Storage:     config.StorageConfig{TempDir: t.TempDir()},
+		RestoreTest: &config.RestoreTestConfig{Host: "scratch.internal", User: "restore_tester"},
+	}
+	return cfg, backend
+}
+
+func float(v float64) *float64 { return &v }
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	dump := append([]byte("PGDMP"), bytes.Repeat([]byte{1}, 1024)...)
+
+	db := config.DatabaseConfig{
+		Name: "app",
+		Jobs: 4,
+		RestoreTest: &config.DatabaseRestoreTest{
+			Enabled: true,
+			Checks: []config.RestoreCheck{
+				{Name: "has_users", SQL: "SELECT count(*) > 0 FROM users"},
+				{Name: "orders", SQL: "SELECT count(*) FROM orders", Min: float(100)},
+			},
+		},
+	}
+
+	t.Run("passes", func(t *testing.T) {
+		cfg, backend := testSetup(t, dump)
+		server := &fakeServer{results: map[string]string{
+			"SELECT count(*) > 0 FROM users": "t",
+			"SELECT count(*) FROM orders":    "1500",
+		}}
+		tester := &tester{run: server.run}
+
+		result := tester.test(ctx, cfg, db, Target{Backend: backend, Path: backupPath}, nil, "/tmp/.pgpass", zerolog.Nop())
+
+		require.NoError(t, result.Error)
+		assert.True(t, result.Success)
+		assert.True(t, result.Dropped)
+		assert.Equal(t, "primary", result.Destination)
+		assert.Equal(t, int64(len(dump)), result.Size)
+		assert.True(t, strings.HasPrefix(result.ScratchDB, "restore_test_app_"))
+		assert.Equal(t, string(dump), server.restored)
+		assert.Equal(t, []string{"createdb", "pg_restore", "psql", "psql", "dropdb"}, server.ran())
+
+		restoreArgs := strings.Join(server.commands[1], " ")
+		assert.Contains(t, restoreArgs, "-h scratch.internal -p 5432 -U restore_tester -d "+result.ScratchDB)
+		assert.Contains(t, restoreArgs, "--no-owner --no-privileges --exit-on-error -j 4")
+		assert.Equal(t, result.ScratchDB, server.commands[4][len(server.commands[4])-1])
+
+		require.Len(t, result.Checks, 2)
+		assert.True(t, result.Checks[0].Passed)
+		assert.True(t, result.Checks[1].Passed)
+		assert.Equal(t, "1500", result.Checks[1].Value)
+
+		entries, err := os.ReadDir(cfg.GetTempDir())
+		require.NoError(t, err)
+		assert.Empty(t, entries, "downloads are removed")
+	})
+
+	t.Run("failed_checks_fail_the_test", func(t *testing.T) {
+		cfg, backend := testSetup(t, dump)
+		server := &fakeServer{results: map[string]string{
+			"SELECT count(*) > 0 FROM users": "f",
+			"SELECT count(*) FROM orders":    "12",
+		}}
+		tester := &tester{run: server.run}
+
+		result := tester.test(ctx, cfg, db, Target{Backend: backend, Path: backupPath}, nil, "", zerolog.Nop())
+
+		assert.False(t, result.Success)
+		assert.ErrorContains(t, result.Error, "2 of 2 restore checks failed")
+		assert.True(t, result.Dropped)
+		assert.ErrorContains(t, result.Checks[0].Error, "want true")
+		assert.ErrorContains(t, result.Checks[1].Error, "want at least 100")
+	})
+
+	t.Run("failed_restore_still_drops", func(t *testing.T) {
+		cfg, backend := testSetup(t, []byte("PGDMP broken"))
+		server := &fakeServer{}
+		tester := &tester{run: server.run}
+
+		result := tester.test(ctx, cfg, db, Target{Backend: backend, Path: backupPath}, nil, "", zerolog.Nop())
+
+		assert.False(t, result.Success)
+		assert.ErrorContains(t, result.Error, "pg_restore failed")
+		assert.True(t, result.Dropped)
+		assert.Empty(t, result.Checks)
+		assert.Equal(t, []string{"createdb", "pg_restore", "dropdb"}, server.ran())
+	})
+
+	t.Run("decrypts_and_replays_plain_dumps", func(t *testing.T) {
+		keyFile := filepath.Join(t.TempDir(), "k1.key")
+		require.NoError(t, os.WriteFile(keyFile, bytes.Repeat([]byte{7}, 32), 0600))
+		keyring, err := encryption.LoadKeyring(config.EncryptionConfig{Keys: []config.EncryptionKey{{ID: "k1", KeyFile: keyFile}}})
+		require.NoError(t, err)
+
+		script := []byte("CREATE TABLE users (id int);\n")
+		sealed, err := keyring.EncryptWith(bytes.NewReader(script), "k1")
+		require.NoError(t, err)
+		encrypted, err := io.ReadAll(sealed)
+		require.NoError(t, err)
+
+		cfg, backend := testSetup(t, encrypted)
+		server := &fakeServer{}
+		tester := &tester{run: server.run}
+		plain := config.DatabaseConfig{Name: "app", RestoreTest: &config.DatabaseRestoreTest{Enabled: true}}
+
+		result := tester.test(ctx, cfg, plain, Target{Backend: backend, Path: backupPath}, keyring, "", zerolog.Nop())
+
+		require.NoError(t, result.Error)
+		assert.True(t, result.Success)
+		assert.Equal(t, string(script), server.restored)
+		assert.Equal(t, []string{"createdb", "psql", "dropdb"}, server.ran())
+		assert.Contains(t, server.commands[1], "ON_ERROR_STOP=1")
+	})
+
+	t.Run("missing_backup", func(t *testing.T) {
+		cfg, backend := testSetup(t, dump)
+		server := &fakeServer{}
+		tester := &tester{run: server.run}
+
+		result := tester.test(ctx, cfg, db, Target{Backend: backend, Path: "app--daily--2025-03-01T02-00-00.dump"}, nil, "", zerolog.Nop())
+
+		assert.False(t, result.Success)
+		assert.ErrorContains(t, result.Error, "failed to download backup")
+		assert.False(t, result.Dropped)
+		assert.Empty(t, server.commands, "no scratch database is created")
+	})
+}
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		check   config.RestoreCheck
+		wantErr string
+	}{
+		{name: "true", value: "t"},
+		{name: "true_spelled_out", value: "TRUE"},
+		{name: "false", value: "f", wantErr: "want true"},
+		{name: "no_rows", value: "", wantErr: "no rows"},
+		{name: "several_rows", value: "t\nt", wantErr: "single value"},
+		{name: "within_bounds", value: "42", check: config.RestoreCheck{Min: float(1), Max: float(100)}},
+		{name: "below_min", value: "0", check: config.RestoreCheck{Min: float(1)}, wantErr: "at least 1"},
+		{name: "above_max", value: "2.5", check: config.RestoreCheck{Max: float(2)}, wantErr: "at most 2"},
+		{name: "not_a_number", value: "t", check: config.RestoreCheck{Min: float(1)}, wantErr: "want a number"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := evaluate(tt.value, tt.check)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestScratchName(t *testing.T) {
+	now := time.Date(2025, 3, 9, 2, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, "restore_test_app_20250309t020000", ScratchName("app", now))
+	assert.Equal(t, "restore_test_billing_eu_1_20250309t020000", ScratchName("Billing-EU.1", now))
+
+	long := ScratchName(strings.Repeat("x", 100), now)
+	assert.Len(t, long, 63)
+	assert.True(t, strings.HasSuffix(long, "_20250309t020000"))
+}
@@ -9,17 +9,46 @@ import (
 
 const (
 	// Date format constants
-	DateFormatOld = "2006-01-02_15-04-05" // Old format with underscore separator
-	DateFormatNew = "2006-01-02T15-04-05" // New format with T separator (ISO-8601 like)
+	DateFormatOld = "2006-01-02_15-04-05"  // Old format with underscore separator
+	DateFormatNew = "2006-01-02T15-04-05"  // New format with T separator (ISO-8601 like), without zone
+	DateFormatUTC = "2006-01-02T15-04-05Z" // Current format: DateFormatNew normalized to UTC
 
 	// Filename separators
 	SeparatorOld = "_"  // Old separator (problematic with database names containing underscores)
 	SeparatorNew = "--" // New separator (rarely used in database names)
+
+	// KindGlobals tags cluster-wide role/tablespace dumps (pg_dumpall --globals-only)
+	KindGlobals = "globals"
+
+	// KindBasebackup tags physical backups of a whole cluster (pg_basebackup)
+	KindBasebackup = "basebackup"
+
+	// KindWAL tags archived WAL segments; they have no tier or timestamp
+	KindWAL = "wal"
 )
 
+// LegacyLocation is the timezone of filename timestamps without the "Z" suffix. They carry the
+// wall-clock time of the host that took the backup; set from global_defaults.timezone at startup.
+var LegacyLocation = time.UTC
+
+// FormatTimestamp formats a backup timestamp for filenames, normalized to UTC
+func FormatTimestamp(t time.Time) string {
+	return t.UTC().Format(DateFormatUTC)
+}
+
+// parseTimestamp parses a filename timestamp: UTC ones ending in "Z",
+// and older ones without zone in LegacyLocation
+func parseTimestamp(value string) (time.Time, error) {
+	if strings.HasSuffix(value, "Z") {
+		return time.Parse(DateFormatUTC, value)
+	}
+	return time.ParseInLocation(DateFormatNew, value, LegacyLocation)
+}
+
 // BackupFilenameComponents represents the parsed components of a backup filename
 type BackupFilenameComponents struct {
-	DatabaseName string
+	DatabaseName string    // Database name, or host identifier for cluster-wide backups
+	Kind         string    // Empty for database dumps, e.g. "globals" otherwise
 	Tier         string    // Empty string if no tier tag
 	Timestamp    time.Time
 	HasTier      bool      // True if filename contains tier tag
@@ -39,10 +68,12 @@ func ExtractDateFromFilename(filename string) (time.Time, error) {
 }
 
 // ParseBackupFilename parses a backup filename and extracts all components.
-// Supports three formats:
-// - New with tier: dbname--TIER--2024-12-17T15-04-05.backup
+// Supports four formats:
+// - Kind with tier: name--KIND--TIER--2024-12-17T15-04-05Z.sql
+// - New with tier: dbname--TIER--2024-12-17T15-04-05Z.backup
 // - New without tier: dbname--2024-12-17T15-04-05.backup
 // - Old format: dbname_2024-12-17_15-04-05.backup
+// Timestamps without the "Z" suffix (written before filenames were normalized to UTC) are read in LegacyLocation.
 func ParseBackupFilename(filename string) (BackupFilenameComponents, error) {
 	base := filepath.Base(filename)
 
@@ -78,13 +109,27 @@ func parseNewFormatWithTier(filename string) (BackupFilenameComponents, error) {
 	// Split by --
 	parts := strings.Split(nameWithoutExt, SeparatorNew)
 
-	if len(parts) == 3 {
+	if len(parts) == 4 {
+		// Format: name--KIND--TIER--timestamp
+		timestamp, err := parseTimestamp(parts[3])
+		if err != nil {
+			return BackupFilenameComponents{}, fmt.Errorf("failed to parse timestamp '%s' from kind format: %w", parts[3], err)
+		}
+
+		return BackupFilenameComponents{
+			DatabaseName: parts[0],
+			Kind:         parts[1],
+			Tier:         parts[2],
+			Timestamp:    timestamp,
+			HasTier:      true,
+		}, nil
+	} else if len(parts) == 3 {
 		// Format: dbname--TIER--timestamp
 		dbName := parts[0]
 		tier := parts[1]
 		timestampStr := parts[2]
 
-		timestamp, err := time.Parse(DateFormatNew, timestampStr)
+		timestamp, err := parseTimestamp(timestampStr)
 		if err != nil {
 			return BackupFilenameComponents{}, fmt.Errorf("failed to parse timestamp '%s' from tier format: %w", timestampStr, err)
 		}
@@ -100,7 +145,7 @@ func parseNewFormatWithTier(filename string) (BackupFilenameComponents, error) {
 		dbName := parts[0]
 		timestampStr := parts[1]
 
-		timestamp, err := time.Parse(DateFormatNew, timestampStr)
+		timestamp, err := parseTimestamp(timestampStr)
 		if err != nil {
 			return BackupFilenameComponents{}, fmt.Errorf("failed to parse timestamp '%s' from new format: %w", timestampStr, err)
 		}
@@ -113,7 +158,7 @@ func parseNewFormatWithTier(filename string) (BackupFilenameComponents, error) {
 		}, nil
 	}
 
-	return BackupFilenameComponents{}, fmt.Errorf("invalid new format: expected 2 or 3 parts separated by --, got %d in %s", len(parts), filename)
+	return BackupFilenameComponents{}, fmt.Errorf("invalid new format: expected 2 to 4 parts separated by --, got %d in %s", len(parts), filename)
 }
 
 // parseNewFormat parses filenames like: dbname--2024-12-17T15-04-05.backup
@@ -152,7 +197,7 @@ func parseOldFormat(filename string) (time.Time, error) {
 	timestampStr := datePart + SeparatorOld + timePart
 
 	// Parse the timestamp
-	t, err := time.Parse(DateFormatOld, timestampStr)
+	t, err := time.ParseInLocation(DateFormatOld, timestampStr, LegacyLocation)
 	if err != nil {
 		return time.Time{}, fmt.Errorf("failed to parse old format date from '%s': %w", timestampStr, err)
 	}
@@ -162,15 +207,15 @@ func parseOldFormat(filename string) (time.Time, error) {
 
 // GenerateBackupFilename creates a backup filename using the new format (without tier tag)
 func GenerateBackupFilename(backupDir, dbName string, timestamp time.Time) string {
-	dateStr := timestamp.Format(DateFormatNew)
+	dateStr := FormatTimestamp(timestamp)
 	filename := fmt.Sprintf("%s%s%s.backup", dbName, SeparatorNew, dateStr)
 	return filepath.Join(backupDir, filename)
 }
 
 // GenerateBackupFilenameWithTier creates a backup filename with tier tag
-// Format: dbname--TIER--2024-12-17T15-04-05.backup
+// Format: dbname--TIER--2024-12-17T15-04-05Z.backup
 func GenerateBackupFilenameWithTier(backupDir, dbName, tier string, timestamp time.Time) string {
-	dateStr := timestamp.Format(DateFormatNew)
+	dateStr := FormatTimestamp(timestamp)
 	filename := fmt.Sprintf("%s%s%s%s%s.backup", dbName, SeparatorNew, tier, SeparatorNew, dateStr)
 	return filepath.Join(backupDir, filename)
 }
@@ -191,3 +236,92 @@ func GetBackupPatternForTier(backupDir, dbName, tier string) string {
 	pattern := fmt.Sprintf("%s%s%s%s*.backup", dbName, SeparatorNew, tier, SeparatorNew)
 	return filepath.Join(backupDir, pattern)
 }
+
+// Naming describes the filenames of one backup source:
+// name--TIER--timestamp.backup for database dumps, name--KIND--TIER--timestamp.ext otherwise
+type Naming struct {
+	Name string // Database name, or host identifier for cluster-wide backups
+	Kind string // Empty for database dumps
+	Ext  string // File extension including the dot
+}
+
+// DatabaseNaming returns the naming of pg_dump backups of a database
+func DatabaseNaming(dbName string) Naming {
+	return Naming{Name: dbName, Ext: ".backup"}
+}
+
+// GlobalsNaming returns the naming of globals backups of a PostgreSQL server
+func GlobalsNaming(host string, port int) Naming {
+	return Naming{Name: HostID(host, port), Kind: KindGlobals, Ext: ".sql"}
+}
+
+// BasebackupNaming returns the naming of physical backups of a PostgreSQL server
+func BasebackupNaming(host string, port int) Naming {
+	return Naming{Name: HostID(host, port), Kind: KindBasebackup, Ext: ".tar"}
+}
+
+// WALFilename returns the archive filename of a WAL file (segment or timeline history),
+// e.g. "db.internal-5432--wal--000000010000000000000002.gz"
+func WALFilename(host string, port int, walName string) string {
+	return HostID(host, port) + SeparatorNew + KindWAL + SeparatorNew + walName + ".gz"
+}
+
+// ParseWALFilename reports whether a filename is an archived WAL file and returns the
+// server (host-port) it belongs to. ParseBackupFilename rejects these names.
+func ParseWALFilename(filename string) (hostID string, ok bool) {
+	hostID, _, ok = strings.Cut(filename, SeparatorNew+KindWAL+SeparatorNew)
+	return hostID, ok
+}
+
+// WALPattern returns the glob pattern matching all archived WAL files of a server
+func WALPattern(host string, port int) string {
+	return HostID(host, port) + SeparatorNew + KindWAL + SeparatorNew + "*.gz"
+}
+
+// BasebackupPattern returns the glob pattern matching base backups of a server in every tier
+func BasebackupPattern(host string, port int) string {
+	naming := BasebackupNaming(host, port)
+	return naming.prefix() + "*" + SeparatorNew + "*" + naming.Ext
+}
+
+// HostID identifies a PostgreSQL server in filenames, e.g. "db.internal-5432"
+func HostID(host string, port int) string {
+	id := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '_':
+			return r
+		default:
+			// Dashes are replaced too, so "--" never appears inside the identifier
+			return '_'
+		}
+	}, host)
+	return fmt.Sprintf("%s-%d", id, port)
+}
+
+// prefix returns the filename part before the tier
+func (n Naming) prefix() string {
+	if n.Kind == "" {
+		return n.Name + SeparatorNew
+	}
+	return n.Name + SeparatorNew + n.Kind + SeparatorNew
+}
+
+// Filename returns the backup filename for a tier and timestamp
+func (n Naming) Filename(tier string, timestamp time.Time) string {
+	return n.prefix() + tier + SeparatorNew + FormatTimestamp(timestamp) + n.Ext
+}
+
+// TierPattern returns the glob pattern matching all backups of a tier
+func (n Naming) TierPattern(tier string) string {
+	return n.prefix() + tier + SeparatorNew + "*" + n.Ext
+}
+
+// Pattern returns the glob pattern matching the backups of the source in every tier
+func (n Naming) Pattern() string {
+	return n.prefix() + "*" + n.Ext
+}
+
+// Matches reports whether parsed filename components belong to this source
+func (n Naming) Matches(c BackupFilenameComponents) bool {
+	return c.DatabaseName == n.Name && c.Kind == n.Kind
+}
@@ -116,19 +116,19 @@ func TestGenerateBackupFilename(t *testing.T) {
 			name:      "simple database name",
 			backupDir: "/backups",
 			dbName:    "mydb",
-			want:      "/backups/mydb--2024-12-17T14-30-45.backup",
+			want:      "/backups/mydb--2024-12-17T14-30-45Z.backup",
 		},
 		{
 			name:      "database with underscores",
 			backupDir: "/backups",
 			dbName:    "my_prod_db",
-			want:      "/backups/my_prod_db--2024-12-17T14-30-45.backup",
+			want:      "/backups/my_prod_db--2024-12-17T14-30-45Z.backup",
 		},
 		{
 			name:      "database with dashes",
 			backupDir: "/backups",
 			dbName:    "my-prod-db",
-			want:      "/backups/my-prod-db--2024-12-17T14-30-45.backup",
+			want:      "/backups/my-prod-db--2024-12-17T14-30-45Z.backup",
 		},
 	}
 
@@ -144,3 +144,115 @@ func TestGenerateBackupFilename(t *testing.T) {
 		})
 	}
 }
+
+func TestFilenameTimestamps_Zones(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+
+	t.Run("new filenames are normalized to UTC", func(t *testing.T) {
+		timestamp := time.Date(2024, 12, 17, 15, 30, 45, 0, berlin)
+		filename := DatabaseNaming("mydb").Filename("daily", timestamp)
+		assert.Equal(t, "mydb--daily--2024-12-17T14-30-45Z.backup", filename)
+
+		components, err := ParseBackupFilename(filename)
+		require.NoError(t, err)
+		assert.True(t, components.Timestamp.Equal(timestamp))
+	})
+
+	t.Run("legacy filenames are read in the configured timezone", func(t *testing.T) {
+		defer func(loc *time.Location) { LegacyLocation = loc }(LegacyLocation)
+		LegacyLocation = berlin
+
+		// Summer time: 14:30 in Berlin is 12:30 UTC
+		components, err := ParseBackupFilename("mydb--daily--2024-07-01T14-30-00.backup")
+		require.NoError(t, err)
+		assert.True(t, components.Timestamp.Equal(time.Date(2024, 7, 1, 12, 30, 0, 0, time.UTC)))
+
+		components, err = ParseBackupFilename("mydb_2024-12-17_14-30-00.backup")
+		require.NoError(t, err)
+		assert.True(t, components.Timestamp.Equal(time.Date(2024, 12, 17, 13, 30, 0, 0, time.UTC)))
+
+		// UTC filenames do not depend on the configured timezone
+		components, err = ParseBackupFilename("mydb--daily--2024-07-01T14-30-00Z.backup")
+		require.NoError(t, err)
+		assert.True(t, components.Timestamp.Equal(time.Date(2024, 7, 1, 14, 30, 0, 0, time.UTC)))
+	})
+
+	t.Run("ordering across a DST change", func(t *testing.T) {
+		// 2024-10-27 03:00 CEST falls back to 02:00 CET: the second backup is one hour later in wall time but two in reality
+		before := time.Date(2024, 10, 27, 0, 30, 0, 0, time.UTC) // 02:30 CEST
+		after := time.Date(2024, 10, 27, 2, 30, 0, 0, time.UTC)  // 03:30 CET
+
+		first, err := ParseBackupFilename(DatabaseNaming("mydb").Filename("hourly", before))
+		require.NoError(t, err)
+		second, err := ParseBackupFilename(DatabaseNaming("mydb").Filename("hourly", after))
+		require.NoError(t, err)
+		assert.Equal(t, 2*time.Hour, second.Timestamp.Sub(first.Timestamp))
+	})
+}
+
+func TestParseBackupFilename_Kind(t *testing.T) {
+	components, err := ParseBackupFilename("/backups/db.internal-5432--globals--daily--2024-12-17T14-30-45.sql")
+
+	require.NoError(t, err)
+	assert.Equal(t, "db.internal-5432", components.DatabaseName)
+	assert.Equal(t, KindGlobals, components.Kind)
+	assert.Equal(t, "daily", components.Tier)
+	assert.True(t, components.HasTier)
+	assert.True(t, components.Timestamp.Equal(time.Date(2024, 12, 17, 14, 30, 45, 0, time.UTC)))
+}
+
+func TestNaming(t *testing.T) {
+	timestamp := time.Date(2024, 12, 17, 14, 30, 45, 0, time.UTC)
+
+	t.Run("database_naming_matches_legacy_helpers", func(t *testing.T) {
+		naming := DatabaseNaming("mydb")
+
+		assert.Equal(t, GenerateBackupFilenameWithTier("", "mydb", "daily", timestamp), naming.Filename("daily", timestamp))
+		assert.Equal(t, GetBackupPatternForTier("", "mydb", "daily"), naming.TierPattern("daily"))
+	})
+
+	t.Run("globals_naming_round_trip", func(t *testing.T) {
+		naming := GlobalsNaming("db.internal", 5432)
+
+		filename := naming.Filename("weekly", timestamp)
+		assert.Equal(t, "db.internal-5432--globals--weekly--2024-12-17T14-30-45Z.sql", filename)
+		assert.Equal(t, "db.internal-5432--globals--weekly--*.sql", naming.TierPattern("weekly"))
+
+		components, err := ParseBackupFilename(filename)
+		require.NoError(t, err)
+		assert.True(t, naming.Matches(components))
+		assert.False(t, DatabaseNaming("db.internal-5432").Matches(components))
+	})
+
+	t.Run("basebackup_naming_is_distinct_from_logical", func(t *testing.T) {
+		naming := BasebackupNaming("db.internal", 5432)
+
+		filename := naming.Filename("daily", timestamp)
+		assert.Equal(t, "db.internal-5432--basebackup--daily--2024-12-17T14-30-45Z.tar", filename)
+		assert.Equal(t, "db.internal-5432--basebackup--daily--*.tar", naming.TierPattern("daily"))
+
+		components, err := ParseBackupFilename(filename)
+		require.NoError(t, err)
+		assert.Equal(t, KindBasebackup, components.Kind)
+		assert.True(t, naming.Matches(components))
+		assert.False(t, GlobalsNaming("db.internal", 5432).Matches(components))
+	})
+
+	t.Run("wal_filenames", func(t *testing.T) {
+		assert.Equal(t, "db.internal-5432--wal--000000010000000000000002.gz", WALFilename("db.internal", 5432, "000000010000000000000002"))
+		assert.Equal(t, "db.internal-5432--wal--*.gz", WALPattern("db.internal", 5432))
+		assert.Equal(t, "db.internal-5432--basebackup--*--*.tar", BasebackupPattern("db.internal", 5432))
+
+		hostID, ok := ParseWALFilename(WALFilename("db.internal", 5432, "000000010000000000000002"))
+		assert.True(t, ok)
+		assert.Equal(t, "db.internal-5432", hostID)
+		_, ok = ParseWALFilename("db.internal-5432--basebackup--daily--2025-03-09T02-00-00Z.tar")
+		assert.False(t, ok)
+	})
+
+	t.Run("host_id_is_filename_safe", func(t *testing.T) {
+		assert.Equal(t, "pg_primary-5433", HostID("pg-primary", 5433))
+		assert.Equal(t, "_var_run_postgresql-5432", HostID("/var/run/postgresql", 5432))
+	})
+}
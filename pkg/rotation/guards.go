@@ -0,0 +1,76 @@
+package rotation
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/williamokano/pg_backuper/pkg/config"
+	"github.com/williamokano/pg_backuper/pkg/storage"
+)
+
+// Guards limit what a single rotation run may delete, so that a misconfigured retention
+// or a wrong clock cannot wipe the backup history. The zero value applies no guard.
+type Guards struct {
+	KeepLast         int          // Newest non-empty backups of a source (across its tiers) that are never deleted
+	MaxDeleteFiles   int          // Most backups deleted per tier and run (0 = no limit)
+	MaxDeletePercent int          // Most percent of a tier's backups deleted per run (0 = no limit)
+	RequireRecent    bool         // Refuse deleting from a tier whose newest backup is older than the tier interval
+	Tiers            config.Tiers // Tier intervals for RequireRecent
+	AllowMassDelete  bool         // Override MaxDeleteFiles, MaxDeletePercent and RequireRecent (KeepLast still applies)
+}
+
+// BlockedDeletion is a backup that retention would delete but a guard kept
+type BlockedDeletion struct {
+	Backend string
+	Tier    string
+	Path    string
+	Reason  string
+}
+
+// protectedFiles returns the paths of the newest keepLast non-empty backups among files
+func protectedFiles(files []storage.FileInfo, keepLast int) map[string]bool {
+	protected := make(map[string]bool)
+	if keepLast <= 0 {
+		return protected
+	}
+
+	candidates := make([]storage.FileInfo, 0, len(files))
+	for _, file := range files {
+		if file.Size > 0 {
+			candidates = append(candidates, file)
+		}
+	}
+	sortNewestFirst(candidates)
+
+	for i := 0; i < len(candidates) && i < keepLast; i++ {
+		protected[candidates[i].Path] = true
+	}
+	return protected
+}
+
+// massDeleteReason returns why deleting toDelete of the files of a tier is refused,
+// or an empty string if the guards allow it
+func (g Guards) massDeleteReason(tier string, files, toDelete []storage.FileInfo, now time.Time) string {
+	if g.AllowMassDelete || len(toDelete) == 0 {
+		return ""
+	}
+
+	if g.RequireRecent {
+		if definition, ok := g.Tiers.Lookup(tier); ok {
+			newest := files[0] // files are sorted newest first
+			if takenAt(newest).Before(now.Add(-definition.Interval)) {
+				return fmt.Sprintf("newest %s backup is older than the tier interval (%s)", tier, definition.Interval)
+			}
+		}
+	}
+
+	if g.MaxDeleteFiles > 0 && len(toDelete) > g.MaxDeleteFiles {
+		return fmt.Sprintf("%d deletions exceed max_delete_files (%d)", len(toDelete), g.MaxDeleteFiles)
+	}
+
+	if g.MaxDeletePercent > 0 && len(toDelete)*100 > g.MaxDeletePercent*len(files) {
+		return fmt.Sprintf("deleting %d of %d backups exceeds max_delete_percent (%d%%)", len(toDelete), len(files), g.MaxDeletePercent)
+	}
+
+	return ""
+}
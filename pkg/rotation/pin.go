@@ -0,0 +1,108 @@
+package rotation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/williamokano/pg_backuper/pkg/storage"
+)
+
+// PinSuffix is appended to a backup filename to form its pin marker.
+// Markers never match the backup patterns, which end with the backup's extension.
+const PinSuffix = ".pin"
+
+// Pin is a legal hold on a stored backup: rotation never deletes a backup with an active pin.
+// It is stored as a JSON sidecar next to the backup on every backend that holds it.
+type Pin struct {
+	Reason   string    `json:"reason,omitempty"`
+	Until    time.Time `json:"until,omitzero"` // Pin expires at this time; zero holds indefinitely
+	PinnedAt time.Time `json:"pinned_at"`
+}
+
+// Active reports whether the pin still holds its backup at now
+func (p Pin) Active(now time.Time) bool {
+	return p.Until.IsZero() || now.Before(p.Until)
+}
+
+// String describes the pin for plans and listings
+func (p Pin) String() string {
+	s := "pinned"
+	if !p.Until.IsZero() {
+		s += " until " + p.Until.Format(time.RFC3339)
+	}
+	if p.Reason != "" {
+		s += ": " + p.Reason
+	}
+	return s
+}
+
+// PinPath returns the path of the pin marker of a backup
+func PinPath(backupPath string) string {
+	return backupPath + PinSuffix
+}
+
+// WritePin stores the pin marker of a backup
+func WritePin(ctx context.Context, backend storage.Backend, backupPath string, pin Pin) error {
+	data, err := json.Marshal(pin)
+	if err != nil {
+		return err
+	}
+	return backend.WriteStream(ctx, bytes.NewReader(data), PinPath(backupPath))
+}
+
+// RemovePin deletes the pin marker of a backup
+func RemovePin(ctx context.Context, backend storage.Backend, backupPath string) error {
+	return backend.Delete(ctx, PinPath(backupPath))
+}
+
+// ReadPin reads the pin marker of a backup.
+// Returns false if the backup has no marker.
+func ReadPin(ctx context.Context, backend storage.Backend, backupPath string) (Pin, bool, error) {
+	exists, err := backend.Exists(ctx, PinPath(backupPath))
+	if err != nil || !exists {
+		return Pin{}, false, err
+	}
+
+	reader, err := backend.Read(ctx, PinPath(backupPath))
+	if err != nil {
+		return Pin{}, false, err
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return Pin{}, false, err
+	}
+
+	var pin Pin
+	if err := json.Unmarshal(data, &pin); err != nil {
+		return Pin{}, true, fmt.Errorf("invalid pin marker %s: %w", PinPath(backupPath), err)
+	}
+	return pin, true, nil
+}
+
+// ListPins returns the pins of the backups matching a backup pattern, keyed by backup path.
+// A marker that cannot be read holds its backup indefinitely, so a damaged marker never
+// releases a legal hold.
+func ListPins(ctx context.Context, backend storage.Backend, pattern string) (map[string]Pin, error) {
+	markers, err := backend.List(ctx, pattern+PinSuffix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pin markers: %w", err)
+	}
+
+	pins := make(map[string]Pin)
+	for _, marker := range markers {
+		backupPath := strings.TrimSuffix(marker.Path, PinSuffix)
+		pin, _, err := ReadPin(ctx, backend, backupPath)
+		if err != nil {
+			pin = Pin{Reason: fmt.Sprintf("unreadable pin marker (%v)", err)}
+		}
+		pins[backupPath] = pin
+	}
+	return pins, nil
+}
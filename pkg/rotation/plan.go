@@ -0,0 +1,277 @@
+package rotation
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/williamokano/pg_backuper/pkg/config"
+	"github.com/williamokano/pg_backuper/pkg/storage"
+)
+
+// Retention plan actions
+const (
+	ActionKeep   = "keep"
+	ActionDelete = "delete"
+)
+
+// PlannedFile is the retention decision for one stored backup
+type PlannedFile struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size_bytes"`
+	TakenAt time.Time `json:"taken_at"`
+	Action  string    `json:"action"`            // ActionKeep or ActionDelete
+	Reason  string    `json:"reason"`            // Why the backup is kept or deleted
+	Blocked bool      `json:"blocked,omitempty"` // Kept by a safety guard although retention would delete it
+	Pin     *Pin      `json:"pin,omitempty"`     // Active pin holding the backup
+
+	expiredPin bool // The backup has a pin marker that no longer holds it
+	manifest   bool // The backup has a manifest, deleted along with it
+}
+
+// TierPlan is the retention plan of one tier, newest backup first
+type TierPlan struct {
+	Tier        string        `json:"tier"`
+	Retention   int           `json:"retention"`
+	MaxAge      string        `json:"max_age,omitempty"`
+	Files       []PlannedFile `json:"files"`
+	KeepBytes   int64         `json:"keep_bytes"`
+	DeleteBytes int64         `json:"delete_bytes"`
+}
+
+// Plan is the retention plan of one backup source on one backend
+type Plan struct {
+	Backend string     `json:"backend"`
+	Source  string     `json:"source"`         // Database name, or host identifier for cluster-wide backups
+	Kind    string     `json:"kind,omitempty"` // Empty for database dumps
+	Tiers   []TierPlan `json:"tiers"`
+}
+
+// Deletions returns the files the plan deletes
+func (p Plan) Deletions() []PlannedFile {
+	var files []PlannedFile
+	for _, tier := range p.Tiers {
+		for _, file := range tier.Files {
+			if file.Action == ActionDelete {
+				files = append(files, file)
+			}
+		}
+	}
+	return files
+}
+
+// Blocked returns the deletions the safety guards blocked
+func (p Plan) Blocked() []BlockedDeletion {
+	var blocked []BlockedDeletion
+	for _, tier := range p.Tiers {
+		for _, file := range tier.Files {
+			if file.Blocked {
+				blocked = append(blocked, BlockedDeletion{
+					Backend: p.Backend,
+					Tier:    tier.Tier,
+					Path:    file.Path,
+					Reason:  file.Reason,
+				})
+			}
+		}
+	}
+	return blocked
+}
+
+// PlanRetention lists the backups of a source on a backend and decides which of them retention
+// keeps and deletes, applying the safety guards. Pinned backups are always kept and do not count
+// against the retention of their tier. Tiers with unlimited retention are only listed (and shown
+// as kept) when guards.KeepLast needs them to find the newest backups of the source.
+func PlanRetention(ctx context.Context, backend storage.Backend, naming Naming, retentionTiers []config.RetentionTier, guards Guards, now time.Time) (Plan, error) {
+	plan := Plan{
+		Backend: backend.Name(),
+		Source:  naming.Name,
+		Kind:    naming.Kind,
+	}
+
+	// List every tier first: the newest backups of the source are protected across tiers
+	tierFiles := make(map[string][]storage.FileInfo)
+	var allFiles []storage.FileInfo
+	for _, tier := range retentionTiers {
+		if tier.IsUnlimited() && guards.KeepLast == 0 {
+			continue
+		}
+
+		// List files for this tier using backend
+		files, err := backend.List(ctx, naming.TierPattern(tier.Tier))
+		if err != nil {
+			return plan, fmt.Errorf("failed to list files for tier %s: %w", tier.Tier, err)
+		}
+
+		// backend.List() sorts by modtime, which for copied files (sync, backfill) is not when the backup was taken
+		sortNewestFirst(files)
+		tierFiles[tier.Tier] = files
+		allFiles = append(allFiles, files...)
+	}
+
+	if len(tierFiles) == 0 {
+		return plan, nil
+	}
+
+	pins, err := ListPins(ctx, backend, naming.Pattern())
+	if err != nil {
+		return plan, err
+	}
+
+	manifests, err := backend.List(ctx, naming.Pattern()+storage.ManifestSuffix)
+	if err != nil {
+		return plan, fmt.Errorf("failed to list manifests: %w", err)
+	}
+	hasManifest := make(map[string]bool, len(manifests))
+	for _, manifest := range manifests {
+		hasManifest[strings.TrimSuffix(manifest.Path, storage.ManifestSuffix)] = true
+	}
+
+	protected := protectedFiles(allFiles, guards.KeepLast)
+
+	for _, tier := range retentionTiers {
+		files, listed := tierFiles[tier.Tier]
+		if !listed {
+			continue
+		}
+
+		tierPlan, err := planTier(tier, files, pins, protected, guards, now)
+		if err != nil {
+			return plan, err
+		}
+		for i := range tierPlan.Files {
+			tierPlan.Files[i].manifest = hasManifest[tierPlan.Files[i].Path]
+		}
+		plan.Tiers = append(plan.Tiers, tierPlan)
+	}
+
+	return plan, nil
+}
+
+// planTier decides which backups of a tier, sorted newest first, are kept and deleted
+func planTier(tier config.RetentionTier, files []storage.FileInfo, pins map[string]Pin, protected map[string]bool, guards Guards, now time.Time) (TierPlan, error) {
+	tierPlan := TierPlan{
+		Tier:      tier.Tier,
+		Retention: tier.Retention,
+		MaxAge:    tier.MaxAge,
+	}
+
+	cutoff, err := tier.Cutoff(now)
+	if err != nil {
+		return tierPlan, fmt.Errorf("tier %s: %w", tier.Tier, err)
+	}
+
+	// Pinned backups are held outside of retention; the others are ranked without them
+	var toDelete, unpinned []storage.FileInfo
+	i := 0
+	for _, file := range files {
+		planned := PlannedFile{
+			Path:    file.Path,
+			Size:    file.Size,
+			TakenAt: takenAt(file),
+			Action:  ActionKeep,
+		}
+
+		if pin, ok := pins[file.Path]; ok {
+			if pin.Active(now) {
+				planned.Pin = &pin
+				planned.Reason = pin.String()
+				tierPlan.Files = append(tierPlan.Files, planned)
+				continue
+			}
+			planned.expiredPin = true
+		}
+		unpinned = append(unpinned, file)
+		i++
+
+		switch {
+		case tier.IsUnlimited():
+			planned.Reason = "unlimited retention"
+		case tier.Retention > 0 && i > tier.Retention:
+			planned.Action = ActionDelete
+			planned.Reason = fmt.Sprintf("beyond retention (#%d, keeps %d)", i, tier.Retention)
+		case planned.TakenAt.Before(cutoff):
+			planned.Action = ActionDelete
+			planned.Reason = fmt.Sprintf("older than max_age (%s)", tier.MaxAge)
+		case tier.Retention > 0:
+			planned.Reason = fmt.Sprintf("within retention (#%d of %d)", i, tier.Retention)
+		default:
+			planned.Reason = fmt.Sprintf("within max_age (%s)", tier.MaxAge)
+		}
+
+		if planned.Action == ActionDelete && protected[file.Path] {
+			planned.Action = ActionKeep
+			planned.Blocked = true
+			planned.Reason = fmt.Sprintf("among the newest %d backups (keep_last)", guards.KeepLast)
+		}
+		if planned.Action == ActionDelete {
+			toDelete = append(toDelete, file)
+		}
+
+		tierPlan.Files = append(tierPlan.Files, planned)
+	}
+
+	if reason := guards.massDeleteReason(tier.Tier, unpinned, toDelete, now); reason != "" {
+		for i := range tierPlan.Files {
+			if tierPlan.Files[i].Action == ActionDelete {
+				tierPlan.Files[i].Action = ActionKeep
+				tierPlan.Files[i].Blocked = true
+				tierPlan.Files[i].Reason = reason
+			}
+		}
+	}
+
+	for _, file := range tierPlan.Files {
+		if file.Action == ActionDelete {
+			tierPlan.DeleteBytes += file.Size
+		} else {
+			tierPlan.KeepBytes += file.Size
+		}
+	}
+
+	return tierPlan, nil
+}
+
+// ExecutePlan deletes the backups a plan marks for deletion and returns the deleted files.
+// A file that fails to delete is logged and left for the next run.
+func ExecutePlan(ctx context.Context, backend storage.Backend, plan Plan, logger zerolog.Logger) []PlannedFile {
+	var deleted []PlannedFile
+
+	for _, tier := range plan.Tiers {
+		tierLog := logger.With().Str("tier", tier.Tier).Logger()
+
+		for _, file := range tier.Files {
+			if file.Action != ActionDelete {
+				continue
+			}
+			if err := backend.Delete(ctx, file.Path); err != nil {
+				tierLog.Error().
+					Err(err).
+					Str("file", file.Path).
+					Msg("failed to delete old backup")
+				continue
+			}
+			// Sidecars go with their backup
+			if file.manifest {
+				if err := backend.Delete(ctx, storage.ManifestPath(file.Path)); err != nil {
+					tierLog.Warn().Err(err).Str("file", file.Path).Msg("failed to delete manifest")
+				}
+			}
+			if file.expiredPin {
+				if err := RemovePin(ctx, backend, file.Path); err != nil {
+					tierLog.Warn().Err(err).Str("file", file.Path).Msg("failed to delete expired pin marker")
+				}
+			}
+			tierLog.Info().
+				Str("file", file.Path).
+				Int64("size", file.Size).
+				Str("reason", file.Reason).
+				Msg("deleted old backup")
+			deleted = append(deleted, file)
+		}
+	}
+
+	return deleted
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/rs/zerolog"
 	"github.com/williamokano/pg_backuper/pkg/config"
+	"github.com/williamokano/pg_backuper/pkg/storage"
 )
 
 // BackupFile represents a backup file with its metadata
@@ -18,9 +19,9 @@ type BackupFile struct {
 	CreationTier string   // Tier tag from filename (empty if untagged)
 }
 
-// ApplyRetention applies the retention policy to a set of backup files
+// ApplyRetention applies the retention policy to a set of backup files, aging them into tiers
 // Returns the list of files that should be deleted
-func ApplyRetention(backups []BackupFile, retentionTiers []config.RetentionTier, logger zerolog.Logger) ([]string, error) {
+func ApplyRetention(backups []BackupFile, retentionTiers []config.RetentionTier, tiers config.Tiers, logger zerolog.Logger) ([]string, error) {
 	if len(backups) == 0 {
 		return nil, nil
 	}
@@ -30,28 +31,29 @@ func ApplyRetention(backups []BackupFile, retentionTiers []config.RetentionTier,
 	// Categorize backups by tier
 	tierMap := make(map[TierName][]BackupFile)
 	for _, backup := range backups {
-		tier := CategorizeTier(backup.Timestamp, now)
+		tier := CategorizeTier(backup.Timestamp, now, tiers)
 		backup.Tier = tier
 		tierMap[tier] = append(tierMap[tier], backup)
 	}
 
 	// Build retention policy map
-	retentionMap := make(map[TierName]int)
+	retentionMap := make(map[TierName]config.RetentionTier)
 	for _, rt := range retentionTiers {
-		retentionMap[TierName(rt.Tier)] = rt.Retention
+		retentionMap[TierName(rt.Tier)] = rt
 	}
 
 	// Collect files to delete
 	var filesToDelete []string
 
 	// Process each tier
-	for _, tierName := range []TierName{TierHourly, TierDaily, TierWeekly, TierMonthly, TierQuarterly, TierYearly} {
+	for _, tier := range tiers {
+		tierName := TierName(tier.Name)
 		tieredBackups := tierMap[tierName]
 		if len(tieredBackups) == 0 {
 			continue
 		}
 
-		retention, hasRetention := retentionMap[tierName]
+		policy, hasRetention := retentionMap[tierName]
 		if !hasRetention {
 			// No retention policy for this tier, keep all
 			logger.Debug().
@@ -61,8 +63,8 @@ func ApplyRetention(backups []BackupFile, retentionTiers []config.RetentionTier,
 			continue
 		}
 
-		if retention == 0 {
-			// Retention = 0 means unlimited, keep all
+		if policy.IsUnlimited() {
+			// Retention = 0 without max_age means unlimited, keep all
 			logger.Debug().
 				Str("tier", string(tierName)).
 				Int("count", len(tieredBackups)).
@@ -70,27 +72,35 @@ func ApplyRetention(backups []BackupFile, retentionTiers []config.RetentionTier,
 			continue
 		}
 
-		// Sort backups by timestamp (oldest first)
+		cutoff, err := policy.Cutoff(now)
+		if err != nil {
+			return nil, fmt.Errorf("tier %s: %w", tierName, err)
+		}
+
+		// Sort backups by timestamp (newest first)
 		sort.Slice(tieredBackups, func(i, j int) bool {
-			return tieredBackups[i].Timestamp.Before(tieredBackups[j].Timestamp)
+			return tieredBackups[i].Timestamp.After(tieredBackups[j].Timestamp)
 		})
 
-		// If we have more backups than retention limit, delete oldest
-		if len(tieredBackups) > retention {
-			toDelete := tieredBackups[:len(tieredBackups)-retention]
-			for _, backup := range toDelete {
+		// Delete backups beyond the retention count or older than max_age
+		marked := 0
+		for i, backup := range tieredBackups {
+			if (policy.Retention > 0 && i >= policy.Retention) || backup.Timestamp.Before(cutoff) {
 				filesToDelete = append(filesToDelete, backup.Path)
+				marked++
 				logger.Info().
 					Str("tier", string(tierName)).
 					Str("file", backup.Path).
 					Time("timestamp", backup.Timestamp).
 					Msg("marking backup for deletion")
 			}
-		} else {
+		}
+		if marked == 0 {
 			logger.Debug().
 				Str("tier", string(tierName)).
 				Int("count", len(tieredBackups)).
-				Int("retention", retention).
+				Int("retention", policy.Retention).
+				Str("max_age", policy.MaxAge).
 				Msg("within retention limit")
 		}
 	}
@@ -111,6 +121,8 @@ func DeleteFiles(files []string, logger zerolog.Logger) error {
 				Msg("failed to delete backup file")
 			errorCount++
 		} else {
+			// The manifest goes with its backup; most backups have none in local directories
+			os.Remove(storage.ManifestPath(file))
 			logger.Info().
 				Str("file", file).
 				Msg("deleted backup file")
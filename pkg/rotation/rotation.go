@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"path/filepath"
+	"sort"
+	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/williamokano/pg_backuper/pkg/config"
@@ -11,7 +13,7 @@ import (
 )
 
 // RotateBackups performs backup rotation for a single database
-func RotateBackups(backupDir string, dbName string, retentionTiers []config.RetentionTier, logger zerolog.Logger) error {
+func RotateBackups(backupDir string, dbName string, retentionTiers []config.RetentionTier, tiers config.Tiers, logger zerolog.Logger) error {
 	dbLogger := logger.With().Str("database", dbName).Logger()
 
 	// Find all backup files for this database
@@ -61,7 +63,7 @@ func RotateBackups(backupDir string, dbName string, retentionTiers []config.Rete
 	}
 
 	// Apply retention policy
-	filesToDelete, err := ApplyRetention(backups, retentionTiers, dbLogger)
+	filesToDelete, err := ApplyRetention(backups, retentionTiers, tiers, dbLogger)
 	if err != nil {
 		return fmt.Errorf("failed to apply retention policy: %w", err)
 	}
@@ -85,59 +87,83 @@ func RotateBackups(backupDir string, dbName string, retentionTiers []config.Rete
 
 // ApplyRetentionWithBackend applies retention policy using storage backend
 func ApplyRetentionWithBackend(ctx context.Context, backend storage.Backend, dbName string, retentionTiers []config.RetentionTier, logger zerolog.Logger) error {
+	return ApplyRetentionForNaming(ctx, backend, DatabaseNaming(dbName), retentionTiers, logger)
+}
+
+// ApplyRetentionForNaming applies retention policy to the backups of any source (database dumps, globals)
+func ApplyRetentionForNaming(ctx context.Context, backend storage.Backend, naming Naming, retentionTiers []config.RetentionTier, logger zerolog.Logger) error {
+	_, err := ApplyGuardedRetention(ctx, backend, naming, retentionTiers, Guards{}, logger)
+	return err
+}
+
+// ApplyGuardedRetention applies retention policy to the backups of any source, keeping the
+// backups the guards protect. Returns the deletions the guards blocked.
+func ApplyGuardedRetention(ctx context.Context, backend storage.Backend, naming Naming, retentionTiers []config.RetentionTier, guards Guards, logger zerolog.Logger) ([]BlockedDeletion, error) {
 	backendLog := logger.With().
 		Str("backend", backend.Name()).
 		Str("backend_type", backend.Type()).
-		Str("database", dbName).
+		Str("database", naming.Name).
 		Logger()
+	if naming.Kind != "" {
+		backendLog = backendLog.With().Str("kind", naming.Kind).Logger()
+	}
 
 	backendLog.Debug().Msg("starting retention check")
 
-	// For each tier, apply retention
-	for _, tier := range retentionTiers {
-		pattern := fmt.Sprintf("%s--%s--*.backup", dbName, tier.Tier)
-
-		// List files for this tier using backend
-		files, err := backend.List(ctx, pattern)
-		if err != nil {
-			return fmt.Errorf("failed to list files for tier %s: %w", tier.Tier, err)
-		}
+	plan, err := PlanRetention(ctx, backend, naming, retentionTiers, guards, time.Now())
+	if err != nil {
+		return nil, err
+	}
 
+	for _, tier := range plan.Tiers {
 		tierLog := backendLog.With().Str("tier", tier.Tier).Logger()
-		tierLog.Debug().Int("count", len(files)).Msg("found backups for tier")
 
-		// Files are already sorted by modtime (newest first) from backend.List()
-		if len(files) <= tier.Retention {
+		deletions := 0
+		for _, file := range tier.Files {
+			switch {
+			case file.Blocked:
+				tierLog.Warn().
+					Str("file", file.Path).
+					Str("reason", file.Reason).
+					Msg("deletion blocked by safety guard, use --allow-mass-delete to override limits")
+			case file.Action == ActionDelete:
+				deletions++
+			}
+		}
+
+		if deletions == 0 {
 			tierLog.Debug().
-				Int("found", len(files)).
+				Int("found", len(tier.Files)).
 				Int("retention", tier.Retention).
+				Str("max_age", tier.MaxAge).
 				Msg("retention not exceeded, no files to delete")
 			continue
 		}
 
-		// Delete old files (beyond retention count)
-		filesToDelete := files[tier.Retention:]
-
 		tierLog.Info().
-			Int("total", len(files)).
+			Int("total", len(tier.Files)).
 			Int("retention", tier.Retention).
-			Int("to_delete", len(filesToDelete)).
+			Str("max_age", tier.MaxAge).
+			Int("to_delete", deletions).
 			Msg("applying retention policy")
-
-		for _, file := range filesToDelete {
-			if err := backend.Delete(ctx, file.Path); err != nil {
-				tierLog.Error().
-					Err(err).
-					Str("file", file.Path).
-					Msg("failed to delete old backup")
-			} else {
-				tierLog.Info().
-					Str("file", file.Path).
-					Int64("size", file.Size).
-					Msg("deleted old backup")
-			}
-		}
 	}
 
-	return nil
+	ExecutePlan(ctx, backend, plan, backendLog)
+
+	return plan.Blocked(), nil
+}
+
+// sortNewestFirst orders stored backups by their filename timestamp, newest first.
+func sortNewestFirst(files []storage.FileInfo) {
+	sort.SliceStable(files, func(i, j int) bool {
+		return takenAt(files[i]).After(takenAt(files[j]))
+	})
+}
+
+// takenAt returns when a stored backup was taken, from its filename timestamp or else its modification time
+func takenAt(file storage.FileInfo) time.Time {
+	if components, err := ParseBackupFilename(file.Path); err == nil {
+		return components.Timestamp
+	}
+	return file.ModTime
 }
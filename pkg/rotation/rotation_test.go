@@ -1,13 +1,18 @@
 package rotation_test
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 	"github.com/williamokano/pg_backuper/pkg/config"
 	"github.com/williamokano/pg_backuper/pkg/rotation"
@@ -15,11 +20,20 @@ import (
 	"github.com/williamokano/pg_backuper/pkg/storage/mocks"
 )
 
+// newMockBackend returns a mock backend on which the backups have no pin markers or manifests
+func newMockBackend(t *testing.T) *mocks.MockBackend {
+	backend := mocks.NewMockBackend(t)
+	backend.On("List", mock.Anything, mock.MatchedBy(func(pattern string) bool {
+		return strings.HasSuffix(pattern, rotation.PinSuffix) || strings.HasSuffix(pattern, storage.ManifestSuffix)
+	})).Return([]storage.FileInfo{}, nil).Maybe()
+	return backend
+}
+
 func TestApplyRetentionWithBackend_DailyRotation(t *testing.T) {
 	ctx := context.Background()
 
 	// Create mock backend
-	mockBackend := mocks.NewMockBackend(t)
+	mockBackend := newMockBackend(t)
 	mockBackend.On("Name").Return("test_backend")
 	mockBackend.On("Type").Return("mock")
 
@@ -63,7 +77,7 @@ func TestApplyRetentionWithBackend_HourlyRotation(t *testing.T) {
 	ctx := context.Background()
 
 	// Create mock backend
-	mockBackend := mocks.NewMockBackend(t)
+	mockBackend := newMockBackend(t)
 	mockBackend.On("Name").Return("test_backend")
 	mockBackend.On("Type").Return("mock")
 
@@ -106,7 +120,7 @@ func TestApplyRetentionWithBackend_MultipleTiers(t *testing.T) {
 	ctx := context.Background()
 
 	// Create mock backend
-	mockBackend := mocks.NewMockBackend(t)
+	mockBackend := newMockBackend(t)
 	mockBackend.On("Name").Return("test_backend").Maybe()
 	mockBackend.On("Type").Return("mock").Maybe()
 
@@ -168,7 +182,7 @@ func TestApplyRetentionWithBackend_NoBackupsToDelete(t *testing.T) {
 	ctx := context.Background()
 
 	// Create mock backend
-	mockBackend := mocks.NewMockBackend(t)
+	mockBackend := newMockBackend(t)
 	mockBackend.On("Name").Return("test_backend")
 	mockBackend.On("Type").Return("mock")
 
@@ -206,7 +220,7 @@ func TestApplyRetentionWithBackend_EmptyBackupList(t *testing.T) {
 	ctx := context.Background()
 
 	// Create mock backend
-	mockBackend := mocks.NewMockBackend(t)
+	mockBackend := newMockBackend(t)
 	mockBackend.On("Name").Return("test_backend")
 	mockBackend.On("Type").Return("mock")
 
@@ -230,7 +244,7 @@ func TestApplyRetentionWithBackend_ListError(t *testing.T) {
 	ctx := context.Background()
 
 	// Create mock backend
-	mockBackend := mocks.NewMockBackend(t)
+	mockBackend := newMockBackend(t)
 	mockBackend.On("Name").Return("test_backend")
 	mockBackend.On("Type").Return("mock")
 
@@ -255,7 +269,7 @@ func TestApplyRetentionWithBackend_DeleteError(t *testing.T) {
 	ctx := context.Background()
 
 	// Create mock backend
-	mockBackend := mocks.NewMockBackend(t)
+	mockBackend := newMockBackend(t)
 	mockBackend.On("Name").Return("test_backend")
 	mockBackend.On("Type").Return("mock")
 
@@ -305,7 +319,7 @@ func TestApplyRetentionWithBackend_ExactRetentionCount(t *testing.T) {
 	ctx := context.Background()
 
 	// Create mock backend
-	mockBackend := mocks.NewMockBackend(t)
+	mockBackend := newMockBackend(t)
 	mockBackend.On("Name").Return("test_backend")
 	mockBackend.On("Type").Return("mock")
 
@@ -337,3 +351,347 @@ func TestApplyRetentionWithBackend_ExactRetentionCount(t *testing.T) {
 	// Assertions
 	assert.NoError(t, err)
 }
+
+func TestApplyRetentionForNaming_Globals(t *testing.T) {
+	ctx := context.Background()
+
+	mockBackend := newMockBackend(t)
+	mockBackend.On("Name").Return("test_backend")
+	mockBackend.On("Type").Return("mock")
+
+	naming := rotation.GlobalsNaming("db.internal", 5432)
+
+	now := time.Now()
+	existingBackups := make([]storage.FileInfo, 4)
+	for i := 0; i < 4; i++ {
+		backupTime := now.Add(-time.Duration(i*24) * time.Hour)
+		existingBackups[i] = storage.FileInfo{
+			Path:    naming.Filename("daily", backupTime),
+			Size:    512,
+			ModTime: backupTime,
+		}
+	}
+
+	// Globals use their own pattern, never touching database dumps
+	mockBackend.On("List", ctx, "db.internal-5432--globals--daily--*.sql").
+		Return(existingBackups, nil).
+		Once()
+	mockBackend.On("Delete", ctx, existingBackups[3].Path).
+		Return(nil).
+		Once()
+
+	retentionTiers := []config.RetentionTier{
+		{Tier: "daily", Retention: 3},
+	}
+
+	err := rotation.ApplyRetentionForNaming(ctx, mockBackend, naming, retentionTiers, zerolog.Nop())
+
+	assert.NoError(t, err)
+}
+
+func TestCategorizeTier_CustomTiers(t *testing.T) {
+	cfg := &config.Config{
+		Tiers: []config.TierDefinition{
+			{Name: "every-15m", Interval: "15m"},
+			{Name: "biweekly", Interval: "14d"},
+		},
+	}
+	tiers, err := cfg.GetTiers()
+	require.NoError(t, err)
+
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		age  time.Duration
+		want rotation.TierName
+	}{
+		{age: 30 * time.Minute, want: "every-15m"},
+		{age: 2 * time.Hour, want: rotation.TierHourly},
+		{age: 3 * 24 * time.Hour, want: rotation.TierDaily},
+		{age: 10 * 24 * time.Hour, want: rotation.TierWeekly},
+		{age: 20 * 24 * time.Hour, want: "biweekly"},
+		{age: 400 * 24 * time.Hour, want: rotation.TierYearly},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, rotation.CategorizeTier(now.Add(-tt.age), now, tiers), "age %v", tt.age)
+	}
+}
+
+func TestApplyRetentionWithBackend_OrdersByFilenameTimestamp(t *testing.T) {
+	ctx := context.Background()
+
+	mockBackend := newMockBackend(t)
+	mockBackend.On("Name").Return("test_backend")
+	mockBackend.On("Type").Return("mock")
+
+	// The oldest backup was copied here last (e.g. by sync), so it has the newest modtime
+	now := time.Now()
+	files := []storage.FileInfo{
+		{Path: "testdb--daily--2025-12-18T03-00-00Z.backup", Size: 1024, ModTime: now},
+		{Path: "testdb--daily--2025-12-20T03-00-00Z.backup", Size: 1024, ModTime: now.Add(-time.Hour)},
+		{Path: "testdb--daily--2025-12-19T03-00-00Z.backup", Size: 1024, ModTime: now.Add(-2 * time.Hour)},
+	}
+	mockBackend.On("List", ctx, "testdb--daily--*.backup").Return(files, nil).Once()
+	mockBackend.On("Delete", ctx, "testdb--daily--2025-12-18T03-00-00Z.backup").Return(nil).Once()
+
+	err := rotation.ApplyRetentionWithBackend(ctx, mockBackend, "testdb",
+		[]config.RetentionTier{{Tier: "daily", Retention: 2}}, zerolog.Nop())
+
+	assert.NoError(t, err)
+}
+
+func TestApplyRetentionWithBackend_UnlimitedRetention(t *testing.T) {
+	ctx := context.Background()
+
+	mockBackend := newMockBackend(t)
+	mockBackend.On("Name").Return("test_backend")
+	mockBackend.On("Type").Return("mock")
+
+	err := rotation.ApplyRetentionWithBackend(ctx, mockBackend, "testdb",
+		[]config.RetentionTier{{Tier: "yearly", Retention: 0}}, zerolog.Nop())
+
+	assert.NoError(t, err)
+	mockBackend.AssertNotCalled(t, "List", mock.Anything, mock.Anything)
+	mockBackend.AssertNotCalled(t, "Delete", mock.Anything, mock.Anything)
+}
+
+func TestApplyRetentionWithBackend_MaxAge(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+
+	// Five dailies taken 1, 10, 20, 40 and 50 days ago
+	var files []storage.FileInfo
+	for _, days := range []int{1, 10, 20, 40, 50} {
+		files = append(files, storage.FileInfo{
+			Path:    rotation.DatabaseNaming("testdb").Filename("daily", now.AddDate(0, 0, -days)),
+			Size:    1024,
+			ModTime: now,
+		})
+	}
+
+	tests := []struct {
+		name        string
+		tier        config.RetentionTier
+		wantDeleted []int // indexes into files
+	}{
+		{name: "age only", tier: config.RetentionTier{Tier: "daily", MaxAge: "35d"}, wantDeleted: []int{3, 4}},
+		{name: "count is stricter", tier: config.RetentionTier{Tier: "daily", Retention: 2, MaxAge: "35d"}, wantDeleted: []int{2, 3, 4}},
+		{name: "age is stricter", tier: config.RetentionTier{Tier: "daily", Retention: 4, MaxAge: "15d"}, wantDeleted: []int{2, 3, 4}},
+		{name: "calendar months", tier: config.RetentionTier{Tier: "daily", MaxAge: "1mo"}, wantDeleted: []int{3, 4}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockBackend := newMockBackend(t)
+			mockBackend.On("Name").Return("test_backend")
+			mockBackend.On("Type").Return("mock")
+			mockBackend.On("List", ctx, "testdb--daily--*.backup").
+				Return(append([]storage.FileInfo(nil), files...), nil).Once()
+			for _, i := range tt.wantDeleted {
+				mockBackend.On("Delete", ctx, files[i].Path).Return(nil).Once()
+			}
+
+			err := rotation.ApplyRetentionWithBackend(ctx, mockBackend, "testdb", []config.RetentionTier{tt.tier}, zerolog.Nop())
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestApplyRetention_MaxAge(t *testing.T) {
+	now := time.Now()
+	backups := []rotation.BackupFile{
+		{Path: "db--daily--a.backup", Timestamp: now.AddDate(0, 0, -2)},
+		{Path: "db--daily--b.backup", Timestamp: now.AddDate(0, 0, -3)},
+		{Path: "db--daily--c.backup", Timestamp: now.AddDate(0, 0, -5)},
+	}
+
+	deleted, err := rotation.ApplyRetention(backups,
+		[]config.RetentionTier{{Tier: "daily", Retention: 7, MaxAge: "4d"}}, config.BuiltinTiers, zerolog.Nop())
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"db--daily--c.backup"}, deleted)
+
+	_, err = rotation.ApplyRetention(backups,
+		[]config.RetentionTier{{Tier: "daily", MaxAge: "4 days"}}, config.BuiltinTiers, zerolog.Nop())
+	assert.Error(t, err)
+}
+
+func TestApplyGuardedRetention(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	naming := rotation.DatabaseNaming("testdb")
+
+	// dailies returns one daily backup per day, newest first, the newest taken age ago
+	dailies := func(count int, age time.Duration) []storage.FileInfo {
+		files := make([]storage.FileInfo, count)
+		for i := range files {
+			files[i] = storage.FileInfo{
+				Path: naming.Filename("daily", now.Add(-age).AddDate(0, 0, -i)),
+				Size: 1024,
+			}
+		}
+		return files
+	}
+
+	tests := []struct {
+		name        string
+		files       []storage.FileInfo
+		tier        config.RetentionTier
+		guards      rotation.Guards
+		wantDeleted int // number of oldest files deleted
+		wantBlocked int
+	}{
+		{
+			name:        "keep_last protects the newest backups from max_age",
+			files:       dailies(5, 40*24*time.Hour),
+			tier:        config.RetentionTier{Tier: "daily", MaxAge: "35d"},
+			guards:      rotation.Guards{KeepLast: 2},
+			wantDeleted: 3,
+			wantBlocked: 2,
+		},
+		{
+			name:        "empty backups are not protected",
+			files:       []storage.FileInfo{{Path: naming.Filename("daily", now.AddDate(0, 0, -40)), Size: 0}},
+			tier:        config.RetentionTier{Tier: "daily", MaxAge: "35d"},
+			guards:      rotation.Guards{KeepLast: 1},
+			wantDeleted: 1,
+		},
+		{
+			name:        "max_delete_files blocks the whole tier",
+			files:       dailies(10, time.Hour),
+			tier:        config.RetentionTier{Tier: "daily", Retention: 1},
+			guards:      rotation.Guards{MaxDeleteFiles: 5},
+			wantBlocked: 9,
+		},
+		{
+			name:        "max_delete_percent blocks the whole tier",
+			files:       dailies(10, time.Hour),
+			tier:        config.RetentionTier{Tier: "daily", Retention: 4},
+			guards:      rotation.Guards{MaxDeletePercent: 50},
+			wantBlocked: 6,
+		},
+		{
+			name:        "deletions within the limits",
+			files:       dailies(10, time.Hour),
+			tier:        config.RetentionTier{Tier: "daily", Retention: 7},
+			guards:      rotation.Guards{MaxDeleteFiles: 5, MaxDeletePercent: 50},
+			wantDeleted: 3,
+		},
+		{
+			name:        "stale tier is not rotated",
+			files:       dailies(10, 3*24*time.Hour),
+			tier:        config.RetentionTier{Tier: "daily", Retention: 7},
+			guards:      rotation.Guards{RequireRecent: true, Tiers: config.BuiltinTiers},
+			wantBlocked: 3,
+		},
+		{
+			name:        "allow mass delete overrides the limits",
+			files:       dailies(10, 3*24*time.Hour),
+			tier:        config.RetentionTier{Tier: "daily", Retention: 1},
+			guards:      rotation.Guards{KeepLast: 1, MaxDeleteFiles: 5, RequireRecent: true, Tiers: config.BuiltinTiers, AllowMassDelete: true},
+			wantDeleted: 9,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockBackend := newMockBackend(t)
+			mockBackend.On("Name").Return("test_backend")
+			mockBackend.On("Type").Return("mock")
+			mockBackend.On("List", ctx, "testdb--daily--*.backup").
+				Return(append([]storage.FileInfo(nil), tt.files...), nil).Once()
+			for _, file := range tt.files[len(tt.files)-tt.wantDeleted:] {
+				mockBackend.On("Delete", ctx, file.Path).Return(nil).Once()
+			}
+
+			blocked, err := rotation.ApplyGuardedRetention(ctx, mockBackend, naming, []config.RetentionTier{tt.tier}, tt.guards, zerolog.Nop())
+
+			require.NoError(t, err)
+			assert.Len(t, blocked, tt.wantBlocked)
+			for _, b := range blocked {
+				assert.Equal(t, "test_backend", b.Backend)
+				assert.Equal(t, "daily", b.Tier)
+				assert.NotEmpty(t, b.Reason)
+			}
+		})
+	}
+}
+
+func TestApplyGuardedRetention_KeepLastAcrossTiers(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	naming := rotation.DatabaseNaming("testdb")
+
+	hourly := storage.FileInfo{Path: naming.Filename("hourly", now.Add(-time.Hour)), Size: 1024}
+	daily := storage.FileInfo{Path: naming.Filename("daily", now.AddDate(0, 0, -40)), Size: 1024}
+
+	mockBackend := newMockBackend(t)
+	mockBackend.On("Name").Return("test_backend")
+	mockBackend.On("Type").Return("mock")
+	mockBackend.On("List", ctx, "testdb--hourly--*.backup").Return([]storage.FileInfo{hourly}, nil).Once()
+	mockBackend.On("List", ctx, "testdb--daily--*.backup").Return([]storage.FileInfo{daily}, nil).Once()
+	// The unlimited hourly tier holds the newest backup, so the expired daily can go
+	mockBackend.On("Delete", ctx, daily.Path).Return(nil).Once()
+
+	retentionTiers := []config.RetentionTier{
+		{Tier: "hourly", Retention: 0},
+		{Tier: "daily", MaxAge: "35d"},
+	}
+	blocked, err := rotation.ApplyGuardedRetention(ctx, mockBackend, naming, retentionTiers, rotation.Guards{KeepLast: 1}, zerolog.Nop())
+
+	require.NoError(t, err)
+	assert.Empty(t, blocked)
+}
+
+func TestPlanRetention_Pins(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	naming := rotation.DatabaseNaming("testdb")
+
+	files := make([]storage.FileInfo, 4)
+	for i := range files {
+		files[i] = storage.FileInfo{Path: naming.Filename("daily", now.AddDate(0, 0, -i-1)), Size: 1024}
+	}
+
+	pins := map[string]rotation.Pin{
+		files[0].Path: {Reason: "incident"},
+		files[3].Path: {Until: now.Add(-time.Hour)}, // expired
+	}
+
+	mockBackend := mocks.NewMockBackend(t)
+	mockBackend.On("Name").Return("test_backend")
+	mockBackend.On("List", ctx, "testdb--daily--*.backup").Return(append([]storage.FileInfo(nil), files...), nil).Once()
+	var markers []storage.FileInfo
+	for path, pin := range pins {
+		markers = append(markers, storage.FileInfo{Path: rotation.PinPath(path)})
+		data, err := json.Marshal(pin)
+		require.NoError(t, err)
+		mockBackend.On("Exists", ctx, rotation.PinPath(path)).Return(true, nil)
+		mockBackend.On("Read", ctx, rotation.PinPath(path)).Return(io.NopCloser(bytes.NewReader(data)), nil)
+	}
+	mockBackend.On("List", ctx, "testdb--*.backup.pin").Return(markers, nil).Once()
+	mockBackend.On("List", ctx, "testdb--*.backup.manifest.json").
+		Return([]storage.FileInfo{{Path: storage.ManifestPath(files[3].Path)}}, nil).Once()
+
+	plan, err := rotation.PlanRetention(ctx, mockBackend, naming,
+		[]config.RetentionTier{{Tier: "daily", Retention: 2}}, rotation.Guards{}, now)
+	require.NoError(t, err)
+	require.Len(t, plan.Tiers, 1)
+
+	// The pinned newest backup does not count against retention: two more are kept
+	var actions []string
+	for _, file := range plan.Tiers[0].Files {
+		actions = append(actions, file.Action)
+	}
+	assert.Equal(t, []string{rotation.ActionKeep, rotation.ActionKeep, rotation.ActionKeep, rotation.ActionDelete}, actions)
+	require.NotNil(t, plan.Tiers[0].Files[0].Pin)
+	assert.Equal(t, "pinned: incident", plan.Tiers[0].Files[0].Reason)
+	assert.Nil(t, plan.Tiers[0].Files[3].Pin)
+
+	// Deleting a backup whose pin expired removes the marker and the manifest too
+	mockBackend.On("Delete", ctx, files[3].Path).Return(nil).Once()
+	mockBackend.On("Delete", ctx, storage.ManifestPath(files[3].Path)).Return(nil).Once()
+	mockBackend.On("Delete", ctx, rotation.PinPath(files[3].Path)).Return(nil).Once()
+	deleted := rotation.ExecutePlan(ctx, mockBackend, plan, zerolog.Nop())
+	assert.Len(t, deleted, 1)
+}
@@ -2,6 +2,8 @@ package rotation
 
 import (
 	"time"
+
+	"github.com/williamokano/pg_backuper/pkg/config"
 )
 
 // TierName represents the different retention tiers
@@ -16,22 +18,19 @@ const (
 	TierYearly    TierName = "yearly"
 )
 
-// CategorizeTier determines which tier a backup belongs to based on its age
-func CategorizeTier(backupTime time.Time, now time.Time) TierName {
+// CategorizeTier determines which tier a backup belongs to based on its age.
+// Each tier holds backups younger than the interval of the next longer tier,
+// the longest tier holds everything older.
+func CategorizeTier(backupTime time.Time, now time.Time, tiers config.Tiers) TierName {
 	age := now.Sub(backupTime)
 
-	switch {
-	case age <= 24*time.Hour:
-		return TierHourly
-	case age <= 7*24*time.Hour:
-		return TierDaily
-	case age <= 30*24*time.Hour:
-		return TierWeekly
-	case age <= 90*24*time.Hour:
-		return TierMonthly
-	case age <= 365*24*time.Hour:
-		return TierQuarterly
-	default:
-		return TierYearly
+	for i := 0; i < len(tiers)-1; i++ {
+		if age <= tiers[i+1].Interval {
+			return TierName(tiers[i].Name)
+		}
+	}
+	if len(tiers) == 0 {
+		return ""
 	}
+	return TierName(tiers[len(tiers)-1].Name)
 }
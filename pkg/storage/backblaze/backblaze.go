@@ -67,22 +67,53 @@ func (b *Backend) Write(ctx context.Context, sourcePath, destPath string) error
 		}
 		defer file.Close()
 
-		key := path.Join(b.prefix, destPath)
+		return b.WriteStream(ctx, file, destPath)
+	})
+}
 
-		obj := b.bucket.Object(key)
-		writer := obj.NewWriter(ctx)
+// WriteStream uploads data from r to B2
+func (b *Backend) WriteStream(ctx context.Context, r io.Reader, destPath string) error {
+	key := path.Join(b.prefix, destPath)
+	obj := b.bucket.Object(key)
 
-		if _, err := io.Copy(writer, file); err != nil {
-			writer.Close()
-			return storage.WrapError(b.name, "upload", err)
-		}
+	// Cancelling the writer's context aborts the upload instead of committing what was sent
+	writeCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	writer := obj.NewWriter(writeCtx)
+
+	if _, err := io.Copy(writer, r); err != nil {
+		cancel()
+		// Deleting by name here would remove the previous version of an overwritten object
+		writer.Close()
+		return storage.WrapError(b.name, "upload", err)
+	}
+
+	if err := writer.Close(); err != nil {
+		return storage.WrapError(b.name, "upload", err)
+	}
+
+	return nil
+}
 
-		if err := writer.Close(); err != nil {
-			return storage.WrapError(b.name, "upload", err)
+// Read opens an object from B2 for reading
+func (b *Backend) Read(ctx context.Context, objectPath string) (io.ReadCloser, error) {
+	return b.ReadRange(ctx, objectPath, 0, -1)
+}
+
+// ReadRange opens a byte range of an object from B2 for reading
+func (b *Backend) ReadRange(ctx context.Context, objectPath string, offset, length int64) (io.ReadCloser, error) {
+	key := path.Join(b.prefix, objectPath)
+	obj := b.bucket.Object(key)
+
+	// The B2 reader only reports errors on the first Read, so check existence up front
+	if _, err := obj.Attrs(ctx); err != nil {
+		if b2.IsNotExist(err) {
+			return nil, storage.WrapError(b.name, "read", storage.ErrNotFound)
 		}
+		return nil, storage.WrapError(b.name, "read", err)
+	}
 
-		return nil
-	})
+	return obj.NewRangeReader(ctx, offset, length), nil
 }
 
 // Delete removes a file from B2
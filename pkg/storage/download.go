@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// partialSuffix marks an incomplete download that can be resumed
+const partialSuffix = ".partial"
+
+// partialSourceSuffix marks the sidecar recording which object a partial download holds
+const partialSourceSuffix = ".partial.source"
+
+// partialSource identifies the version of a stored object a partial download was started from
+type partialSource struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// limitReadCloser limits reads from an underlying ReadCloser
+type limitReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// LimitReadCloser returns a ReadCloser that reads at most n bytes from rc.
+// A negative n returns rc unchanged.
+func LimitReadCloser(rc io.ReadCloser, n int64) io.ReadCloser {
+	if n < 0 {
+		return rc
+	}
+	return limitReadCloser{Reader: io.LimitReader(rc, n), Closer: rc}
+}
+
+// Download copies a stored file to localPath, resuming where it left off.
+// Data is written to localPath+".partial" and renamed once complete, so an
+// interrupted download (even across process restarts) continues from the
+// bytes already on disk instead of starting over. The size and modification time
+// of the object are recorded next to the partial file, and a partial file from
+// another version of the object (re-uploaded under the same name) is discarded.
+// Interruptions during the transfer are retried with ReadRange from the current offset.
+func Download(ctx context.Context, backend Backend, path, localPath string, cfg RetryConfig) error {
+	info, err := backend.Stat(ctx, path)
+	if err != nil {
+		return err
+	}
+
+	partialPath := localPath + partialSuffix
+	sourcePath := localPath + partialSourceSuffix
+	file, err := os.OpenFile(partialPath, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	offset, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if offset > 0 && !samePartialSource(sourcePath, *info) {
+		// Stale partial file from a different object or version, start over
+		if err := file.Truncate(0); err != nil {
+			return err
+		}
+		if offset, err = file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+	}
+	if err := writePartialSource(sourcePath, *info); err != nil {
+		return err
+	}
+
+	delay := cfg.InitialDelay
+	attempt := 1
+	for offset < info.Size {
+		n, err := copyRange(ctx, backend, path, offset, file)
+		offset += n
+		if err == nil && offset < info.Size {
+			err = io.ErrUnexpectedEOF
+		}
+		if err == nil {
+			break
+		}
+
+		if errors.Is(err, ErrNotFound) || IsCritical(err) || ctx.Err() != nil {
+			return err
+		}
+
+		// Only count attempts that made no progress
+		if n > 0 {
+			attempt = 1
+			delay = cfg.InitialDelay
+		} else if attempt >= cfg.MaxAttempts {
+			return fmt.Errorf("download stalled at byte %d of %d: %w", offset, info.Size, err)
+		} else {
+			attempt++
+		}
+
+		select {
+		case <-time.After(delay):
+			delay = time.Duration(float64(delay) * cfg.BackoffFactor)
+			if delay > cfg.MaxDelay {
+				delay = cfg.MaxDelay
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	if err := file.Sync(); err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(partialPath, localPath); err != nil {
+		return err
+	}
+	os.Remove(sourcePath)
+	return nil
+}
+
+// samePartialSource reports whether a partial download was started from the object
+// described by info. Partial files without a sidecar are not trusted.
+func samePartialSource(sourcePath string, info FileInfo) bool {
+	data, err := os.ReadFile(sourcePath)
+	if err != nil {
+		return false
+	}
+	var source partialSource
+	if err := json.Unmarshal(data, &source); err != nil {
+		return false
+	}
+	return source.Size == info.Size && source.ModTime.Equal(info.ModTime)
+}
+
+// writePartialSource records the object a partial download is taken from
+func writePartialSource(sourcePath string, info FileInfo) error {
+	data, err := json.Marshal(partialSource{Size: info.Size, ModTime: info.ModTime})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(sourcePath, data, 0644)
+}
+
+// copyRange copies from offset to the end of a stored file, returning the bytes written
+func copyRange(ctx context.Context, backend Backend, path string, offset int64, dst io.Writer) (int64, error) {
+	reader, err := backend.ReadRange(ctx, path, offset, -1)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+
+	return io.Copy(dst, reader)
+}
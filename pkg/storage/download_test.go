@@ -0,0 +1,161 @@
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/williamokano/pg_backuper/pkg/storage"
+	"github.com/williamokano/pg_backuper/pkg/storage/mocks"
+)
+
+// fastRetry avoids real backoff delays in tests
+var fastRetry = storage.RetryConfig{
+	MaxAttempts:   3,
+	InitialDelay:  time.Millisecond,
+	MaxDelay:      time.Millisecond,
+	BackoffFactor: 1,
+}
+
+func TestDownload(t *testing.T) {
+	content := []byte("PGDMP custom archive content for download tests")
+	remotePath := "db--daily--2025-12-20T10-00-00.backup"
+	info := &storage.FileInfo{Path: remotePath, Size: int64(len(content))}
+
+	t.Run("full_download", func(t *testing.T) {
+		localPath := filepath.Join(t.TempDir(), "restore.backup")
+
+		mockBackend := mocks.NewMockBackend(t)
+		mockBackend.On("Stat", mock.Anything, remotePath).Return(info, nil).Once()
+		mockBackend.On("ReadRange", mock.Anything, remotePath, int64(0), int64(-1)).
+			Return(mocks.NewContentReader(content), nil).Once()
+
+		err := storage.Download(context.Background(), mockBackend, remotePath, localPath, fastRetry)
+
+		require.NoError(t, err)
+		got, err := os.ReadFile(localPath)
+		require.NoError(t, err)
+		assert.Equal(t, content, got)
+		assert.NoFileExists(t, localPath+".partial")
+	})
+
+	t.Run("resumes_after_interruption", func(t *testing.T) {
+		localPath := filepath.Join(t.TempDir(), "restore.backup")
+
+		mockBackend := mocks.NewMockBackend(t)
+		mockBackend.On("Stat", mock.Anything, remotePath).Return(info, nil).Once()
+		mockBackend.On("ReadRange", mock.Anything, remotePath, int64(0), int64(-1)).
+			Return(mocks.NewFailingReader(content, 10, errors.New("connection reset")), nil).Once()
+		mockBackend.On("ReadRange", mock.Anything, remotePath, int64(10), int64(-1)).
+			Return(mocks.NewContentReader(content[10:]), nil).Once()
+
+		err := storage.Download(context.Background(), mockBackend, remotePath, localPath, fastRetry)
+
+		require.NoError(t, err)
+		got, err := os.ReadFile(localPath)
+		require.NoError(t, err)
+		assert.Equal(t, content, got)
+	})
+
+	// interrupt leaves a partial download of the first 20 bytes, as a process killed mid-transfer would
+	interrupt := func(t *testing.T, localPath string, info *storage.FileInfo) {
+		mockBackend := mocks.NewMockBackend(t)
+		mockBackend.On("Stat", mock.Anything, remotePath).Return(info, nil).Once()
+		mockBackend.On("ReadRange", mock.Anything, remotePath, int64(0), int64(-1)).
+			Return(mocks.NewFailingReader(content, 20, errors.New("connection reset")), nil).Once()
+		mockBackend.On("ReadRange", mock.Anything, remotePath, int64(20), int64(-1)).
+			Return(nil, storage.ErrConnFailed).Times(3)
+
+		require.Error(t, storage.Download(context.Background(), mockBackend, remotePath, localPath, fastRetry))
+		require.FileExists(t, localPath+".partial")
+	}
+
+	t.Run("resumes_existing_partial_file", func(t *testing.T) {
+		localPath := filepath.Join(t.TempDir(), "restore.backup")
+		interrupt(t, localPath, info)
+
+		mockBackend := mocks.NewMockBackend(t)
+		mockBackend.On("Stat", mock.Anything, remotePath).Return(info, nil).Once()
+		mockBackend.On("ReadRange", mock.Anything, remotePath, int64(20), int64(-1)).
+			Return(mocks.NewContentReader(content[20:]), nil).Once()
+
+		err := storage.Download(context.Background(), mockBackend, remotePath, localPath, fastRetry)
+
+		require.NoError(t, err)
+		got, err := os.ReadFile(localPath)
+		require.NoError(t, err)
+		assert.Equal(t, content, got)
+		assert.NoFileExists(t, localPath+".partial.source")
+	})
+
+	t.Run("restarts_when_object_changed", func(t *testing.T) {
+		localPath := filepath.Join(t.TempDir(), "restore.backup")
+		interrupt(t, localPath, info)
+
+		// Re-uploaded under the same name with the same size
+		replaced := []byte("PGDMP CUSTOM ARCHIVE CONTENT FOR DOWNLOAD TESTS")
+		require.Len(t, replaced, len(content))
+		newer := &storage.FileInfo{Path: remotePath, Size: info.Size, ModTime: time.Now()}
+
+		mockBackend := mocks.NewMockBackend(t)
+		mockBackend.On("Stat", mock.Anything, remotePath).Return(newer, nil).Once()
+		mockBackend.On("ReadRange", mock.Anything, remotePath, int64(0), int64(-1)).
+			Return(mocks.NewContentReader(replaced), nil).Once()
+
+		err := storage.Download(context.Background(), mockBackend, remotePath, localPath, fastRetry)
+
+		require.NoError(t, err)
+		got, err := os.ReadFile(localPath)
+		require.NoError(t, err)
+		assert.Equal(t, replaced, got)
+	})
+
+	t.Run("restarts_partial_file_of_unknown_origin", func(t *testing.T) {
+		localPath := filepath.Join(t.TempDir(), "restore.backup")
+		require.NoError(t, os.WriteFile(localPath+".partial", []byte("stale bytes"), 0644))
+
+		mockBackend := mocks.NewMockBackend(t)
+		mockBackend.On("Stat", mock.Anything, remotePath).Return(info, nil).Once()
+		mockBackend.On("ReadRange", mock.Anything, remotePath, int64(0), int64(-1)).
+			Return(mocks.NewContentReader(content), nil).Once()
+
+		err := storage.Download(context.Background(), mockBackend, remotePath, localPath, fastRetry)
+
+		require.NoError(t, err)
+		got, err := os.ReadFile(localPath)
+		require.NoError(t, err)
+		assert.Equal(t, content, got)
+	})
+
+	t.Run("gives_up_without_progress", func(t *testing.T) {
+		localPath := filepath.Join(t.TempDir(), "restore.backup")
+
+		mockBackend := mocks.NewMockBackend(t)
+		mockBackend.On("Stat", mock.Anything, remotePath).Return(info, nil).Once()
+		mockBackend.On("ReadRange", mock.Anything, remotePath, int64(0), int64(-1)).
+			Return(nil, storage.ErrConnFailed).Times(3)
+
+		err := storage.Download(context.Background(), mockBackend, remotePath, localPath, fastRetry)
+
+		require.Error(t, err)
+		assert.ErrorIs(t, err, storage.ErrConnFailed)
+		assert.NoFileExists(t, localPath)
+	})
+
+	t.Run("not_found", func(t *testing.T) {
+		localPath := filepath.Join(t.TempDir(), "restore.backup")
+
+		mockBackend := mocks.NewMockBackend(t)
+		mockBackend.On("Stat", mock.Anything, remotePath).Return(nil, storage.ErrNotFound).Once()
+
+		err := storage.Download(context.Background(), mockBackend, remotePath, localPath, fastRetry)
+
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+	})
+}
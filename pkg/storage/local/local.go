@@ -7,6 +7,7 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"time"
 
 	"github.com/williamokano/pg_backuper/pkg/storage"
 )
@@ -56,6 +57,21 @@ func (b *Backend) Type() string { return "local" }
 
 // Write copies a file to the backend
 func (b *Backend) Write(ctx context.Context, sourcePath, destPath string) error {
+	// Open source file
+	source, err := os.Open(sourcePath)
+	if err != nil {
+		return storage.WrapError(b.name, "write", err)
+	}
+	defer source.Close()
+
+	return b.WriteStream(ctx, source, destPath)
+}
+
+// WriteStream writes data from r to a file in the backend.
+// Data goes to a temporary file that is synced and renamed over destPath, so an
+// interrupted write never leaves a truncated file, and files hardlinked to an
+// existing destPath keep their content.
+func (b *Backend) WriteStream(ctx context.Context, r io.Reader, destPath string) error {
 	destFullPath := filepath.Join(b.basePath, destPath)
 
 	// Ensure destination directory exists
@@ -64,29 +80,122 @@ func (b *Backend) Write(ctx context.Context, sourcePath, destPath string) error
 		return storage.WrapError(b.name, "write", err)
 	}
 
-	// Open source file
-	source, err := os.Open(sourcePath)
+	// Hidden and without the backup extension, so listings never match it
+	temp, err := os.CreateTemp(destDir, "."+filepath.Base(destFullPath)+".*.tmp")
 	if err != nil {
 		return storage.WrapError(b.name, "write", err)
 	}
-	defer source.Close()
+	tempPath := temp.Name()
 
-	// Create destination file
-	dest, err := os.Create(destFullPath)
-	if err != nil {
+	fail := func(err error) error {
+		temp.Close()
+		os.Remove(tempPath) // Clean up partial file
+		return storage.WrapError(b.name, "write", err)
+	}
+
+	if err := temp.Chmod(0644); err != nil {
+		return fail(err)
+	}
+	if _, err := io.Copy(temp, r); err != nil {
+		return fail(err)
+	}
+	if err := temp.Sync(); err != nil {
+		return fail(err)
+	}
+	if err := temp.Close(); err != nil {
+		os.Remove(tempPath)
 		return storage.WrapError(b.name, "write", err)
 	}
-	defer dest.Close()
 
-	// Copy data
-	if _, err := io.Copy(dest, source); err != nil {
-		os.Remove(destFullPath) // Clean up partial file
+	if err := os.Rename(tempPath, destFullPath); err != nil {
+		os.Remove(tempPath)
 		return storage.WrapError(b.name, "write", err)
 	}
+	return nil
+}
+
+// Copy duplicates a stored file, using a hardlink when possible
+func (b *Backend) Copy(ctx context.Context, srcPath, destPath string) error {
+	srcFullPath := filepath.Join(b.basePath, srcPath)
+	destFullPath := filepath.Join(b.basePath, destPath)
+
+	if err := os.MkdirAll(filepath.Dir(destFullPath), 0755); err != nil {
+		return storage.WrapError(b.name, "copy", err)
+	}
+
+	if _, err := os.Stat(srcFullPath); err != nil {
+		if os.IsNotExist(err) {
+			return storage.WrapError(b.name, "copy", storage.ErrNotFound)
+		}
+		return storage.WrapError(b.name, "copy", err)
+	}
+
+	// Hardlinks share data blocks, so the copy is instant and free. The link is made under
+	// a temporary name and renamed over destPath: writing into an existing destPath could
+	// truncate a file it is already linked to.
+	tempPath := filepath.Join(filepath.Dir(destFullPath), fmt.Sprintf(".%s.%d.tmp", filepath.Base(destFullPath), time.Now().UnixNano()))
+	if err := os.Link(srcFullPath, tempPath); err == nil {
+		err = os.Rename(tempPath, destFullPath)
+		// Renaming a link over another link to the same file leaves both names in place
+		os.Remove(tempPath)
+		if err != nil {
+			return storage.WrapError(b.name, "copy", err)
+		}
+		return nil
+	}
+
+	// Fall back to a full copy when linking is not possible (e.g. some network filesystems)
+	return b.Write(ctx, srcFullPath, destPath)
+}
+
+// Rename moves a file over another within the backend
+func (b *Backend) Rename(ctx context.Context, srcPath, destPath string) error {
+	if err := os.Rename(filepath.Join(b.basePath, srcPath), filepath.Join(b.basePath, destPath)); err != nil {
+		if os.IsNotExist(err) {
+			return storage.WrapError(b.name, "rename", storage.ErrNotFound)
+		}
+		return storage.WrapError(b.name, "rename", err)
+	}
+	return nil
+}
 
+// SetModTime sets the modification time of a file
+func (b *Backend) SetModTime(ctx context.Context, path string, modTime time.Time) error {
+	if err := os.Chtimes(filepath.Join(b.basePath, path), modTime, modTime); err != nil {
+		return storage.WrapError(b.name, "chtimes", err)
+	}
 	return nil
 }
 
+// Read opens a file from the backend for reading
+func (b *Backend) Read(ctx context.Context, path string) (io.ReadCloser, error) {
+	fullPath := filepath.Join(b.basePath, path)
+	file, err := os.Open(fullPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, storage.WrapError(b.name, "read", storage.ErrNotFound)
+		}
+		return nil, storage.WrapError(b.name, "read", err)
+	}
+	return file, nil
+}
+
+// ReadRange opens a byte range of a file for reading
+func (b *Backend) ReadRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, error) {
+	reader, err := b.Read(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	file := reader.(*os.File)
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, storage.WrapError(b.name, "read", err)
+	}
+
+	return storage.LimitReadCloser(file, length), nil
+}
+
 // Delete removes a file from the backend
 func (b *Backend) Delete(ctx context.Context, path string) error {
 	fullPath := filepath.Join(b.basePath, path)
@@ -0,0 +1,79 @@
+package local_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/williamokano/pg_backuper/pkg/storage"
+	"github.com/williamokano/pg_backuper/pkg/storage/local"
+)
+
+// failingReader returns some data and then an error, as an interrupted dump would
+type failingReader struct{ sent bool }
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.sent {
+		return 0, errors.New("pg_dump: connection lost")
+	}
+	r.sent = true
+	return copy(p, "PGDMP partial"), nil
+}
+
+func newBackend(t *testing.T) (*local.Backend, string) {
+	dir := t.TempDir()
+	backend, err := local.New(storage.Config{Name: "primary", Options: map[string]interface{}{"path": dir}})
+	require.NoError(t, err)
+	return backend, dir
+}
+
+func TestCopy_KeepsLinkedFiles(t *testing.T) {
+	ctx := context.Background()
+	backend, dir := newBackend(t)
+	content := []byte("PGDMP daily dump")
+
+	require.NoError(t, backend.WriteStream(ctx, bytes.NewReader(content), "app--daily.dump"))
+	require.NoError(t, backend.Copy(ctx, "app--daily.dump", "app--weekly.dump"))
+
+	// Copying again over an existing link of the same file must not truncate it
+	require.NoError(t, backend.Copy(ctx, "app--daily.dump", "app--weekly.dump"))
+
+	for _, name := range []string{"app--daily.dump", "app--weekly.dump"} {
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		require.NoError(t, err)
+		assert.Equal(t, content, got, name)
+	}
+
+	// Rewriting one tier file leaves its linked sibling untouched
+	require.NoError(t, backend.WriteStream(ctx, bytes.NewReader([]byte("PGDMP rewritten")), "app--weekly.dump"))
+	got, err := os.ReadFile(filepath.Join(dir, "app--daily.dump"))
+	require.NoError(t, err)
+	assert.Equal(t, content, got)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2, "no temporary files are left behind")
+}
+
+func TestWriteStream_InterruptedKeepsExistingFile(t *testing.T) {
+	ctx := context.Background()
+	backend, dir := newBackend(t)
+	content := []byte("PGDMP complete dump")
+	require.NoError(t, backend.WriteStream(ctx, bytes.NewReader(content), "app--daily.dump"))
+
+	err := backend.WriteStream(ctx, &failingReader{}, "app--daily.dump")
+
+	require.Error(t, err)
+	got, err := os.ReadFile(filepath.Join(dir, "app--daily.dump"))
+	require.NoError(t, err)
+	assert.Equal(t, content, got)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "the partial file is removed")
+}
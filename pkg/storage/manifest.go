@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ManifestSuffix is appended to a backup filename to form its manifest.
+// Manifests never match the backup patterns, which end with the backup's extension.
+const ManifestSuffix = ".manifest.json"
+
+// Manifest describes a stored backup: what it contains and how to check it is intact.
+// It is stored as a JSON sidecar next to the backup on every backend that holds it.
+type Manifest struct {
+	Database        string    `json:"database"`       // Database name, or host identifier for cluster-wide backups
+	Kind            string    `json:"kind,omitempty"` // Empty for database dumps
+	Tier            string    `json:"tier"`
+	Host            string    `json:"host"`
+	Port            int       `json:"port"`
+	ServerVersion   string    `json:"server_version,omitempty"`
+	PgDumpVersion   string    `json:"pg_dump_version,omitempty"` // Version of the client tool that took the backup
+	Size            int64     `json:"size_bytes"`                // Size of the stored object
+	SHA256          string    `json:"sha256"`                    // Hex SHA-256 of the stored object
+	DurationSeconds float64   `json:"duration_seconds"`          // Time taken by the dump
+	Format          string    `json:"format"`
+	Compression     string    `json:"compression"`
+	KeyID           string    `json:"encryption_key_id,omitempty"` // Empty for unencrypted backups
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// ManifestPath returns the path of the manifest of a backup
+func ManifestPath(backupPath string) string {
+	return backupPath + ManifestSuffix
+}
+
+// WriteManifest stores the manifest of a backup
+func WriteManifest(ctx context.Context, backend Backend, backupPath string, manifest Manifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return backend.WriteStream(ctx, bytes.NewReader(data), ManifestPath(backupPath))
+}
+
+// ReadManifest reads the manifest of a backup.
+// Returns ErrNotFound if the backup has none.
+func ReadManifest(ctx context.Context, backend Backend, backupPath string) (*Manifest, error) {
+	reader, err := backend.Read(ctx, ManifestPath(backupPath))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest %s: %w", ManifestPath(backupPath), err)
+	}
+	return &manifest, nil
+}
+
+// CopyManifest copies the manifest of a backup from source to target, if it has one
+func CopyManifest(ctx context.Context, source, target Backend, backupPath string) error {
+	manifest, err := ReadManifest(ctx, source, backupPath)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return WriteManifest(ctx, target, backupPath, *manifest)
+}
+
+// AttachManifests reads the manifests of stored files listed with pattern and sets
+// their Manifest. Files without a manifest keep a nil Manifest; unreadable manifests are
+// returned as errors, keyed by backup path.
+func AttachManifests(ctx context.Context, backend Backend, files []FileInfo, pattern string) (map[string]error, error) {
+	sidecars, err := backend.List(ctx, pattern+ManifestSuffix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list manifests: %w", err)
+	}
+
+	present := make(map[string]bool, len(sidecars))
+	for _, sidecar := range sidecars {
+		present[strings.TrimSuffix(sidecar.Path, ManifestSuffix)] = true
+	}
+
+	invalid := make(map[string]error)
+	for i := range files {
+		if !present[files[i].Path] {
+			continue
+		}
+		manifest, err := ReadManifest(ctx, backend, files[i].Path)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			invalid[files[i].Path] = err
+			continue
+		}
+		files[i].Manifest = manifest
+	}
+	return invalid, nil
+}
@@ -0,0 +1,111 @@
+package storage_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/williamokano/pg_backuper/pkg/storage"
+	"github.com/williamokano/pg_backuper/pkg/storage/mocks"
+)
+
+func testManifest() storage.Manifest {
+	return storage.Manifest{
+		Database:    "app",
+		Tier:        "daily",
+		Host:        "db.example.com",
+		Port:        5432,
+		Size:        1024,
+		SHA256:      strings.Repeat("ab", 32),
+		Format:      "custom",
+		Compression: "pg_dump",
+		CreatedAt:   time.Date(2025, 3, 9, 2, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestManifest_RoundTrip(t *testing.T) {
+	ctx := context.Background()
+	backend := mocks.NewMockBackend(t)
+
+	var stored []byte
+	backend.On("WriteStream", mock.Anything, mock.Anything, "app--daily--2025-03-09T02-00-00.dump.manifest.json").
+		Run(func(args mock.Arguments) {
+			stored, _ = io.ReadAll(args.Get(1).(io.Reader))
+		}).
+		Return(nil).Once()
+
+	require.NoError(t, storage.WriteManifest(ctx, backend, "app--daily--2025-03-09T02-00-00.dump", testManifest()))
+	assert.Contains(t, string(stored), `"sha256": "abab`)
+
+	backend.On("Read", mock.Anything, "app--daily--2025-03-09T02-00-00.dump.manifest.json").
+		Return(io.NopCloser(bytes.NewReader(stored)), nil).Once()
+
+	manifest, err := storage.ReadManifest(ctx, backend, "app--daily--2025-03-09T02-00-00.dump")
+	require.NoError(t, err)
+	assert.Equal(t, testManifest(), *manifest)
+}
+
+func TestAttachManifests(t *testing.T) {
+	ctx := context.Background()
+	backend := mocks.NewMockBackend(t)
+
+	files := []storage.FileInfo{
+		{Path: "app--daily--2025-03-09T02-00-00.dump"},
+		{Path: "app--daily--2025-03-08T02-00-00.dump"},
+		{Path: "app--daily--2025-03-07T02-00-00.dump"},
+	}
+	backend.On("List", mock.Anything, "app--*.dump"+storage.ManifestSuffix).Return([]storage.FileInfo{
+		{Path: storage.ManifestPath(files[0].Path)},
+		{Path: storage.ManifestPath(files[2].Path)},
+	}, nil).Once()
+
+	data, err := json.Marshal(testManifest())
+	require.NoError(t, err)
+	backend.On("Read", mock.Anything, storage.ManifestPath(files[0].Path)).
+		Return(io.NopCloser(bytes.NewReader(data)), nil).Once()
+	backend.On("Read", mock.Anything, storage.ManifestPath(files[2].Path)).
+		Return(io.NopCloser(strings.NewReader("{truncated")), nil).Once()
+
+	invalid, err := storage.AttachManifests(ctx, backend, files, "app--*.dump")
+
+	require.NoError(t, err)
+	require.NotNil(t, files[0].Manifest)
+	assert.Equal(t, "app", files[0].Manifest.Database)
+	assert.Nil(t, files[1].Manifest)
+	assert.Nil(t, files[2].Manifest)
+	assert.Len(t, invalid, 1)
+	assert.Contains(t, invalid, files[2].Path)
+}
+
+func TestCopyManifest(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("copies_existing_manifest", func(t *testing.T) {
+		source := mocks.NewMockBackend(t)
+		target := mocks.NewMockBackend(t)
+		data, err := json.Marshal(testManifest())
+		require.NoError(t, err)
+		source.On("Read", mock.Anything, "app.dump"+storage.ManifestSuffix).
+			Return(io.NopCloser(bytes.NewReader(data)), nil).Once()
+		target.On("WriteStream", mock.Anything, mock.Anything, "app.dump"+storage.ManifestSuffix).Return(nil).Once()
+
+		assert.NoError(t, storage.CopyManifest(ctx, source, target, "app.dump"))
+	})
+
+	t.Run("skips_backups_without_manifest", func(t *testing.T) {
+		source := mocks.NewMockBackend(t)
+		target := mocks.NewMockBackend(t)
+		source.On("Read", mock.Anything, "app.dump"+storage.ManifestSuffix).
+			Return(nil, storage.ErrNotFound).Once()
+
+		assert.NoError(t, storage.CopyManifest(ctx, source, target, "app.dump"))
+		target.AssertNotCalled(t, "WriteStream", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
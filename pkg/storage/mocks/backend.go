@@ -4,6 +4,7 @@ package mocks
 
 import (
 	"context"
+	"io"
 
 	"github.com/stretchr/testify/mock"
 	"github.com/williamokano/pg_backuper/pkg/storage"
@@ -56,6 +57,72 @@ func (m *MockBackend) Write(ctx context.Context, sourcePath string, destPath str
 	return r0
 }
 
+// WriteStream provides a mock function with given fields: ctx, r, destPath
+func (m *MockBackend) WriteStream(ctx context.Context, r io.Reader, destPath string) error {
+	ret := m.Called(ctx, r, destPath)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, io.Reader, string) error); ok {
+		r0 = rf(ctx, r, destPath)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Read provides a mock function with given fields: ctx, path
+func (m *MockBackend) Read(ctx context.Context, path string) (io.ReadCloser, error) {
+	ret := m.Called(ctx, path)
+
+	var r0 io.ReadCloser
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (io.ReadCloser, error)); ok {
+		return rf(ctx, path)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) io.ReadCloser); ok {
+		r0 = rf(ctx, path)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(io.ReadCloser)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, path)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ReadRange provides a mock function with given fields: ctx, path, offset, length
+func (m *MockBackend) ReadRange(ctx context.Context, path string, offset int64, length int64) (io.ReadCloser, error) {
+	ret := m.Called(ctx, path, offset, length)
+
+	var r0 io.ReadCloser
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, int64, int64) (io.ReadCloser, error)); ok {
+		return rf(ctx, path, offset, length)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, int64, int64) io.ReadCloser); ok {
+		r0 = rf(ctx, path, offset, length)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(io.ReadCloser)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, int64, int64) error); ok {
+		r1 = rf(ctx, path, offset, length)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // Delete provides a mock function with given fields: ctx, path
 func (m *MockBackend) Delete(ctx context.Context, path string) error {
 	ret := m.Called(ctx, path)
@@ -0,0 +1,30 @@
+package mocks
+
+import (
+	"bytes"
+	"io"
+)
+
+// NewContentReader returns a reader over content, for simulating downloads
+// via Read/ReadRange expectations
+func NewContentReader(content []byte) io.ReadCloser {
+	return io.NopCloser(bytes.NewReader(content))
+}
+
+// NewFailingReader returns a reader that yields the first failAfter bytes of
+// content and then fails with err, for simulating interrupted downloads
+func NewFailingReader(content []byte, failAfter int, err error) io.ReadCloser {
+	if failAfter > len(content) {
+		failAfter = len(content)
+	}
+	return io.NopCloser(io.MultiReader(bytes.NewReader(content[:failAfter]), &errReader{err: err}))
+}
+
+// errReader always fails with err
+type errReader struct {
+	err error
+}
+
+func (r *errReader) Read(p []byte) (int, error) {
+	return 0, r.err
+}
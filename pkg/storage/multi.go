@@ -2,12 +2,20 @@ package storage
 
 import (
 	"context"
+	"errors"
+	"io"
 	"sync"
 	"time"
 
 	"github.com/rs/zerolog"
 )
 
+// streamBufferSize is the chunk size UploadStream reads from its source
+const streamBufferSize = 1024 * 1024
+
+// errStreamAbandoned is reported when a backend returned before consuming the whole stream
+var errStreamAbandoned = errors.New("backend stopped reading the stream before it ended")
+
 // MultiUploader handles uploading to multiple backends in parallel
 type MultiUploader struct {
 	logger zerolog.Logger
@@ -78,6 +86,225 @@ func (m *MultiUploader) Upload(ctx context.Context, backends []Backend, sourcePa
 	return results
 }
 
+// UploadStream uploads data read from r to multiple backends concurrently.
+// r is read once and fanned out to every backend through a pipe; a backend that
+// fails is dropped while the others continue. If reading r fails, every backend
+// receives the error and discards its partial object.
+// Backends consume the stream in lockstep, so the slowest one sets the pace.
+func (m *MultiUploader) UploadStream(ctx context.Context, backends []Backend, r io.Reader, destPath string) []Result {
+	var wg sync.WaitGroup
+	results := make([]Result, len(backends))
+	writers := make([]*io.PipeWriter, len(backends))
+
+	for i, backend := range backends {
+		pr, pw := io.Pipe()
+		writers[i] = pw
+		wg.Add(1)
+
+		go func(i int, b Backend, pr *io.PipeReader) {
+			defer wg.Done()
+
+			start := time.Now()
+
+			m.logger.Debug().
+				Str("backend", b.Name()).
+				Str("type", b.Type()).
+				Str("file", destPath).
+				Msg("starting streaming upload")
+
+			err := b.WriteStream(ctx, pr, destPath)
+
+			// Unblock the fan-out if the backend stopped reading early
+			if err != nil {
+				pr.CloseWithError(err)
+			} else {
+				pr.CloseWithError(errStreamAbandoned)
+			}
+
+			results[i] = Result{
+				BackendName: b.Name(),
+				BackendType: b.Type(),
+				Success:     err == nil,
+				Error:       err,
+				Duration:    time.Since(start),
+			}
+		}(i, backend, pr)
+	}
+
+	dropped := fanOut(r, writers)
+	wg.Wait()
+
+	for i := range results {
+		result := &results[i]
+		if result.Success && dropped[i] {
+			result.Success = false
+			result.Error = WrapError(result.BackendName, "upload", errStreamAbandoned)
+		}
+
+		if result.Error != nil {
+			m.logger.Error().
+				Err(result.Error).
+				Str("backend", result.BackendName).
+				Dur("duration", result.Duration).
+				Msg("streaming upload failed")
+		} else {
+			m.logger.Info().
+				Str("backend", result.BackendName).
+				Dur("duration", result.Duration).
+				Msg("streaming upload succeeded")
+		}
+	}
+
+	return results
+}
+
+// fanOut copies r to every writer until EOF or until all writers have failed.
+// Writers are closed with the read error, if any, so backends abort instead of
+// committing a truncated object. Returns which writers were dropped on error.
+func fanOut(r io.Reader, writers []*io.PipeWriter) []bool {
+	dropped := make([]bool, len(writers))
+	live := len(writers)
+	buf := make([]byte, streamBufferSize)
+
+	var readErr error
+	for live > 0 {
+		n, err := r.Read(buf)
+		if n > 0 {
+			for i, w := range writers {
+				if dropped[i] {
+					continue
+				}
+				if _, werr := w.Write(buf[:n]); werr != nil {
+					dropped[i] = true
+					live--
+				}
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			readErr = err
+			break
+		}
+	}
+
+	for _, w := range writers {
+		if readErr != nil {
+			w.CloseWithError(readErr)
+		} else {
+			w.Close()
+		}
+	}
+
+	return dropped
+}
+
+// Replicate stores an already uploaded file under another name on multiple backends concurrently.
+// Backends implementing Copier duplicate srcPath server-side; the others, and any
+// backend where the copy fails (e.g. srcPath was never uploaded there), re-upload sourcePath.
+// An empty sourcePath (streamed backups have no local artifact) re-uploads srcPath
+// from the backend itself instead.
+func (m *MultiUploader) Replicate(ctx context.Context, backends []Backend, sourcePath, srcPath, destPath string) []Result {
+	var wg sync.WaitGroup
+	resultsChan := make(chan Result, len(backends))
+
+	for _, backend := range backends {
+		wg.Add(1)
+
+		go func(b Backend) {
+			defer wg.Done()
+
+			start := time.Now()
+			copied := false
+			var err error
+
+			if copier, ok := b.(Copier); ok {
+				if err = copier.Copy(ctx, srcPath, destPath); err == nil {
+					copied = true
+				} else {
+					m.logger.Warn().
+						Err(err).
+						Str("backend", b.Name()).
+						Str("source", srcPath).
+						Str("file", destPath).
+						Msg("server-side copy failed, falling back to upload")
+				}
+			}
+
+			if !copied {
+				if sourcePath != "" {
+					err = b.Write(ctx, sourcePath, destPath)
+				} else {
+					err = copyThrough(ctx, b, srcPath, destPath)
+				}
+			}
+			duration := time.Since(start)
+
+			if err != nil {
+				m.logger.Error().
+					Err(err).
+					Str("backend", b.Name()).
+					Dur("duration", duration).
+					Msg("replication failed")
+			} else {
+				m.logger.Info().
+					Str("backend", b.Name()).
+					Str("file", destPath).
+					Bool("server_side_copy", copied).
+					Dur("duration", duration).
+					Msg("replication succeeded")
+			}
+
+			resultsChan <- Result{
+				BackendName: b.Name(),
+				BackendType: b.Type(),
+				Success:     err == nil,
+				Copied:      copied,
+				Error:       err,
+				Duration:    duration,
+			}
+		}(backend)
+	}
+
+	wg.Wait()
+	close(resultsChan)
+
+	var results []Result
+	for result := range resultsChan {
+		results = append(results, result)
+	}
+
+	return results
+}
+
+// CopyAcross copies a file stored on source to the same path on other backends.
+// The file is read from source once and streamed to every target; if it cannot
+// be read, every target fails with the read error.
+func (m *MultiUploader) CopyAcross(ctx context.Context, source Backend, targets []Backend, path string) []Result {
+	reader, err := source.Read(ctx, path)
+	if err != nil {
+		m.logger.Error().
+			Err(err).
+			Str("backend", source.Name()).
+			Str("file", path).
+			Msg("cannot read file to copy")
+
+		results := make([]Result, len(targets))
+		for i, b := range targets {
+			results[i] = Result{
+				BackendName: b.Name(),
+				BackendType: b.Type(),
+				Error:       err,
+			}
+		}
+		return results
+	}
+	defer reader.Close()
+
+	return m.UploadStream(ctx, targets, reader, path)
+}
+
 // Delete deletes a file from multiple backends
 func (m *MultiUploader) Delete(ctx context.Context, backends []Backend, path string) []Result {
 	var wg sync.WaitGroup
@@ -112,3 +339,14 @@ func (m *MultiUploader) Delete(ctx context.Context, backends []Backend, path str
 
 	return results
 }
+
+// copyThrough duplicates a stored file by streaming it back through the backend
+func copyThrough(ctx context.Context, b Backend, srcPath, destPath string) error {
+	reader, err := b.Read(ctx, srcPath)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	return b.WriteStream(ctx, reader, destPath)
+}
@@ -3,6 +3,8 @@ package storage_test
 import (
 	"context"
 	"errors"
+	"io"
+	"strings"
 	"testing"
 	"time"
 
@@ -296,6 +298,245 @@ func TestMultiUploader_Upload(t *testing.T) {
 	})
 }
 
+// readAllInto returns a WriteStream implementation that consumes the stream into dst
+func readAllInto(dst *string) func(context.Context, io.Reader, string) error {
+	return func(_ context.Context, r io.Reader, _ string) error {
+		data, err := io.ReadAll(r)
+		*dst = string(data)
+		return err
+	}
+}
+
+func TestMultiUploader_UploadStream(t *testing.T) {
+	content := strings.Repeat("PGDMP", 500000) // spans several fan-out chunks
+
+	t.Run("fans_out_to_all_backends", func(t *testing.T) {
+		var got1, got2 string
+
+		backend1 := mocks.NewMockBackend(t)
+		backend1.On("Name").Return("backend1")
+		backend1.On("Type").Return("local")
+		backend1.On("WriteStream", mock.Anything, mock.Anything, "db.backup").
+			Return(readAllInto(&got1)).Once()
+
+		backend2 := mocks.NewMockBackend(t)
+		backend2.On("Name").Return("backend2")
+		backend2.On("Type").Return("s3")
+		backend2.On("WriteStream", mock.Anything, mock.Anything, "db.backup").
+			Return(readAllInto(&got2)).Once()
+
+		uploader := storage.NewMultiUploader(zerolog.Nop())
+
+		results := uploader.UploadStream(context.Background(), []storage.Backend{backend1, backend2},
+			strings.NewReader(content), "db.backup")
+
+		require.Len(t, results, 2)
+		for _, r := range results {
+			assert.True(t, r.Success, "backend %s should succeed", r.BackendName)
+		}
+		assert.Equal(t, content, got1)
+		assert.Equal(t, content, got2)
+	})
+
+	t.Run("failed_backend_does_not_stall_others", func(t *testing.T) {
+		var got string
+
+		failing := mocks.NewMockBackend(t)
+		failing.On("Name").Return("failing")
+		failing.On("Type").Return("ssh")
+		failing.On("WriteStream", mock.Anything, mock.Anything, "db.backup").
+			Return(errors.New("connection lost")).Once()
+
+		healthy := mocks.NewMockBackend(t)
+		healthy.On("Name").Return("healthy")
+		healthy.On("Type").Return("local")
+		healthy.On("WriteStream", mock.Anything, mock.Anything, "db.backup").
+			Return(readAllInto(&got)).Once()
+
+		uploader := storage.NewMultiUploader(zerolog.Nop())
+
+		results := uploader.UploadStream(context.Background(), []storage.Backend{failing, healthy},
+			strings.NewReader(content), "db.backup")
+
+		require.Len(t, results, 2)
+		assert.False(t, results[0].Success)
+		assert.True(t, results[1].Success)
+		assert.Equal(t, content, got)
+	})
+
+	t.Run("source_error_reaches_backends", func(t *testing.T) {
+		var got string
+		sourceErr := errors.New("pg_dump failed")
+
+		backend := mocks.NewMockBackend(t)
+		backend.On("Name").Return("backend1")
+		backend.On("Type").Return("local")
+		backend.On("WriteStream", mock.Anything, mock.Anything, "db.backup").
+			Return(readAllInto(&got)).Once()
+
+		source := mocks.NewFailingReader([]byte("partial"), 7, sourceErr)
+		uploader := storage.NewMultiUploader(zerolog.Nop())
+
+		results := uploader.UploadStream(context.Background(), []storage.Backend{backend}, source, "db.backup")
+
+		require.Len(t, results, 1)
+		assert.False(t, results[0].Success)
+		assert.ErrorIs(t, results[0].Error, sourceErr)
+	})
+
+	t.Run("backend_returning_early_is_failed", func(t *testing.T) {
+		backend := mocks.NewMockBackend(t)
+		backend.On("Name").Return("backend1")
+		backend.On("Type").Return("local")
+		backend.On("WriteStream", mock.Anything, mock.Anything, "db.backup").
+			Return(nil).Once()
+
+		uploader := storage.NewMultiUploader(zerolog.Nop())
+
+		results := uploader.UploadStream(context.Background(), []storage.Backend{backend},
+			strings.NewReader(content), "db.backup")
+
+		require.Len(t, results, 1)
+		assert.False(t, results[0].Success)
+	})
+}
+
+// copierBackend is a mock backend that also supports server-side copies
+type copierBackend struct {
+	*mocks.MockBackend
+}
+
+func (c copierBackend) Copy(ctx context.Context, srcPath string, destPath string) error {
+	args := c.Called(ctx, srcPath, destPath)
+	return args.Error(0)
+}
+
+func TestMultiUploader_Replicate(t *testing.T) {
+	t.Run("server_side_copy", func(t *testing.T) {
+		mockBackend := copierBackend{mocks.NewMockBackend(t)}
+		mockBackend.On("Name").Return("backend1")
+		mockBackend.On("Type").Return("s3")
+		mockBackend.On("Copy",
+			mock.Anything,
+			"db--daily--2025-12-20T10-00-00.backup",
+			"db--weekly--2025-12-20T10-00-00.backup",
+		).Return(nil).Once()
+
+		uploader := storage.NewMultiUploader(zerolog.Nop())
+
+		results := uploader.Replicate(context.Background(), []storage.Backend{mockBackend},
+			"/tmp/backup.tmp", "db--daily--2025-12-20T10-00-00.backup", "db--weekly--2025-12-20T10-00-00.backup")
+
+		require.Len(t, results, 1)
+		assert.True(t, results[0].Success)
+		assert.True(t, results[0].Copied)
+		mockBackend.AssertNotCalled(t, "Write", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("falls_back_to_upload_when_copy_fails", func(t *testing.T) {
+		mockBackend := copierBackend{mocks.NewMockBackend(t)}
+		mockBackend.On("Name").Return("backend1")
+		mockBackend.On("Type").Return("s3")
+		mockBackend.On("Copy", mock.Anything, "src.backup", "dest.backup").
+			Return(storage.ErrNotFound).Once()
+		mockBackend.On("Write", mock.Anything, "/tmp/backup.tmp", "dest.backup").
+			Return(nil).Once()
+
+		uploader := storage.NewMultiUploader(zerolog.Nop())
+
+		results := uploader.Replicate(context.Background(), []storage.Backend{mockBackend},
+			"/tmp/backup.tmp", "src.backup", "dest.backup")
+
+		require.Len(t, results, 1)
+		assert.True(t, results[0].Success)
+		assert.False(t, results[0].Copied)
+	})
+
+	t.Run("uploads_to_backends_without_copy_support", func(t *testing.T) {
+		mockBackend := mocks.NewMockBackend(t)
+		mockBackend.On("Name").Return("b2")
+		mockBackend.On("Type").Return("backblaze")
+		mockBackend.On("Write", mock.Anything, "/tmp/backup.tmp", "dest.backup").
+			Return(errors.New("upload failed")).Once()
+
+		uploader := storage.NewMultiUploader(zerolog.Nop())
+
+		results := uploader.Replicate(context.Background(), []storage.Backend{mockBackend},
+			"/tmp/backup.tmp", "src.backup", "dest.backup")
+
+		require.Len(t, results, 1)
+		assert.False(t, results[0].Success)
+		assert.False(t, results[0].Copied)
+		assert.Error(t, results[0].Error)
+	})
+
+	t.Run("streamed_backup_copies_through_backend", func(t *testing.T) {
+		var got string
+
+		mockBackend := mocks.NewMockBackend(t)
+		mockBackend.On("Name").Return("b2")
+		mockBackend.On("Type").Return("backblaze")
+		mockBackend.On("Read", mock.Anything, "src.backup").
+			Return(mocks.NewContentReader([]byte("PGDMP")), nil).Once()
+		mockBackend.On("WriteStream", mock.Anything, mock.Anything, "dest.backup").
+			Return(readAllInto(&got)).Once()
+
+		uploader := storage.NewMultiUploader(zerolog.Nop())
+
+		results := uploader.Replicate(context.Background(), []storage.Backend{mockBackend},
+			"", "src.backup", "dest.backup")
+
+		require.Len(t, results, 1)
+		assert.True(t, results[0].Success)
+		assert.Equal(t, "PGDMP", got)
+	})
+}
+
+func TestMultiUploader_CopyAcross(t *testing.T) {
+	t.Run("streams_from_source_to_targets", func(t *testing.T) {
+		var got string
+
+		source := mocks.NewMockBackend(t)
+		source.On("Read", mock.Anything, "db--daily--2025-12-20T10-00-00Z.backup").
+			Return(mocks.NewContentReader([]byte("PGDMP")), nil).Once()
+
+		target := mocks.NewMockBackend(t)
+		target.On("Name").Return("s3_offsite")
+		target.On("Type").Return("s3")
+		target.On("WriteStream", mock.Anything, mock.Anything, "db--daily--2025-12-20T10-00-00Z.backup").
+			Return(readAllInto(&got)).Once()
+
+		uploader := storage.NewMultiUploader(zerolog.Nop())
+
+		results := uploader.CopyAcross(context.Background(), source, []storage.Backend{target},
+			"db--daily--2025-12-20T10-00-00Z.backup")
+
+		require.Len(t, results, 1)
+		assert.True(t, results[0].Success)
+		assert.Equal(t, "s3_offsite", results[0].BackendName)
+		assert.Equal(t, "PGDMP", got)
+	})
+
+	t.Run("read_failure_fails_every_target", func(t *testing.T) {
+		source := mocks.NewMockBackend(t)
+		source.On("Name").Return("local")
+		source.On("Read", mock.Anything, "db.backup").Return(nil, storage.ErrNotFound).Once()
+
+		target := mocks.NewMockBackend(t)
+		target.On("Name").Return("s3_offsite")
+		target.On("Type").Return("s3")
+
+		uploader := storage.NewMultiUploader(zerolog.Nop())
+
+		results := uploader.CopyAcross(context.Background(), source, []storage.Backend{target}, "db.backup")
+
+		require.Len(t, results, 1)
+		assert.False(t, results[0].Success)
+		assert.ErrorIs(t, results[0].Error, storage.ErrNotFound)
+		target.AssertNotCalled(t, "WriteStream", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
 func TestNewMultiUploader(t *testing.T) {
 	t.Run("creates_uploader", func(t *testing.T) {
 		logger := zerolog.Nop()
@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// Replace moves srcPath over destPath, so that readers of destPath see either the old or
+// the new file, never a partial one. srcPath is gone afterwards.
+//
+// Backends implementing Renamer rename in place, after giving srcPath modTime (if set and the
+// backend implements ModTimeSetter). Backends implementing Copier copy server-side, which
+// replaces the object at once on object stores; the others get srcPath uploaded again.
+// Object stores cannot keep modTime: the new object is dated now.
+func Replace(ctx context.Context, backend Backend, srcPath, destPath string, modTime time.Time) error {
+	if renamer, ok := backend.(Renamer); ok {
+		if setter, ok := backend.(ModTimeSetter); ok && !modTime.IsZero() {
+			if err := setter.SetModTime(ctx, srcPath, modTime); err != nil {
+				return err
+			}
+		}
+		return renamer.Rename(ctx, srcPath, destPath)
+	}
+
+	if copier, ok := backend.(Copier); ok {
+		if err := copier.Copy(ctx, srcPath, destPath); err != nil {
+			return err
+		}
+		return backend.Delete(ctx, srcPath)
+	}
+
+	reader, err := backend.Read(ctx, srcPath)
+	if err != nil {
+		return err
+	}
+	err = backend.WriteStream(ctx, reader, destPath)
+	reader.Close()
+	if err != nil {
+		return err
+	}
+	return backend.Delete(ctx, srcPath)
+}
@@ -0,0 +1,79 @@
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/williamokano/pg_backuper/pkg/storage"
+	"github.com/williamokano/pg_backuper/pkg/storage/mocks"
+)
+
+// renamerBackend is a mock backend that also supports renames and modification times
+type renamerBackend struct {
+	*mocks.MockBackend
+}
+
+func (r renamerBackend) Rename(ctx context.Context, srcPath string, destPath string) error {
+	args := r.Called(ctx, srcPath, destPath)
+	return args.Error(0)
+}
+
+func (r renamerBackend) SetModTime(ctx context.Context, path string, modTime time.Time) error {
+	args := r.Called(ctx, path, modTime)
+	return args.Error(0)
+}
+
+func TestReplace(t *testing.T) {
+	ctx := context.Background()
+	modTime := time.Date(2025, 3, 9, 2, 0, 0, 0, time.UTC)
+
+	t.Run("renames_with_mod_time", func(t *testing.T) {
+		backend := renamerBackend{mocks.NewMockBackend(t)}
+		backend.On("SetModTime", mock.Anything, "db.backup.tmp", modTime).Return(nil).Once()
+		backend.On("Rename", mock.Anything, "db.backup.tmp", "db.backup").Return(nil).Once()
+
+		assert.NoError(t, storage.Replace(ctx, backend, "db.backup.tmp", "db.backup", modTime))
+	})
+
+	t.Run("keeps_source_when_mod_time_fails", func(t *testing.T) {
+		backend := renamerBackend{mocks.NewMockBackend(t)}
+		backend.On("SetModTime", mock.Anything, "db.backup.tmp", modTime).Return(errors.New("permission denied")).Once()
+
+		assert.Error(t, storage.Replace(ctx, backend, "db.backup.tmp", "db.backup", modTime))
+		backend.AssertNotCalled(t, "Rename", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("copies_server_side", func(t *testing.T) {
+		backend := copierBackend{mocks.NewMockBackend(t)}
+		backend.On("Copy", mock.Anything, "db.backup.tmp", "db.backup").Return(nil).Once()
+		backend.On("Delete", mock.Anything, "db.backup.tmp").Return(nil).Once()
+
+		assert.NoError(t, storage.Replace(ctx, backend, "db.backup.tmp", "db.backup", modTime))
+	})
+
+	t.Run("uploads_again_without_copy_support", func(t *testing.T) {
+		backend := mocks.NewMockBackend(t)
+		backend.On("Read", mock.Anything, "db.backup.tmp").
+			Return(io.NopCloser(strings.NewReader("sealed")), nil).Once()
+		backend.On("WriteStream", mock.Anything, mock.Anything, "db.backup").Return(nil).Once()
+		backend.On("Delete", mock.Anything, "db.backup.tmp").Return(nil).Once()
+
+		assert.NoError(t, storage.Replace(ctx, backend, "db.backup.tmp", "db.backup", modTime))
+	})
+
+	t.Run("keeps_source_when_upload_fails", func(t *testing.T) {
+		backend := mocks.NewMockBackend(t)
+		backend.On("Read", mock.Anything, "db.backup.tmp").
+			Return(io.NopCloser(strings.NewReader("sealed")), nil).Once()
+		backend.On("WriteStream", mock.Anything, mock.Anything, "db.backup").Return(errors.New("upload failed")).Once()
+
+		assert.Error(t, storage.Replace(ctx, backend, "db.backup.tmp", "db.backup", modTime))
+		backend.AssertNotCalled(t, "Delete", mock.Anything, mock.Anything)
+	})
+}
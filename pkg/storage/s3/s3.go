@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"net/url"
 	"os"
 	"path"
 	"sort"
@@ -14,10 +16,18 @@ import (
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 
 	"github.com/williamokano/pg_backuper/pkg/storage"
 )
 
+const (
+	// maxCopyObjectSize is the largest object CopyObject accepts (5 GiB)
+	maxCopyObjectSize = 5 * 1024 * 1024 * 1024
+	// copyPartSize is the part size for multipart copies of larger objects
+	copyPartSize = 512 * 1024 * 1024
+)
+
 type Backend struct {
 	name     string
 	client   *s3.Client
@@ -93,22 +103,146 @@ func (b *Backend) Write(ctx context.Context, sourcePath, destPath string) error
 		}
 		defer file.Close()
 
-		// Build S3 key
-		key := path.Join(b.prefix, destPath)
+		return b.WriteStream(ctx, file, destPath)
+	})
+}
+
+// WriteStream uploads data from r to S3.
+// Bodies larger than one part are sent as a multipart upload, which the
+// uploader aborts on failure so no partial object is left behind.
+func (b *Backend) WriteStream(ctx context.Context, r io.Reader, destPath string) error {
+	// Build S3 key
+	key := path.Join(b.prefix, destPath)
+
+	// Upload
+	_, err := b.uploader.Upload(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(key),
+		Body:   r,
+	})
+
+	if err != nil {
+		return storage.WrapError(b.name, "upload", err)
+	}
+
+	return nil
+}
+
+// Copy duplicates an object server-side without re-uploading it.
+// Objects above the 5 GiB CopyObject limit are copied in parts.
+func (b *Backend) Copy(ctx context.Context, srcPath, destPath string) error {
+	srcKey := path.Join(b.prefix, srcPath)
+	destKey := path.Join(b.prefix, destPath)
 
-		// Upload
-		_, err = b.uploader.Upload(ctx, &s3.PutObjectInput{
-			Bucket: aws.String(b.bucket),
-			Key:    aws.String(key),
-			Body:   file,
+	head, err := b.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(srcKey),
+	})
+	if err != nil {
+		return storage.WrapError(b.name, "copy", err)
+	}
+
+	if aws.ToInt64(head.ContentLength) <= maxCopyObjectSize {
+		_, err = b.client.CopyObject(ctx, &s3.CopyObjectInput{
+			Bucket:     aws.String(b.bucket),
+			Key:        aws.String(destKey),
+			CopySource: aws.String(copySource(b.bucket, srcKey)),
 		})
+		if err != nil {
+			return storage.WrapError(b.name, "copy", err)
+		}
+		return nil
+	}
+
+	if err := b.multipartCopy(ctx, srcKey, destKey, aws.ToInt64(head.ContentLength)); err != nil {
+		return storage.WrapError(b.name, "copy", err)
+	}
+	return nil
+}
+
+// multipartCopy copies a large object with UploadPartCopy
+func (b *Backend) multipartCopy(ctx context.Context, srcKey, destKey string, size int64) error {
+	upload, err := b.client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(destKey),
+	})
+	if err != nil {
+		return err
+	}
+
+	var parts []types.CompletedPart
+	for offset, partNumber := int64(0), int32(1); offset < size; offset, partNumber = offset+copyPartSize, partNumber+1 {
+		last := offset + copyPartSize - 1
+		if last >= size {
+			last = size - 1
+		}
 
+		part, err := b.client.UploadPartCopy(ctx, &s3.UploadPartCopyInput{
+			Bucket:          aws.String(b.bucket),
+			Key:             aws.String(destKey),
+			UploadId:        upload.UploadId,
+			PartNumber:      aws.Int32(partNumber),
+			CopySource:      aws.String(copySource(b.bucket, srcKey)),
+			CopySourceRange: aws.String(fmt.Sprintf("bytes=%d-%d", offset, last)),
+		})
 		if err != nil {
-			return storage.WrapError(b.name, "upload", err)
+			b.client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+				Bucket:   aws.String(b.bucket),
+				Key:      aws.String(destKey),
+				UploadId: upload.UploadId,
+			})
+			return err
 		}
 
-		return nil
+		parts = append(parts, types.CompletedPart{
+			ETag:       part.CopyPartResult.ETag,
+			PartNumber: aws.Int32(partNumber),
+		})
+	}
+
+	_, err = b.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(b.bucket),
+		Key:             aws.String(destKey),
+		UploadId:        upload.UploadId,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
 	})
+	return err
+}
+
+// Read opens an object from S3 for reading
+func (b *Backend) Read(ctx context.Context, objectPath string) (io.ReadCloser, error) {
+	return b.ReadRange(ctx, objectPath, 0, -1)
+}
+
+// ReadRange opens a byte range of an object from S3 for reading
+func (b *Backend) ReadRange(ctx context.Context, objectPath string, offset, length int64) (io.ReadCloser, error) {
+	key := path.Join(b.prefix, objectPath)
+
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(key),
+	}
+
+	// HTTP range: "bytes=offset-" reads to the end, "bytes=offset-last" is inclusive
+	if length == 0 {
+		return io.NopCloser(strings.NewReader("")), nil
+	} else if length > 0 {
+		input.Range = aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	} else if offset > 0 {
+		input.Range = aws.String(fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	result, err := b.client.GetObject(ctx, input)
+
+	if err != nil {
+		var noSuchKey *types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return nil, storage.WrapError(b.name, "read", storage.ErrNotFound)
+		}
+		return nil, storage.WrapError(b.name, "read", err)
+	}
+
+	return result.Body, nil
 }
 
 // Delete removes an object from S3
@@ -260,6 +394,11 @@ func parseConfig(options map[string]interface{}) (*Config, error) {
 	return cfg, nil
 }
 
+// copySource builds the URL-encoded "bucket/key" value for copy requests
+func copySource(bucket, key string) string {
+	return (&url.URL{Path: bucket + "/" + key}).EscapedPath()
+}
+
 func extractPrefix(pattern string) string {
 	// Extract prefix before first wildcard
 	// "dbname--*.backup" -> "dbname--"
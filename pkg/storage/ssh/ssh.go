@@ -8,6 +8,7 @@ import (
 	"os"
 	"path"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/pkg/sftp"
@@ -115,29 +116,133 @@ func (b *Backend) Write(ctx context.Context, sourcePath, destPath string) error
 		}
 		defer localFile.Close()
 
-		// Build remote path
-		remotePath := path.Join(b.remotePath, destPath)
+		return b.WriteStream(ctx, localFile, destPath)
+	})
+}
+
+// WriteStream uploads data from r via SFTP
+func (b *Backend) WriteStream(ctx context.Context, r io.Reader, destPath string) error {
+	// Build remote path
+	remotePath := path.Join(b.remotePath, destPath)
+
+	// Ensure remote directory exists
+	remoteDir := path.Dir(remotePath)
+	if err := b.sftpClient.MkdirAll(remoteDir); err != nil {
+		return storage.WrapError(b.name, "mkdir", err)
+	}
+
+	// Upload under a temporary name renamed over remotePath once complete, so an interrupted
+	// upload never leaves a truncated file under the final name
+	tempPath := path.Join(remoteDir, fmt.Sprintf(".%s.%d.tmp", path.Base(remotePath), time.Now().UnixNano()))
+	remoteFile, err := b.sftpClient.Create(tempPath)
+	if err != nil {
+		return storage.WrapError(b.name, "create", err)
+	}
+
+	fail := func(op string, err error) error {
+		remoteFile.Close()
+		b.sftpClient.Remove(tempPath) // Clean up partial file
+		return storage.WrapError(b.name, op, err)
+	}
 
-		// Ensure remote directory exists
-		remoteDir := path.Dir(remotePath)
-		if err := b.sftpClient.MkdirAll(remoteDir); err != nil {
-			return storage.WrapError(b.name, "mkdir", err)
+	if _, err := io.Copy(remoteFile, r); err != nil {
+		return fail("upload", err)
+	}
+	// Flushing to stable storage needs the fsync@openssh.com extension
+	if version, ok := b.sftpClient.HasExtension("fsync@openssh.com"); ok && version == "1" {
+		if err := remoteFile.Sync(); err != nil {
+			return fail("sync", err)
 		}
+	}
+	if err := remoteFile.Close(); err != nil {
+		b.sftpClient.Remove(tempPath)
+		return storage.WrapError(b.name, "upload", err)
+	}
 
-		// Create remote file
-		remoteFile, err := b.sftpClient.Create(remotePath)
-		if err != nil {
-			return storage.WrapError(b.name, "create", err)
+	// Plain SFTP rename refuses to overwrite, posix-rename (OpenSSH) replaces atomically
+	if err := b.sftpClient.PosixRename(tempPath, remotePath); err != nil {
+		if renameErr := b.sftpClient.Rename(tempPath, remotePath); renameErr != nil {
+			b.sftpClient.Remove(tempPath)
+			return storage.WrapError(b.name, "rename", err)
 		}
-		defer remoteFile.Close()
+	}
+
+	return nil
+}
+
+// Copy duplicates a remote file by running cp on the server.
+// Fails on SFTP-only servers without shell access; callers fall back to re-uploading.
+func (b *Backend) Copy(ctx context.Context, srcPath, destPath string) error {
+	srcRemote := path.Join(b.remotePath, srcPath)
+	destRemote := path.Join(b.remotePath, destPath)
+
+	if err := b.sftpClient.MkdirAll(path.Dir(destRemote)); err != nil {
+		return storage.WrapError(b.name, "mkdir", err)
+	}
+
+	session, err := b.sshClient.NewSession()
+	if err != nil {
+		return storage.WrapError(b.name, "copy", err)
+	}
+	defer session.Close()
 
-		// Copy data
-		if _, err := io.Copy(remoteFile, localFile); err != nil {
-			return storage.WrapError(b.name, "upload", err)
+	cmd := fmt.Sprintf("cp -- %s %s", shellQuote(srcRemote), shellQuote(destRemote))
+	if output, err := session.CombinedOutput(cmd); err != nil {
+		return storage.WrapError(b.name, "copy", fmt.Errorf("%w: %s", err, strings.TrimSpace(string(output))))
+	}
+
+	return nil
+}
+
+// Rename moves a remote file over another via SFTP.
+// Requires the posix-rename extension (OpenSSH), as plain SFTP rename refuses to overwrite.
+func (b *Backend) Rename(ctx context.Context, srcPath, destPath string) error {
+	srcRemote := path.Join(b.remotePath, srcPath)
+	destRemote := path.Join(b.remotePath, destPath)
+
+	if err := b.sftpClient.PosixRename(srcRemote, destRemote); err != nil {
+		return storage.WrapError(b.name, "rename", err)
+	}
+	return nil
+}
+
+// SetModTime sets the modification time of a remote file via SFTP
+func (b *Backend) SetModTime(ctx context.Context, filePath string, modTime time.Time) error {
+	if err := b.sftpClient.Chtimes(path.Join(b.remotePath, filePath), modTime, modTime); err != nil {
+		return storage.WrapError(b.name, "chtimes", err)
+	}
+	return nil
+}
+
+// Read opens a remote file via SFTP for reading
+func (b *Backend) Read(ctx context.Context, filePath string) (io.ReadCloser, error) {
+	remotePath := path.Join(b.remotePath, filePath)
+
+	remoteFile, err := b.sftpClient.Open(remotePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, storage.WrapError(b.name, "read", storage.ErrNotFound)
 		}
+		return nil, storage.WrapError(b.name, "read", err)
+	}
 
-		return nil
-	})
+	return remoteFile, nil
+}
+
+// ReadRange opens a byte range of a remote file via SFTP for reading
+func (b *Backend) ReadRange(ctx context.Context, filePath string, offset, length int64) (io.ReadCloser, error) {
+	reader, err := b.Read(ctx, filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	remoteFile := reader.(*sftp.File)
+	if _, err := remoteFile.Seek(offset, io.SeekStart); err != nil {
+		remoteFile.Close()
+		return nil, storage.WrapError(b.name, "read", err)
+	}
+
+	return storage.LimitReadCloser(remoteFile, length), nil
 }
 
 // Delete removes a file via SFTP
@@ -299,3 +404,8 @@ func matchesGlob(path, pattern string) bool {
 	// Exact match
 	return path == pattern
 }
+
+// shellQuote quotes a string for safe use as a single POSIX shell argument
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
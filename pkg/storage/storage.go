@@ -2,6 +2,7 @@ package storage
 
 import (
 	"context"
+	"io"
 	"time"
 )
 
@@ -18,6 +19,23 @@ type Backend interface {
 	// destPath: relative path in backend (e.g., "dbname--hourly--2024-12-19.backup")
 	Write(ctx context.Context, sourcePath string, destPath string) error
 
+	// WriteStream uploads data read from r until EOF to the backend
+	// destPath: relative path in backend
+	// Streams cannot be replayed, so there is no retry; on error any
+	// partially written object is removed
+	WriteStream(ctx context.Context, r io.Reader, destPath string) error
+
+	// Read opens a stored file for reading
+	// path: relative path in backend
+	// The caller must close the returned reader
+	Read(ctx context.Context, path string) (io.ReadCloser, error)
+
+	// ReadRange opens a byte range of a stored file for reading
+	// offset: first byte to read
+	// length: number of bytes to read (negative reads to the end of the file)
+	// Used to resume interrupted downloads
+	ReadRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, error)
+
 	// Delete removes a file from the backend
 	// path: relative path in backend
 	Delete(ctx context.Context, path string) error
@@ -38,11 +56,36 @@ type Backend interface {
 	Close() error
 }
 
+// Copier is implemented by backends that can duplicate a stored file
+// without uploading it again (e.g. S3 CopyObject, local hardlink)
+type Copier interface {
+	// Copy stores a copy of srcPath under destPath
+	// srcPath, destPath: relative paths in backend
+	Copy(ctx context.Context, srcPath string, destPath string) error
+}
+
+// Renamer is implemented by backends that can atomically move a stored file
+// over another (e.g. local and SFTP rename)
+type Renamer interface {
+	// Rename moves srcPath to destPath, replacing destPath if it exists
+	// srcPath, destPath: relative paths in backend
+	Rename(ctx context.Context, srcPath string, destPath string) error
+}
+
+// ModTimeSetter is implemented by backends that can set the modification time of a stored file.
+// Object stores set it on upload only.
+type ModTimeSetter interface {
+	// SetModTime sets the modification time of path
+	SetModTime(ctx context.Context, path string, modTime time.Time) error
+}
+
 // FileInfo represents metadata about a stored file
 type FileInfo struct {
 	Path    string    // Relative path in backend
 	Size    int64     // Size in bytes
 	ModTime time.Time // Last modification time
+
+	Manifest *Manifest // Manifest of the backup, when loaded (see AttachManifests)
 }
 
 // Config represents storage backend configuration
@@ -59,6 +102,7 @@ type Result struct {
 	BackendName string
 	BackendType string
 	Success     bool
+	Copied      bool // True if stored via server-side copy instead of an upload
 	Error       error
 	Duration    time.Duration
 }
@@ -0,0 +1,424 @@
+package verify
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/williamokano/pg_backuper/pkg/backup"
+	"github.com/williamokano/pg_backuper/pkg/config"
+	"github.com/williamokano/pg_backuper/pkg/dumpformat"
+	"github.com/williamokano/pg_backuper/pkg/encryption"
+	"github.com/williamokano/pg_backuper/pkg/rotation"
+	"github.com/williamokano/pg_backuper/pkg/storage"
+)
+
+// Status of a verified object
+const (
+	StatusOK        = "ok"
+	StatusCorrupt   = "corrupt"   // Checksum mismatch, failed decryption or unreadable archive
+	StatusTruncated = "truncated" // Shorter than recorded in its manifest
+	StatusMissing   = "missing"   // Manifest left without its backup, or the backup cannot be found
+	StatusError     = "error"     // Could not be checked (download failed, key or pg_restore unavailable)
+)
+
+// Checksum outcome of a verified object
+const (
+	ChecksumMatch    = "match"
+	ChecksumMismatch = "mismatch"
+	ChecksumNone     = "none" // No manifest to compare with
+)
+
+// Options defines which stored backups to verify
+type Options struct {
+	Destination string // Only this storage destination, optional (default: all enabled destinations)
+	Database    string // Only backups of this database or server (host-port), optional
+	Sample      int    // Verify this many randomly chosen backups per destination, optional (default: all)
+}
+
+// Object is the outcome of verifying one stored backup
+type Object struct {
+	Destination string `json:"destination"`
+	Path        string `json:"path"`
+	Source      string `json:"source"`
+	Kind        string `json:"kind,omitempty"`
+	Tier        string `json:"tier"`
+	Size        int64  `json:"size_bytes"`
+	Status      string `json:"status"`
+	Checksum    string `json:"checksum,omitempty"`
+	TOCEntries  int    `json:"toc_entries,omitempty"` // Entries listed by pg_restore --list, for pg_dump archives
+	Error       string `json:"error,omitempty"`
+}
+
+// Result represents the outcome of a verify run
+type Result struct {
+	Objects  []Object       // Every verified object, per destination in name order
+	Counts   map[string]int // Objects per status
+	Bytes    int64          // Bytes downloaded
+	Success  bool           // All objects are intact
+	Error    error
+	Duration time.Duration
+}
+
+// verifier holds the steps that depend on external tools, so tests can replace them
+type verifier struct {
+	keyring *encryption.Keyring
+	tempDir string
+	// listTOC returns the number of entries in the table of contents of a pg_dump archive
+	listTOC func(ctx context.Context, path string) (int, error)
+}
+
+// Verify downloads the stored backups of the selected destinations and checks that they are
+// intact: their size and SHA-256 against their manifest, that encrypted backups decrypt
+// completely, and that pg_dump archives have a readable table of contents. Manifests left
+// without their backup are reported as missing. Archived WAL is not verified.
+func Verify(ctx context.Context, cfg *config.Config, opts Options, logger zerolog.Logger) Result {
+	v := &verifier{listTOC: listTOC}
+	return v.run(ctx, cfg, opts, logger)
+}
+
+func (v *verifier) run(ctx context.Context, cfg *config.Config, opts Options, logger zerolog.Logger) Result {
+	start := time.Now()
+	result := Result{Counts: make(map[string]int)}
+
+	fail := func(err error) Result {
+		result.Error = err
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	if opts.Sample < 0 {
+		return fail(errors.New("sample must not be negative"))
+	}
+
+	keyring, err := backup.LoadKeyring(cfg)
+	if err != nil {
+		return fail(err)
+	}
+	v.keyring = keyring
+
+	if err := os.MkdirAll(cfg.GetTempDir(), 0755); err != nil {
+		return fail(fmt.Errorf("failed to create temp directory: %w", err))
+	}
+	v.tempDir, err = os.MkdirTemp(cfg.GetTempDir(), "verify-")
+	if err != nil {
+		return fail(fmt.Errorf("failed to create temp directory: %w", err))
+	}
+	defer os.RemoveAll(v.tempDir)
+
+	destinations := backup.EnabledDestinations(cfg)
+	if opts.Destination != "" {
+		destinations = []string{opts.Destination}
+	}
+	if len(destinations) == 0 {
+		return fail(errors.New("no enabled storage destinations configured"))
+	}
+
+	for _, name := range destinations {
+		if err := ctx.Err(); err != nil {
+			return fail(err)
+		}
+
+		backend, err := backup.InitializeDestination(ctx, cfg, name)
+		if err != nil {
+			return fail(fmt.Errorf("failed to initialize storage destination %s: %w", name, err))
+		}
+		err = v.verifyDestination(ctx, backend, opts, &result, logger.With().Str("destination", name).Logger())
+		backend.Close()
+		if err != nil {
+			return fail(fmt.Errorf("failed to verify %s: %w", name, err))
+		}
+	}
+
+	result.Duration = time.Since(start)
+	if bad := len(result.Objects) - result.Counts[StatusOK]; bad > 0 {
+		result.Error = fmt.Errorf("%d of %d objects failed verification", bad, len(result.Objects))
+		return result
+	}
+	result.Success = true
+	return result
+}
+
+// verifyDestination verifies the selected backups of one backend.
+// Returns an error only if the backend cannot be listed or the run was cancelled.
+func (v *verifier) verifyDestination(ctx context.Context, backend storage.Backend, opts Options, result *Result, logger zerolog.Logger) error {
+	files, err := backend.List(ctx, opts.Database+"*")
+	if err != nil {
+		return err
+	}
+
+	stored := make(map[string]bool)
+	var backups []storage.FileInfo
+	var manifests []string
+	for _, file := range files {
+		stored[file.Path] = true
+		if strings.HasSuffix(file.Path, storage.ManifestSuffix) {
+			manifests = append(manifests, strings.TrimSuffix(file.Path, storage.ManifestSuffix))
+			continue
+		}
+		if _, ok := selectBackup(file.Path, opts.Database); ok {
+			backups = append(backups, file)
+		}
+	}
+
+	var objects []Object
+	for _, path := range manifests {
+		components, ok := selectBackup(path, opts.Database)
+		if !ok || stored[path] {
+			continue
+		}
+		object := newObject(backend.Name(), path, components)
+		object.Status = StatusMissing
+		object.Error = "manifest exists but the backup does not"
+		objects = append(objects, object)
+	}
+
+	if opts.Sample > 0 && opts.Sample < len(backups) {
+		rand.Shuffle(len(backups), func(i, j int) {
+			backups[i], backups[j] = backups[j], backups[i]
+		})
+		backups = backups[:opts.Sample]
+	}
+
+	invalid, err := storage.AttachManifests(ctx, backend, backups, opts.Database+"*")
+	if err != nil {
+		return err
+	}
+
+	for i, file := range backups {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		fileLog := logger.With().
+			Str("file", file.Path).
+			Str("progress", fmt.Sprintf("%d/%d", i+1, len(backups))).
+			Logger()
+
+		components, _ := selectBackup(file.Path, opts.Database)
+		object := newObject(backend.Name(), file.Path, components)
+		object.Size = file.Size
+		if err, ok := invalid[file.Path]; ok {
+			// The backup may still be fine, but nothing vouches for it
+			object.Status = StatusCorrupt
+			object.Error = err.Error()
+		} else {
+			result.Bytes += v.verifyObject(ctx, backend, file, &object)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if object.Status == StatusOK {
+			fileLog.Info().
+				Str("checksum", object.Checksum).
+				Int("toc_entries", object.TOCEntries).
+				Msg("backup verified")
+		} else {
+			fileLog.Error().
+				Str("status", object.Status).
+				Str("error", object.Error).
+				Msg("backup failed verification")
+		}
+		objects = append(objects, object)
+	}
+
+	sort.SliceStable(objects, func(i, j int) bool {
+		return objects[i].Path < objects[j].Path
+	})
+	for _, object := range objects {
+		result.Counts[object.Status]++
+	}
+	result.Objects = append(result.Objects, objects...)
+	return nil
+}
+
+// verifyObject downloads one backup and checks it, filling the status of object.
+// Returns the bytes downloaded.
+func (v *verifier) verifyObject(ctx context.Context, backend storage.Backend, file storage.FileInfo, object *Object) int64 {
+	setStatus := func(status string, err error) {
+		object.Status = status
+		if err != nil {
+			object.Error = err.Error()
+		}
+	}
+
+	localPath := filepath.Join(v.tempDir, filepath.Base(file.Path))
+	defer os.Remove(localPath)
+
+	if err := storage.Download(ctx, backend, file.Path, localPath, storage.DefaultRetryConfig()); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			setStatus(StatusMissing, err)
+		} else {
+			setStatus(StatusError, fmt.Errorf("download failed: %w", err))
+		}
+		return 0
+	}
+
+	sum, size, err := hashFile(localPath)
+	if err != nil {
+		setStatus(StatusError, err)
+		return 0
+	}
+
+	object.Checksum = ChecksumNone
+	if manifest := file.Manifest; manifest != nil {
+		if size < manifest.Size {
+			setStatus(StatusTruncated, fmt.Errorf("stored %d bytes, manifest records %d", size, manifest.Size))
+			return size
+		}
+		if sum != manifest.SHA256 || size != manifest.Size {
+			object.Checksum = ChecksumMismatch
+			setStatus(StatusCorrupt, fmt.Errorf("sha256 %s, manifest records %s (%d bytes)", sum, manifest.SHA256, manifest.Size))
+			return size
+		}
+		object.Checksum = ChecksumMatch
+	}
+
+	archivePath, err := v.decrypt(localPath)
+	if err != nil {
+		if errors.Is(err, encryption.ErrNoKey) {
+			setStatus(StatusError, err)
+		} else {
+			setStatus(StatusCorrupt, err)
+		}
+		return size
+	}
+	if archivePath != localPath {
+		defer os.Remove(archivePath)
+	}
+
+	// Globals and base backups are not pg_dump archives
+	if object.Kind == "" {
+		entries, err := v.checkArchive(ctx, archivePath)
+		if err != nil {
+			var notFound *exec.Error
+			if errors.As(err, &notFound) {
+				setStatus(StatusError, err)
+			} else {
+				setStatus(StatusCorrupt, err)
+			}
+			return size
+		}
+		object.TOCEntries = entries
+	}
+
+	setStatus(StatusOK, nil)
+	return size
+}
+
+// decrypt returns the path of the plaintext of a downloaded backup, decrypting it next to
+// path when it is encrypted
+func (v *verifier) decrypt(path string) (string, error) {
+	encrypted, err := encryption.IsEncryptedFile(path)
+	if err != nil || !encrypted {
+		return path, err
+	}
+
+	plainPath := path + ".dec"
+	if err := v.keyring.DecryptFile(path, plainPath); err != nil {
+		return "", fmt.Errorf("failed to decrypt: %w", err)
+	}
+	return plainPath, nil
+}
+
+// checkArchive lists the table of contents of a pg_dump archive and returns its entry count.
+// Plain-format dumps have none and are accepted as they are.
+func (v *verifier) checkArchive(ctx context.Context, path string) (int, error) {
+	format, err := dumpformat.Detect(path)
+	if err != nil {
+		return 0, err
+	}
+
+	switch format {
+	case dumpformat.Plain:
+		return 0, nil
+	case dumpformat.Directory:
+		dir := path + ".dir"
+		os.RemoveAll(dir)
+		defer os.RemoveAll(dir)
+		if err := dumpformat.UnpackDirectory(path, dir); err != nil {
+			return 0, fmt.Errorf("failed to unpack directory dump: %w", err)
+		}
+		path = dir
+	}
+
+	return v.listTOC(ctx, path)
+}
+
+// listTOC runs pg_restore --list on an archive and counts the entries of its table of contents
+func listTOC(ctx context.Context, path string) (int, error) {
+	cmd := exec.CommandContext(ctx, "pg_restore", "--list", path)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return 0, fmt.Errorf("pg_restore --list failed: %w: %s", err, msg)
+		}
+		return 0, fmt.Errorf("pg_restore --list failed: %w", err)
+	}
+
+	// Lines starting with ";" are comments
+	entries := 0
+	scanner := bufio.NewScanner(&stdout)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, ";") {
+			entries++
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// hashFile returns the hex SHA-256 and size of a local file
+func hashFile(path string) (string, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), size, nil
+}
+
+// selectBackup parses a stored path and reports whether it is a backup of database (any if
+// empty). Archived WAL and sidecars are not selected.
+func selectBackup(path, database string) (rotation.BackupFilenameComponents, bool) {
+	if _, wal := rotation.ParseWALFilename(filepath.Base(path)); wal {
+		return rotation.BackupFilenameComponents{}, false
+	}
+	components, err := rotation.ParseBackupFilename(filepath.Base(path))
+	if err != nil {
+		return components, false
+	}
+	return components, database == "" || components.DatabaseName == database
+}
+
+// newObject returns the object of a stored backup, without a status
+func newObject(destination, path string, components rotation.BackupFilenameComponents) Object {
+	return Object{
+		Destination: destination,
+		Path:        path,
+		Source:      components.DatabaseName,
+		Kind:        components.Kind,
+		Tier:        components.Tier,
+	}
+}
@@ -0,0 +1,189 @@
+package verify
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/williamokano/pg_backuper/pkg/config"
+	"github.com/williamokano/pg_backuper/pkg/encryption"
+	"github.com/williamokano/pg_backuper/pkg/rotation"
+	"github.com/williamokano/pg_backuper/pkg/storage"
+)
+
+// verifyConfig returns a config with one local destination holding backups, with key "k1"
+func verifyConfig(t *testing.T) (*config.Config, string) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(t.TempDir(), "k1.key")
+	require.NoError(t, os.WriteFile(keyFile, bytes.Repeat([]byte{7}, 32), 0600))
+
+	cfg := &config.Config{
+		Storage: config.StorageConfig{
+			TempDir: t.TempDir(),
+			Destinations: []config.StorageDestination{
+				{Name: "primary", Type: "local", Enabled: true, Options: map[string]interface{}{"path": dir}},
+			},
+		},
+		Encryption: config.EncryptionConfig{Keys: []config.EncryptionKey{{ID: "k1", KeyFile: keyFile}}},
+	}
+	return cfg, dir
+}
+
+// storeBackup writes content as a daily backup of naming, with a manifest describing it
+func storeBackup(t *testing.T, dir string, naming rotation.Naming, day int, content []byte, withManifest bool) string {
+	name := naming.Filename("daily", time.Date(2025, 3, day, 2, 0, 0, 0, time.UTC))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), content, 0644))
+	if withManifest {
+		sum := sha256.Sum256(content)
+		data, err := json.Marshal(storage.Manifest{Database: naming.Name, Tier: "daily", Size: int64(len(content)), SHA256: hex.EncodeToString(sum[:])})
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, storage.ManifestPath(name)), data, 0644))
+	}
+	return name
+}
+
+// fakeTOC stands in for pg_restore --list, rejecting archives that contain "broken", and
+// records the checked paths
+func fakeTOC(checked *[]string) func(ctx context.Context, path string) (int, error) {
+	return func(ctx context.Context, path string) (int, error) {
+		*checked = append(*checked, filepath.Base(path))
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return 0, err
+		}
+		if bytes.Contains(data, []byte("broken")) {
+			return 0, errors.New("pg_restore: error: input file does not appear to be a valid archive")
+		}
+		return 12, nil
+	}
+}
+
+// objectsByPath indexes the verified objects by backup path
+func objectsByPath(result Result) map[string]Object {
+	objects := make(map[string]Object)
+	for _, object := range result.Objects {
+		objects[object.Path] = object
+	}
+	return objects
+}
+
+func TestVerify(t *testing.T) {
+	ctx := context.Background()
+	app := rotation.DatabaseNaming("app")
+	dump := append([]byte("PGDMP"), bytes.Repeat([]byte{1}, 4096)...)
+
+	t.Run("reports_each_problem", func(t *testing.T) {
+		cfg, dir := verifyConfig(t)
+		good := storeBackup(t, dir, app, 1, dump, true)
+		unverified := storeBackup(t, dir, app, 2, dump, false)
+
+		corrupt := storeBackup(t, dir, app, 3, dump, true)
+		flipped := bytes.Clone(dump)
+		flipped[100] ^= 1
+		require.NoError(t, os.WriteFile(filepath.Join(dir, corrupt), flipped, 0644))
+
+		truncated := storeBackup(t, dir, app, 4, dump, true)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, truncated), dump[:1000], 0644))
+
+		missing := storeBackup(t, dir, app, 5, dump, true)
+		require.NoError(t, os.Remove(filepath.Join(dir, missing)))
+
+		unreadable := storeBackup(t, dir, app, 6, []byte("PGDMP broken"), true)
+
+		var checked []string
+		v := &verifier{listTOC: fakeTOC(&checked)}
+		result := v.run(ctx, cfg, Options{}, zerolog.Nop())
+
+		assert.False(t, result.Success)
+		assert.ErrorContains(t, result.Error, "4 of 6 objects failed verification")
+		require.Len(t, result.Objects, 6)
+
+		objects := objectsByPath(result)
+		assert.Equal(t, StatusOK, objects[good].Status)
+		assert.Equal(t, ChecksumMatch, objects[good].Checksum)
+		assert.Equal(t, 12, objects[good].TOCEntries)
+		assert.Equal(t, StatusOK, objects[unverified].Status)
+		assert.Equal(t, ChecksumNone, objects[unverified].Checksum)
+		assert.Equal(t, StatusCorrupt, objects[corrupt].Status)
+		assert.Equal(t, ChecksumMismatch, objects[corrupt].Checksum)
+		assert.Equal(t, StatusTruncated, objects[truncated].Status)
+		assert.Equal(t, StatusMissing, objects[missing].Status)
+		assert.Equal(t, StatusCorrupt, objects[unreadable].Status)
+		assert.Contains(t, objects[unreadable].Error, "valid archive")
+
+		assert.Equal(t, map[string]int{StatusOK: 2, StatusCorrupt: 2, StatusTruncated: 1, StatusMissing: 1}, result.Counts)
+		assert.ElementsMatch(t, []string{good, unverified, unreadable}, checked)
+
+		entries, err := os.ReadDir(cfg.GetTempDir())
+		require.NoError(t, err)
+		assert.Empty(t, entries, "downloads are removed")
+	})
+
+	t.Run("decrypts_before_listing", func(t *testing.T) {
+		cfg, dir := verifyConfig(t)
+		keyring, err := encryption.LoadKeyring(cfg.Encryption)
+		require.NoError(t, err)
+		sealed, err := keyring.EncryptWith(bytes.NewReader(dump), "k1")
+		require.NoError(t, err)
+		encrypted, err := io.ReadAll(sealed)
+		require.NoError(t, err)
+
+		intact := storeBackup(t, dir, app, 1, encrypted, true)
+		damaged := storeBackup(t, dir, app, 2, encrypted[:len(encrypted)-10], false)
+
+		var checked []string
+		v := &verifier{listTOC: fakeTOC(&checked)}
+		result := v.run(ctx, cfg, Options{Database: "app"}, zerolog.Nop())
+
+		objects := objectsByPath(result)
+		assert.Equal(t, StatusOK, objects[intact].Status)
+		assert.Equal(t, ChecksumMatch, objects[intact].Checksum)
+		assert.Equal(t, StatusCorrupt, objects[damaged].Status)
+		assert.Contains(t, objects[damaged].Error, "decrypt")
+		assert.Len(t, checked, 1)
+	})
+
+	t.Run("server_backups_skip_toc", func(t *testing.T) {
+		cfg, dir := verifyConfig(t)
+		globals := storeBackup(t, dir, rotation.GlobalsNaming("db.internal", 5432), 1, []byte("CREATE ROLE app;"), true)
+		storeBackup(t, dir, app, 1, dump, true)
+
+		var checked []string
+		v := &verifier{listTOC: fakeTOC(&checked)}
+		result := v.run(ctx, cfg, Options{Database: "db.internal-5432"}, zerolog.Nop())
+
+		require.NoError(t, result.Error)
+		assert.True(t, result.Success)
+		require.Len(t, result.Objects, 1)
+		assert.Equal(t, globals, result.Objects[0].Path)
+		assert.Equal(t, rotation.KindGlobals, result.Objects[0].Kind)
+		assert.Empty(t, checked)
+	})
+
+	t.Run("sample", func(t *testing.T) {
+		cfg, dir := verifyConfig(t)
+		for day := 1; day <= 5; day++ {
+			storeBackup(t, dir, app, day, dump, true)
+		}
+
+		var checked []string
+		v := &verifier{listTOC: fakeTOC(&checked)}
+		result := v.run(ctx, cfg, Options{Sample: 2}, zerolog.Nop())
+
+		assert.True(t, result.Success)
+		assert.Len(t, result.Objects, 2)
+		assert.Len(t, checked, 2)
+		assert.Equal(t, int64(2*len(dump)), result.Bytes)
+	})
+}
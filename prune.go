@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/rs/zerolog"
+	"github.com/williamokano/pg_backuper/pkg/config"
+	"github.com/williamokano/pg_backuper/pkg/logger"
+	"github.com/williamokano/pg_backuper/pkg/prune"
+	"github.com/williamokano/pg_backuper/pkg/rotation"
+)
+
+// runPrune implements "pg_backuper prune"
+func runPrune(args []string) int {
+	flags := flag.NewFlagSet("prune", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: pg_backuper prune [options]\n\n")
+		fmt.Fprintf(os.Stderr, "Applies retention to the stored backups without running a backup,\n")
+		fmt.Fprintf(os.Stderr, "printing the plan of kept and deleted backups per destination and tier.\n\n")
+		fmt.Fprintf(os.Stderr, "Example:\n")
+		fmt.Fprintf(os.Stderr, "  pg_backuper prune --database myapp --destination s3_offsite --dry-run\n\n")
+		flags.PrintDefaults()
+	}
+
+	configFile := flags.String("config", defaultConfigFile(), "path to config file")
+	var opts prune.Options
+	flags.StringVar(&opts.Database, "database", "", "only prune backups of this database (or host-port for server backups)")
+	flags.StringVar(&opts.Destination, "destination", "", "only prune this storage destination (default: all enabled destinations)")
+	flags.BoolVar(&opts.DryRun, "dry-run", false, "only print the plan, delete nothing")
+	output := flags.String("output", "table", "plan output format: table or json")
+	allowMassDelete := flags.Bool("allow-mass-delete", false, "lift the rotation deletion limits (keep_last still applies)")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *output != "table" && *output != "json" {
+		flags.Usage()
+		return 2
+	}
+
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	cfg.AllowMassDelete = *allowMassDelete
+
+	// The plan goes to stdout, logs to stderr
+	log := stderrLogger(cfg)
+
+	// Stop deleting on Ctrl+C / SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	result := prune.Prune(ctx, cfg, opts, log)
+
+	if *output == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(result.Plans); err != nil {
+			log.Error().Err(err).Msg("failed to write plan")
+			return 1
+		}
+	} else {
+		printPlans(os.Stdout, result.Plans)
+	}
+
+	event := log.Info()
+	msg := "prune completed"
+	if !result.Success {
+		event = log.Error().Err(result.Error)
+		msg = "prune failed"
+	}
+	event.
+		Bool("dry_run", opts.DryRun).
+		Int("planned", result.Planned).
+		Int64("planned_bytes", result.PlannedBytes).
+		Int("deleted", result.Deleted).
+		Int64("deleted_bytes", result.DeletedBytes).
+		Int("blocked_deletions", len(result.Blocked)).
+		Dur("duration", result.Duration).
+		Msg(msg)
+
+	if !result.Success {
+		return 1
+	}
+	return 0
+}
+
+// stderrLogger returns the global logger writing to stderr in the configured format
+func stderrLogger(cfg *config.Config) zerolog.Logger {
+	var out io.Writer = os.Stderr
+	if cfg.GetLogFormat() == "console" {
+		out = zerolog.ConsoleWriter{Out: os.Stderr}
+	}
+	return logger.Get().Output(out)
+}
+
+// printPlans writes retention plans as a table of backups followed by per-tier totals
+func printPlans(w io.Writer, plans []rotation.Plan) {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "DESTINATION\tSOURCE\tTIER\tBACKUP\tSIZE\tACTION\tREASON")
+	for _, plan := range plans {
+		for _, tier := range plan.Tiers {
+			for _, file := range tier.Files {
+				action := file.Action
+				if file.Blocked {
+					action = "keep (blocked)"
+				}
+				fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+					plan.Backend, planSource(plan), tier.Tier, file.Path, formatBytes(file.Size), action, file.Reason)
+			}
+		}
+	}
+	table.Flush()
+
+	fmt.Fprintln(w)
+	totals := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(totals, "DESTINATION\tSOURCE\tTIER\tKEEP\tKEEP SIZE\tDELETE\tDELETE SIZE")
+	for _, plan := range plans {
+		for _, tier := range plan.Tiers {
+			keep, remove := 0, 0
+			for _, file := range tier.Files {
+				if file.Action == rotation.ActionDelete {
+					remove++
+				} else {
+					keep++
+				}
+			}
+			fmt.Fprintf(totals, "%s\t%s\t%s\t%d\t%s\t%d\t%s\n",
+				plan.Backend, planSource(plan), tier.Tier, keep, formatBytes(tier.KeepBytes), remove, formatBytes(tier.DeleteBytes))
+		}
+	}
+	totals.Flush()
+}
+
+// planSource returns the source of a plan as shown in the table (e.g. "db-5432/globals")
+func planSource(plan rotation.Plan) string {
+	if plan.Kind == "" {
+		return plan.Source
+	}
+	return plan.Source + "/" + plan.Kind
+}
+
+// formatBytes formats a size with a binary unit (e.g. "1.5 GiB")
+func formatBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
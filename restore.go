@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/williamokano/pg_backuper/pkg/logger"
+	"github.com/williamokano/pg_backuper/pkg/restore"
+)
+
+// runRestore implements "pg_backuper restore"
+func runRestore(args []string) int {
+	flags := flag.NewFlagSet("restore", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: pg_backuper restore --database <name> --target-db <name> [options]\n\n")
+		fmt.Fprintf(os.Stderr, "Fetches a backup from a storage destination and restores it with pg_restore.\n\n")
+		fmt.Fprintf(os.Stderr, "Example:\n")
+		fmt.Fprintf(os.Stderr, "  pg_backuper restore --database myapp --destination s3_offsite --backup latest --tier daily \\\n")
+		fmt.Fprintf(os.Stderr, "    --target-host restore.internal --target-db myapp_restored --create\n\n")
+		flags.PrintDefaults()
+	}
+
+	configFile := flags.String("config", defaultConfigFile(), "path to config file")
+	var opts restore.Options
+	flags.StringVar(&opts.Database, "database", "", "source database name (as used in backup filenames)")
+	flags.StringVar(&opts.Destination, "destination", "", "storage destination to restore from (default: first destination of the database)")
+	flags.StringVar(&opts.Backup, "backup", restore.SelectorLatest, "backup filename or \"latest\"")
+	flags.StringVar(&opts.Tier, "tier", "", "restrict \"latest\" to a retention tier (e.g. daily)")
+	flags.StringVar(&opts.TargetHost, "target-host", "", "host to restore into (default: source database host)")
+	flags.IntVar(&opts.TargetPort, "target-port", 0, "port to restore into (default: source database port)")
+	flags.StringVar(&opts.TargetUser, "target-user", "", "user to restore as (default: source database user)")
+	flags.StringVar(&opts.TargetDB, "target-db", "", "database to restore into (required)")
+	flags.BoolVar(&opts.Clean, "clean", false, "drop database objects before recreating them")
+	flags.BoolVar(&opts.Create, "create", false, "create the target database before restoring")
+	flags.BoolVar(&opts.NoOwner, "no-owner", true, "do not restore object ownership")
+	flags.IntVar(&opts.Jobs, "jobs", 1, "number of parallel pg_restore jobs")
+	flags.BoolVar(&opts.KeepDownload, "keep-download", false, "keep the downloaded archive in the temp directory")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	log := logger.Get()
+
+	// Cancel pg_restore on Ctrl+C / SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	result := restore.Restore(ctx, cfg, opts, *log)
+	if !result.Success {
+		log.Error().
+			Err(result.Error).
+			Str("database", result.Database).
+			Str("backup", result.Backup).
+			Msg("restore failed")
+		return 1
+	}
+
+	log.Info().
+		Str("database", result.Database).
+		Str("backup", result.Backup).
+		Str("target_db", result.TargetDB).
+		Int64("size_bytes", result.Size).
+		Dur("duration", result.Duration).
+		Msg("restore completed")
+
+	return 0
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/williamokano/pg_backuper/pkg/backup"
+	"github.com/williamokano/pg_backuper/pkg/restoretest"
+)
+
+// restoreTestReport is one entry of the JSON output of "pg_backuper restore-test", for monitoring
+type restoreTestReport struct {
+	Database                string               `json:"database"`
+	Destination             string               `json:"destination"`
+	Backup                  string               `json:"backup,omitempty"`
+	ScratchDB               string               `json:"scratch_db,omitempty"`
+	Size                    int64                `json:"size_bytes"`
+	Success                 bool                 `json:"success"`
+	Error                   string               `json:"error,omitempty"`
+	Dropped                 bool                 `json:"dropped"`
+	Checks                  []restoreCheckReport `json:"checks"`
+	DownloadDurationSeconds float64              `json:"download_duration_seconds"`
+	RestoreDurationSeconds  float64              `json:"restore_duration_seconds"`
+	ChecksDurationSeconds   float64              `json:"checks_duration_seconds"`
+	DurationSeconds         float64              `json:"duration_seconds"`
+}
+
+// restoreCheckReport is the JSON output of one sanity check
+type restoreCheckReport struct {
+	Name            string  `json:"name"`
+	Value           string  `json:"value"`
+	Passed          bool    `json:"passed"`
+	Error           string  `json:"error,omitempty"`
+	DurationSeconds float64 `json:"duration_seconds"`
+}
+
+// runRestoreTest implements "pg_backuper restore-test"
+func runRestoreTest(args []string) int {
+	flags := flag.NewFlagSet("restore-test", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: pg_backuper restore-test [options]\n\n")
+		fmt.Fprintf(os.Stderr, "Restores the newest backup of each database with restore tests enabled into a\n")
+		fmt.Fprintf(os.Stderr, "scratch database on the restore_test server, runs its sanity checks and drops it.\n")
+		fmt.Fprintf(os.Stderr, "Exits with status 1 if any restore or check fails.\n\n")
+		fmt.Fprintf(os.Stderr, "Example:\n")
+		fmt.Fprintf(os.Stderr, "  pg_backuper restore-test --database myapp --destination s3_offsite --output json\n\n")
+		flags.PrintDefaults()
+	}
+
+	configFile := flags.String("config", defaultConfigFile(), "path to config file")
+	var opts backup.RestoreTestOptions
+	flags.StringVar(&opts.Database, "database", "", "only this database, even if restore tests are not enabled for it (default: all enabled)")
+	flags.StringVar(&opts.Destination, "destination", "", "storage destination to fetch backups from (default: each database's first destination)")
+	output := flags.String("output", "table", "report format: table or json")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *output != "table" && *output != "json" {
+		flags.Usage()
+		return 2
+	}
+
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	// The report goes to stdout, logs to stderr
+	log := stderrLogger(cfg)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	results, err := backup.TestRestores(ctx, cfg, opts, log)
+	if err != nil && len(results) == 0 {
+		log.Error().Err(err).Msg("restore test failed")
+		return 1
+	}
+
+	if *output == "json" {
+		reports := make([]restoreTestReport, 0, len(results))
+		for _, result := range results {
+			reports = append(reports, newRestoreTestReport(result))
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(reports); err != nil {
+			log.Error().Err(err).Msg("failed to write restore test report")
+			return 1
+		}
+	} else {
+		printRestoreTests(os.Stdout, results)
+	}
+
+	passed, failed := 0, 0
+	for _, result := range results {
+		if result.Success {
+			passed++
+		} else {
+			failed++
+		}
+	}
+
+	event := log.Info()
+	msg := "restore tests completed"
+	if failed > 0 || err != nil {
+		event = log.Error().Err(err)
+		msg = "restore tests failed"
+	}
+	event.
+		Int("passed", passed).
+		Int("failed", failed).
+		Msg(msg)
+
+	if failed > 0 || err != nil {
+		return 1
+	}
+	return 0
+}
+
+// newRestoreTestReport converts a restore test result to its JSON report
+func newRestoreTestReport(result restoretest.Result) restoreTestReport {
+	report := restoreTestReport{
+		Database:                result.Database,
+		Destination:             result.Destination,
+		Backup:                  result.Backup,
+		ScratchDB:               result.ScratchDB,
+		Size:                    result.Size,
+		Success:                 result.Success,
+		Dropped:                 result.Dropped,
+		Checks:                  make([]restoreCheckReport, 0, len(result.Checks)),
+		DownloadDurationSeconds: result.DownloadDuration.Seconds(),
+		RestoreDurationSeconds:  result.RestoreDuration.Seconds(),
+		ChecksDurationSeconds:   result.ChecksDuration.Seconds(),
+		DurationSeconds:         result.Duration.Seconds(),
+	}
+	if result.Error != nil {
+		report.Error = result.Error.Error()
+	}
+	for _, check := range result.Checks {
+		checkReport := restoreCheckReport{
+			Name:            check.Name,
+			Value:           check.Value,
+			Passed:          check.Passed,
+			DurationSeconds: check.Duration.Seconds(),
+		}
+		if check.Error != nil {
+			checkReport.Error = check.Error.Error()
+		}
+		report.Checks = append(report.Checks, checkReport)
+	}
+	return report
+}
+
+// printRestoreTests writes one row per tested database followed by its failed checks
+func printRestoreTests(w io.Writer, results []restoretest.Result) {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "DATABASE\tDESTINATION\tBACKUP\tSIZE\tRESTORE\tCHECKS\tRESULT\tERROR")
+	for _, result := range results {
+		backupName, status, errText := "-", "passed", "-"
+		if result.Backup != "" {
+			backupName = result.Backup
+		}
+		if !result.Success {
+			status = "failed"
+		}
+		if result.Error != nil {
+			errText = result.Error.Error()
+		}
+		passed := 0
+		for _, check := range result.Checks {
+			if check.Passed {
+				passed++
+			}
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\t%d/%d\t%s\t%s\n",
+			result.Database, result.Destination, backupName, formatBytes(result.Size),
+			result.RestoreDuration.Round(time.Millisecond), passed, len(result.Checks), status, errText)
+		for _, check := range result.Checks {
+			if !check.Passed {
+				fmt.Fprintf(table, "\t\t  check %s\t\t\t\tfailed\t%v\n", check.Name, check.Error)
+			}
+		}
+	}
+	table.Flush()
+}
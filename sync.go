@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/williamokano/pg_backuper/pkg/logger"
+	"github.com/williamokano/pg_backuper/pkg/replication"
+)
+
+// runSync implements "pg_backuper sync"
+func runSync(args []string) int {
+	flags := flag.NewFlagSet("sync", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: pg_backuper sync --from <destination> --to <destination> [options]\n\n")
+		fmt.Fprintf(os.Stderr, "Copies the backups missing on one storage destination from another,\n")
+		fmt.Fprintf(os.Stderr, "then applies retention on the target.\n\n")
+		fmt.Fprintf(os.Stderr, "Example:\n")
+		fmt.Fprintf(os.Stderr, "  pg_backuper sync --from local_primary --to s3_offsite --database myapp --verify checksum\n\n")
+		flags.PrintDefaults()
+	}
+
+	configFile := flags.String("config", defaultConfigFile(), "path to config file")
+	var opts replication.Options
+	flags.StringVar(&opts.From, "from", "", "storage destination to copy from (required)")
+	flags.StringVar(&opts.To, "to", "", "storage destination to copy to (required)")
+	flags.StringVar(&opts.Database, "database", "", "only copy backups of this database (or host-port for server backups)")
+	flags.StringVar(&opts.Tier, "tier", "", "only copy backups of this tier (e.g. daily)")
+	flags.StringVar(&opts.Verify, "verify", replication.VerifyNone, "verify copies: none, size or checksum")
+	flags.BoolVar(&opts.DryRun, "dry-run", false, "only list what would be copied")
+	allowMassDelete := flags.Bool("allow-mass-delete", false, "lift the rotation deletion limits on the target (keep_last still applies)")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if opts.From == "" || opts.To == "" {
+		flags.Usage()
+		return 2
+	}
+
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	cfg.AllowMassDelete = *allowMassDelete
+	log := logger.Get()
+
+	// Cancel the copy in progress on Ctrl+C / SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	result := replication.Sync(ctx, cfg, opts, *log)
+
+	event := log.Info()
+	msg := "sync completed"
+	if !result.Success {
+		event = log.Error().Err(result.Error).Strs("failed_files", result.Failed)
+		msg = "sync failed"
+	}
+	event.
+		Str("from", result.From).
+		Str("to", result.To).
+		Bool("dry_run", opts.DryRun).
+		Int("copied", len(result.Copied)).
+		Int("present", result.Present).
+		Int("failed", len(result.Failed)).
+		Int64("bytes", result.Bytes).
+		Int("blocked_deletions", len(result.Blocked)).
+		Dur("duration", result.Duration).
+		Msg(msg)
+
+	if !result.Success {
+		return 1
+	}
+	return 0
+}
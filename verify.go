@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/williamokano/pg_backuper/pkg/verify"
+)
+
+// verifyReport is the JSON output of "pg_backuper verify", for monitoring
+type verifyReport struct {
+	Success         bool            `json:"success"`
+	Error           string          `json:"error,omitempty"`
+	Counts          map[string]int  `json:"counts"`
+	Bytes           int64           `json:"bytes"`
+	DurationSeconds float64         `json:"duration_seconds"`
+	Objects         []verify.Object `json:"objects"`
+}
+
+// runVerify implements "pg_backuper verify"
+func runVerify(args []string) int {
+	flags := flag.NewFlagSet("verify", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: pg_backuper verify [options]\n\n")
+		fmt.Fprintf(os.Stderr, "Downloads stored backups and checks their checksum against their manifest,\n")
+		fmt.Fprintf(os.Stderr, "that they decrypt and that pg_restore can read their table of contents.\n")
+		fmt.Fprintf(os.Stderr, "Exits with status 1 if any backup is corrupt, truncated, missing or cannot be checked.\n\n")
+		fmt.Fprintf(os.Stderr, "Example:\n")
+		fmt.Fprintf(os.Stderr, "  pg_backuper verify --destination b2_archive --sample 5 --output json\n\n")
+		flags.PrintDefaults()
+	}
+
+	configFile := flags.String("config", defaultConfigFile(), "path to config file")
+	var opts verify.Options
+	flags.StringVar(&opts.Destination, "destination", "", "only this storage destination (default: all enabled destinations)")
+	flags.StringVar(&opts.Database, "database", "", "only backups of this database (or host-port for server backups)")
+	flags.IntVar(&opts.Sample, "sample", 0, "verify this many randomly chosen backups per destination (default: all)")
+	output := flags.String("output", "table", "report format: table or json")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if (*output != "table" && *output != "json") || opts.Sample < 0 {
+		flags.Usage()
+		return 2
+	}
+
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	// The report goes to stdout, logs to stderr
+	log := stderrLogger(cfg)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	result := verify.Verify(ctx, cfg, opts, log)
+
+	if *output == "json" {
+		report := verifyReport{
+			Success:         result.Success,
+			Counts:          result.Counts,
+			Bytes:           result.Bytes,
+			DurationSeconds: result.Duration.Seconds(),
+			Objects:         result.Objects,
+		}
+		if result.Error != nil {
+			report.Error = result.Error.Error()
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			log.Error().Err(err).Msg("failed to write verify report")
+			return 1
+		}
+	} else {
+		printVerified(os.Stdout, result)
+	}
+
+	event := log.Info()
+	msg := "verify completed"
+	if !result.Success {
+		event = log.Error().Err(result.Error)
+		msg = "verify failed"
+	}
+	event.
+		Int("objects", len(result.Objects)).
+		Int("ok", result.Counts[verify.StatusOK]).
+		Int("corrupt", result.Counts[verify.StatusCorrupt]).
+		Int("truncated", result.Counts[verify.StatusTruncated]).
+		Int("missing", result.Counts[verify.StatusMissing]).
+		Int("errors", result.Counts[verify.StatusError]).
+		Int64("bytes", result.Bytes).
+		Dur("duration", result.Duration).
+		Msg(msg)
+
+	if !result.Success {
+		return 1
+	}
+	return 0
+}
+
+// printVerified writes verified objects as a table followed by the count per status
+func printVerified(w io.Writer, result verify.Result) {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "DESTINATION\tBACKUP\tSIZE\tSTATUS\tCHECKSUM\tTOC\tERROR")
+	for _, object := range result.Objects {
+		checksum, toc, errText := "-", "-", "-"
+		if object.Checksum != "" {
+			checksum = object.Checksum
+		}
+		if object.TOCEntries > 0 {
+			toc = fmt.Sprintf("%d entries", object.TOCEntries)
+		}
+		if object.Error != "" {
+			errText = object.Error
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			object.Destination, object.Path, formatBytes(object.Size), object.Status, checksum, toc, errText)
+	}
+	table.Flush()
+
+	statuses := make([]string, 0, len(result.Counts))
+	for status := range result.Counts {
+		statuses = append(statuses, status)
+	}
+	sort.Strings(statuses)
+
+	fmt.Fprintln(w)
+	totals := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(totals, "STATUS\tOBJECTS")
+	for _, status := range statuses {
+		fmt.Fprintf(totals, "%s\t%d\n", status, result.Counts[status])
+	}
+	totals.Flush()
+}
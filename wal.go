@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/williamokano/pg_backuper/pkg/backup"
+	"github.com/williamokano/pg_backuper/pkg/logger"
+)
+
+// runArchiveWAL implements "pg_backuper archive-wal", used as PostgreSQL's archive_command
+func runArchiveWAL(args []string) int {
+	flags := flag.NewFlagSet("archive-wal", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: pg_backuper archive-wal --server <host[:port]> <path> <name>\n\n")
+		fmt.Fprintf(os.Stderr, "Uploads a WAL file to the storage destinations of a basebackup server.\n\n")
+		fmt.Fprintf(os.Stderr, "Example (postgresql.conf):\n")
+		fmt.Fprintf(os.Stderr, "  archive_command = 'pg_backuper archive-wal --config /etc/pg_backuper.json --server db.internal:5432 %%p %%f'\n\n")
+		flags.PrintDefaults()
+	}
+
+	configFile := flags.String("config", defaultConfigFile(), "path to config file")
+	serverSpec := flags.String("server", "", "server the WAL belongs to, as host or host:port (required)")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *serverSpec == "" || flags.NArg() != 2 {
+		flags.Usage()
+		return 2
+	}
+	walPath, walName := flags.Arg(0), flags.Arg(1)
+
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	log := logger.Get()
+
+	server, err := backup.FindWALServer(cfg, *serverSpec)
+	if err != nil {
+		log.Error().Err(err).Msg("cannot archive WAL")
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// A non-zero exit makes PostgreSQL keep the segment and retry later
+	if err := backup.ArchiveWAL(ctx, cfg, server, walPath, walName, *log); err != nil {
+		log.Error().Err(err).Str("wal", walName).Msg("WAL archiving failed")
+		return 1
+	}
+	return 0
+}
+
+// runRestoreWAL implements "pg_backuper restore-wal", used as PostgreSQL's restore_command
+func runRestoreWAL(args []string) int {
+	flags := flag.NewFlagSet("restore-wal", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: pg_backuper restore-wal --server <host[:port]> <name> <path>\n\n")
+		fmt.Fprintf(os.Stderr, "Fetches an archived WAL file for point-in-time recovery.\n\n")
+		fmt.Fprintf(os.Stderr, "Example (postgresql.conf):\n")
+		fmt.Fprintf(os.Stderr, "  restore_command = 'pg_backuper restore-wal --config /etc/pg_backuper.json --server db.internal:5432 %%f %%p'\n\n")
+		flags.PrintDefaults()
+	}
+
+	configFile := flags.String("config", defaultConfigFile(), "path to config file")
+	serverSpec := flags.String("server", "", "server the WAL was archived from, as host or host:port (required)")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *serverSpec == "" || flags.NArg() != 2 {
+		flags.Usage()
+		return 2
+	}
+	walName, destPath := flags.Arg(0), flags.Arg(1)
+
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	log := logger.Get()
+
+	server, err := backup.FindWALServer(cfg, *serverSpec)
+	if err != nil {
+		log.Error().Err(err).Msg("cannot restore WAL")
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := backup.FetchWAL(ctx, cfg, server, walName, destPath, *log); err != nil {
+		// PostgreSQL asks for files past the end of the archive when recovery finishes
+		if errors.Is(err, backup.ErrWALNotArchived) {
+			log.Info().Str("wal", walName).Msg("WAL file not in archive")
+		} else {
+			log.Error().Err(err).Str("wal", walName).Msg("WAL restore failed")
+		}
+		return 1
+	}
+	return 0
+}